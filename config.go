@@ -1,6 +1,9 @@
 package kDB
 
-import "github.com/KarlvenK/kDB/storage"
+import (
+	"github.com/KarlvenK/kDB/ds/listpack"
+	"github.com/KarlvenK/kDB/storage"
+)
 
 // DataIndexMode 数据索引模式
 type DataIndexMode int
@@ -34,6 +37,14 @@ const (
 	// DefaultReclaimThreshold 默认回收磁盘空间的阈值，当已封存文件个数到达 4 时，可进行回收
 	// default disk reclaim threshold: 4
 	DefaultReclaimThreshold = 4
+
+	// DefaultMaxListpackEntries 默认的哈希表、集合和有序集使用紧凑编码的最大成员个数
+	// default max number of members or fields of a compact hash, set or sorted set: 128
+	DefaultMaxListpackEntries = 128
+
+	// DefaultMaxListpackValue 默认的哈希表、集合和有序集使用紧凑编码的最大成员长度
+	// default max length of a member, field or value of a compact hash, set or sorted set: 64 bytes
+	DefaultMaxListpackValue = 64
 )
 
 // Config 数据库配置
@@ -48,6 +59,16 @@ type Config struct {
 	MaxValueSize     uint32               `json:"max_value_size" toml:"max_value_size"`
 	Sync             bool                 `json:"sync" toml:"sync"`                           //每次写数据是否持久化 sync to disk
 	ReclaimThreshold int                  `json:"reclaim_threshold" toml:"reclaim_threshold"` //回收磁盘空间的阈值   threshold to reclaim disk
+	KeyProvider      storage.KeyProvider  `json:"-" toml:"-"`                                 //数据加密密钥，为nil时不加密 keys to encrypt data at rest, nil to disable
+
+	//哈希表、集合和有序集使用紧凑编码的上限，为0时使用默认值，为负数时不使用紧凑编码
+	//the limits of the compact encodings of hashes, sets and sorted sets, 0 for the default, negative to disable
+	HashMaxListpackEntries int `json:"hash_max_listpack_entries" toml:"hash_max_listpack_entries"`
+	HashMaxListpackValue   int `json:"hash_max_listpack_value" toml:"hash_max_listpack_value"`
+	SetMaxListpackEntries  int `json:"set_max_listpack_entries" toml:"set_max_listpack_entries"`
+	SetMaxListpackValue    int `json:"set_max_listpack_value" toml:"set_max_listpack_value"`
+	ZSetMaxListpackEntries int `json:"zset_max_listpack_entries" toml:"zset_max_listpack_entries"`
+	ZSetMaxListpackValue   int `json:"zset_max_listpack_value" toml:"zset_max_listpack_value"`
 }
 
 // DefaultConfig 获取默认配置
@@ -62,5 +83,27 @@ func DefaultConfig() Config {
 		MaxValueSize:     DefaultMaxValueSize,
 		Sync:             false,
 		ReclaimThreshold: DefaultReclaimThreshold,
+
+		HashMaxListpackEntries: DefaultMaxListpackEntries,
+		HashMaxListpackValue:   DefaultMaxListpackValue,
+		SetMaxListpackEntries:  DefaultMaxListpackEntries,
+		SetMaxListpackValue:    DefaultMaxListpackValue,
+		ZSetMaxListpackEntries: DefaultMaxListpackEntries,
+		ZSetMaxListpackValue:   DefaultMaxListpackValue,
+	}
+}
+
+// listpackLimits 将配置的上限转换为 listpack.Limits，0 取默认值，负数不使用紧凑编码
+// converts the configured limits, 0 is taken as the default and a negative one disables the compact encoding
+func listpackLimits(maxEntries, maxValue int) listpack.Limits {
+	if maxEntries == 0 {
+		maxEntries = DefaultMaxListpackEntries
+	}
+	if maxValue == 0 {
+		maxValue = DefaultMaxListpackValue
+	}
+	if maxEntries < 0 || maxValue < 0 {
+		return listpack.Limits{MaxEntries: -1, MaxValue: -1}
 	}
+	return listpack.Limits{MaxEntries: maxEntries, MaxValue: maxValue}
 }
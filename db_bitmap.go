@@ -0,0 +1,262 @@
+package kDB
+
+import (
+	"github.com/KarlvenK/kDB/index"
+	"github.com/KarlvenK/kDB/storage"
+	"math/bits"
+	"strconv"
+)
+
+//BitOperation the operation of BitOp
+type BitOperation uint8
+
+// bit operations
+const (
+	BitAnd BitOperation = iota
+	BitOr
+	BitXor
+	BitNot
+)
+
+// KeyOnlyRamMode 下，一个key累计的SetBit修改超过该值时重写整个值
+// in KeyOnlyRamMode the whole value is rewritten once the bytes set by SetBit after it exceed this
+const maxBytePatches = 1024
+
+// SetBit 设置或清除key所储存的字符串值在偏移量offset上的位，返回该位原来的值
+// 日志中只记录被修改的字节，key不存在时写入完整的值
+// Sets or clears the bit at offset in the string value stored at key, returns the original bit value.
+// Only the changed byte is logged, unless the key does not exist yet.
+func (db *kDB) SetBit(key []byte, offset uint32, bit int) (int, error) {
+	if err := db.checkKeyValue(key, nil); err != nil {
+		return 0, err
+	}
+	if bit != 0 && bit != 1 {
+		return 0, ErrInvalidBit
+	}
+
+	byteIdx := int(offset >> 3)
+	if uint64(byteIdx) >= uint64(db.config.MaxValueSize) {
+		return 0, ErrValueTooLarge
+	}
+
+	db.strIndex.mu.Lock()
+	defer db.strIndex.mu.Unlock()
+
+	val, err := db.peekVal(key)
+	exist := err == nil
+	if err != nil && err != ErrKeyNotExist && err != ErrKeyExpired {
+		return 0, err
+	}
+
+	var old byte
+	if byteIdx < len(val) {
+		old = val[byteIdx]
+	}
+	shift := 7 - offset&7
+	orig := int(old>>shift) & 1
+
+	b := old &^ (1 << shift)
+	if bit == 1 {
+		b |= 1 << shift
+	}
+	if exist && byteIdx < len(val) && b == old {
+		return orig, nil
+	}
+
+	if !exist || len(db.strIndex.patches[string(key)]) >= maxBytePatches {
+		length := len(val)
+		if byteIdx >= length {
+			length = byteIdx + 1
+		}
+		newVal := make([]byte, length)
+		copy(newVal, val)
+		newVal[byteIdx] = b
+		return orig, db.setVal(key, newVal)
+	}
+
+	e := storage.NewEntry(key, []byte{b}, []byte(strconv.Itoa(byteIdx)), String, StringSetBit)
+	if err = db.store(e); err != nil {
+		return 0, err
+	}
+	return orig, db.buildIndex(e, &index.Indexer{Meta: e.Meta})
+}
+
+// GetBit 返回key所储存的字符串值在偏移量offset上的位，key不存在或offset超出长度时返回0
+// Returns the bit value at offset in the string value stored at key.
+func (db *kDB) GetBit(key []byte, offset uint32) (int, error) {
+	if err := db.checkKeyValue(key, nil); err != nil {
+		return 0, err
+	}
+
+	res := 0
+	err := db.viewVal(key, func(val []byte) {
+		if byteIdx := int(offset >> 3); byteIdx < len(val) {
+			res = int(val[byteIdx]>>(7-offset&7)) & 1
+		}
+	})
+	return res, err
+}
+
+// BitCount 计算字符串值在字节区间[start, end]中被设置为1的位的数量，负数表示从末尾开始计算
+// Count the number of set bits in the bytes from start to end (both inclusive) of the string value.
+func (db *kDB) BitCount(key []byte, start, end int) (int, error) {
+	if err := db.checkKeyValue(key, nil); err != nil {
+		return 0, err
+	}
+
+	count := 0
+	err := db.viewVal(key, func(val []byte) {
+		start, end, ok := byteRange(len(val), start, end)
+		if !ok {
+			return
+		}
+		for _, b := range val[start : end+1] {
+			count += bits.OnesCount8(b)
+		}
+	})
+	return count, err
+}
+
+// BitPos 返回字符串值在字节区间[start, end]中第一个值为bit的位的位置，不存在时返回-1
+// 未指定end时查找到字符串末尾，此时若查找0且所有位都为1，返回字符串之后的第一个位置
+// Return the position of the first bit set to 1 or 0 in the bytes from start to end of the string value, -1 if not found.
+// The end is the last byte if it is not given, and then the first bit after the string is returned
+// when looking for a clear bit in a string with all bits set, as the string is padded with zero-bytes.
+func (db *kDB) BitPos(key []byte, bit int, start int, end ...int) (int, error) {
+	if err := db.checkKeyValue(key, nil); err != nil {
+		return -1, err
+	}
+	if bit != 0 && bit != 1 {
+		return -1, ErrInvalidBit
+	}
+	if len(end) > 1 {
+		return -1, ErrWrongNumberOfArgs
+	}
+
+	pos := -1
+	err := db.viewVal(key, func(val []byte) {
+		pos = bitPos(val, bit, start, end...)
+	})
+	if err != nil {
+		return -1, err
+	}
+	return pos, nil
+}
+
+// bitPos 返回val在字节区间[start, end]中第一个值为bit的位的位置，不存在时返回-1
+func bitPos(val []byte, bit int, start int, end ...int) int {
+	//the missing key is treated as an empty string of zero bits
+	if val == nil && bit == 0 {
+		return 0
+	}
+
+	last := -1
+	if len(end) == 1 {
+		last = end[0]
+	}
+	first, last, ok := byteRange(len(val), start, last)
+	if !ok {
+		return -1
+	}
+
+	for i := first; i <= last; i++ {
+		b := val[i]
+		if bit == 0 {
+			b = ^b
+		}
+		if b != 0 {
+			return i*8 + bits.LeadingZeros8(b)
+		}
+	}
+	if bit == 0 && len(end) == 0 {
+		return len(val) * 8
+	}
+	return -1
+}
+
+// BitOp 对一个或多个字符串值进行位操作，并将结果保存到dest，返回结果的长度
+// 长度不同的值以0补齐，BitNot只接受一个key
+// Perform a bitwise operation between the string values of keys and store the result in dest.
+// Shorter values are padded with zero-bytes, BitNot takes only one key.
+func (db *kDB) BitOp(op BitOperation, dest []byte, keys ...[]byte) (int, error) {
+	if len(keys) == 0 || (op == BitNot && len(keys) != 1) {
+		return 0, ErrWrongNumberOfArgs
+	}
+	if op > BitNot {
+		return 0, ErrInvalidBitOp
+	}
+	if err := db.checkKeyValue(dest, nil); err != nil {
+		return 0, err
+	}
+	for _, key := range keys {
+		if err := db.checkKeyValue(key, nil); err != nil {
+			return 0, err
+		}
+	}
+
+	db.strIndex.mu.Lock()
+	defer db.strIndex.mu.Unlock()
+
+	values := make([][]byte, len(keys))
+	length := 0
+	for i, key := range keys {
+		val, err := db.peekVal(key)
+		if err != nil && err != ErrKeyNotExist && err != ErrKeyExpired {
+			return 0, err
+		}
+		values[i] = val
+		if len(val) > length {
+			length = len(val)
+		}
+	}
+
+	//the result is empty, remove dest like Redis does
+	if length == 0 {
+		return 0, db.remVal(dest)
+	}
+
+	res := make([]byte, length)
+	copy(res, values[0])
+	switch op {
+	case BitNot:
+		for i := range res {
+			res[i] = ^res[i]
+		}
+	default:
+		for _, val := range values[1:] {
+			for i := range res {
+				var b byte
+				if i < len(val) {
+					b = val[i]
+				}
+				switch op {
+				case BitAnd:
+					res[i] &= b
+				case BitOr:
+					res[i] |= b
+				case BitXor:
+					res[i] ^= b
+				}
+			}
+		}
+	}
+
+	return length, db.doMSet([][]byte{dest, res})
+}
+
+// byteRange 处理字节区间的下标，负数表示从末尾开始计算，返回区间是否有效
+func byteRange(length, start, end int) (int, int, bool) {
+	if start < 0 {
+		start += length
+	}
+	if end < 0 {
+		end += length
+	}
+	if start < 0 {
+		start = 0
+	}
+	if end >= length {
+		end = length - 1
+	}
+	return start, end, start <= end && length > 0
+}
@@ -0,0 +1,242 @@
+package kDB
+
+import (
+	"bytes"
+	"runtime"
+	"testing"
+)
+
+func TestKDB_SetBit(t *testing.T) {
+	db := InitDb()
+	defer db.Close()
+
+	key := []byte("my_bitmap")
+	_ = db.StrRem(key)
+
+	if orig, err := db.SetBit(key, 7, 1); err != nil || orig != 0 {
+		t.Errorf("setbit got %d, %v", orig, err)
+	}
+	if orig, _ := db.SetBit(key, 7, 0); orig != 1 {
+		t.Errorf("setbit got original bit %d", orig)
+	}
+	_, _ = db.SetBit(key, 1, 1)
+	_, _ = db.SetBit(key, 20, 1)
+
+	if val, _ := db.Get(key); !bytes.Equal(val, []byte{0x40, 0x00, 0x08}) {
+		t.Errorf("get bitmap got %v", val)
+	}
+	if bit, _ := db.GetBit(key, 20); bit != 1 {
+		t.Errorf("getbit got %d", bit)
+	}
+	if bit, _ := db.GetBit(key, 1000); bit != 0 {
+		t.Errorf("getbit out of range got %d", bit)
+	}
+	if _, err := db.SetBit(key, 1, 2); err != ErrInvalidBit {
+		t.Errorf("setbit invalid bit, err = %v", err)
+	}
+}
+
+func TestKDB_BitCount(t *testing.T) {
+	db := InitDb()
+	defer db.Close()
+
+	key := []byte("my_bitcount")
+	_ = db.Set(key, []byte("foobar"))
+
+	for _, c := range []struct{ start, end, want int }{{0, -1, 26}, {0, 0, 4}, {1, 1, 6}, {-2, -1, 7}} {
+		if n, err := db.BitCount(key, c.start, c.end); err != nil || n != c.want {
+			t.Errorf("bitcount %d %d got %d, %v", c.start, c.end, n, err)
+		}
+	}
+}
+
+func TestKDB_BitPos(t *testing.T) {
+	db := InitDb()
+	defer db.Close()
+
+	key := []byte("my_bitpos")
+	_ = db.Set(key, []byte{0xff, 0xf0, 0x00})
+
+	if pos, _ := db.BitPos(key, 0, 0, -1); pos != 12 {
+		t.Errorf("bitpos 0 got %d", pos)
+	}
+	if pos, _ := db.BitPos(key, 1, 2, -1); pos != -1 {
+		t.Errorf("bitpos 1 got %d", pos)
+	}
+	if pos, _ := db.BitPos([]byte("my_bitpos_not_exist"), 0, 0, -1); pos != 0 {
+		t.Errorf("bitpos of not exist key got %d", pos)
+	}
+
+	//the clear bit right after the string is found only if end is not given
+	_ = db.Set(key, []byte{0xff, 0xff})
+	if pos, _ := db.BitPos(key, 0, 0); pos != 16 {
+		t.Errorf("bitpos 0 without end got %d", pos)
+	}
+	if pos, _ := db.BitPos(key, 0, 0, -1); pos != -1 {
+		t.Errorf("bitpos 0 with end got %d", pos)
+	}
+	if pos, _ := db.BitPos(key, 1, 2); pos != -1 {
+		t.Errorf("bitpos 1 out of range got %d", pos)
+	}
+	if _, err := db.BitPos(key, 0, 0, 1, 2); err != ErrWrongNumberOfArgs {
+		t.Errorf("bitpos with two ends, err = %v", err)
+	}
+}
+
+func TestKDB_BitOp(t *testing.T) {
+	db := InitDb()
+	defer db.Close()
+
+	_ = db.Set([]byte("bitop_1"), []byte{0xf0, 0x0f})
+	_ = db.Set([]byte("bitop_2"), []byte{0xff})
+	dest := []byte("bitop_dest")
+
+	cases := []struct {
+		op   BitOperation
+		keys [][]byte
+		want []byte
+	}{
+		{BitAnd, [][]byte{[]byte("bitop_1"), []byte("bitop_2")}, []byte{0xf0, 0x00}},
+		{BitOr, [][]byte{[]byte("bitop_1"), []byte("bitop_2")}, []byte{0xff, 0x0f}},
+		{BitXor, [][]byte{[]byte("bitop_1"), []byte("bitop_2")}, []byte{0x0f, 0x0f}},
+		{BitNot, [][]byte{[]byte("bitop_1")}, []byte{0x0f, 0xf0}},
+	}
+	for _, c := range cases {
+		n, err := db.BitOp(c.op, dest, c.keys...)
+		if err != nil || n != len(c.want) {
+			t.Errorf("bitop %d got %d, %v", c.op, n, err)
+		}
+		if val, _ := db.Get(dest); !bytes.Equal(val, c.want) {
+			t.Errorf("bitop %d got %v, want %v", c.op, val, c.want)
+		}
+	}
+
+	if _, err := db.BitOp(BitNot, dest, []byte("bitop_1"), []byte("bitop_2")); err != ErrWrongNumberOfArgs {
+		t.Errorf("bitnot with two keys, err = %v", err)
+	}
+}
+
+func TestKDB_SetBitReplay(t *testing.T) {
+	replay := func(t *testing.T, mode DataIndexMode) {
+		db, config := OpenDb(t, "/tmp/kdb/db-bitmap", mode)
+
+		key := []byte("my_replay_bitmap")
+		want := make([]byte, 16*1024)
+		_ = db.Set(key, want)
+
+		// only the changed byte is logged
+		off := db.activeFile.Offset
+		_, _ = db.SetBit(key, 8*100+1, 1)
+		want[100] = 0x40
+		if size := db.activeFile.Offset - off; size > 64 {
+			t.Errorf("setbit wrote %d bytes to the log", size)
+		}
+
+		for i := uint32(0); i < 3000; i++ {
+			_, _ = db.SetBit(key, i*37%(16*1024*8), 1)
+			want[i*37%(16*1024*8)/8] |= 1 << (7 - i*37%(16*1024*8)%8)
+			_ = db.Set([]byte("bitmap_padding"), []byte("some value to fill the db files"))
+		}
+		_, _ = db.SetBit(key, 16*1024*8+3, 1)
+		want = append(want, 0x10)
+
+		check := func(step string) {
+			if val, _ := db.Get(key); !bytes.Equal(val, want) {
+				t.Errorf("%s: bitmap is not rebuilt correctly", step)
+			}
+			if n := db.StrLen(key); n != len(want) {
+				t.Errorf("%s: strlen got %d", step, n)
+			}
+		}
+		check("before reopen")
+		db.Close()
+
+		var err error
+		if db, err = Open(config); err != nil {
+			t.Fatal(err)
+		}
+		check("after reopen")
+
+		if err = db.Reclaim(); err != nil {
+			t.Fatal(err)
+		}
+		check("after reclaim")
+		db.Close()
+
+		if db, err = Open(config); err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+		check("reopen after reclaim")
+	}
+
+	t.Run("KeyValueRamMode", func(t *testing.T) {
+		replay(t, KeyValueRamMode)
+	})
+
+	t.Run("KeyOnlyRamMode", func(t *testing.T) {
+		replay(t, KeyOnlyRamMode)
+	})
+}
+
+func TestKDB_SetBitInPlace(t *testing.T) {
+	db, _ := OpenDb(t, "/tmp/kdb/db-bitmap-inplace", KeyValueRamMode)
+	defer db.Close()
+
+	key := []byte("my_large_bitmap")
+	val := make([]byte, 512*1024)
+	_ = db.Set(key, val)
+	if _, err := db.SetBit(key, 0, 1); err != nil {
+		t.Fatal(err)
+	}
+	got, _ := db.Get(key)
+
+	//the value is copied by the first SetBit, and then set in place
+	const n = 100
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	alloc := stats.TotalAlloc
+	for i := 0; i < n; i++ {
+		if _, err := db.SetBit(key, uint32(8*i+8), 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	runtime.ReadMemStats(&stats)
+	if perOp := (stats.TotalAlloc - alloc) / n; perOp > 64*1024 {
+		t.Errorf("setbit allocates %d bytes per call on a value of %d bytes", perOp, len(val))
+	}
+
+	//the values set and returned before do not change
+	if val[0] != 0 || got[0] != 0x80 || got[1] != 0 {
+		t.Errorf("the values given out are changed: %x %x %x", val[0], got[0], got[1])
+	}
+	if bit, _ := db.GetBit(key, 8*n); bit != 1 {
+		t.Errorf("expected bit 1 at %d, got %d", 8*n, bit)
+	}
+
+	//the value grows past its end
+	offset := uint32(8*len(val) + 100)
+	if _, err := db.SetBit(key, offset, 1); err != nil {
+		t.Fatal(err)
+	}
+	if n := db.StrLen(key); n != len(val)+13 {
+		t.Errorf("expected length %d, got %d", len(val)+13, n)
+	}
+	if count, _ := db.BitCount(key, 0, -1); count != n+2 {
+		t.Errorf("expected %d bits set, got %d", n+2, count)
+	}
+}
+
+func BenchmarkKDB_SetBit(b *testing.B) {
+	db, _ := OpenDb(b, "/tmp/kdb/db-bitmap-bench", KeyValueRamMode)
+	defer db.Close()
+
+	key := []byte("my_bench_bitmap")
+	_ = db.Set(key, make([]byte, 512*1024))
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, _ = db.SetBit(key, uint32(i*8191)%(512*1024*8), i&1)
+	}
+}
@@ -0,0 +1,293 @@
+package kDB
+
+import (
+	"github.com/KarlvenK/kDB/ds/bloom"
+	"github.com/KarlvenK/kDB/storage"
+	"strconv"
+	"sync"
+)
+
+// BloomIdx the bloom and cuckoo filter idx
+type BloomIdx struct {
+	mu      sync.RWMutex
+	indexes *bloom.Filters
+}
+
+func newBloomIdx() *BloomIdx {
+	return &BloomIdx{indexes: bloom.New()}
+}
+
+//reclaimer 重放过滤器的操作，因为它们不是幂等的，快照为每个过滤器的 dump
+//replays the filter operations, which are not idempotent, the snapshot is the dump of each filter
+func (bi *BloomIdx) reclaimer() reclaimer {
+	filters := bloom.New()
+	return &replayReclaimer{
+		apply: func(e *storage.Entry) {
+			applyBloom(filters, string(e.Meta.Key), e.Mark, e.Meta.Extra, e.Meta.Value)
+		},
+		keys: filters.Keys,
+		dump: func(key string) []*storage.Entry {
+			return []*storage.Entry{storage.NewEntryNoExtra([]byte(key), filters.Dump(key), Bloom, BloomRestore)}
+		},
+	}
+}
+
+// BFReserve 创建一个可扩展的布隆过滤器，errorRate 为期望的错误率，capacity 为容量
+// 超过容量后添加一个两倍容量的子过滤器，总的错误率不超过errorRate的两倍
+// Creates a scalable bloom filter with the expected error rate and capacity.
+// A layer with twice the capacity is added when it is full, the total error rate is bounded by twice of errorRate.
+func (db *kDB) BFReserve(key []byte, errorRate float64, capacity uint64) error {
+	if err := db.checkKeyValue(key, nil); err != nil {
+		return err
+	}
+	if errorRate <= 0 || errorRate >= 1 || capacity == 0 {
+		return bloom.ErrInvalidParams
+	}
+
+	db.bloomIndex.mu.Lock()
+	defer db.bloomIndex.mu.Unlock()
+
+	if db.bloomIndex.indexes.Exists(string(key)) {
+		return bloom.ErrFilterExists
+	}
+
+	e := newBFReserveEntry(key, errorRate, capacity)
+	if err := db.store(e); err != nil {
+		return err
+	}
+	return db.bloomIndex.indexes.BFReserve(string(key), errorRate, capacity, bloom.DefaultExpansion)
+}
+
+// BFAdd 添加元素，返回元素是否是新添加的，key不存在时以默认参数创建布隆过滤器
+// Adds the item, returns false if the item may exist already.
+// A bloom filter with the default parameters is created if key does not exist.
+func (db *kDB) BFAdd(key, item []byte) (bool, error) {
+	res, err := db.BFMAdd(key, item)
+	if err != nil {
+		return false, err
+	}
+	return res[0], nil
+}
+
+// BFMAdd 添加多个元素，返回每个元素是否是新添加的
+// Adds the items, returns whether each item is newly added.
+func (db *kDB) BFMAdd(key []byte, items ...[]byte) ([]bool, error) {
+	if err := db.checkKeyValue(key, items...); err != nil {
+		return nil, err
+	}
+	if len(items) == 0 {
+		return nil, ErrWrongNumberOfArgs
+	}
+
+	db.bloomIndex.mu.Lock()
+	defer db.bloomIndex.mu.Unlock()
+
+	k := string(key)
+	var entries []*storage.Entry
+	exist := db.bloomIndex.indexes.Exists(k)
+	if !exist {
+		//the filter is created in the same batch as the items
+		entries = append(entries, newBFReserveEntry(key, bloom.DefaultErrorRate, bloom.DefaultCapacity))
+	} else if !db.bloomIndex.indexes.IsBloom(k) {
+		return nil, bloom.ErrWrongType
+	}
+
+	//the items which may exist already or are repeated are not logged,
+	//the others are added in order after they are logged, the same as the replay
+	seen := make(map[string]bool)
+	for _, item := range items {
+		if seen[string(item)] {
+			continue
+		}
+		seen[string(item)] = true
+		if ok, _ := db.bloomIndex.indexes.BFExists(k, item); !ok {
+			entries = append(entries, storage.NewEntryNoExtra(key, item, Bloom, BloomBFAdd))
+		}
+	}
+
+	if len(entries) > 0 {
+		if _, err := db.storeBatch(entries...); err != nil {
+			return nil, err
+		}
+	}
+
+	if !exist {
+		_ = db.bloomIndex.indexes.BFReserve(k, bloom.DefaultErrorRate, bloom.DefaultCapacity, bloom.DefaultExpansion)
+	}
+	res := make([]bool, len(items))
+	for i, item := range items {
+		added, err := db.bloomIndex.indexes.BFAdd(k, item)
+		if err != nil {
+			return nil, err
+		}
+		res[i] = added
+	}
+	return res, nil
+}
+
+// BFExists 判断元素是否可能存在，返回 false 时一定不存在
+// Returns whether the item may exist, false means the item definitely does not exist.
+func (db *kDB) BFExists(key, item []byte) (bool, error) {
+	res, err := db.BFMExists(key, item)
+	if err != nil {
+		return false, err
+	}
+	return res[0], nil
+}
+
+// BFMExists 判断多个元素是否可能存在
+// Returns whether each item may exist.
+func (db *kDB) BFMExists(key []byte, items ...[]byte) ([]bool, error) {
+	if err := db.checkKeyValue(key, items...); err != nil {
+		return nil, err
+	}
+	if len(items) == 0 {
+		return nil, ErrWrongNumberOfArgs
+	}
+
+	db.bloomIndex.mu.RLock()
+	defer db.bloomIndex.mu.RUnlock()
+
+	res := make([]bool, len(items))
+	for i, item := range items {
+		ok, err := db.bloomIndex.indexes.BFExists(string(key), item)
+		if err != nil {
+			return nil, err
+		}
+		res[i] = ok
+	}
+	return res, nil
+}
+
+// CFReserve 创建一个可扩展的布谷鸟过滤器，capacity 为容量
+// Creates a scalable cuckoo filter with the capacity.
+func (db *kDB) CFReserve(key []byte, capacity uint64) error {
+	if err := db.checkKeyValue(key, nil); err != nil {
+		return err
+	}
+	if capacity == 0 {
+		return bloom.ErrInvalidParams
+	}
+
+	db.bloomIndex.mu.Lock()
+	defer db.bloomIndex.mu.Unlock()
+
+	if db.bloomIndex.indexes.Exists(string(key)) {
+		return bloom.ErrFilterExists
+	}
+
+	if err := db.store(newCFReserveEntry(key, capacity)); err != nil {
+		return err
+	}
+	return db.bloomIndex.indexes.CFReserve(string(key), capacity, bloom.DefaultBucketSize,
+		bloom.DefaultCuckooExpansion, bloom.DefaultMaxIterations)
+}
+
+// CFAdd 添加元素，同一个元素可以添加多次，key不存在时以默认参数创建布谷鸟过滤器
+// Adds the item, an item can be added more than once.
+// A cuckoo filter with the default parameters is created if key does not exist.
+func (db *kDB) CFAdd(key, item []byte) error {
+	_, err := db.cfAdd(key, item, false)
+	return err
+}
+
+// CFAddNX 元素可能不存在时才添加，返回是否添加
+// Adds the item only if it does not exist, returns whether it is added.
+func (db *kDB) CFAddNX(key, item []byte) (bool, error) {
+	return db.cfAdd(key, item, true)
+}
+
+// CFExists 判断元素是否可能存在
+// Returns whether the item may exist.
+func (db *kDB) CFExists(key, item []byte) (bool, error) {
+	n, err := db.CFCount(key, item)
+	return n > 0, err
+}
+
+// CFCount 返回元素可能被添加的次数
+// Returns the number of times the item may have been added.
+func (db *kDB) CFCount(key, item []byte) (int, error) {
+	if err := db.checkKeyValue(key, item); err != nil {
+		return 0, err
+	}
+
+	db.bloomIndex.mu.RLock()
+	defer db.bloomIndex.mu.RUnlock()
+
+	return db.bloomIndex.indexes.CFCount(string(key), item)
+}
+
+// CFDel 删除元素的一次添加，返回是否删除，只能删除确实被添加过的元素
+// Deletes one occurrence of the item, returns whether it is deleted.
+// Only the items which are really added can be deleted, otherwise the fingerprint of another item may be deleted.
+func (db *kDB) CFDel(key, item []byte) (bool, error) {
+	if err := db.checkKeyValue(key, item); err != nil {
+		return false, err
+	}
+
+	db.bloomIndex.mu.Lock()
+	defer db.bloomIndex.mu.Unlock()
+
+	if n, err := db.bloomIndex.indexes.CFCount(string(key), item); err != nil || n == 0 {
+		return false, err
+	}
+
+	e := storage.NewEntryNoExtra(key, item, Bloom, BloomCFDel)
+	if err := db.store(e); err != nil {
+		return false, err
+	}
+	return db.bloomIndex.indexes.CFDel(string(key), item)
+}
+
+func (db *kDB) cfAdd(key, item []byte, nx bool) (bool, error) {
+	if err := db.checkKeyValue(key, item); err != nil {
+		return false, err
+	}
+
+	db.bloomIndex.mu.Lock()
+	defer db.bloomIndex.mu.Unlock()
+
+	k := string(key)
+	var entries []*storage.Entry
+	exist := db.bloomIndex.indexes.Exists(k)
+	if !exist {
+		//the filter is created in the same batch as the item
+		entries = append(entries, newCFReserveEntry(key, bloom.DefaultCuckooCapacity))
+	} else if !db.bloomIndex.indexes.IsCuckoo(k) {
+		return false, bloom.ErrWrongType
+	}
+
+	if nx {
+		if n, _ := db.bloomIndex.indexes.CFCount(k, item); n > 0 {
+			return false, nil
+		}
+	}
+
+	entries = append(entries, storage.NewEntryNoExtra(key, item, Bloom, BloomCFAdd))
+	if _, err := db.storeBatch(entries...); err != nil {
+		return false, err
+	}
+
+	if !exist {
+		_ = db.bloomIndex.indexes.CFReserve(k, bloom.DefaultCuckooCapacity, bloom.DefaultBucketSize,
+			bloom.DefaultCuckooExpansion, bloom.DefaultMaxIterations)
+	}
+	if err := db.bloomIndex.indexes.CFAdd(k, item); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// newBFReserveEntry extra 为 errorRate、capacity 和 expansion
+func newBFReserveEntry(key []byte, errorRate float64, capacity uint64) *storage.Entry {
+	extra := strconv.FormatFloat(errorRate, 'g', -1, 64) + ExtraSeparator +
+		strconv.FormatUint(capacity, 10) + ExtraSeparator + strconv.Itoa(bloom.DefaultExpansion)
+	return storage.NewEntry(key, nil, []byte(extra), Bloom, BloomBFReserve)
+}
+
+// newCFReserveEntry extra 为 capacity、bucketSize、expansion 和 maxIterations
+func newCFReserveEntry(key []byte, capacity uint64) *storage.Entry {
+	extra := strconv.FormatUint(capacity, 10) + ExtraSeparator + strconv.Itoa(bloom.DefaultBucketSize) +
+		ExtraSeparator + strconv.Itoa(bloom.DefaultCuckooExpansion) + ExtraSeparator + strconv.Itoa(bloom.DefaultMaxIterations)
+	return storage.NewEntry(key, nil, []byte(extra), Bloom, BloomCFReserve)
+}
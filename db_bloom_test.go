@@ -0,0 +1,210 @@
+package kDB
+
+import (
+	"github.com/KarlvenK/kDB/ds/bloom"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestKDB_BFReserve(t *testing.T) {
+	db, _ := OpenDb(t, "/tmp/kdb/db-bloom", KeyValueRamMode)
+	defer db.Close()
+
+	key := []byte("my_bf")
+	if err := db.BFReserve(key, 0.001, 1000); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.BFReserve(key, 0.001, 1000); err != bloom.ErrFilterExists {
+		t.Errorf("reserve twice, err = %v", err)
+	}
+	if err := db.BFReserve([]byte("other"), 2, 1000); err != bloom.ErrInvalidParams {
+		t.Errorf("reserve with an invalid error rate, err = %v", err)
+	}
+	if err := db.CFReserve(key, 1000); err != bloom.ErrFilterExists {
+		t.Errorf("reserve a cuckoo filter on a bloom filter, err = %v", err)
+	}
+}
+
+func TestKDB_BFAdd(t *testing.T) {
+	db, _ := OpenDb(t, "/tmp/kdb/db-bloom", KeyValueRamMode)
+	defer db.Close()
+
+	key := []byte("my_bf")
+	if ok, err := db.BFAdd(key, []byte("a")); err != nil || !ok {
+		t.Errorf("add to a new filter got %v, %v", ok, err)
+	}
+	res, _ := db.BFMAdd(key, []byte("a"), []byte("b"), []byte("c"))
+	if !reflect.DeepEqual(res, []bool{false, true, true}) {
+		t.Errorf("madd got %v", res)
+	}
+	if ok, _ := db.BFExists(key, []byte("b")); !ok {
+		t.Error("expected b to exist")
+	}
+	res, _ = db.BFMExists(key, []byte("c"), []byte("d"))
+	if !reflect.DeepEqual(res, []bool{true, false}) {
+		t.Errorf("mexists got %v", res)
+	}
+	if ok, err := db.BFExists([]byte("missing"), []byte("a")); ok || err != nil {
+		t.Errorf("exists in a missing filter got %v, %v", ok, err)
+	}
+	if _, err := db.BFMAdd(key); err != ErrWrongNumberOfArgs {
+		t.Errorf("madd nothing, err = %v", err)
+	}
+
+	//the default filter scales beyond its capacity
+	for i := 0; i < 1000; i++ {
+		_, _ = db.BFAdd(key, []byte("member"+strconv.Itoa(i)))
+	}
+	for i := 0; i < 1000; i++ {
+		if ok, _ := db.BFExists(key, []byte("member"+strconv.Itoa(i))); !ok {
+			t.Fatalf("false negative of %d", i)
+		}
+	}
+}
+
+func TestKDB_CFAdd(t *testing.T) {
+	db, _ := OpenDb(t, "/tmp/kdb/db-bloom", KeyValueRamMode)
+	defer db.Close()
+
+	key := []byte("my_cf")
+	if err := db.CFAdd(key, []byte("a")); err != nil {
+		t.Fatal(err)
+	}
+	_ = db.CFAdd(key, []byte("a"))
+	if n, _ := db.CFCount(key, []byte("a")); n != 2 {
+		t.Errorf("count got %d", n)
+	}
+	if ok, _ := db.CFAddNX(key, []byte("a")); ok {
+		t.Error("expected addnx of an existing item to fail")
+	}
+	if ok, _ := db.CFAddNX(key, []byte("b")); !ok {
+		t.Error("expected addnx of a new item to succeed")
+	}
+
+	if ok, _ := db.CFDel(key, []byte("a")); !ok {
+		t.Error("expected a to be deleted")
+	}
+	if ok, _ := db.CFExists(key, []byte("a")); !ok {
+		t.Error("expected a to exist")
+	}
+	if ok, _ := db.CFDel(key, []byte("c")); ok {
+		t.Error("expected nothing to delete")
+	}
+
+	if _, err := db.BFAdd(key, []byte("a")); err != bloom.ErrWrongType {
+		t.Errorf("add to a cuckoo filter as a bloom filter, err = %v", err)
+	}
+	_, _ = db.BFAdd([]byte("bf"), []byte("a"))
+	if err := db.CFAdd([]byte("bf"), []byte("a")); err != bloom.ErrWrongType {
+		t.Errorf("add to a bloom filter as a cuckoo filter, err = %v", err)
+	}
+}
+
+func TestKDB_BloomAddFailed(t *testing.T) {
+	db, _ := OpenDb(t, "/tmp/kdb/db-bloom", KeyValueRamMode)
+	defer db.Close()
+
+	_, _ = db.BFAdd([]byte("bf"), []byte("a"))
+	restore := failNextWrite(t, db)
+	if _, err := db.BFMAdd([]byte("bf"), []byte("b"), []byte("c")); err == nil {
+		t.Error("expected an error")
+	}
+	if _, err := db.BFAdd([]byte("new_bf"), []byte("a")); err == nil {
+		t.Error("expected an error")
+	}
+	if err := db.CFAdd([]byte("new_cf"), []byte("a")); err == nil {
+		t.Error("expected an error")
+	}
+	if _, err := db.CFAddNX([]byte("new_cf"), []byte("a")); err == nil {
+		t.Error("expected an error")
+	}
+	restore()
+
+	//nothing is changed by the failed writes
+	if res, _ := db.BFMExists([]byte("bf"), []byte("a"), []byte("b"), []byte("c")); !reflect.DeepEqual(res, []bool{true, false, false}) {
+		t.Errorf("mexists got %v", res)
+	}
+	for _, key := range []string{"new_bf", "new_cf"} {
+		if db.bloomIndex.indexes.Exists(key) {
+			t.Errorf("the filter of %s is created", key)
+		}
+	}
+}
+
+func TestKDB_BloomReplay(t *testing.T) {
+	replay := func(t *testing.T, mode DataIndexMode) {
+		db, config := OpenDb(t, "/tmp/kdb/db-bloom-replay", mode)
+
+		bf, cf := []byte("bf"), []byte("cf")
+		if err := db.BFReserve(bf, 0.01, 500); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.CFReserve(cf, 500); err != nil {
+			t.Fatal(err)
+		}
+
+		//enough operations to fill the archived files, the last ones are in the active file
+		for i := 0; i < 3000; i++ {
+			item := []byte("member" + strconv.Itoa(i))
+			_, _ = db.BFAdd(bf, item)
+			_ = db.CFAdd(cf, item)
+			_ = db.CFAdd(cf, item)
+			if i%3 == 0 {
+				_, _ = db.CFDel(cf, item)
+			}
+		}
+		if len(db.archFiles) == 0 {
+			t.Fatal("expected archived files")
+		}
+
+		want := map[string][]byte{}
+		for _, key := range []string{"bf", "cf"} {
+			want[key] = db.bloomIndex.indexes.Dump(key)
+		}
+		check := func(step string) {
+			for _, key := range []string{"bf", "cf"} {
+				if got := db.bloomIndex.indexes.Dump(key); string(got) != string(want[key]) {
+					t.Errorf("%s: %s is not rebuilt correctly", step, key)
+				}
+			}
+			for i := 0; i < 3000; i += 7 {
+				item := []byte("member" + strconv.Itoa(i))
+				if ok, _ := db.BFExists(bf, item); !ok {
+					t.Errorf("%s: false negative of %s", step, item)
+				}
+				if n, _ := db.CFCount(cf, item); n < 1 {
+					t.Errorf("%s: count of %s got %d", step, item, n)
+				}
+			}
+		}
+		check("before reopen")
+		db.Close()
+
+		var err error
+		if db, err = Open(config); err != nil {
+			t.Fatal(err)
+		}
+		check("after reopen")
+
+		if err = db.Reclaim(); err != nil {
+			t.Fatal(err)
+		}
+		check("after reclaim")
+		db.Close()
+
+		if db, err = Open(config); err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+		check("reopen after reclaim")
+	}
+
+	t.Run("KeyValueRamMode", func(t *testing.T) {
+		replay(t, KeyValueRamMode)
+	})
+
+	t.Run("KeyOnlyRamMode", func(t *testing.T) {
+		replay(t, KeyOnlyRamMode)
+	})
+}
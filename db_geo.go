@@ -0,0 +1,243 @@
+package kDB
+
+import (
+	"github.com/KarlvenK/kDB/ds/geo"
+	"github.com/KarlvenK/kDB/ds/zset"
+	"github.com/KarlvenK/kDB/storage"
+	"github.com/KarlvenK/kDB/utils"
+	"sort"
+)
+
+// GeoUnit the unit of distances
+type GeoUnit string
+
+// distance units
+const (
+	GeoMeters     GeoUnit = "m"
+	GeoKilometers GeoUnit = "km"
+	GeoMiles      GeoUnit = "mi"
+	GeoFeet       GeoUnit = "ft"
+)
+
+// GeoSort the order of the results of GeoSearch
+type GeoSort uint8
+
+// orders of GeoSearch
+const (
+	GeoSortNone GeoSort = iota
+	GeoSortAsc
+	GeoSortDesc
+)
+
+type (
+	//GeoLocation 地理位置，Dist 为GeoSearch中到中心的距离
+	//a location, Dist is the distance to the center in GeoSearch
+	GeoLocation struct {
+		Member    []byte
+		Longitude float64
+		Latitude  float64
+		Dist      float64
+	}
+
+	//GeoSearchOption GeoSearch的参数
+	//中心为Member的位置，Member为nil时为(Longitude, Latitude)
+	//Radius大于0时按半径查找，否则按宽Width高Height的矩形查找
+	//the options of GeoSearch.
+	//The center is the location of Member, or (Longitude, Latitude) if Member is nil.
+	//Search in the circle of Radius if it is greater than 0, otherwise in the box of Width and Height.
+	GeoSearchOption struct {
+		Member    []byte
+		Longitude float64
+		Latitude  float64
+		Radius    float64
+		Width     float64
+		Height    float64
+		Unit      GeoUnit
+		Sort      GeoSort
+		Count     int //return at most Count locations if it is greater than 0, the nearest ones unless Sort is GeoSortDesc
+	}
+)
+
+// GeoAdd 将地理位置添加到有序集合key中，score为位置的geohash，返回新添加的成员个数
+// Adds the locations to the sorted set stored at key, the scores are the geohashes of the locations.
+// Returns the number of members added, not including the updated ones.
+func (db *kDB) GeoAdd(key []byte, locations ...GeoLocation) (int, error) {
+	if err := db.checkKeyValue(key, nil); err != nil {
+		return 0, err
+	}
+	for _, loc := range locations {
+		if err := db.checkKeyValue(key, loc.Member); err != nil {
+			return 0, err
+		}
+		if !geo.ValidCoordinates(loc.Longitude, loc.Latitude) {
+			return 0, ErrInvalidCoordinates
+		}
+	}
+
+	db.zsetIndex.mu.Lock()
+	defer db.zsetIndex.mu.Unlock()
+
+	entries := make([]*storage.Entry, len(locations))
+	scores := make([]float64, len(locations))
+	for i, loc := range locations {
+		scores[i] = float64(geo.Encode(loc.Longitude, loc.Latitude))
+		extra := []byte(utils.Float64ToStr(scores[i]))
+		entries[i] = storage.NewEntry(key, loc.Member, extra, ZSet, ZSetZAdd)
+	}
+	if _, err := db.storeBatch(entries...); err != nil {
+		return 0, err
+	}
+
+	added := 0
+	for i, loc := range locations {
+		if db.zsetIndex.indexes.ZRank(string(key), string(loc.Member)) < 0 {
+			added++
+		}
+		db.zsetIndex.indexes.ZAdd(string(key), scores[i], string(loc.Member))
+	}
+	return added, nil
+}
+
+// GeoPos 返回成员的位置，不存在的成员对应的结果为nil
+// Returns the locations of the members, the result of a missing member is nil.
+func (db *kDB) GeoPos(key []byte, members ...[]byte) []*GeoLocation {
+	if err := db.checkKeyValue(key, members...); err != nil {
+		return nil
+	}
+
+	db.zsetIndex.mu.RLock()
+	defer db.zsetIndex.mu.RUnlock()
+
+	res := make([]*GeoLocation, len(members))
+	for i, m := range members {
+		if loc, ok := db.geoLocation(key, m); ok {
+			res[i] = &loc
+		}
+	}
+	return res
+}
+
+// GeoDist 返回两个成员之间的距离
+// Returns the distance between the two members in unit.
+func (db *kDB) GeoDist(key, member1, member2 []byte, unit GeoUnit) (float64, error) {
+	if err := db.checkKeyValue(key, member1, member2); err != nil {
+		return 0, err
+	}
+	factor, err := unit.toMeters()
+	if err != nil {
+		return 0, err
+	}
+
+	db.zsetIndex.mu.RLock()
+	defer db.zsetIndex.mu.RUnlock()
+
+	loc1, ok1 := db.geoLocation(key, member1)
+	loc2, ok2 := db.geoLocation(key, member2)
+	if !ok1 || !ok2 {
+		return 0, ErrMemberNotExist
+	}
+	return geo.Distance(loc1.Longitude, loc1.Latitude, loc2.Longitude, loc2.Latitude) / factor, nil
+}
+
+// GeoSearch 查找在圆形或者矩形范围内的成员
+// Returns the members within the circle or the box centered at a member or the given coordinates.
+func (db *kDB) GeoSearch(key []byte, opt GeoSearchOption) ([]GeoLocation, error) {
+	if err := db.checkKeyValue(key, nil); err != nil {
+		return nil, err
+	}
+	factor, err := opt.Unit.toMeters()
+	if err != nil {
+		return nil, err
+	}
+	byRadius := opt.Radius > 0
+	if !byRadius && (opt.Width <= 0 || opt.Height <= 0) {
+		return nil, ErrInvalidGeoShape
+	}
+
+	db.zsetIndex.mu.RLock()
+	defer db.zsetIndex.mu.RUnlock()
+
+	lon, lat := opt.Longitude, opt.Latitude
+	if opt.Member != nil {
+		center, ok := db.geoLocation(key, opt.Member)
+		if !ok {
+			return nil, ErrMemberNotExist
+		}
+		lon, lat = center.Longitude, center.Latitude
+	} else if !geo.ValidCoordinates(lon, lat) {
+		return nil, ErrInvalidCoordinates
+	}
+
+	radius, width, height := opt.Radius*factor, opt.Width*factor, opt.Height*factor
+	ranges := geo.RadiusRanges(lon, lat, radius)
+	if !byRadius {
+		ranges = geo.BoxRanges(lon, lat, width, height)
+	}
+
+	var res []GeoLocation
+	for _, r := range ranges {
+		elems := db.zsetIndex.indexes.ZRangeByScore(string(key), zset.Inclusive(float64(r.Min)), zset.Inclusive(float64(r.Max)), zset.Limit{})
+		for _, e := range elems {
+			plon, plat := geo.Decode(uint64(e.Score))
+
+			var dist float64
+			var ok bool
+			if byRadius {
+				dist = geo.Distance(lon, lat, plon, plat)
+				ok = dist <= radius
+			} else {
+				dist, ok = geo.InBox(lon, lat, width, height, plon, plat)
+			}
+			if ok {
+				res = append(res, GeoLocation{Member: []byte(e.Member), Longitude: plon, Latitude: plat, Dist: dist / factor})
+			}
+		}
+	}
+
+	//the nearest ones are returned if count is limited without an order, like Redis does
+	if opt.Sort == GeoSortNone && opt.Count > 0 {
+		opt.Sort = GeoSortAsc
+	}
+	if opt.Sort != GeoSortNone {
+		sort.SliceStable(res, func(i, j int) bool {
+			if opt.Sort == GeoSortDesc {
+				return res[i].Dist > res[j].Dist
+			}
+			return res[i].Dist < res[j].Dist
+		})
+	}
+	if opt.Count > 0 && len(res) > opt.Count {
+		res = res[:opt.Count]
+	}
+	return res, nil
+}
+
+// geoLocation 返回成员的位置，调用者需持有锁
+func (db *kDB) geoLocation(key, member []byte) (GeoLocation, bool) {
+	if db.zsetIndex.indexes.ZRank(string(key), string(member)) < 0 {
+		return GeoLocation{}, false
+	}
+
+	score := db.zsetIndex.indexes.ZScore(string(key), string(member))
+	if score < 0 || score >= 1<<(2*geo.Step) {
+		return GeoLocation{}, false
+	}
+
+	lon, lat := geo.Decode(uint64(score))
+	return GeoLocation{Member: member, Longitude: lon, Latitude: lat}, true
+}
+
+// toMeters returns the meters of one unit
+func (u GeoUnit) toMeters() (float64, error) {
+	switch u {
+	case GeoMeters, "":
+		return 1, nil
+	case GeoKilometers:
+		return 1000, nil
+	case GeoMiles:
+		return 1609.34, nil
+	case GeoFeet:
+		return 0.3048, nil
+	}
+	return 0, ErrInvalidGeoUnit
+}
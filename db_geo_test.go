@@ -0,0 +1,164 @@
+package kDB
+
+import (
+	"github.com/KarlvenK/kDB/ds/geo"
+	"math"
+	"math/rand"
+	"reflect"
+	"sort"
+	"strconv"
+	"testing"
+)
+
+// the examples of Redis
+func addSicily(t *testing.T, db *kDB) []byte {
+	key := []byte("Sicily")
+	n, err := db.GeoAdd(key,
+		GeoLocation{Member: []byte("Palermo"), Longitude: 13.361389, Latitude: 38.115556},
+		GeoLocation{Member: []byte("Catania"), Longitude: 15.087269, Latitude: 37.502669},
+		GeoLocation{Member: []byte("edge1"), Longitude: 12.758489, Latitude: 38.788135},
+		GeoLocation{Member: []byte("edge2"), Longitude: 17.241510, Latitude: 38.788135},
+	)
+	if err != nil || n != 4 {
+		t.Fatalf("geoadd got %d, %v", n, err)
+	}
+	return key
+}
+
+func geoMembers(locations []GeoLocation) (res []string) {
+	for _, loc := range locations {
+		res = append(res, string(loc.Member))
+	}
+	return
+}
+
+func TestKDB_GeoAdd(t *testing.T) {
+	db, _ := OpenDb(t, "/tmp/kdb/db-geo", KeyValueRamMode)
+	defer db.Close()
+
+	key := addSicily(t, db)
+	if score := db.ZScore(key, []byte("Palermo")); score != 3479099956230698 {
+		t.Errorf("zscore got %f", score)
+	}
+
+	n, _ := db.GeoAdd(key, GeoLocation{Member: []byte("Palermo"), Longitude: 13.361389, Latitude: 38.115556})
+	if n != 0 {
+		t.Errorf("geoadd an existing member got %d", n)
+	}
+	if _, err := db.GeoAdd(key, GeoLocation{Member: []byte("pole"), Longitude: 0, Latitude: 89}); err != ErrInvalidCoordinates {
+		t.Errorf("geoadd invalid coordinates, err = %v", err)
+	}
+
+	pos := db.GeoPos(key, []byte("Palermo"), []byte("not exist"))
+	if pos[0] == nil || math.Abs(pos[0].Longitude-13.361389) > 1e-5 || math.Abs(pos[0].Latitude-38.115556) > 1e-5 {
+		t.Errorf("geopos got %v", pos[0])
+	}
+	if pos[1] != nil {
+		t.Errorf("geopos of a missing member got %v", pos[1])
+	}
+}
+
+func TestKDB_GeoDist(t *testing.T) {
+	db, _ := OpenDb(t, "/tmp/kdb/db-geo", KeyValueRamMode)
+	defer db.Close()
+
+	key := addSicily(t, db)
+	if d, _ := db.GeoDist(key, []byte("Palermo"), []byte("Catania"), GeoMeters); math.Abs(d-166274.1516) > 0.0001 {
+		t.Errorf("geodist got %f", d)
+	}
+	if d, _ := db.GeoDist(key, []byte("Palermo"), []byte("Catania"), GeoKilometers); math.Abs(d-166.2742) > 0.0001 {
+		t.Errorf("geodist in km got %f", d)
+	}
+	if _, err := db.GeoDist(key, []byte("Palermo"), []byte("not exist"), GeoMeters); err != ErrMemberNotExist {
+		t.Errorf("geodist of a missing member, err = %v", err)
+	}
+	if _, err := db.GeoDist(key, []byte("Palermo"), []byte("Catania"), "parsec"); err != ErrInvalidGeoUnit {
+		t.Errorf("geodist in an invalid unit, err = %v", err)
+	}
+}
+
+func TestKDB_GeoSearch(t *testing.T) {
+	db, _ := OpenDb(t, "/tmp/kdb/db-geo", KeyValueRamMode)
+	defer db.Close()
+
+	key := addSicily(t, db)
+
+	res, err := db.GeoSearch(key, GeoSearchOption{Longitude: 15, Latitude: 37, Radius: 200, Unit: GeoKilometers, Sort: GeoSortAsc})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := geoMembers(res); len(got) != 2 || got[0] != "Catania" || got[1] != "Palermo" {
+		t.Errorf("geosearch by radius got %v", got)
+	}
+	if math.Abs(res[0].Dist-56.4413) > 0.0001 || math.Abs(res[1].Dist-190.4424) > 0.0001 {
+		t.Errorf("geosearch by radius got distances %f, %f", res[0].Dist, res[1].Dist)
+	}
+
+	res, _ = db.GeoSearch(key, GeoSearchOption{Longitude: 15, Latitude: 37, Width: 400, Height: 400, Unit: GeoKilometers, Sort: GeoSortAsc})
+	if got := geoMembers(res); len(got) != 4 || got[2] != "edge2" || got[3] != "edge1" {
+		t.Errorf("geosearch by box got %v", got)
+	}
+
+	res, _ = db.GeoSearch(key, GeoSearchOption{Member: []byte("Palermo"), Radius: 200, Unit: GeoKilometers, Sort: GeoSortDesc})
+	if got := geoMembers(res); len(got) != 3 || got[0] != "Catania" || got[2] != "Palermo" {
+		t.Errorf("geosearch from a member got %v", got)
+	}
+
+	res, _ = db.GeoSearch(key, GeoSearchOption{Longitude: 15, Latitude: 37, Width: 400, Height: 400, Unit: GeoKilometers, Count: 1})
+	if got := geoMembers(res); len(got) != 1 || got[0] != "Catania" {
+		t.Errorf("geosearch with count got %v", got)
+	}
+
+	if _, err = db.GeoSearch(key, GeoSearchOption{Longitude: 15, Latitude: 37}); err != ErrInvalidGeoShape {
+		t.Errorf("geosearch without radius or box, err = %v", err)
+	}
+	if _, err = db.GeoSearch(key, GeoSearchOption{Member: []byte("not exist"), Radius: 1}); err != ErrMemberNotExist {
+		t.Errorf("geosearch from a missing member, err = %v", err)
+	}
+}
+
+func TestKDB_GeoSearchRandom(t *testing.T) {
+	db, _ := OpenDb(t, "/tmp/kdb/db-geo", KeyValueRamMode)
+	defer db.Close()
+
+	key := []byte("random_points")
+	r := rand.New(rand.NewSource(1))
+	var locations []GeoLocation
+	for i := 0; i < 2000; i++ {
+		locations = append(locations, GeoLocation{
+			Member:    []byte("p" + strconv.Itoa(i)),
+			Longitude: 10 + r.Float64()*4,
+			Latitude:  40 + r.Float64()*4,
+		})
+	}
+	if _, err := db.GeoAdd(key, locations...); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 20; i++ {
+		lon, lat := 10+r.Float64()*4, 40+r.Float64()*4
+		radius := r.Float64() * 100
+
+		var want []string
+		for _, p := range db.GeoPos(key, memberBytes(locations)...) {
+			if geo.Distance(lon, lat, p.Longitude, p.Latitude) <= radius*1000 {
+				want = append(want, string(p.Member))
+			}
+		}
+
+		res, _ := db.GeoSearch(key, GeoSearchOption{Longitude: lon, Latitude: lat, Radius: radius, Unit: GeoKilometers})
+		got := geoMembers(res)
+		sort.Strings(want)
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("center (%f, %f) radius %f km: got %d members, want %d", lon, lat, radius, len(got), len(want))
+		}
+	}
+}
+
+func memberBytes(locations []GeoLocation) (res [][]byte) {
+	for _, loc := range locations {
+		res = append(res, loc.Member)
+	}
+	return
+}
@@ -3,7 +3,27 @@ package kDB
 import (
 	"github.com/KarlvenK/kDB/ds/hash"
 	"github.com/KarlvenK/kDB/storage"
+	"github.com/KarlvenK/kDB/utils"
+	"strconv"
 	"sync"
+	"time"
+)
+
+// 域过期时间的返回值，与 Redis 的 HEXPIRE、HTTL 和 HPERSIST 相同
+// the replies about the field deadlines, the same as HEXPIRE, HTTL and HPERSIST of Redis
+const (
+	HashFieldNotExist = -2 // the field does not exist
+	HashFieldNoTTL    = -1 // the field has no deadline
+	HashFieldUpdated  = 1  // the deadline is set or cleared
+)
+
+const (
+	// hashExpireInterval 主动删除过期域的间隔
+	// the interval to delete the expired fields actively
+	hashExpireInterval = time.Second
+
+	// hashExpireLimit the max number of expired fields deleted each time
+	hashExpireLimit = 1000
 )
 
 //HashIdx hash idx
@@ -16,6 +36,12 @@ func newHashIdx() *HashIdx {
 	return &HashIdx{indexes: hash.New()}
 }
 
+//reclaimer 保留有效的哈希表 entry
+//keeps the valid hash entries
+func (hi *HashIdx) reclaimer() reclaimer {
+	return validReclaimer{}
+}
+
 //HSet set field in the hash stored at key to value
 func (db *kDB) HSet(key, field, value []byte) (res int, err error) {
 	if err = db.checkKeyValue(key, value); err != nil {
@@ -136,3 +162,279 @@ func (db *kDB) HValues(key []byte) (val [][]byte) {
 
 	return db.hashIndex.indexes.HValues(string(key))
 }
+
+//HMSet 同时设置多个域的值，pairs 为 field value 交替排列，所有的域在同一个批次中写入
+//sets the fields to the values in one batch, pairs are fields and values in turn, returns the number of new fields
+func (db *kDB) HMSet(key []byte, pairs ...[]byte) (res int, err error) {
+	if len(pairs) == 0 || len(pairs)%2 != 0 {
+		return 0, ErrWrongNumberOfArgs
+	}
+	if err = db.checkKeyValue(key, pairs...); err != nil {
+		return
+	}
+
+	db.hashIndex.mu.Lock()
+	defer db.hashIndex.mu.Unlock()
+
+	entries := make([]*storage.Entry, 0, len(pairs)/2)
+	for i := 0; i < len(pairs); i += 2 {
+		entries = append(entries, storage.NewEntry(key, pairs[i+1], pairs[i], Hash, HashHMSet))
+	}
+	if _, err = db.storeBatch(entries...); err != nil {
+		return
+	}
+
+	res = db.hashIndex.indexes.HMSet(string(key), pairs...)
+	return
+}
+
+//HMGet 返回多个域的值，不存在的域为nil
+//returns the values of the fields, nil for the fields not exist
+func (db *kDB) HMGet(key []byte, fields ...[]byte) [][]byte {
+	if err := db.checkKeyValue(key, nil); err != nil {
+		return nil
+	}
+
+	db.hashIndex.mu.RLock()
+	defer db.hashIndex.mu.RUnlock()
+
+	return db.hashIndex.indexes.HMGet(string(key), toStrings(fields)...)
+}
+
+//HIncrBy 将域的整数值加上增量incr，域不存在时视为0，日志中记录增加后的值，保留域的过期时间
+//increments the integer value of the field by incr, the field not exist is taken as 0. The result is logged, and the deadline is kept.
+func (db *kDB) HIncrBy(key, field []byte, incr int64) (res int64, err error) {
+	if err = db.checkKeyValue(key, nil); err != nil {
+		return
+	}
+
+	db.hashIndex.mu.Lock()
+	defer db.hashIndex.mu.Unlock()
+
+	if res, err = db.hashIndex.indexes.HIncrByResult(string(key), string(field), incr); err != nil {
+		return 0, hashNumberErr(err)
+	}
+	if err = db.hIncrSet(key, field, []byte(strconv.FormatInt(res, 10))); err != nil {
+		return 0, err
+	}
+	return
+}
+
+//HIncrByFloat 将域的浮点数值加上增量incr，域不存在时视为0，日志中记录增加后的值，保留域的过期时间
+//increments the float value of the field by incr, the field not exist is taken as 0. The result is logged, and the deadline is kept.
+func (db *kDB) HIncrByFloat(key, field []byte, incr float64) (res float64, err error) {
+	if err = db.checkKeyValue(key, nil); err != nil {
+		return
+	}
+
+	db.hashIndex.mu.Lock()
+	defer db.hashIndex.mu.Unlock()
+
+	if res, err = db.hashIndex.indexes.HIncrByFloatResult(string(key), string(field), incr); err != nil {
+		return 0, hashNumberErr(err)
+	}
+	if err = db.hIncrSet(key, field, []byte(utils.Float64ToStr(res))); err != nil {
+		return 0, err
+	}
+	return
+}
+
+//HStrLen return the length of the value of the field, 0 if the field does not exist
+func (db *kDB) HStrLen(key, field []byte) int {
+	if err := db.checkKeyValue(key, nil); err != nil {
+		return 0
+	}
+
+	db.hashIndex.mu.RLock()
+	defer db.hashIndex.mu.RUnlock()
+
+	return db.hashIndex.indexes.HStrLen(string(key), string(field))
+}
+
+//HRandField 随机返回count个域，count为正数时域各不相同，为负数时可能重复，withValues为true时域和值交替排列
+//returns count random fields, which are distinct if count is positive and may repeat if count is negative.
+//The fields and values are in turn if withValues is true.
+func (db *kDB) HRandField(key []byte, count int, withValues bool) [][]byte {
+	if err := db.checkKeyValue(key, nil); err != nil {
+		return nil
+	}
+
+	db.hashIndex.mu.RLock()
+	defer db.hashIndex.mu.RUnlock()
+
+	return db.hashIndex.indexes.HRandField(string(key), count, withValues)
+}
+
+//hashNumberErr 将数值操作的错误转换为与字符串操作相同的错误
+func hashNumberErr(err error) error {
+	switch err {
+	case hash.ErrNotInteger:
+		return ErrValueNotInteger
+	case hash.ErrNotFloat:
+		return ErrValueNotFloat
+	case hash.ErrOverflow:
+		return ErrIncrOverflow
+	}
+	return err
+}
+
+//hIncrSet 记录并写入 HIncrBy 的结果，调用方需持有 hashIndex.mu
+//域的过期时间在值之后再次记录，Reclaim 后重放日志时也不会丢失
+//log and set the result of HIncrBy, the caller must hold hashIndex.mu.
+//The deadline of the field is logged again after the value, so that it is not lost by the replay after Reclaim.
+func (db *kDB) hIncrSet(key, field, value []byte) error {
+	entries := []*storage.Entry{storage.NewEntry(key, value, field, Hash, HashHIncrBy)}
+	deadline, ok := db.hashIndex.indexes.HDeadline(string(key), string(field))
+	if ok {
+		entries = append(entries, storage.NewEntry(key, []byte(strconv.FormatInt(deadline, 10)), field, Hash, HashHExpire))
+	}
+
+	if _, err := db.storeBatch(entries...); err != nil {
+		return err
+	}
+	db.hashIndex.indexes.HUpdate(string(key), string(field), value)
+	return nil
+}
+
+//HExpire 设置域的过期时间为seconds秒后，写入域的值时清除它的过期时间，HIncrBy 除外
+//返回每个域的结果，HashFieldNotExist 或 HashFieldUpdated
+//sets the fields to expire after seconds, writing the value of a field clears its deadline except HIncrBy.
+//Returns HashFieldNotExist or HashFieldUpdated for each field.
+func (db *kDB) HExpire(key []byte, seconds uint32, fields ...[]byte) ([]int, error) {
+	return db.HPExpire(key, uint64(seconds)*1000, fields...)
+}
+
+//HPExpire 和 HExpire 相同，但以毫秒为单位设置过期时间
+//works exactly like HExpire with the ttl in milliseconds
+func (db *kDB) HPExpire(key []byte, milliseconds uint64, fields ...[]byte) ([]int, error) {
+	if err := db.checkKeyValue(key, nil); err != nil {
+		return nil, err
+	}
+	if milliseconds == 0 {
+		return nil, ErrInvalidTTL
+	}
+	if len(fields) == 0 {
+		return nil, ErrWrongNumberOfArgs
+	}
+
+	db.hashIndex.mu.Lock()
+	defer db.hashIndex.mu.Unlock()
+
+	deadline := time.Now().UnixNano()/int64(time.Millisecond) + int64(milliseconds)
+	res := make([]int, len(fields))
+	var entries []*storage.Entry
+	for i, f := range fields {
+		if !db.hashIndex.indexes.HExists(string(key), string(f)) {
+			res[i] = HashFieldNotExist
+			continue
+		}
+		res[i] = HashFieldUpdated
+		entries = append(entries, storage.NewEntry(key, []byte(strconv.FormatInt(deadline, 10)), f, Hash, HashHExpire))
+	}
+
+	if len(entries) > 0 {
+		if _, err := db.storeBatch(entries...); err != nil {
+			return nil, err
+		}
+	}
+	for i, f := range fields {
+		if res[i] == HashFieldUpdated {
+			db.hashIndex.indexes.HExpire(string(key), string(f), deadline)
+		}
+	}
+	return res, nil
+}
+
+//HTTL 返回域的剩余生存时间（秒），域不存在时为 HashFieldNotExist，没有过期时间时为 HashFieldNoTTL
+//returns the remaining seconds to live of the fields, HashFieldNotExist or HashFieldNoTTL if the field does not exist or has no deadline
+func (db *kDB) HTTL(key []byte, fields ...[]byte) ([]int64, error) {
+	res, err := db.HPTTL(key, fields...)
+	if err != nil {
+		return nil, err
+	}
+	for i, ttl := range res {
+		if ttl > 0 {
+			res[i] = (ttl + 999) / 1000
+		}
+	}
+	return res, nil
+}
+
+//HPTTL 和 HTTL 相同，但以毫秒为单位返回剩余生存时间
+//works exactly like HTTL with the ttl in milliseconds
+func (db *kDB) HPTTL(key []byte, fields ...[]byte) ([]int64, error) {
+	if err := db.checkKeyValue(key, nil); err != nil {
+		return nil, err
+	}
+
+	db.hashIndex.mu.RLock()
+	defer db.hashIndex.mu.RUnlock()
+
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+	res := make([]int64, len(fields))
+	for i, f := range fields {
+		if !db.hashIndex.indexes.HExists(string(key), string(f)) {
+			res[i] = HashFieldNotExist
+		} else if deadline, ok := db.hashIndex.indexes.HDeadline(string(key), string(f)); ok {
+			res[i] = deadline - now
+		} else {
+			res[i] = HashFieldNoTTL
+		}
+	}
+	return res, nil
+}
+
+//HPersist 清除域的过期时间，返回每个域的结果，HashFieldNotExist、HashFieldNoTTL 或 HashFieldUpdated
+//clears the deadlines of the fields, returns HashFieldNotExist, HashFieldNoTTL or HashFieldUpdated for each field
+func (db *kDB) HPersist(key []byte, fields ...[]byte) ([]int, error) {
+	if err := db.checkKeyValue(key, nil); err != nil {
+		return nil, err
+	}
+
+	db.hashIndex.mu.Lock()
+	defer db.hashIndex.mu.Unlock()
+
+	res := make([]int, len(fields))
+	var entries []*storage.Entry
+	for i, f := range fields {
+		if _, ok := db.hashIndex.indexes.HDeadline(string(key), string(f)); ok {
+			res[i] = HashFieldUpdated
+			entries = append(entries, storage.NewEntry(key, nil, f, Hash, HashHPersist))
+		} else if db.hashIndex.indexes.HExists(string(key), string(f)) {
+			res[i] = HashFieldNoTTL
+		} else {
+			res[i] = HashFieldNotExist
+		}
+	}
+
+	if len(entries) > 0 {
+		if _, err := db.storeBatch(entries...); err != nil {
+			return nil, err
+		}
+	}
+	for i, f := range fields {
+		if res[i] == HashFieldUpdated {
+			db.hashIndex.indexes.HPersist(string(key), string(f))
+		}
+	}
+	return res, nil
+}
+
+//expireHashFields 定期删除过期的域，直到done被关闭，过期时间记录在日志中，因此不需要写入删除操作
+//deletes the expired fields periodically until done is closed.
+//The deadlines are in the log, so the deletions are not logged.
+func (db *kDB) expireHashFields(done <-chan struct{}) {
+	ticker := time.NewTicker(hashExpireInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			db.hashIndex.mu.Lock()
+			db.hashIndex.indexes.DeleteExpired(hashExpireLimit)
+			db.hashIndex.mu.Unlock()
+		}
+	}
+}
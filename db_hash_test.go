@@ -1,7 +1,10 @@
 package kDB
 
 import (
+	"reflect"
+	"strconv"
 	"testing"
+	"time"
 )
 
 var key = "myhash"
@@ -134,3 +137,342 @@ func Test_kDB_HLen(t *testing.T) {
 
 	db.HLen([]byte("11"))
 }
+
+func TestKDB_HMSet(t *testing.T) {
+	db, _ := OpenDb(t, "/tmp/kdb/db-hash", KeyValueRamMode)
+	defer db.Close()
+
+	key := []byte("my_hash")
+	if _, err := db.HMSet(key, []byte("a")); err != ErrWrongNumberOfArgs {
+		t.Errorf("hmset without a value, err = %v", err)
+	}
+	n, err := db.HMSet(key, []byte("a"), []byte("1"), []byte("b"), []byte("22"), []byte("a"), []byte("333"))
+	if n != 2 || err != nil {
+		t.Errorf("hmset got %d, %v", n, err)
+	}
+	if n, _ = db.HMSet(key, []byte("b"), []byte("2"), []byte("c"), []byte("3")); n != 1 {
+		t.Errorf("hmset got %d", n)
+	}
+
+	res := db.HMGet(key, []byte("a"), []byte("b"), []byte("none"))
+	if !reflect.DeepEqual(res, [][]byte{[]byte("333"), []byte("2"), nil}) {
+		t.Errorf("hmget got %q", res)
+	}
+	if n := db.HStrLen(key, []byte("a")); n != 3 {
+		t.Errorf("hstrlen got %d", n)
+	}
+	if n := db.HStrLen(key, []byte("none")); n != 0 {
+		t.Errorf("hstrlen of a missing field got %d", n)
+	}
+}
+
+func TestKDB_HIncrBy(t *testing.T) {
+	db, _ := OpenDb(t, "/tmp/kdb/db-hash", KeyValueRamMode)
+	defer db.Close()
+
+	key := []byte("my_hash")
+	if res, err := db.HIncrBy(key, []byte("n"), 10); res != 10 || err != nil {
+		t.Errorf("hincrby got %d, %v", res, err)
+	}
+	if res, _ := db.HIncrBy(key, []byte("n"), -3); res != 7 {
+		t.Errorf("hincrby got %d", res)
+	}
+	if res, err := db.HIncrByFloat(key, []byte("n"), 0.25); res != 7.25 || err != nil {
+		t.Errorf("hincrbyfloat got %v, %v", res, err)
+	}
+	if _, err := db.HIncrBy(key, []byte("n"), 1); err != ErrValueNotInteger {
+		t.Errorf("hincrby a float, err = %v", err)
+	}
+
+	_, _ = db.HSet(key, []byte("s"), []byte("abc"))
+	if _, err := db.HIncrByFloat(key, []byte("s"), 1); err != ErrValueNotFloat {
+		t.Errorf("hincrbyfloat a string, err = %v", err)
+	}
+	_, _ = db.HSet(key, []byte("max"), []byte("9223372036854775807"))
+	if _, err := db.HIncrBy(key, []byte("max"), 1); err != ErrIncrOverflow {
+		t.Errorf("hincrby overflow, err = %v", err)
+	}
+}
+
+func TestKDB_HIncrByKeepTTL(t *testing.T) {
+	db, config := OpenDb(t, "/tmp/kdb/db-hash-incr-ttl", KeyOnlyRamMode)
+	defer func() { _ = db.Close() }()
+
+	key, field := []byte("my_hash"), []byte("n")
+	_, _ = db.HSet(key, field, []byte("1"))
+	_, _ = db.HExpire(key, 100, field)
+	_, _ = db.HIncrBy(key, field, 1)
+	_, _ = db.HIncrByFloat(key, field, 0.5)
+	check := func(step string) {
+		ttl, _ := db.HTTL(key, field)
+		if val := db.HGet(key, field); string(val) != "2.5" || ttl[0] <= 0 {
+			t.Errorf("%s: expected 2.5 with the deadline, got %s, ttl %d", step, val, ttl[0])
+		}
+	}
+	check("after hincrby")
+
+	//nothing is changed if the result can not be stored
+	restore := failNextWrite(t, db)
+	if _, err := db.HIncrBy(key, field, 1); err == nil {
+		t.Error("expected an error")
+	}
+	restore()
+	check("after the failed hincrby")
+
+	//the deadline logged with the result is kept by Reclaim
+	for i := 0; i < 3000; i++ {
+		_, _ = db.HSet([]byte("other"), []byte(strconv.Itoa(i%10)), []byte(strconv.Itoa(i)))
+	}
+	if err := db.Reclaim(); err != nil {
+		t.Fatal(err)
+	}
+	_ = db.Close()
+
+	var err error
+	if db, err = Open(config); err != nil {
+		t.Fatal(err)
+	}
+	check("after reclaim and reopen")
+}
+
+func TestKDB_HRandField(t *testing.T) {
+	db, _ := OpenDb(t, "/tmp/kdb/db-hash", KeyValueRamMode)
+	defer db.Close()
+
+	key := []byte("my_hash")
+	_, _ = db.HMSet(key, []byte("a"), []byte("1"), []byte("b"), []byte("2"), []byte("c"), []byte("3"))
+
+	if res := db.HRandField(key, 2, false); len(res) != 2 || string(res[0]) == string(res[1]) {
+		t.Errorf("expected 2 distinct fields, got %q", res)
+	}
+	res := db.HRandField(key, -4, true)
+	if len(res) != 8 {
+		t.Fatalf("expected 4 fields with values, got %q", res)
+	}
+	for i := 0; i < len(res); i += 2 {
+		if string(db.HGet(key, res[i])) != string(res[i+1]) {
+			t.Errorf("%s is not followed by its value", res[i])
+		}
+	}
+	if res := db.HRandField([]byte("none"), 1, false); len(res) != 0 {
+		t.Errorf("expected nothing, got %q", res)
+	}
+}
+
+func TestKDB_HashReplay(t *testing.T) {
+	replay := func(t *testing.T, mode DataIndexMode) {
+		db, config := OpenDb(t, "/tmp/kdb/db-hash-replay", mode)
+
+		key := []byte("my_hash")
+		//enough operations to fill the archived files, the last ones are in the active file
+		for i := 0; i < 3000; i++ {
+			field := []byte("f" + strconv.Itoa(i%50))
+			switch i % 4 {
+			case 0:
+				_, _ = db.HMSet(key, field, []byte("v"+strconv.Itoa(i)), []byte("count"), []byte(strconv.Itoa(i)))
+			case 1:
+				_, _ = db.HIncrBy(key, []byte("n"+strconv.Itoa(i%7)), int64(i))
+			case 2:
+				_, _ = db.HIncrByFloat(key, []byte("x"), 0.5)
+			default:
+				_, _ = db.HDel(key, field)
+			}
+		}
+		if len(db.archFiles) == 0 {
+			t.Fatal("expected archived files")
+		}
+
+		want := make(map[string]string)
+		for _, field := range db.HKeys(key) {
+			want[field] = string(db.HGet(key, []byte(field)))
+		}
+		check := func(step string) {
+			got := make(map[string]string)
+			for _, field := range db.HKeys(key) {
+				got[field] = string(db.HGet(key, []byte(field)))
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("%s: hash is not rebuilt correctly", step)
+			}
+		}
+		check("before reopen")
+		db.Close()
+
+		var err error
+		if db, err = Open(config); err != nil {
+			t.Fatal(err)
+		}
+		check("after reopen")
+
+		if err = db.Reclaim(); err != nil {
+			t.Fatal(err)
+		}
+		check("after reclaim")
+		db.Close()
+
+		if db, err = Open(config); err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+		check("reopen after reclaim")
+	}
+
+	t.Run("KeyValueRamMode", func(t *testing.T) {
+		replay(t, KeyValueRamMode)
+	})
+
+	t.Run("KeyOnlyRamMode", func(t *testing.T) {
+		replay(t, KeyOnlyRamMode)
+	})
+}
+
+func TestKDB_HExpire(t *testing.T) {
+	db, _ := OpenDb(t, "/tmp/kdb/db-hash", KeyValueRamMode)
+	defer db.Close()
+
+	key := []byte("session")
+	_, _ = db.HMSet(key, []byte("user"), []byte("u1"), []byte("token"), []byte("t1"), []byte("cart"), []byte("c1"))
+	if _, err := db.HExpire(key, 0, []byte("token")); err != ErrInvalidTTL {
+		t.Errorf("hexpire with 0, err = %v", err)
+	}
+
+	res, err := db.HExpire(key, 100, []byte("token"), []byte("none"))
+	if err != nil || !reflect.DeepEqual(res, []int{HashFieldUpdated, HashFieldNotExist}) {
+		t.Errorf("hexpire got %v, %v", res, err)
+	}
+	if ttl, err := db.HTTL(key, []byte("token"), []byte("user"), []byte("none")); err != nil || !reflect.DeepEqual(ttl, []int64{100, HashFieldNoTTL, HashFieldNotExist}) {
+		t.Errorf("httl got %v, %v", ttl, err)
+	}
+	if _, err := db.HTTL(nil, []byte("token")); err != ErrEmptyKey {
+		t.Errorf("httl with empty key, err = %v", err)
+	}
+	if _, err := db.HPTTL(nil, []byte("token")); err != ErrEmptyKey {
+		t.Errorf("hpttl with empty key, err = %v", err)
+	}
+	if res, _ = db.HPersist(key, []byte("token"), []byte("user"), []byte("none")); !reflect.DeepEqual(res, []int{HashFieldUpdated, HashFieldNoTTL, HashFieldNotExist}) {
+		t.Errorf("hpersist got %v", res)
+	}
+
+	//writing the value clears the deadline
+	_, _ = db.HExpire(key, 100, []byte("user"))
+	_, _ = db.HSet(key, []byte("user"), []byte("u2"))
+	if ttl, _ := db.HTTL(key, []byte("user")); ttl[0] != HashFieldNoTTL {
+		t.Errorf("expected the deadline to be cleared, got %d", ttl[0])
+	}
+
+	_, _ = db.HPExpire(key, 10, []byte("cart"))
+	time.Sleep(20 * time.Millisecond)
+	if db.HGet(key, []byte("cart")) != nil || db.HExists(key, []byte("cart")) || db.HLen(key) != 2 {
+		t.Error("expected cart to be expired")
+	}
+	if len(db.HKeys(key)) != 2 || len(db.HGetAll(key)) != 4 {
+		t.Errorf("expected the expired field to be hidden, got %v", db.HKeys(key))
+	}
+}
+
+func TestKDB_HashExpireActively(t *testing.T) {
+	db, _ := OpenDb(t, "/tmp/kdb/db-hash", KeyValueRamMode)
+	defer db.Close()
+
+	key := []byte("session")
+	for i := 0; i < 100; i++ {
+		field := []byte(strconv.Itoa(i))
+		_, _ = db.HSet(key, field, field)
+		_, _ = db.HPExpire(key, 1, field)
+	}
+	time.Sleep(hashExpireInterval + 200*time.Millisecond)
+
+	db.hashIndex.mu.RLock()
+	defer db.hashIndex.mu.RUnlock()
+	if n := db.hashIndex.indexes.DeleteExpired(1000); n != 0 {
+		t.Errorf("expected the expired fields to be deleted actively, %d left", n)
+	}
+}
+
+//fieldHasTTL whether the field has a deadline
+func fieldHasTTL(db *kDB, key []byte, field string) bool {
+	ttl, err := db.HTTL(key, []byte(field))
+	return err == nil && ttl[0] > 0
+}
+
+func TestKDB_HashExpireReplay(t *testing.T) {
+	replay := func(t *testing.T, mode DataIndexMode) {
+		db, config := OpenDb(t, "/tmp/kdb/db-hash-expire", mode)
+
+		key := []byte("session")
+		for i := 0; i < 1000; i++ {
+			field := []byte("f" + strconv.Itoa(i%100))
+			_, _ = db.HSet(key, field, []byte(strconv.Itoa(i)))
+			switch i % 5 {
+			case 0:
+				_, _ = db.HPExpire(key, 1, field)
+			case 1:
+				_, _ = db.HExpire(key, 3600, field)
+			case 2:
+				_, _ = db.HExpire(key, 3600, field)
+				_, _ = db.HPersist(key, field)
+			}
+		}
+		//enough operations to move the fields above to the archived files
+		for i := 0; i < 2000; i++ {
+			_, _ = db.HSet([]byte("other"), []byte(strconv.Itoa(i%10)), []byte(strconv.Itoa(i)))
+		}
+		if len(db.archFiles) == 0 {
+			t.Fatal("expected archived files")
+		}
+		time.Sleep(10 * time.Millisecond)
+
+		want := make(map[string]string)
+		for _, field := range db.HKeys(key) {
+			want[field] = string(db.HGet(key, []byte(field))) + "/" + strconv.FormatBool(fieldHasTTL(db, key, field))
+		}
+		if len(want) != 80 {
+			t.Fatalf("expected 80 fields not expired, got %d", len(want))
+		}
+		check := func(step string) {
+			got := make(map[string]string)
+			for _, field := range db.HKeys(key) {
+				got[field] = string(db.HGet(key, []byte(field))) + "/" + strconv.FormatBool(fieldHasTTL(db, key, field))
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("%s: hash is not rebuilt correctly", step)
+			}
+		}
+		check("before reopen")
+		db.Close()
+
+		var err error
+		if db, err = Open(config); err != nil {
+			t.Fatal(err)
+		}
+		check("after reopen")
+
+		if err = db.Reclaim(); err != nil {
+			t.Fatal(err)
+		}
+		check("after reclaim")
+		db.Close()
+
+		if db, err = Open(config); err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+		check("reopen after reclaim")
+
+		//the expired fields are dropped by reclaim
+		db.hashIndex.mu.Lock()
+		n := db.hashIndex.indexes.DeleteExpired(1000)
+		db.hashIndex.mu.Unlock()
+		if n != 0 {
+			t.Errorf("expected the expired fields to be dropped, got %d", n)
+		}
+	}
+
+	t.Run("KeyValueRamMode", func(t *testing.T) {
+		replay(t, KeyValueRamMode)
+	})
+
+	t.Run("KeyOnlyRamMode", func(t *testing.T) {
+		replay(t, KeyOnlyRamMode)
+	})
+}
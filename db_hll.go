@@ -0,0 +1,142 @@
+package kDB
+
+import (
+	"github.com/KarlvenK/kDB/ds/hll"
+	"github.com/KarlvenK/kDB/storage"
+	"sync"
+)
+
+// HllIdx the hyperloglog idx
+type HllIdx struct {
+	mu      sync.RWMutex
+	indexes *hll.HyperLogLog
+}
+
+func newHllIdx() *HllIdx {
+	return &HllIdx{indexes: hll.New()}
+}
+
+//reclaimer 把一个 hyperloglog 的 entries 替换为一个整个 sketch 的 entry
+//replaces the entries of a hyperloglog by one entry of the whole sketch
+func (hi *HllIdx) reclaimer() reclaimer {
+	return &keySnapshotReclaimer{
+		keys: make(map[string]bool),
+		dump: func(e *storage.Entry) {
+			hi.mu.RLock()
+			e.Meta.Value = hi.indexes.Dump(string(e.Meta.Key))
+			hi.mu.RUnlock()
+			e.Meta.ValueSize = uint32(len(e.Meta.Value))
+			e.Mark = HyperLogLogPFMerge
+		},
+	}
+}
+
+// PFAdd 将元素添加到key的HyperLogLog中，只保存寄存器而不保存元素本身
+// 返回估计的基数是否发生变化，key不存在时会创建一个空的HyperLogLog
+// Adds the elements to the HyperLogLog stored at key, the elements themselves are not kept.
+// Returns true if at least one internal register was altered or the key was created.
+func (db *kDB) PFAdd(key []byte, elements ...[]byte) (bool, error) {
+	if err := db.checkKeyValue(key, elements...); err != nil {
+		return false, err
+	}
+
+	db.hllIndex.mu.Lock()
+	defer db.hllIndex.mu.Unlock()
+
+	k := string(key)
+	created := !db.hllIndex.indexes.PFExists(k)
+	if len(elements) == 0 {
+		if !created {
+			return false, nil
+		}
+
+		//an empty sketch is logged to create the key
+		e := storage.NewEntryNoExtra(key, hll.NewSketch().Bytes(), HyperLogLog, HyperLogLogPFMerge)
+		if err := db.store(e); err != nil {
+			return false, err
+		}
+		return true, db.hllIndex.indexes.Restore(k, e.Meta.Value)
+	}
+
+	//only the elements which alter the registers are logged
+	var entries []*storage.Entry
+	for _, elem := range elements {
+		if db.hllIndex.indexes.PFAdd(k, elem) {
+			entries = append(entries, storage.NewEntryNoExtra(key, elem, HyperLogLog, HyperLogLogPFAdd))
+		}
+	}
+	if len(entries) == 0 {
+		return false, nil
+	}
+
+	if _, err := db.storeBatch(entries...); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// PFCount 返回给定key的HyperLogLog的并集的基数估计值，不存在的key被视为空集
+// Returns the approximated cardinality of the union of the HyperLogLogs stored at keys.
+func (db *kDB) PFCount(keys ...[]byte) (uint64, error) {
+	if len(keys) == 0 {
+		return 0, ErrWrongNumberOfArgs
+	}
+	for _, key := range keys {
+		if err := db.checkKeyValue(key, nil); err != nil {
+			return 0, err
+		}
+	}
+
+	db.hllIndex.mu.RLock()
+	defer db.hllIndex.mu.RUnlock()
+
+	return db.hllIndex.indexes.PFCount(toStrings(keys)...), nil
+}
+
+// PFMerge 将多个HyperLogLog合并到dest中，dest不存在时会被创建
+// Merge the HyperLogLogs stored at keys into dest, dest is created if it does not exist.
+func (db *kDB) PFMerge(dest []byte, keys ...[]byte) error {
+	if err := db.checkKeyValue(dest, nil); err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if err := db.checkKeyValue(key, nil); err != nil {
+			return err
+		}
+	}
+
+	db.hllIndex.mu.Lock()
+	defer db.hllIndex.mu.Unlock()
+
+	//merge into a copy, so that dest is unchanged if the entry fails to store
+	tmp := hll.New()
+	d := string(dest)
+	if data := db.hllIndex.indexes.Dump(d); data != nil {
+		if err := tmp.Restore(d, data); err != nil {
+			return err
+		}
+	}
+	for _, key := range keys {
+		if data := db.hllIndex.indexes.Dump(string(key)); data != nil && string(key) != d {
+			if err := tmp.Restore(d, data); err != nil {
+				return err
+			}
+		}
+	}
+	tmp.PFMerge(d)
+
+	e := storage.NewEntryNoExtra(dest, tmp.Dump(d), HyperLogLog, HyperLogLogPFMerge)
+	if err := db.store(e); err != nil {
+		return err
+	}
+	return db.hllIndex.indexes.Restore(d, e.Meta.Value)
+}
+
+// toStrings convert the keys to strings
+func toStrings(keys [][]byte) []string {
+	res := make([]string, len(keys))
+	for i, key := range keys {
+		res[i] = string(key)
+	}
+	return res
+}
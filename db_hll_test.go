@@ -0,0 +1,117 @@
+package kDB
+
+import (
+	"math"
+	"strconv"
+	"testing"
+)
+
+func TestKDB_PFAdd(t *testing.T) {
+	db, _ := OpenDb(t, "/tmp/kdb/db-pfadd", KeyValueRamMode)
+	defer db.Close()
+
+	key := []byte("my_hll")
+
+	if ok, err := db.PFAdd(key); err != nil || !ok {
+		t.Errorf("pfadd create got %v, %v", ok, err)
+	}
+	if ok, _ := db.PFAdd(key); ok {
+		t.Error("pfadd an existing key without elements should return false")
+	}
+	if ok, _ := db.PFAdd(key, []byte("a"), []byte("b"), []byte("c")); !ok {
+		t.Error("pfadd new elements should return true")
+	}
+	if ok, _ := db.PFAdd(key, []byte("a")); ok {
+		t.Error("pfadd an existing element should return false")
+	}
+	if n, _ := db.PFCount(key); n != 3 {
+		t.Errorf("pfcount got %d", n)
+	}
+	if _, err := db.PFAdd(nil, []byte("a")); err != ErrEmptyKey {
+		t.Errorf("pfadd empty key, err = %v", err)
+	}
+}
+
+func TestKDB_PFMerge(t *testing.T) {
+	db := InitDb()
+	defer db.Close()
+
+	k1, k2, dest := []byte("my_hll_1"), []byte("my_hll_2"), []byte("my_hll_dest")
+	for i := 0; i < 2000; i++ {
+		_, _ = db.PFAdd(k1, []byte("a"+strconv.Itoa(i)))
+		_, _ = db.PFAdd(k2, []byte("b"+strconv.Itoa(i)))
+	}
+
+	union, _ := db.PFCount(k1, k2)
+	if err := db.PFMerge(dest, k1, k2, []byte("not exist")); err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := db.PFCount(dest); n != union {
+		t.Errorf("pfmerge got %d, union is %d", n, union)
+	}
+
+	if _, err := db.PFCount(); err != ErrWrongNumberOfArgs {
+		t.Errorf("pfcount without keys, err = %v", err)
+	}
+	if n, _ := db.PFCount([]byte("not exist")); n != 0 {
+		t.Errorf("pfcount not exist got %d", n)
+	}
+}
+
+func TestKDB_PFReplay(t *testing.T) {
+	replay := func(t *testing.T, mode DataIndexMode) {
+		db, config := OpenDb(t, "/tmp/kdb/db-hll", mode)
+
+		sparse, large, merged := []byte("hll_sparse"), []byte("hll_large"), []byte("hll_merged")
+		_, _ = db.PFAdd(sparse, []byte("x"), []byte("y"))
+		for i := 0; i < 20000; i++ {
+			_, _ = db.PFAdd(large, []byte(strconv.Itoa(i)))
+		}
+		_ = db.PFMerge(merged, sparse, large)
+		_, _ = db.PFAdd(merged, []byte("z"))
+
+		counts := make(map[string]uint64)
+		for _, k := range [][]byte{sparse, large, merged} {
+			counts[string(k)], _ = db.PFCount(k)
+		}
+		if e := math.Abs(float64(counts["hll_large"])-20000) / 20000; e > 0.02 {
+			t.Errorf("pfcount got %d, error = %.4f", counts["hll_large"], e)
+		}
+
+		check := func(step string) {
+			for k, want := range counts {
+				if n, _ := db.PFCount([]byte(k)); n != want {
+					t.Errorf("%s: pfcount %s got %d, want %d", step, k, n, want)
+				}
+			}
+		}
+		check("before reopen")
+		db.Close()
+
+		var err error
+		if db, err = Open(config); err != nil {
+			t.Fatal(err)
+		}
+		check("after reopen")
+
+		if err = db.Reclaim(); err != nil {
+			t.Fatal(err)
+		}
+		check("after reclaim")
+		db.Close()
+
+		if db, err = Open(config); err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+		check("reopen after reclaim")
+	}
+
+	t.Run("KeyValueRamMode", func(t *testing.T) {
+		replay(t, KeyValueRamMode)
+	})
+
+	t.Run("KeyOnlyRamMode", func(t *testing.T) {
+		replay(t, KeyOnlyRamMode)
+	})
+}
@@ -0,0 +1,166 @@
+package kDB
+
+import (
+	"bytes"
+	"github.com/KarlvenK/kDB/ds/document"
+	"github.com/KarlvenK/kDB/storage"
+	"strconv"
+	"sync"
+)
+
+// JSONIdx the json document idx
+type JSONIdx struct {
+	mu      sync.RWMutex
+	indexes *document.Documents
+}
+
+func newJSONIdx() *JSONIdx {
+	return &JSONIdx{indexes: document.New()}
+}
+
+//reclaimer 重放文档的修改，快照为每个完整的文档
+//replays the mutations of the documents, the snapshot is each whole document
+func (ji *JSONIdx) reclaimer() reclaimer {
+	docs := document.New()
+	return &replayReclaimer{
+		apply: func(e *storage.Entry) {
+			applyJSON(docs, string(e.Meta.Key), e.Mark, string(e.Meta.Extra), e.Meta.Value)
+		},
+		keys: docs.Keys,
+		dump: func(key string) []*storage.Entry {
+			if doc, ok, err := docs.Get(key); ok && err == nil {
+				return []*storage.Entry{storage.NewEntry([]byte(key), doc, []byte("$"), JSON, JSONSet)}
+			}
+			return nil
+		},
+	}
+}
+
+// JSONSet 将path匹配的值设为value，对象中不存在的最后一级成员会被创建，返回修改的个数
+// key不存在时path必须为根节点 $，日志中只记录路径和新的值
+// Sets the values matched by path in the document stored at key, the missing last member of an object is created.
+// Returns the number of values set. A new document can only be set at the root $.
+// Only the path and the value are logged instead of the whole document.
+func (db *kDB) JSONSet(key []byte, path string, value []byte) (int, error) {
+	if err := db.checkKeyValue(key, value); err != nil {
+		return 0, err
+	}
+	if err := document.Validate(path, value); err != nil {
+		return 0, err
+	}
+
+	db.jsonIndex.mu.Lock()
+	defer db.jsonIndex.mu.Unlock()
+
+	if !db.jsonIndex.indexes.Exists(string(key)) && !document.IsRoot(path) {
+		return 0, ErrKeyNotExist
+	}
+	if err := db.storeJSON(key, path, value, JSONSet); err != nil {
+		return 0, err
+	}
+	return db.jsonIndex.indexes.Set(string(key), path, value)
+}
+
+// JSONGet 返回path匹配的值
+// 没有path时返回整个文档，一个path时返回匹配的值组成的数组，多个path时返回每个path到其匹配的值的对象
+// Returns the whole document without paths, an array of the values matched by one path,
+// or an object of each path to the array of its matches.
+func (db *kDB) JSONGet(key []byte, paths ...string) ([]byte, error) {
+	if err := db.checkKeyValue(key, nil); err != nil {
+		return nil, err
+	}
+
+	db.jsonIndex.mu.RLock()
+	defer db.jsonIndex.mu.RUnlock()
+
+	res, exist, err := db.jsonIndex.indexes.Get(string(key), paths...)
+	if err != nil {
+		return nil, err
+	}
+	if !exist {
+		return nil, ErrKeyNotExist
+	}
+	return res, nil
+}
+
+// JSONDel 删除path匹配的值，path为根节点时删除整个文档，返回删除的个数
+// Deletes the values matched by path, the whole document is deleted if path is the root.
+// Returns the number of values deleted.
+func (db *kDB) JSONDel(key []byte, path string) (int, error) {
+	if err := db.checkKeyValue(key, nil); err != nil {
+		return 0, err
+	}
+	if err := document.Validate(path); err != nil {
+		return 0, err
+	}
+
+	db.jsonIndex.mu.Lock()
+	defer db.jsonIndex.mu.Unlock()
+
+	if !db.jsonIndex.indexes.Exists(string(key)) {
+		return 0, nil
+	}
+	if err := db.storeJSON(key, path, nil, JSONDel); err != nil {
+		return 0, err
+	}
+	return db.jsonIndex.indexes.Del(string(key), path)
+}
+
+// JSONNumIncrBy 将path匹配的数字加上by，返回新的值组成的JSON数组，不是数字的值对应的结果为null
+// Increments the numbers matched by path by by, returns a JSON array of the new values, null for non-numbers.
+func (db *kDB) JSONNumIncrBy(key []byte, path string, by float64) ([]byte, error) {
+	if err := db.checkKeyValue(key, nil); err != nil {
+		return nil, err
+	}
+	if err := document.Validate(path); err != nil {
+		return nil, err
+	}
+
+	db.jsonIndex.mu.Lock()
+	defer db.jsonIndex.mu.Unlock()
+
+	if !db.jsonIndex.indexes.Exists(string(key)) {
+		return nil, ErrKeyNotExist
+	}
+
+	incr := []byte(strconv.FormatFloat(by, 'g', -1, 64))
+	if err := db.storeJSON(key, path, incr, JSONNumIncrBy); err != nil {
+		return nil, err
+	}
+	return db.jsonIndex.indexes.NumIncrBy(string(key), path, incr)
+}
+
+// JSONArrAppend 将values添加到path匹配的数组末尾，返回数组新的长度，不是数组的值对应的结果为-1
+// Appends the values to the arrays matched by path, returns the new lengths, -1 for non-arrays.
+func (db *kDB) JSONArrAppend(key []byte, path string, values ...[]byte) ([]int, error) {
+	if err := db.checkKeyValue(key, values...); err != nil {
+		return nil, err
+	}
+	if len(values) == 0 {
+		return nil, ErrWrongNumberOfArgs
+	}
+	if err := document.Validate(path, values...); err != nil {
+		return nil, err
+	}
+
+	db.jsonIndex.mu.Lock()
+	defer db.jsonIndex.mu.Unlock()
+
+	if !db.jsonIndex.indexes.Exists(string(key)) {
+		return nil, ErrKeyNotExist
+	}
+
+	//the values are logged as one JSON array
+	arr := append([]byte{'['}, bytes.Join(values, []byte{','})...)
+	arr = append(arr, ']')
+	if err := db.storeJSON(key, path, arr, JSONArrAppend); err != nil {
+		return nil, err
+	}
+	return db.jsonIndex.indexes.ArrAppend(string(key), path, values...)
+}
+
+// storeJSON 记录一次路径修改，extra为路径
+func (db *kDB) storeJSON(key []byte, path string, value []byte, mark uint16) error {
+	e := storage.NewEntry(key, value, []byte(path), JSON, mark)
+	return db.store(e)
+}
@@ -0,0 +1,172 @@
+package kDB
+
+import (
+	"github.com/KarlvenK/kDB/ds/document"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestKDB_JSONSet(t *testing.T) {
+	db, _ := OpenDb(t, "/tmp/kdb/db-json", KeyValueRamMode)
+	defer db.Close()
+
+	key := []byte("my_doc")
+	if _, err := db.JSONSet(key, "$.a", []byte("1")); err != ErrKeyNotExist {
+		t.Errorf("set a missing document not at the root, err = %v", err)
+	}
+	if n, err := db.JSONSet(key, "$", []byte(`{"a":1,"b":{"c":"x"}}`)); err != nil || n != 1 {
+		t.Errorf("set got %d, %v", n, err)
+	}
+	if n, _ := db.JSONSet(key, "$.b.d", []byte(`[1,2]`)); n != 1 {
+		t.Errorf("set a new member got %d", n)
+	}
+	if _, err := db.JSONSet(key, "$.b", []byte(`{`)); err != document.ErrInvalidValue {
+		t.Errorf("set an invalid value, err = %v", err)
+	}
+	if _, err := db.JSONSet(key, "$[", []byte(`1`)); err != document.ErrInvalidPath {
+		t.Errorf("set an invalid path, err = %v", err)
+	}
+
+	if doc, _ := db.JSONGet(key); string(doc) != `{"a":1,"b":{"c":"x","d":[1,2]}}` {
+		t.Errorf("get got %s", doc)
+	}
+	if res, _ := db.JSONGet(key, "$.b.d[-1]"); string(res) != `[2]` {
+		t.Errorf("get a path got %s", res)
+	}
+	if res, _ := db.JSONGet(key, "$.a", "b.c"); string(res) != `{"$.a":[1],"b.c":["x"]}` {
+		t.Errorf("get paths got %s", res)
+	}
+	if _, err := db.JSONGet([]byte("missing")); err != ErrKeyNotExist {
+		t.Errorf("get a missing document, err = %v", err)
+	}
+}
+
+func TestKDB_JSONDel(t *testing.T) {
+	db, _ := OpenDb(t, "/tmp/kdb/db-json", KeyValueRamMode)
+	defer db.Close()
+
+	key := []byte("my_doc")
+	_, _ = db.JSONSet(key, "$", []byte(`{"a":[1,2,3],"b":true}`))
+	if n, _ := db.JSONDel(key, "$.a[*]"); n != 3 {
+		t.Errorf("del got %d", n)
+	}
+	if doc, _ := db.JSONGet(key); string(doc) != `{"a":[],"b":true}` {
+		t.Errorf("get got %s", doc)
+	}
+	if n, _ := db.JSONDel(key, "$"); n != 1 {
+		t.Errorf("del the root got %d", n)
+	}
+	if _, err := db.JSONGet(key); err != ErrKeyNotExist {
+		t.Errorf("get a deleted document, err = %v", err)
+	}
+	if n, _ := db.JSONDel(key, "$"); n != 0 {
+		t.Errorf("del a missing document got %d", n)
+	}
+}
+
+func TestKDB_JSONNumIncrBy(t *testing.T) {
+	db, _ := OpenDb(t, "/tmp/kdb/db-json", KeyValueRamMode)
+	defer db.Close()
+
+	key := []byte("my_doc")
+	_, _ = db.JSONSet(key, "$", []byte(`{"a":1,"b":1.5,"c":"x"}`))
+	if res, err := db.JSONNumIncrBy(key, "$.*", 2); err != nil || string(res) != `[3,3.5,null]` {
+		t.Errorf("numincrby got %s, %v", res, err)
+	}
+	if res, _ := db.JSONNumIncrBy(key, "$.a", 0.5); string(res) != `[3.5]` {
+		t.Errorf("numincrby a float got %s", res)
+	}
+	if _, err := db.JSONNumIncrBy([]byte("missing"), "$", 1); err != ErrKeyNotExist {
+		t.Errorf("numincrby a missing document, err = %v", err)
+	}
+}
+
+func TestKDB_JSONArrAppend(t *testing.T) {
+	db, _ := OpenDb(t, "/tmp/kdb/db-json", KeyValueRamMode)
+	defer db.Close()
+
+	key := []byte("my_doc")
+	_, _ = db.JSONSet(key, "$", []byte(`{"a":[1],"b":{"a":[]},"c":{"a":0}}`))
+	res, err := db.JSONArrAppend(key, "$..a", []byte("2"))
+	if err != document.ErrInvalidPath {
+		t.Errorf("arrappend an invalid path, err = %v", err)
+	}
+	if res, err = db.JSONArrAppend(key, "$.*.a", []byte("2"), []byte(`"x"`)); err != nil || !reflect.DeepEqual(res, []int{2, -1}) {
+		t.Errorf("arrappend got %v, %v", res, err)
+	}
+	if res, _ = db.JSONArrAppend(key, "$.a", []byte(`{"k":[]}`)); !reflect.DeepEqual(res, []int{2}) {
+		t.Errorf("arrappend got %v", res)
+	}
+	if doc, _ := db.JSONGet(key); string(doc) != `{"a":[1,{"k":[]}],"b":{"a":[2,"x"]},"c":{"a":0}}` {
+		t.Errorf("get got %s", doc)
+	}
+	if _, err = db.JSONArrAppend(key, "$.a"); err != ErrWrongNumberOfArgs {
+		t.Errorf("arrappend nothing, err = %v", err)
+	}
+}
+
+func TestKDB_JSONReplay(t *testing.T) {
+	replay := func(t *testing.T, mode DataIndexMode) {
+		db, config := OpenDb(t, "/tmp/kdb/db-json-replay", mode)
+
+		key, deleted := []byte("doc"), []byte("deleted")
+		_, _ = db.JSONSet(key, "$", []byte(`{"count":0,"ratio":0,"list":[],"obj":{}}`))
+		_, _ = db.JSONSet(deleted, "$", []byte(`{"a":1}`))
+		_, _ = db.JSONDel(deleted, "$")
+
+		//enough mutations to fill the archived files, the last ones are in the active file
+		for i := 0; i < 3000; i++ {
+			_, _ = db.JSONNumIncrBy(key, "$.count", 1)
+			_, _ = db.JSONNumIncrBy(key, "$.ratio", 0.5)
+			if i%10 == 0 {
+				_, _ = db.JSONArrAppend(key, "$.list", []byte(strconv.Itoa(i)))
+				_, _ = db.JSONSet(key, "$.obj.k"+strconv.Itoa(i%50), []byte(strconv.Itoa(i)))
+			}
+			if i%100 == 0 {
+				_, _ = db.JSONDel(key, "$.list[0]")
+			}
+		}
+		if len(db.archFiles) == 0 {
+			t.Fatal("expected archived files")
+		}
+
+		want, _ := db.JSONGet(key)
+		check := func(step string) {
+			if got, err := db.JSONGet(key); err != nil || string(got) != string(want) {
+				t.Errorf("%s: document is not rebuilt correctly, got %.100s, %v", step, got, err)
+			}
+			if _, err := db.JSONGet(deleted); err != ErrKeyNotExist {
+				t.Errorf("%s: deleted document exists, err = %v", step, err)
+			}
+		}
+		check("before reopen")
+		db.Close()
+
+		var err error
+		if db, err = Open(config); err != nil {
+			t.Fatal(err)
+		}
+		check("after reopen")
+
+		if err = db.Reclaim(); err != nil {
+			t.Fatal(err)
+		}
+		check("after reclaim")
+		db.Close()
+
+		if db, err = Open(config); err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+		check("reopen after reclaim")
+	}
+
+	t.Run("KeyValueRamMode", func(t *testing.T) {
+		replay(t, KeyValueRamMode)
+	})
+
+	t.Run("KeyOnlyRamMode", func(t *testing.T) {
+		replay(t, KeyOnlyRamMode)
+	})
+}
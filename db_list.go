@@ -2,22 +2,78 @@ package kDB
 
 import (
 	"bytes"
+	"context"
 	"github.com/KarlvenK/kDB/ds/list"
 	"github.com/KarlvenK/kDB/storage"
 	"log"
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 )
 
 // ListIdx the list idx
 type ListIdx struct {
 	mu      sync.RWMutex
 	indexes *list.List
+	waiters map[string][]*listWaiter //blocked callers of each key, in FIFO order
+}
+
+// listWaiter 一个阻塞在若干列表上的调用者
+// a caller blocked on some lists, it is served by the push that makes one of them non-empty
+type listWaiter struct {
+	keys   []string
+	from   list.Direction
+	move   bool //move the element to dst instead of returning it only
+	dst    []byte
+	to     list.Direction
+	served bool
+	res    chan listPopResult //buffered, receives exactly one result once served
+}
+
+type listPopResult struct {
+	key   []byte
+	value []byte
+	err   error
+}
+
+// LPosOption LPos 的选项
+// the options of LPos
+type LPosOption struct {
+	// Rank 跳过前 |Rank|-1 个匹配的元素，为负数时从表尾开始查找，为0时视为1
+	// skips the first |Rank|-1 matches, searching from the tail if it is negative, 0 is taken as 1
+	Rank int
+
+	// Count 最多返回的下标个数，为0时返回所有匹配的下标
+	// the max number of indexes returned, all matches are returned if it is 0
+	Count int
+
+	// MaxLen 最多比较的元素个数，为0时比较整个列表
+	// the max number of elements compared, the whole list is compared if it is 0
+	MaxLen int
 }
 
 func newList() *ListIdx {
-	return &ListIdx{indexes: list.New()}
+	return &ListIdx{indexes: list.New(), waiters: make(map[string][]*listWaiter)}
+}
+
+//reclaimer 重放列表的操作，因为 pop 和 move 依赖之前的元素，快照为每个列表的所有元素
+//replays the list operations, since the pops and moves depend on the elements before them,
+//the snapshot is all elements of each list
+func (li *ListIdx) reclaimer() reclaimer {
+	lists := list.New()
+	return &replayReclaimer{
+		apply: func(e *storage.Entry) {
+			applyList(lists, string(e.Meta.Key), e.Mark, string(e.Meta.Extra), e.Meta.Value)
+		},
+		keys: lists.Keys,
+		dump: func(key string) (entries []*storage.Entry) {
+			for _, val := range lists.LRange(key, 0, -1) {
+				entries = append(entries, storage.NewEntryNoExtra([]byte(key), val, List, ListRPush))
+			}
+			return
+		},
+	}
 }
 
 // LPush insert all the specified values at the head of the list stored at key
@@ -29,6 +85,7 @@ func (db *kDB) LPush(key []byte, values ...[]byte) (res int, err error) {
 
 	db.listIndex.mu.Lock()
 	defer db.listIndex.mu.Unlock()
+	defer db.serveListWaiters(string(key))
 
 	for _, val := range values {
 		e := storage.NewEntryNoExtra(key, val, List, ListLPush)
@@ -50,6 +107,7 @@ func (db *kDB) RPush(key []byte, values ...[]byte) (res int, err error) {
 
 	db.listIndex.mu.Lock()
 	defer db.listIndex.mu.Unlock()
+	defer db.serveListWaiters(string(key))
 
 	for _, val := range values {
 		e := storage.NewEntryNoExtra(key, val, List, ListRPush)
@@ -142,6 +200,7 @@ func (db *kDB) LInsert(key string, option list.InsertOption, pivot, val []byte)
 
 	db.listIndex.mu.Lock()
 	defer db.listIndex.mu.Unlock()
+	defer db.serveListWaiters(key)
 
 	count = db.listIndex.indexes.LInsert(key, option, pivot, val)
 	if count != -1 {
@@ -220,3 +279,287 @@ func (db *kDB) LLen(key []byte) int {
 
 	return db.listIndex.indexes.LLen(string(key))
 }
+
+// LPushX 仅当列表存在时将所有的值插入到表头，返回列表的长度，列表不存在时返回0
+// Inserts the values at the head of the list stored at key, only if key already exists and holds a list.
+// Returns the length of the list, 0 if it does not exist.
+func (db *kDB) LPushX(key []byte, values ...[]byte) (int, error) {
+	return db.pushX(key, ListLPush, values...)
+}
+
+// RPushX 仅当列表存在时将所有的值插入到表尾，返回列表的长度，列表不存在时返回0
+// Inserts the values at the tail of the list stored at key, only if key already exists and holds a list.
+// Returns the length of the list, 0 if it does not exist.
+func (db *kDB) RPushX(key []byte, values ...[]byte) (int, error) {
+	return db.pushX(key, ListRPush, values...)
+}
+
+// LPopCount 从表头移除并返回最多count个元素，所有元素写入一条日志
+// Removes and returns at most count elements from the head of the list stored at key, which are logged as one entry.
+func (db *kDB) LPopCount(key []byte, count int) ([][]byte, error) {
+	return db.popCount(key, count, ListLPop)
+}
+
+// RPopCount 从表尾移除并返回最多count个元素，所有元素写入一条日志
+// Removes and returns at most count elements from the tail of the list stored at key, which are logged as one entry.
+func (db *kDB) RPopCount(key []byte, count int) ([][]byte, error) {
+	return db.popCount(key, count, ListRPop)
+}
+
+// LMove 从 src 的 from 端移除一个元素并插入到 dst 的 to 端，返回该元素，src 为空时返回nil
+// 移动作为一条日志写入，重启后不会出现元素已从 src 移除但不在 dst 中的情况
+// Atomically removes the element at the from end of src, and pushes it at the to end of dst.
+// Returns the element, nil if src is empty. The move is logged as one entry,
+// so the element is never popped from src but missing from dst after a crash.
+func (db *kDB) LMove(src, dst []byte, from, to list.Direction) ([]byte, error) {
+	if err := db.checkKeyValue(src, nil); err != nil {
+		return nil, err
+	}
+	if err := db.checkKeyValue(dst, nil); err != nil {
+		return nil, err
+	}
+
+	db.listIndex.mu.Lock()
+	defer db.listIndex.mu.Unlock()
+
+	if db.listIndex.indexes.LLen(string(src)) == 0 {
+		return nil, nil
+	}
+
+	val, err := db.lmove(src, dst, from, to)
+	if err != nil {
+		return nil, err
+	}
+	db.serveListWaiters(string(dst))
+	return val, nil
+}
+
+// RPopLPush 移除 src 的最后一个元素并插入到 dst 的表头，与 LMove(src, dst, list.Right, list.Left) 相同
+// Atomically removes the last element of src and pushes it at the head of dst, the same as LMove(src, dst, list.Right, list.Left).
+func (db *kDB) RPopLPush(src, dst []byte) ([]byte, error) {
+	return db.LMove(src, dst, list.Right, list.Left)
+}
+
+// LPos 返回列表中与 value 相等的元素的下标
+// Returns the indexes of the elements equal to value in the list stored at key, under the options.
+func (db *kDB) LPos(key, value []byte, opt LPosOption) ([]int, error) {
+	if err := db.checkKeyValue(key, value); err != nil {
+		return nil, err
+	}
+	if opt.Count < 0 || opt.MaxLen < 0 {
+		return nil, ErrInvalidLPosOption
+	}
+	if opt.Rank == 0 {
+		opt.Rank = 1
+	}
+
+	db.listIndex.mu.RLock()
+	defer db.listIndex.mu.RUnlock()
+
+	return db.listIndex.indexes.LPos(string(key), value, opt.Rank, opt.Count, opt.MaxLen), nil
+}
+
+func (db *kDB) pushX(key []byte, mark uint16, values ...[]byte) (int, error) {
+	if err := db.checkKeyValue(key, values...); err != nil {
+		return 0, err
+	}
+
+	db.listIndex.mu.Lock()
+	defer db.listIndex.mu.Unlock()
+
+	if db.listIndex.indexes.LLen(string(key)) == 0 || len(values) == 0 {
+		return db.listIndex.indexes.LLen(string(key)), nil
+	}
+	defer db.serveListWaiters(string(key))
+
+	entries := make([]*storage.Entry, len(values))
+	for i, val := range values {
+		entries[i] = storage.NewEntryNoExtra(key, val, List, mark)
+	}
+	if _, err := db.storeBatch(entries...); err != nil {
+		return 0, err
+	}
+
+	if mark == ListLPush {
+		return db.listIndex.indexes.LPush(string(key), values...), nil
+	}
+	return db.listIndex.indexes.RPush(string(key), values...), nil
+}
+
+func (db *kDB) popCount(key []byte, count int, mark uint16) ([][]byte, error) {
+	if err := db.checkKeyValue(key, nil); err != nil {
+		return nil, err
+	}
+
+	db.listIndex.mu.Lock()
+	defer db.listIndex.mu.Unlock()
+
+	if count <= 0 || db.listIndex.indexes.LLen(string(key)) == 0 {
+		return nil, nil
+	}
+
+	e := storage.NewEntry(key, nil, []byte(strconv.Itoa(count)), List, mark)
+	if err := db.store(e); err != nil {
+		return nil, err
+	}
+	if mark == ListLPop {
+		return db.listIndex.indexes.LPopCount(string(key), count), nil
+	}
+	return db.listIndex.indexes.RPopCount(string(key), count), nil
+}
+
+// BLPop LPop 的阻塞版本，返回第一个非空列表的键和表头元素
+// 所有列表都为空时阻塞，直到有元素被插入、超时或 ctx 结束，timeout 为0时一直等待到 ctx 结束
+// 多个调用者阻塞在同一个列表上时，按阻塞的先后顺序被唤醒，每插入一个元素只唤醒一个调用者
+// The blocking version of LPop, returns the key and the head element of the first non-empty list.
+// It blocks while all the lists are empty, until an element is pushed, the timeout expires or ctx is done.
+// A zero timeout waits until ctx is done. Callers blocked on the same list are served in FIFO order,
+// one caller per pushed element. Returns nil when the timeout expires, and ctx.Err() when ctx is done.
+func (db *kDB) BLPop(ctx context.Context, timeout time.Duration, keys ...[]byte) (key, value []byte, err error) {
+	return db.blockingPop(ctx, timeout, &listWaiter{from: list.Left}, keys...)
+}
+
+// BRPop RPop 的阻塞版本，返回第一个非空列表的键和表尾元素，其他同 BLPop
+// The blocking version of RPop, returns the key and the tail element of the first non-empty list, see BLPop.
+func (db *kDB) BRPop(ctx context.Context, timeout time.Duration, keys ...[]byte) (key, value []byte, err error) {
+	return db.blockingPop(ctx, timeout, &listWaiter{from: list.Right}, keys...)
+}
+
+// BLMove LMove 的阻塞版本，src 为空时阻塞，其他同 BLPop
+// The blocking version of LMove, it blocks while src is empty, see BLPop.
+func (db *kDB) BLMove(ctx context.Context, src, dst []byte, from, to list.Direction, timeout time.Duration) ([]byte, error) {
+	if err := db.checkKeyValue(dst, nil); err != nil {
+		return nil, err
+	}
+	w := &listWaiter{from: from, move: true, dst: dst, to: to}
+	_, val, err := db.blockingPop(ctx, timeout, w, src)
+	return val, err
+}
+
+func (db *kDB) blockingPop(ctx context.Context, timeout time.Duration, w *listWaiter, keys ...[]byte) ([]byte, []byte, error) {
+	if len(keys) == 0 {
+		return nil, nil, ErrWrongNumberOfArgs
+	}
+	for _, key := range keys {
+		if err := db.checkKeyValue(key, nil); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	idx := db.listIndex
+	idx.mu.Lock()
+	for _, key := range keys {
+		if idx.indexes.LLen(string(key)) > 0 {
+			val, err := db.popFor(w, string(key))
+			if err == nil && w.move {
+				db.serveListWaiters(string(w.dst))
+			}
+			idx.mu.Unlock()
+			return key, val, err
+		}
+	}
+
+	w.keys = keysToStrings(keys)
+	w.res = make(chan listPopResult, 1)
+	for _, key := range w.keys {
+		idx.waiters[key] = append(idx.waiters[key], w)
+	}
+	idx.mu.Unlock()
+
+	var expired <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+
+	var err error
+	select {
+	case r := <-w.res:
+		return r.key, r.value, r.err
+	case <-ctx.Done():
+		err = ctx.Err()
+	case <-db.done:
+		err = ErrDBClosed
+	case <-expired:
+	}
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	//the element has been popped for us in the meantime, return it rather than lose it
+	if w.served {
+		r := <-w.res
+		return r.key, r.value, r.err
+	}
+	idx.removeWaiter(w)
+	return nil, nil, err
+}
+
+// serveListWaiters 唤醒阻塞在 key 上的调用者，调用时需持有 listIndex 的锁
+// serves the callers blocked on key in FIFO order while it is not empty, listIndex.mu must be held.
+func (db *kDB) serveListWaiters(key string) {
+	idx := db.listIndex
+	ready := []string{key}
+	for len(ready) > 0 {
+		key, ready = ready[0], ready[1:]
+		for len(idx.waiters[key]) > 0 && idx.indexes.LLen(key) > 0 {
+			w := idx.waiters[key][0]
+			idx.removeWaiter(w)
+
+			val, err := db.popFor(w, key)
+			w.served = true
+			w.res <- listPopResult{key: []byte(key), value: val, err: err}
+			//the moved element may serve the callers blocked on dst
+			if err == nil && w.move && string(w.dst) != key {
+				ready = append(ready, string(w.dst))
+			}
+		}
+	}
+}
+
+// popFor pops an element from the non-empty list key for the waiter, and logs it as one entry
+func (db *kDB) popFor(w *listWaiter, key string) ([]byte, error) {
+	if w.move {
+		return db.lmove([]byte(key), w.dst, w.from, w.to)
+	}
+
+	mark, i := ListLPop, 0
+	if w.from == list.Right {
+		mark, i = ListRPop, -1
+	}
+	val := db.listIndex.indexes.LIndex(key, i)
+	e := storage.NewEntryNoExtra([]byte(key), val, List, mark)
+	if err := db.store(e); err != nil {
+		return nil, err
+	}
+	if mark == ListLPop {
+		return db.listIndex.indexes.LPop(key), nil
+	}
+	return db.listIndex.indexes.RPop(key), nil
+}
+
+func (db *kDB) lmove(src, dst []byte, from, to list.Direction) ([]byte, error) {
+	extra := strconv.Itoa(int(from)) + ExtraSeparator + strconv.Itoa(int(to))
+	e := storage.NewEntry(src, dst, []byte(extra), List, ListLMove)
+	if err := db.store(e); err != nil {
+		return nil, err
+	}
+	return db.listIndex.indexes.LMove(string(src), string(dst), from, to), nil
+}
+
+func (idx *ListIdx) removeWaiter(w *listWaiter) {
+	for _, key := range w.keys {
+		waiters := idx.waiters[key]
+		for i, other := range waiters {
+			if other == w {
+				waiters = append(waiters[:i], waiters[i+1:]...)
+				break
+			}
+		}
+		if len(waiters) == 0 {
+			delete(idx.waiters, key)
+		} else {
+			idx.waiters[key] = waiters
+		}
+	}
+}
@@ -1,9 +1,13 @@
 package kDB
 
 import (
+	"context"
 	"github.com/KarlvenK/kDB/ds/list"
 	"log"
+	"reflect"
+	"strconv"
 	"testing"
+	"time"
 )
 
 func TestKDB_LPush(t *testing.T) {
@@ -292,3 +296,373 @@ func TestKDB_LLen(t *testing.T) {
 	key := []byte("mylist")
 	db.LLen(key)
 }
+
+func listStrings(values [][]byte) []string {
+	res := make([]string, len(values))
+	for i, v := range values {
+		res[i] = string(v)
+	}
+	return res
+}
+
+func lrangeStrings(db *kDB, key []byte) []string {
+	values, _ := db.LRange(key, 0, -1)
+	return listStrings(values)
+}
+
+func TestKDB_LPushX(t *testing.T) {
+	db, _ := OpenDb(t, "/tmp/kdb/db-list", KeyValueRamMode)
+	defer db.Close()
+
+	key := []byte("my_list")
+	n, err := db.LPushX(key, []byte("a"))
+	if err != nil || n != 0 || db.LLen(key) != 0 {
+		t.Fatalf("LPushX on a missing list should do nothing, got %d, %v", n, err)
+	}
+
+	_, _ = db.RPush(key, []byte("b"))
+	if n, _ = db.LPushX(key, []byte("a")); n != 2 {
+		t.Errorf("expected 2, got %d", n)
+	}
+	if n, _ = db.RPushX(key, []byte("c"), []byte("d")); n != 4 {
+		t.Errorf("expected 4, got %d", n)
+	}
+	if n, _ = db.RPushX([]byte("missing"), []byte("c")); n != 0 {
+		t.Errorf("expected 0, got %d", n)
+	}
+
+	want := []string{"a", "b", "c", "d"}
+	if got := lrangeStrings(db, key); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
+
+func TestKDB_LPopCount(t *testing.T) {
+	db, _ := OpenDb(t, "/tmp/kdb/db-list", KeyValueRamMode)
+	defer db.Close()
+
+	key := []byte("my_list")
+	_, _ = db.RPush(key, []byte("a"), []byte("b"), []byte("c"), []byte("d"))
+
+	vals, err := db.LPopCount(key, 2)
+	if err != nil || !reflect.DeepEqual(listStrings(vals), []string{"a", "b"}) {
+		t.Errorf("unexpected LPopCount result %v, %v", listStrings(vals), err)
+	}
+	vals, _ = db.RPopCount(key, 5)
+	if !reflect.DeepEqual(listStrings(vals), []string{"d", "c"}) {
+		t.Errorf("unexpected RPopCount result %v", listStrings(vals))
+	}
+	if vals, _ = db.LPopCount(key, 1); vals != nil {
+		t.Errorf("expected nil from an empty list, got %v", listStrings(vals))
+	}
+}
+
+func TestKDB_LMove(t *testing.T) {
+	db, _ := OpenDb(t, "/tmp/kdb/db-list", KeyValueRamMode)
+	defer db.Close()
+
+	src, dst := []byte("src"), []byte("dst")
+	_, _ = db.RPush(src, []byte("a"), []byte("b"), []byte("c"))
+
+	val, err := db.LMove(src, dst, list.Left, list.Right)
+	if err != nil || string(val) != "a" {
+		t.Errorf("expected a, got %s, %v", val, err)
+	}
+	if val, _ = db.RPopLPush(src, dst); string(val) != "c" {
+		t.Errorf("expected c, got %s", val)
+	}
+	if got := lrangeStrings(db, dst); !reflect.DeepEqual(got, []string{"c", "a"}) {
+		t.Errorf("unexpected dst %v", got)
+	}
+
+	//rotate a list by moving to itself
+	_, _ = db.RPush(dst, []byte("b"))
+	_, _ = db.LMove(dst, dst, list.Right, list.Left)
+	if got := lrangeStrings(db, dst); !reflect.DeepEqual(got, []string{"b", "c", "a"}) {
+		t.Errorf("unexpected rotated list %v", got)
+	}
+
+	_, _ = db.LPop(src)
+	if val, _ = db.LMove(src, dst, list.Left, list.Left); val != nil {
+		t.Errorf("expected nil from an empty src, got %s", val)
+	}
+}
+
+func TestKDB_LPos(t *testing.T) {
+	db, _ := OpenDb(t, "/tmp/kdb/db-list", KeyValueRamMode)
+	defer db.Close()
+
+	key := []byte("my_list")
+	for _, v := range []string{"a", "b", "c", "1", "2", "3", "c", "c"} {
+		_, _ = db.RPush(key, []byte(v))
+	}
+
+	tests := []struct {
+		opt  LPosOption
+		want []int
+	}{
+		{LPosOption{Count: 1}, []int{2}},
+		{LPosOption{Rank: 2, Count: 1}, []int{6}},
+		{LPosOption{Rank: -1, Count: 1}, []int{7}},
+		{LPosOption{}, []int{2, 6, 7}},
+		{LPosOption{Count: 2}, []int{2, 6}},
+		{LPosOption{Rank: -1, Count: 0}, []int{7, 6, 2}},
+		{LPosOption{Count: 0, MaxLen: 7}, []int{2, 6}},
+		{LPosOption{Rank: 4}, nil},
+	}
+	for _, tt := range tests {
+		got, err := db.LPos(key, []byte("c"), tt.opt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != len(tt.want) || (len(got) > 0 && !reflect.DeepEqual(got, tt.want)) {
+			t.Errorf("LPos(%+v) expected %v, got %v", tt.opt, tt.want, got)
+		}
+	}
+
+	if _, err := db.LPos(key, []byte("c"), LPosOption{Count: -1}); err != ErrInvalidLPosOption {
+		t.Errorf("expected ErrInvalidLPosOption, got %v", err)
+	}
+}
+
+func TestKDB_ListReplay(t *testing.T) {
+	replay := func(t *testing.T, mode DataIndexMode) {
+		db, config := OpenDb(t, "/tmp/kdb/db-list-replay", mode)
+
+		keys := [][]byte{[]byte("l1"), []byte("l2"), []byte("l3")}
+		//enough operations to fill the archived files, the last ones are in the active file
+		for i := 0; i < 3000; i++ {
+			val := []byte("v" + strconv.Itoa(i%50))
+			key := keys[i%3]
+			switch i % 9 {
+			case 0, 1:
+				_, _ = db.RPush(key, val)
+			case 2:
+				_, _ = db.LPush(key, val, []byte("x"))
+			case 3:
+				_, _ = db.LPop(key)
+			case 4:
+				_, _ = db.LMove(key, keys[(i+1)%3], list.Direction(i%2), list.Direction((i/2)%2))
+			case 5:
+				_, _ = db.RPopLPush(key, key)
+			case 6:
+				_, _ = db.LPopCount(key, 2)
+				_, _ = db.RPopCount(keys[(i+2)%3], 1)
+			case 7:
+				_, _ = db.LRem(key, []byte("x"), 1)
+				_, _ = db.RPushX(key, val)
+			default:
+				_ = db.LTrim(key, 0, 30)
+			}
+		}
+		if len(db.archFiles) == 0 {
+			t.Fatal("expected archived files")
+		}
+
+		want := make(map[string][]string)
+		for _, k := range keys {
+			want[string(k)] = lrangeStrings(db, k)
+		}
+		check := func(step string) {
+			for _, k := range keys {
+				if got := lrangeStrings(db, k); !reflect.DeepEqual(got, want[string(k)]) {
+					t.Errorf("%s: list %s is not rebuilt correctly", step, k)
+				}
+			}
+		}
+		check("before reopen")
+		db.Close()
+
+		var err error
+		if db, err = Open(config); err != nil {
+			t.Fatal(err)
+		}
+		check("after reopen")
+
+		if err = db.Reclaim(); err != nil {
+			t.Fatal(err)
+		}
+		check("after reclaim")
+		db.Close()
+
+		if db, err = Open(config); err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+		check("reopen after reclaim")
+	}
+
+	t.Run("KeyValueRamMode", func(t *testing.T) {
+		replay(t, KeyValueRamMode)
+	})
+
+	t.Run("KeyOnlyRamMode", func(t *testing.T) {
+		replay(t, KeyOnlyRamMode)
+	})
+}
+
+//waitListWaiters waits until n callers are blocked on key
+func waitListWaiters(t *testing.T, db *kDB, key string, n int) {
+	for i := 0; i < 1000; i++ {
+		db.listIndex.mu.RLock()
+		blocked := len(db.listIndex.waiters[key])
+		db.listIndex.mu.RUnlock()
+		if blocked == n {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("expected %d callers blocked on %s", n, key)
+}
+
+func TestKDB_BLPop(t *testing.T) {
+	db, _ := OpenDb(t, "/tmp/kdb/db-list", KeyValueRamMode)
+	defer db.Close()
+	ctx := context.Background()
+
+	t.Run("non-empty", func(t *testing.T) {
+		_, _ = db.RPush([]byte("l2"), []byte("a"), []byte("b"))
+		key, val, err := db.BLPop(ctx, time.Second, []byte("l1"), []byte("l2"))
+		if err != nil || string(key) != "l2" || string(val) != "a" {
+			t.Errorf("expected l2 a, got %s %s %v", key, val, err)
+		}
+		if _, val, _ = db.BRPop(ctx, time.Second, []byte("l2")); string(val) != "b" {
+			t.Errorf("expected b, got %s", val)
+		}
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		key, val, err := db.BLPop(ctx, 10*time.Millisecond, []byte("empty"))
+		if err != nil || key != nil || val != nil {
+			t.Errorf("expected nil on timeout, got %s %s %v", key, val, err)
+		}
+		if len(db.listIndex.waiters) != 0 {
+			t.Error("the caller is still blocked after the timeout")
+		}
+	})
+
+	t.Run("cancel", func(t *testing.T) {
+		cctx, cancel := context.WithCancel(ctx)
+		go func() {
+			waitListWaiters(t, db, "empty", 1)
+			cancel()
+		}()
+		if _, _, err := db.BLPop(cctx, 0, []byte("empty")); err != context.Canceled {
+			t.Errorf("expected context.Canceled, got %v", err)
+		}
+	})
+
+	t.Run("fifo", func(t *testing.T) {
+		key := []byte("queue")
+		results := make(chan string, 3)
+		for i := 0; i < 3; i++ {
+			go func(i int) {
+				_, val, err := db.BLPop(ctx, 0, key)
+				if err != nil {
+					t.Error(err)
+				}
+				results <- strconv.Itoa(i) + string(val)
+			}(i)
+			waitListWaiters(t, db, string(key), i+1)
+		}
+
+		//two elements wake exactly the first two callers
+		_, _ = db.RPush(key, []byte("a"), []byte("b"))
+		got := []string{<-results, <-results}
+		if !((got[0] == "0a" && got[1] == "1b") || (got[0] == "1b" && got[1] == "0a")) {
+			t.Errorf("unexpected wake up order %v", got)
+		}
+		waitListWaiters(t, db, string(key), 1)
+		if db.LLen(key) != 0 {
+			t.Errorf("expected the pushed elements to be popped, got length %d", db.LLen(key))
+		}
+
+		_, _ = db.LPush(key, []byte("c"))
+		if got := <-results; got != "2c" {
+			t.Errorf("expected 2c, got %s", got)
+		}
+	})
+
+	t.Run("multiple keys", func(t *testing.T) {
+		done := make(chan string, 1)
+		go func() {
+			key, val, _ := db.BRPop(ctx, 0, []byte("k1"), []byte("k2"))
+			done <- string(key) + string(val)
+		}()
+		waitListWaiters(t, db, "k2", 1)
+		_, _ = db.RPush([]byte("k2"), []byte("v"))
+		if got := <-done; got != "k2v" {
+			t.Errorf("expected k2v, got %s", got)
+		}
+		if len(db.listIndex.waiters) != 0 {
+			t.Error("the served caller is still blocked on k1")
+		}
+	})
+}
+
+func TestKDB_BLMove(t *testing.T) {
+	db, config := OpenDb(t, "/tmp/kdb/db-list", KeyValueRamMode)
+	ctx := context.Background()
+
+	src, dst := []byte("src"), []byte("dst")
+	moved := make(chan string, 1)
+	go func() {
+		val, err := db.BLMove(ctx, src, dst, list.Left, list.Right, 0)
+		if err != nil {
+			t.Error(err)
+		}
+		moved <- string(val)
+	}()
+	waitListWaiters(t, db, "src", 1)
+
+	//the moved element serves the caller blocked on dst
+	popped := make(chan string, 1)
+	go func() {
+		_, val, _ := db.BLPop(ctx, 0, dst)
+		popped <- string(val)
+	}()
+	waitListWaiters(t, db, "dst", 1)
+
+	_, _ = db.RPush(src, []byte("a"), []byte("b"))
+	if got := <-moved; got != "a" {
+		t.Errorf("expected a, got %s", got)
+	}
+	if got := <-popped; got != "a" {
+		t.Errorf("expected a, got %s", got)
+	}
+
+	val, err := db.BLMove(ctx, src, dst, list.Left, list.Left, time.Second)
+	if err != nil || string(val) != "b" {
+		t.Errorf("expected b, got %s %v", val, err)
+	}
+	if val, _ = db.BLMove(ctx, src, dst, list.Left, list.Left, 10*time.Millisecond); val != nil {
+		t.Errorf("expected nil on timeout, got %s", val)
+	}
+	db.Close()
+
+	if db, err = Open(config); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if got := lrangeStrings(db, dst); !reflect.DeepEqual(got, []string{"b"}) {
+		t.Errorf("unexpected dst after reopen %v", got)
+	}
+	if db.LLen(src) != 0 {
+		t.Errorf("expected an empty src after reopen, got length %d", db.LLen(src))
+	}
+}
+
+func TestKDB_BLPopClose(t *testing.T) {
+	db, _ := OpenDb(t, "/tmp/kdb/db-list", KeyValueRamMode)
+
+	done := make(chan error, 1)
+	go func() {
+		_, _, err := db.BLPop(context.Background(), 0, []byte("empty"))
+		done <- err
+	}()
+	waitListWaiters(t, db, "empty", 1)
+	db.Close()
+	if err := <-done; err != ErrDBClosed {
+		t.Errorf("expected ErrDBClosed, got %v", err)
+	}
+}
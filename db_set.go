@@ -16,6 +16,12 @@ func newSetIdx() *SetIdx {
 	return &SetIdx{indexes: set.New()}
 }
 
+//reclaimer 保留有效的集合 entry
+//keeps the valid set entries
+func (si *SetIdx) reclaimer() reclaimer {
+	return validReclaimer{}
+}
+
 //SAdd Add the specified members to the set stored at key.
 // Specified members that are already a member of this set are ignored.
 // If key does not exist, a new set is created before adding the specified members.
@@ -180,3 +186,101 @@ func (db *kDB) SDiff(keys ...[]byte) (val [][]byte) {
 
 	return db.setIndex.indexes.SDiff(s...)
 }
+
+// SInter 返回给定全部集合数据的交集
+// Returns the members of the set resulting from the intersection of all the given sets.
+func (db *kDB) SInter(keys ...[]byte) (val [][]byte) {
+	if len(keys) == 0 {
+		return
+	}
+
+	db.setIndex.mu.RLock()
+	defer db.setIndex.mu.RUnlock()
+
+	return db.setIndex.indexes.SInter(keysToStrings(keys)...)
+}
+
+// SInterCard 返回交集的元素个数，limit 大于0时最多计数到limit
+// Returns the cardinality of the intersection of all the given sets, counting stops at limit if it is positive.
+func (db *kDB) SInterCard(limit int, keys ...[]byte) int {
+	if len(keys) == 0 {
+		return 0
+	}
+
+	db.setIndex.mu.RLock()
+	defer db.setIndex.mu.RUnlock()
+
+	return db.setIndex.indexes.SInterCard(limit, keysToStrings(keys)...)
+}
+
+// SMIsMember 判断多个 member 元素是不是集合 key 的成员
+// Returns whether each member is a member of the set stored at key.
+func (db *kDB) SMIsMember(key []byte, members ...[]byte) []bool {
+	if err := db.checkKeyValue(key, nil); err != nil {
+		return make([]bool, len(members))
+	}
+
+	db.setIndex.mu.RLock()
+	defer db.setIndex.mu.RUnlock()
+
+	return db.setIndex.indexes.SMIsMember(string(key), members...)
+}
+
+// SUnionStore 将给定集合的并集保存到 dst 集合，dst 已存在时被覆盖，返回结果集的元素个数
+// Stores the union of all the given sets in dst, which is overwritten if it exists.
+// Returns the number of members in the resulting set.
+func (db *kDB) SUnionStore(dst []byte, keys ...[]byte) (int, error) {
+	return db.setStore(dst, keys, db.setIndex.indexes.SUnion)
+}
+
+// SInterStore 将给定集合的交集保存到 dst 集合，dst 已存在时被覆盖，返回结果集的元素个数
+// Stores the intersection of all the given sets in dst, which is overwritten if it exists.
+// Returns the number of members in the resulting set.
+func (db *kDB) SInterStore(dst []byte, keys ...[]byte) (int, error) {
+	return db.setStore(dst, keys, db.setIndex.indexes.SInter)
+}
+
+// SDiffStore 将给定集合的差集保存到 dst 集合，dst 已存在时被覆盖，返回结果集的元素个数
+// Stores the difference between the first set and all the successive sets in dst, which is overwritten if it exists.
+// Returns the number of members in the resulting set.
+func (db *kDB) SDiffStore(dst []byte, keys ...[]byte) (int, error) {
+	return db.setStore(dst, keys, db.setIndex.indexes.SDiff)
+}
+
+// setStore 计算结果集并将清空 dst 和添加成员作为一个批次写入，结果为空时 dst 被删除
+// computes the resulting set, and writes clearing dst and adding the members in one batch.
+// dst is deleted if the resulting set is empty.
+func (db *kDB) setStore(dst []byte, keys [][]byte, op func(keys ...string) [][]byte) (int, error) {
+	if err := db.checkKeyValue(dst, nil); err != nil {
+		return 0, err
+	}
+	if len(keys) == 0 {
+		return 0, ErrWrongNumberOfArgs
+	}
+
+	db.setIndex.mu.Lock()
+	defer db.setIndex.mu.Unlock()
+
+	members := op(keysToStrings(keys)...)
+	entries := []*storage.Entry{storage.NewEntryNoExtra(dst, nil, Set, SetSClear)}
+	for _, m := range members {
+		entries = append(entries, storage.NewEntryNoExtra(dst, m, Set, SetSAdd))
+	}
+	if _, err := db.storeBatch(entries...); err != nil {
+		return 0, err
+	}
+
+	db.setIndex.indexes.SClear(string(dst))
+	for _, m := range members {
+		db.setIndex.indexes.SAdd(string(dst), m)
+	}
+	return len(members), nil
+}
+
+func keysToStrings(keys [][]byte) []string {
+	s := make([]string, len(keys))
+	for i, k := range keys {
+		s[i] = string(k)
+	}
+	return s
+}
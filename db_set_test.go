@@ -1,6 +1,9 @@
 package kDB
 
 import (
+	"reflect"
+	"sort"
+	"strconv"
 	"testing"
 )
 
@@ -102,6 +105,27 @@ func TestKDB_SRem(t *testing.T) {
 	t.Log(db.SRem(key, []byte("not exist one")))
 }
 
+func TestKDB_SRemReplay(t *testing.T) {
+	db, config := OpenDb(t, "/tmp/kdb/db-set-srem", KeyValueRamMode)
+
+	key := []byte("my_set")
+	_, _ = db.SAdd(key, []byte("a"), []byte("b"), []byte("c"))
+	if res, err := db.SRem(key, []byte("a"), []byte("c"), []byte("not exist")); err != nil || res != 2 {
+		t.Errorf("expected 2 removed members, got %d %v", res, err)
+	}
+	_ = db.Close()
+
+	//the removals are logged, so the members do not come back after reopen
+	var err error
+	if db, err = Reopen(config.DirPath); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if got := sortedMembers(db.SMembers(key)); !reflect.DeepEqual(got, []string{"b"}) {
+		t.Errorf("expected [b] after reopen, got %v", got)
+	}
+}
+
 func TestKDB_SRandMember(t *testing.T) {
 	db := ReopenDb()
 	defer db.Close()
@@ -160,3 +184,145 @@ func TestKDB_SUnion(t *testing.T) {
 	db.SUnion(emptyKeys...)
 	db.SUnion(keys...)
 }
+
+func sortedMembers(members [][]byte) []string {
+	res := make([]string, len(members))
+	for i, m := range members {
+		res[i] = string(m)
+	}
+	sort.Strings(res)
+	return res
+}
+
+func TestKDB_SInter(t *testing.T) {
+	db, _ := OpenDb(t, "/tmp/kdb/db-set", KeyValueRamMode)
+	defer db.Close()
+
+	_, _ = db.SAdd([]byte("s1"), []byte("a"), []byte("b"), []byte("c"), []byte("d"))
+	_, _ = db.SAdd([]byte("s2"), []byte("b"), []byte("c"), []byte("e"))
+	_, _ = db.SAdd([]byte("s3"), []byte("c"), []byte("b"))
+
+	if got := sortedMembers(db.SInter([]byte("s1"), []byte("s2"), []byte("s3"))); !reflect.DeepEqual(got, []string{"b", "c"}) {
+		t.Errorf("unexpected intersection %v", got)
+	}
+	if got := db.SInter([]byte("s1"), []byte("not_exist")); len(got) != 0 {
+		t.Errorf("unexpected intersection %v", got)
+	}
+	if n := db.SInterCard(0, []byte("s1"), []byte("s2")); n != 2 {
+		t.Errorf("expected card 2, got %d", n)
+	}
+	if n := db.SInterCard(1, []byte("s1"), []byte("s2")); n != 1 {
+		t.Errorf("expected card 1 with limit, got %d", n)
+	}
+
+	res := db.SMIsMember([]byte("s2"), []byte("e"), []byte("a"))
+	if !reflect.DeepEqual(res, []bool{true, false}) {
+		t.Errorf("unexpected result %v", res)
+	}
+}
+
+func TestKDB_SStore(t *testing.T) {
+	db, _ := OpenDb(t, "/tmp/kdb/db-set", KeyValueRamMode)
+	defer db.Close()
+
+	_, _ = db.SAdd([]byte("s1"), []byte("a"), []byte("b"), []byte("c"))
+	_, _ = db.SAdd([]byte("s2"), []byte("b"), []byte("d"))
+	_, _ = db.SAdd([]byte("dst"), []byte("old"))
+
+	tests := []struct {
+		name  string
+		store func(dst []byte, keys ...[]byte) (int, error)
+		want  []string
+	}{
+		{"union", db.SUnionStore, []string{"a", "b", "c", "d"}},
+		{"inter", db.SInterStore, []string{"b"}},
+		{"diff", db.SDiffStore, []string{"a", "c"}},
+	}
+	for _, tt := range tests {
+		n, err := tt.store([]byte("dst"), []byte("s1"), []byte("s2"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := sortedMembers(db.SMembers([]byte("dst"))); n != len(tt.want) || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %d %v, want %v", tt.name, n, got, tt.want)
+		}
+	}
+
+	//dst can be one of the sources
+	if n, _ := db.SInterStore([]byte("s1"), []byte("s1"), []byte("s2")); n != 1 || !db.SIsMember([]byte("s1"), []byte("b")) {
+		t.Error("s1 should be overwritten by the intersection")
+	}
+	if n, _ := db.SInterStore([]byte("dst"), []byte("s1"), []byte("not_exist")); n != 0 || db.SCard([]byte("dst")) != 0 {
+		t.Error("dst should be deleted by an empty result")
+	}
+	if _, err := db.SUnionStore([]byte("dst")); err != ErrWrongNumberOfArgs {
+		t.Errorf("expected ErrWrongNumberOfArgs, got %v", err)
+	}
+}
+
+func TestKDB_SetStoreReplay(t *testing.T) {
+	replay := func(t *testing.T, mode DataIndexMode) {
+		db, config := OpenDb(t, "/tmp/kdb/db-set-replay", mode)
+
+		keys := [][]byte{[]byte("s1"), []byte("s2"), []byte("s3")}
+		//enough operations to fill the archived files, the last ones are in the active file
+		for i := 0; i < 3000; i++ {
+			member := []byte("m" + strconv.Itoa(i%40))
+			switch i % 5 {
+			case 0, 1:
+				_, _ = db.SAdd(keys[i%3], member)
+			case 2:
+				_, _ = db.SRem(keys[(i+1)%3], member)
+			case 3:
+				_, _ = db.SUnionStore([]byte("union"), keys[i%3], keys[(i+1)%3])
+			default:
+				_, _ = db.SDiffStore(keys[i%3], keys[i%3], []byte("union"))
+				_, _ = db.SInterStore([]byte("inter"), keys...)
+			}
+		}
+		if len(db.archFiles) == 0 {
+			t.Fatal("expected archived files")
+		}
+
+		all := append(keys, []byte("union"), []byte("inter"))
+		want := make(map[string][]string)
+		for _, k := range all {
+			want[string(k)] = sortedMembers(db.SMembers(k))
+		}
+		check := func(step string) {
+			for _, k := range all {
+				if got := sortedMembers(db.SMembers(k)); !reflect.DeepEqual(got, want[string(k)]) {
+					t.Errorf("%s: set %s is not rebuilt correctly", step, k)
+				}
+			}
+		}
+		check("before reopen")
+		db.Close()
+
+		var err error
+		if db, err = Open(config); err != nil {
+			t.Fatal(err)
+		}
+		check("after reopen")
+
+		if err = db.Reclaim(); err != nil {
+			t.Fatal(err)
+		}
+		check("after reclaim")
+		db.Close()
+
+		if db, err = Open(config); err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+		check("reopen after reclaim")
+	}
+
+	t.Run("KeyValueRamMode", func(t *testing.T) {
+		replay(t, KeyValueRamMode)
+	})
+
+	t.Run("KeyOnlyRamMode", func(t *testing.T) {
+		replay(t, KeyOnlyRamMode)
+	})
+}
@@ -0,0 +1,313 @@
+package kDB
+
+import (
+	"github.com/KarlvenK/kDB/ds/sketch"
+	"github.com/KarlvenK/kDB/storage"
+	"strconv"
+	"sync"
+)
+
+// SketchIdx the count-min sketch and top-k idx
+type SketchIdx struct {
+	mu      sync.RWMutex
+	indexes *sketch.Sketches
+}
+
+func newSketchIdx() *SketchIdx {
+	return &SketchIdx{indexes: sketch.New()}
+}
+
+//reclaimer 重放 sketch 的操作，快照为每个 sketch 的 dump
+//replays the sketch operations, the snapshot is the dump of each sketch
+func (si *SketchIdx) reclaimer() reclaimer {
+	sketches := sketch.New()
+	return &replayReclaimer{
+		apply: func(e *storage.Entry) {
+			applySketch(sketches, string(e.Meta.Key), e.Mark, e.Meta.Extra, e.Meta.Value)
+		},
+		keys: sketches.Keys,
+		dump: func(key string) []*storage.Entry {
+			return []*storage.Entry{storage.NewEntryNoExtra([]byte(key), sketches.Dump(key), Sketch, SketchRestore)}
+		},
+	}
+}
+
+// CMSInitByDim 以给定的宽度和深度创建Count-Min Sketch
+// Creates a count-min sketch with width counters in each of depth rows.
+func (db *kDB) CMSInitByDim(key []byte, width, depth uint64) error {
+	if err := db.checkKeyValue(key, nil); err != nil {
+		return err
+	}
+	if width == 0 || depth == 0 {
+		return sketch.ErrInvalidParams
+	}
+
+	db.sketchIndex.mu.Lock()
+	defer db.sketchIndex.mu.Unlock()
+
+	if db.sketchIndex.indexes.Exists(string(key)) {
+		return sketch.ErrSketchExists
+	}
+
+	extra := strconv.FormatUint(width, 10) + ExtraSeparator + strconv.FormatUint(depth, 10)
+	e := storage.NewEntry(key, nil, []byte(extra), Sketch, SketchCMSInit)
+	if err := db.store(e); err != nil {
+		return err
+	}
+	return db.sketchIndex.indexes.CMSInitByDim(string(key), width, depth)
+}
+
+// CMSInitByProb 根据误差和概率创建Count-Min Sketch，估计值以probability的概率超过真实值 errorRate * 总数
+// Creates a count-min sketch whose estimation exceeds the real count by errorRate * total with probability.
+func (db *kDB) CMSInitByProb(key []byte, errorRate, probability float64) error {
+	width, depth, err := sketch.CMSDimByProb(errorRate, probability)
+	if err != nil {
+		return err
+	}
+	return db.CMSInitByDim(key, width, depth)
+}
+
+// CMSIncrBy 将元素的计数加上increment，返回新的估计值
+// Increments the count of the item, returns the new estimated count.
+func (db *kDB) CMSIncrBy(key, item []byte, increment uint64) (uint64, error) {
+	if err := db.checkKeyValue(key, item); err != nil {
+		return 0, err
+	}
+
+	db.sketchIndex.mu.Lock()
+	defer db.sketchIndex.mu.Unlock()
+
+	if err := db.checkCountMin(key); err != nil {
+		return 0, err
+	}
+
+	e := storage.NewEntry(key, item, []byte(strconv.FormatUint(increment, 10)), Sketch, SketchCMSIncrBy)
+	if err := db.store(e); err != nil {
+		return 0, err
+	}
+	return db.sketchIndex.indexes.CMSIncrBy(string(key), item, increment)
+}
+
+// CMSQuery 返回元素计数的估计值
+// Returns the estimated counts of the items.
+func (db *kDB) CMSQuery(key []byte, items ...[]byte) ([]uint64, error) {
+	if err := db.checkKeyValue(key, items...); err != nil {
+		return nil, err
+	}
+
+	db.sketchIndex.mu.RLock()
+	defer db.sketchIndex.mu.RUnlock()
+
+	if err := db.checkCountMin(key); err != nil {
+		return nil, err
+	}
+
+	res := make([]uint64, len(items))
+	for i, item := range items {
+		res[i], _ = db.sketchIndex.indexes.CMSQuery(string(key), item)
+	}
+	return res, nil
+}
+
+// CMSMerge 将sources按权重合并到dest，dest原来的计数被覆盖，weights为nil时权重均为1
+// 所有sketch的宽度和深度必须相同，日志中记录合并后的整个dest
+// Merges the sources with weights into dest, overwriting the counts of dest, the weights are all 1 if nil.
+// All sketches must have the same width and depth. The whole merged dest is logged.
+func (db *kDB) CMSMerge(dest []byte, sources [][]byte, weights []uint64) error {
+	if err := db.checkKeyValue(dest, sources...); err != nil {
+		return err
+	}
+
+	db.sketchIndex.mu.Lock()
+	defer db.sketchIndex.mu.Unlock()
+
+	keys := toStrings(sources)
+	for _, key := range append(keys, string(dest)) {
+		if !db.sketchIndex.indexes.Exists(key) {
+			return ErrKeyNotExist
+		}
+	}
+
+	//merge into a copy, so that dest is not changed if logging fails
+	tmp := sketch.New()
+	for _, key := range append(keys, string(dest)) {
+		_ = tmp.Restore(key, db.sketchIndex.indexes.Dump(key))
+	}
+	if err := tmp.CMSMerge(string(dest), keys, weights); err != nil {
+		return err
+	}
+
+	e := storage.NewEntryNoExtra(dest, tmp.Dump(string(dest)), Sketch, SketchRestore)
+	if err := db.store(e); err != nil {
+		return err
+	}
+	return db.sketchIndex.indexes.Restore(string(dest), e.Meta.Value)
+}
+
+// TopKReserve 创建一个保存k个元素的Top-K，width、depth 和 decay 为 0 时使用默认值
+// Creates a Top-K keeping k items, the default width, depth and decay are used if they are 0.
+func (db *kDB) TopKReserve(key []byte, k, width, depth uint64, decay float64) error {
+	if err := db.checkKeyValue(key, nil); err != nil {
+		return err
+	}
+	if width == 0 {
+		width = sketch.DefaultTopKWidth
+	}
+	if depth == 0 {
+		depth = sketch.DefaultTopKDepth
+	}
+	if decay == 0 {
+		decay = sketch.DefaultTopKDecay
+	}
+	if k == 0 || decay < 0 || decay > 1 {
+		return sketch.ErrInvalidParams
+	}
+
+	db.sketchIndex.mu.Lock()
+	defer db.sketchIndex.mu.Unlock()
+
+	if db.sketchIndex.indexes.Exists(string(key)) {
+		return sketch.ErrSketchExists
+	}
+
+	extra := strconv.FormatUint(k, 10) + ExtraSeparator + strconv.FormatUint(width, 10) + ExtraSeparator +
+		strconv.FormatUint(depth, 10) + ExtraSeparator + strconv.FormatFloat(decay, 'g', -1, 64)
+	e := storage.NewEntry(key, nil, []byte(extra), Sketch, SketchTopKReserve)
+	if err := db.store(e); err != nil {
+		return err
+	}
+	return db.sketchIndex.indexes.TopKReserve(string(key), k, width, depth, decay)
+}
+
+// TopKAdd 添加元素，返回每个元素添加时被挤出Top-K的元素，没有时为nil
+// Adds the items, returns the item expelled from the Top-K by each item, nil if nothing is expelled.
+func (db *kDB) TopKAdd(key []byte, items ...[]byte) ([][]byte, error) {
+	if err := db.checkKeyValue(key, items...); err != nil {
+		return nil, err
+	}
+	if len(items) == 0 {
+		return nil, ErrWrongNumberOfArgs
+	}
+
+	db.sketchIndex.mu.Lock()
+	defer db.sketchIndex.mu.Unlock()
+
+	if err := db.checkTopK(key); err != nil {
+		return nil, err
+	}
+
+	entries := make([]*storage.Entry, len(items))
+	for i, item := range items {
+		entries[i] = storage.NewEntry(key, item, []byte("1"), Sketch, SketchTopKIncrBy)
+	}
+	if _, err := db.storeBatch(entries...); err != nil {
+		return nil, err
+	}
+
+	res := make([][]byte, len(items))
+	for i, item := range items {
+		res[i], _ = db.sketchIndex.indexes.TopKIncrBy(string(key), item, 1)
+	}
+	return res, nil
+}
+
+// TopKIncrBy 将元素的计数加上increment，返回被挤出Top-K的元素，没有时为nil
+// Increments the count of the item, returns the item expelled from the Top-K, nil if nothing is expelled.
+func (db *kDB) TopKIncrBy(key, item []byte, increment uint64) ([]byte, error) {
+	if err := db.checkKeyValue(key, item); err != nil {
+		return nil, err
+	}
+
+	db.sketchIndex.mu.Lock()
+	defer db.sketchIndex.mu.Unlock()
+
+	if err := db.checkTopK(key); err != nil {
+		return nil, err
+	}
+
+	e := storage.NewEntry(key, item, []byte(strconv.FormatUint(increment, 10)), Sketch, SketchTopKIncrBy)
+	if err := db.store(e); err != nil {
+		return nil, err
+	}
+	return db.sketchIndex.indexes.TopKIncrBy(string(key), item, increment)
+}
+
+// TopKQuery 判断元素是否在Top-K中
+// Returns whether each item is in the Top-K.
+func (db *kDB) TopKQuery(key []byte, items ...[]byte) ([]bool, error) {
+	if err := db.checkKeyValue(key, items...); err != nil {
+		return nil, err
+	}
+
+	db.sketchIndex.mu.RLock()
+	defer db.sketchIndex.mu.RUnlock()
+
+	if err := db.checkTopK(key); err != nil {
+		return nil, err
+	}
+
+	res := make([]bool, len(items))
+	for i, item := range items {
+		res[i], _ = db.sketchIndex.indexes.TopKQuery(string(key), item)
+	}
+	return res, nil
+}
+
+// TopKCount 返回元素计数的估计值
+// Returns the estimated counts of the items.
+func (db *kDB) TopKCount(key []byte, items ...[]byte) ([]uint64, error) {
+	if err := db.checkKeyValue(key, items...); err != nil {
+		return nil, err
+	}
+
+	db.sketchIndex.mu.RLock()
+	defer db.sketchIndex.mu.RUnlock()
+
+	if err := db.checkTopK(key); err != nil {
+		return nil, err
+	}
+
+	res := make([]uint64, len(items))
+	for i, item := range items {
+		res[i], _ = db.sketchIndex.indexes.TopKCount(string(key), item)
+	}
+	return res, nil
+}
+
+// TopKList 返回Top-K中的元素和计数，按计数从大到小排列
+// Returns the items in the Top-K with their counts, ordered by count from the greatest.
+func (db *kDB) TopKList(key []byte) ([]sketch.Item, error) {
+	if err := db.checkKeyValue(key, nil); err != nil {
+		return nil, err
+	}
+
+	db.sketchIndex.mu.RLock()
+	defer db.sketchIndex.mu.RUnlock()
+
+	if err := db.checkTopK(key); err != nil {
+		return nil, err
+	}
+	return db.sketchIndex.indexes.TopKList(string(key))
+}
+
+// checkCountMin 检查key是否为Count-Min Sketch，调用者需持有锁
+func (db *kDB) checkCountMin(key []byte) error {
+	if !db.sketchIndex.indexes.Exists(string(key)) {
+		return ErrKeyNotExist
+	}
+	if !db.sketchIndex.indexes.IsCountMin(string(key)) {
+		return sketch.ErrWrongType
+	}
+	return nil
+}
+
+// checkTopK 检查key是否为Top-K，调用者需持有锁
+func (db *kDB) checkTopK(key []byte) error {
+	if !db.sketchIndex.indexes.Exists(string(key)) {
+		return ErrKeyNotExist
+	}
+	if !db.sketchIndex.indexes.IsTopK(string(key)) {
+		return sketch.ErrWrongType
+	}
+	return nil
+}
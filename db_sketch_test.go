@@ -0,0 +1,171 @@
+package kDB
+
+import (
+	"github.com/KarlvenK/kDB/ds/sketch"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestKDB_CMSIncrBy(t *testing.T) {
+	db, _ := OpenDb(t, "/tmp/kdb/db-sketch", KeyValueRamMode)
+	defer db.Close()
+
+	key := []byte("my_cms")
+	if _, err := db.CMSIncrBy(key, []byte("a"), 1); err != ErrKeyNotExist {
+		t.Errorf("incrby a missing sketch, err = %v", err)
+	}
+	if err := db.CMSInitByProb(key, 0.01, 0.01); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.CMSInitByDim(key, 100, 5); err != sketch.ErrSketchExists {
+		t.Errorf("init twice, err = %v", err)
+	}
+
+	if n, _ := db.CMSIncrBy(key, []byte("a"), 3); n != 3 {
+		t.Errorf("incrby got %d", n)
+	}
+	if n, _ := db.CMSIncrBy(key, []byte("a"), 2); n != 5 {
+		t.Errorf("incrby got %d", n)
+	}
+	if res, _ := db.CMSQuery(key, []byte("a"), []byte("b")); !reflect.DeepEqual(res, []uint64{5, 0}) {
+		t.Errorf("query got %v", res)
+	}
+}
+
+func TestKDB_CMSMerge(t *testing.T) {
+	db, _ := OpenDb(t, "/tmp/kdb/db-sketch", KeyValueRamMode)
+	defer db.Close()
+
+	a, b, dest := []byte("a"), []byte("b"), []byte("dest")
+	for _, key := range [][]byte{a, b, dest} {
+		_ = db.CMSInitByDim(key, 100, 5)
+	}
+	_, _ = db.CMSIncrBy(a, []byte("x"), 1)
+	_, _ = db.CMSIncrBy(b, []byte("x"), 2)
+
+	if err := db.CMSMerge(dest, [][]byte{a, b}, []uint64{3, 1}); err != nil {
+		t.Fatal(err)
+	}
+	if res, _ := db.CMSQuery(dest, []byte("x")); res[0] != 5 {
+		t.Errorf("query merged got %d", res[0])
+	}
+	if err := db.CMSMerge(dest, [][]byte{a, []byte("missing")}, nil); err != ErrKeyNotExist {
+		t.Errorf("merge a missing sketch, err = %v", err)
+	}
+
+	_ = db.CMSInitByDim([]byte("small"), 10, 5)
+	if err := db.CMSMerge(dest, [][]byte{[]byte("small")}, nil); err != sketch.ErrDimensionMismatch {
+		t.Errorf("merge different dimensions, err = %v", err)
+	}
+	if res, _ := db.CMSQuery(dest, []byte("x")); res[0] != 5 {
+		t.Errorf("dest is changed by a failed merge, got %d", res[0])
+	}
+}
+
+func TestKDB_TopKAdd(t *testing.T) {
+	db, _ := OpenDb(t, "/tmp/kdb/db-sketch", KeyValueRamMode)
+	defer db.Close()
+
+	key := []byte("my_topk")
+	if _, err := db.TopKAdd(key, []byte("a")); err != ErrKeyNotExist {
+		t.Errorf("add to a missing top-k, err = %v", err)
+	}
+	if err := db.TopKReserve(key, 2, 50, 5, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := db.TopKAdd(key, []byte("a"), []byte("b"), []byte("a"))
+	if err != nil || !reflect.DeepEqual(res, [][]byte{nil, nil, nil}) {
+		t.Errorf("add got %v, %v", res, err)
+	}
+	if expelled, _ := db.TopKIncrBy(key, []byte("c"), 5); string(expelled) != "b" {
+		t.Errorf("expected b to be expelled, got %s", expelled)
+	}
+
+	list, _ := db.TopKList(key)
+	if len(list) != 2 || string(list[0].Item) != "c" || list[0].Count != 5 || string(list[1].Item) != "a" {
+		t.Errorf("list got %v", list)
+	}
+	if res, _ := db.TopKQuery(key, []byte("a"), []byte("b")); !reflect.DeepEqual(res, []bool{true, false}) {
+		t.Errorf("query got %v", res)
+	}
+	if res, _ := db.TopKCount(key, []byte("a"), []byte("c")); !reflect.DeepEqual(res, []uint64{2, 5}) {
+		t.Errorf("count got %v", res)
+	}
+
+	_ = db.CMSInitByDim([]byte("cms"), 10, 2)
+	if _, err := db.TopKList([]byte("cms")); err != sketch.ErrWrongType {
+		t.Errorf("list a count-min sketch, err = %v", err)
+	}
+	if _, err := db.CMSQuery(key, []byte("a")); err != sketch.ErrWrongType {
+		t.Errorf("query a top-k as a count-min sketch, err = %v", err)
+	}
+}
+
+func TestKDB_SketchReplay(t *testing.T) {
+	replay := func(t *testing.T, mode DataIndexMode) {
+		db, config := OpenDb(t, "/tmp/kdb/db-sketch-replay", mode)
+
+		cms, merged, topk := []byte("cms"), []byte("merged"), []byte("topk")
+		_ = db.CMSInitByDim(cms, 200, 4)
+		_ = db.CMSInitByDim(merged, 200, 4)
+		if err := db.TopKReserve(topk, 10, 20, 4, 0.9); err != nil {
+			t.Fatal(err)
+		}
+
+		//enough operations to fill the archived files, the last ones are in the active file
+		for i := 0; i < 3000; i++ {
+			item := []byte("item" + strconv.Itoa(i%(1+i%97)))
+			_, _ = db.CMSIncrBy(cms, item, uint64(1+i%3))
+			_, _ = db.TopKAdd(topk, item)
+			if i%500 == 0 {
+				_ = db.CMSMerge(merged, [][]byte{cms, merged}, nil)
+			}
+		}
+		if len(db.archFiles) == 0 {
+			t.Fatal("expected archived files")
+		}
+
+		keys := []string{"cms", "merged", "topk"}
+		want := map[string][]byte{}
+		for _, key := range keys {
+			want[key] = db.sketchIndex.indexes.Dump(key)
+		}
+		check := func(step string) {
+			for _, key := range keys {
+				if got := db.sketchIndex.indexes.Dump(key); string(got) != string(want[key]) {
+					t.Errorf("%s: %s is not rebuilt correctly", step, key)
+				}
+			}
+		}
+		check("before reopen")
+		db.Close()
+
+		var err error
+		if db, err = Open(config); err != nil {
+			t.Fatal(err)
+		}
+		check("after reopen")
+
+		if err = db.Reclaim(); err != nil {
+			t.Fatal(err)
+		}
+		check("after reclaim")
+		db.Close()
+
+		if db, err = Open(config); err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+		check("reopen after reclaim")
+	}
+
+	t.Run("KeyValueRamMode", func(t *testing.T) {
+		replay(t, KeyValueRamMode)
+	})
+
+	t.Run("KeyOnlyRamMode", func(t *testing.T) {
+		replay(t, KeyOnlyRamMode)
+	})
+}
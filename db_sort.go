@@ -0,0 +1,218 @@
+package kDB
+
+import (
+	"bytes"
+	"github.com/KarlvenK/kDB/storage"
+	"sort"
+	"strconv"
+)
+
+// SortOption Sort 的选项
+// the options of Sort
+type SortOption struct {
+	// By 按外部键的值排序，模式中的第一个 * 替换为元素，key->field 表示哈希表的域，不含 * 时不排序
+	// sorts by the values of external keys, the first * of the pattern is replaced by the element,
+	// and key->field refers to a field of a hash. Sorting is skipped if the pattern has no *.
+	By []byte
+
+	// Get 返回外部键的值而不是元素本身，模式同 By，# 表示元素本身，不存在的值为nil
+	// returns the values of external keys instead of the elements, the patterns are the same as By,
+	// and # is the element itself. The values not exist are nil.
+	Get [][]byte
+
+	// Offset Count 跳过前 Offset 个元素，最多返回 Count 个，Count 不大于0时不限制个数
+	// skips Offset elements and returns at most Count ones, there is no limit if Count is not positive
+	Offset int
+	Count  int
+
+	// Desc 从大到小排序
+	// sorts from the largest
+	Desc bool
+
+	// Alpha 按字典序排序，否则将元素或权重解析为浮点数排序
+	// sorts lexicographically, otherwise the elements or weights are parsed as floats
+	Alpha bool
+
+	// Store 将结果保存到该列表中，替换其原有的元素
+	// stores the result in this list, replacing its elements
+	Store []byte
+}
+
+// sortItem an element to sort with its weight
+type sortItem struct {
+	elem   []byte
+	weight []byte
+	score  float64
+}
+
+// Sort 对列表、集合或有序集 key 的元素排序，依次查找列表、集合和有序集，key 不存在时返回空结果
+// 未设置 By 时按元素本身排序，权重相同时按元素的字典序排列，不存在的权重视为0
+// 设置 Get 时每个元素依次返回各个模式的值，设置 Store 时结果写入列表并作为一条批量日志保存
+// Sorts the elements of the list, set or sorted set stored at key, looking up the lists, sets and sorted sets
+// in turn. The result is empty if key does not exist. The elements themselves are compared without By,
+// the ones of equal weights are ordered lexicographically, and the missing weights are taken as 0.
+// Each element is replaced by the values of the Get patterns in turn. With Store, the result is written
+// to the list as one batch of entries.
+func (db *kDB) Sort(key []byte, opt SortOption) ([][]byte, error) {
+	if err := db.checkKeyValue(key, nil); err != nil {
+		return nil, err
+	}
+	if opt.Store != nil {
+		if err := db.checkKeyValue(opt.Store, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	elems := db.sortElements(key)
+	items := make([]sortItem, len(elems))
+	for i, elem := range elems {
+		items[i].elem = elem
+	}
+
+	if opt.By == nil || bytes.IndexByte(opt.By, '*') >= 0 {
+		if err := db.sortItems(items, opt); err != nil {
+			return nil, err
+		}
+	}
+
+	start := opt.Offset
+	if start < 0 {
+		start = 0
+	}
+	if start > len(items) {
+		start = len(items)
+	}
+	items = items[start:]
+	if opt.Count > 0 && opt.Count < len(items) {
+		items = items[:opt.Count]
+	}
+
+	var res [][]byte
+	for _, item := range items {
+		if len(opt.Get) == 0 {
+			res = append(res, item.elem)
+			continue
+		}
+		for _, pattern := range opt.Get {
+			res = append(res, db.sortLookup(pattern, item.elem))
+		}
+	}
+
+	if opt.Store != nil {
+		if err := db.sortStore(opt.Store, res); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+// sortElements returns the elements of the list, set or sorted set stored at key
+func (db *kDB) sortElements(key []byte) [][]byte {
+	if db.LLen(key) > 0 {
+		elems, _ := db.LRange(key, 0, -1)
+		return elems
+	}
+	if db.SCard(key) > 0 {
+		return db.SMembers(key)
+	}
+
+	var elems [][]byte
+	for _, m := range db.ZRangeMembers(key, 0, -1, false) {
+		elems = append(elems, m.Member)
+	}
+	return elems
+}
+
+func (db *kDB) sortItems(items []sortItem, opt SortOption) error {
+	for i := range items {
+		item := &items[i]
+		item.weight = item.elem
+		if opt.By != nil {
+			item.weight = db.sortLookup(opt.By, item.elem)
+		}
+		if opt.Alpha || item.weight == nil {
+			continue
+		}
+
+		score, err := strconv.ParseFloat(string(item.weight), 64)
+		if err != nil {
+			return ErrSortNotNumber
+		}
+		item.score = score
+	}
+
+	sort.SliceStable(items, func(i, j int) bool {
+		a, b := items[i], items[j]
+		if opt.Desc {
+			a, b = b, a
+		}
+		if opt.Alpha {
+			if c := bytes.Compare(a.weight, b.weight); c != 0 {
+				return c < 0
+			}
+		} else if a.score != b.score {
+			return a.score < b.score
+		}
+		return bytes.Compare(a.elem, b.elem) < 0
+	})
+	return nil
+}
+
+// sortLookup 返回模式对应的值，模式中的第一个 * 替换为元素，key->field 表示哈希表的域，# 表示元素本身
+// returns the value of the pattern, whose first * is replaced by the element, key->field refers to
+// a field of a hash, and # is the element itself. Returns nil if the value does not exist.
+func (db *kDB) sortLookup(pattern, elem []byte) []byte {
+	if string(pattern) == "#" {
+		return elem
+	}
+	star := bytes.IndexByte(pattern, '*')
+	if star < 0 {
+		return nil
+	}
+
+	var field []byte
+	if arrow := bytes.LastIndex(pattern, []byte("->")); arrow > star && arrow+2 < len(pattern) {
+		field = pattern[arrow+2:]
+		pattern = pattern[:arrow]
+	}
+
+	key := make([]byte, 0, len(pattern)+len(elem))
+	key = append(key, pattern[:star]...)
+	key = append(key, elem...)
+	key = append(key, pattern[star+1:]...)
+	if db.checkKeyValue(key, nil) != nil {
+		return nil
+	}
+
+	if field != nil {
+		return db.HGet(key, field)
+	}
+	val, err := db.Get(key)
+	if err != nil {
+		return nil
+	}
+	return val
+}
+
+// sortStore replaces the elements of the list dst by values, which are logged as one batch
+func (db *kDB) sortStore(dst []byte, values [][]byte) error {
+	db.listIndex.mu.Lock()
+	defer db.listIndex.mu.Unlock()
+
+	//LTrim with start greater than end clears the list
+	extra := []byte("1" + ExtraSeparator + "0")
+	entries := []*storage.Entry{storage.NewEntry(dst, nil, extra, List, ListLTrim)}
+	for _, val := range values {
+		entries = append(entries, storage.NewEntryNoExtra(dst, val, List, ListRPush))
+	}
+	if _, err := db.storeBatch(entries...); err != nil {
+		return err
+	}
+
+	db.listIndex.indexes.LTrim(string(dst), 1, 0)
+	if len(values) > 0 {
+		db.listIndex.indexes.RPush(string(dst), values...)
+		db.serveListWaiters(string(dst))
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package kDB
+
+import (
+	"reflect"
+	"testing"
+)
+
+func sortStrings(t *testing.T, db *kDB, key string, opt SortOption) []string {
+	t.Helper()
+	res, err := db.Sort([]byte(key), opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return listStrings(res)
+}
+
+func TestKDB_Sort(t *testing.T) {
+	db, _ := OpenDb(t, "/tmp/kdb/db-sort", KeyValueRamMode)
+	defer db.Close()
+
+	_, _ = db.RPush([]byte("nums"), []byte("3"), []byte("10"), []byte("1.5"), []byte("-2"), []byte("3"))
+	_, _ = db.RPush([]byte("names"), []byte("bob"), []byte("alice"), []byte("carol"))
+
+	tests := []struct {
+		name string
+		key  string
+		opt  SortOption
+		want []string
+	}{
+		{"numeric", "nums", SortOption{}, []string{"-2", "1.5", "3", "3", "10"}},
+		{"desc", "nums", SortOption{Desc: true}, []string{"10", "3", "3", "1.5", "-2"}},
+		{"limit", "nums", SortOption{Offset: 1, Count: 2}, []string{"1.5", "3"}},
+		{"offset out of range", "nums", SortOption{Offset: 10}, []string{}},
+		{"alpha", "nums", SortOption{Alpha: true}, []string{"-2", "1.5", "10", "3", "3"}},
+		{"alpha names", "names", SortOption{Alpha: true, Desc: true}, []string{"carol", "bob", "alice"}},
+		{"missing key", "missing", SortOption{}, []string{}},
+	}
+	for _, tt := range tests {
+		if got := sortStrings(t, db, tt.key, tt.opt); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.want, got)
+		}
+	}
+
+	if _, err := db.Sort([]byte("names"), SortOption{}); err != ErrSortNotNumber {
+		t.Errorf("expected ErrSortNotNumber, got %v", err)
+	}
+}
+
+func TestKDB_SortByGet(t *testing.T) {
+	db, _ := OpenDb(t, "/tmp/kdb/db-sort", KeyValueRamMode)
+	defer db.Close()
+
+	_, _ = db.SAdd([]byte("users"), []byte("1"), []byte("2"), []byte("3"))
+	//id -> age, name, rank
+	for id, user := range map[string][3]string{"1": {"30", "alice", "c"}, "2": {"20", "bob", "b"}, "3": {"25", "carol", "a"}} {
+		_ = db.Set([]byte("age_"+id), []byte(user[0]))
+		_, _ = db.HSet([]byte("user_"+id), []byte("name"), []byte(user[1]))
+		_, _ = db.HSet([]byte("user_"+id), []byte("rank"), []byte(user[2]))
+	}
+
+	tests := []struct {
+		name string
+		opt  SortOption
+		want []string
+	}{
+		{"by string keys", SortOption{By: []byte("age_*")}, []string{"2", "3", "1"}},
+		{"by hash fields", SortOption{By: []byte("user_*->rank"), Alpha: true}, []string{"3", "2", "1"}},
+		{"get", SortOption{By: []byte("age_*"), Get: [][]byte{[]byte("#"), []byte("user_*->name"), []byte("age_*")}},
+			[]string{"2", "bob", "20", "3", "carol", "25", "1", "alice", "30"}},
+		{"missing weights", SortOption{By: []byte("missing_*"), Desc: true}, []string{"3", "2", "1"}},
+		{"missing values", SortOption{Get: [][]byte{[]byte("user_*->missing"), []byte("nostar")}, Count: 1}, []string{"", ""}},
+	}
+	for _, tt := range tests {
+		if got := sortStrings(t, db, "users", tt.opt); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.want, got)
+		}
+	}
+
+	res, _ := db.Sort([]byte("users"), SortOption{Get: [][]byte{[]byte("user_*->missing")}})
+	for _, v := range res {
+		if v != nil {
+			t.Errorf("expected nil for a missing value, got %q", v)
+		}
+	}
+
+	//a pattern without * skips sorting, keeping the order of the sorted set
+	_ = db.ZAdd([]byte("zset"), 2, []byte("b"))
+	_ = db.ZAdd([]byte("zset"), 1, []byte("c"))
+	_ = db.ZAdd([]byte("zset"), 3, []byte("a"))
+	if got := sortStrings(t, db, "zset", SortOption{By: []byte("nosort")}); !reflect.DeepEqual(got, []string{"c", "b", "a"}) {
+		t.Errorf("unexpected unsorted zset %v", got)
+	}
+	if got := sortStrings(t, db, "zset", SortOption{Alpha: true}); !reflect.DeepEqual(got, []string{"a", "b", "c"}) {
+		t.Errorf("unexpected sorted zset %v", got)
+	}
+}
+
+func TestKDB_SortStore(t *testing.T) {
+	db, config := OpenDb(t, "/tmp/kdb/db-sort", KeyValueRamMode)
+
+	_, _ = db.RPush([]byte("src"), []byte("3"), []byte("1"), []byte("2"))
+	_, _ = db.RPush([]byte("dst"), []byte("old"))
+
+	res, err := db.Sort([]byte("src"), SortOption{Store: []byte("dst"), Desc: true})
+	if err != nil || !reflect.DeepEqual(listStrings(res), []string{"3", "2", "1"}) {
+		t.Fatalf("unexpected result %v %v", listStrings(res), err)
+	}
+	if got := lrangeStrings(db, []byte("dst")); !reflect.DeepEqual(got, []string{"3", "2", "1"}) {
+		t.Errorf("unexpected stored list %v", got)
+	}
+
+	_, _ = db.Sort([]byte("missing"), SortOption{Store: []byte("empty")})
+	if db.LLen([]byte("empty")) != 0 {
+		t.Error("expected an empty list")
+	}
+	_ = db.Close()
+
+	if db, err = Open(config); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if got := lrangeStrings(db, []byte("dst")); !reflect.DeepEqual(got, []string{"3", "2", "1"}) {
+		t.Errorf("unexpected stored list after reopen %v", got)
+	}
+}
@@ -4,7 +4,10 @@ import (
 	"bytes"
 	"github.com/KarlvenK/kDB/index"
 	"github.com/KarlvenK/kDB/storage"
+	"github.com/KarlvenK/kDB/utils"
 	"log"
+	"math"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -14,10 +17,63 @@ import (
 type StrIdx struct {
 	mu      sync.RWMutex
 	idxList *index.SkipList
+	patches map[string][]bytePatch    //bytes set by SetBit after the value entry, only used in KeyOnlyRamMode
+	owned   map[string]*index.Indexer //indexers whose value is copied by SetBit and set in place, only used in KeyValueRamMode
+}
+
+//bytePatch a byte of the value changed by SetBit
+type bytePatch struct {
+	offset int
+	value  byte
 }
 
 func newStrIdx() *StrIdx {
-	return &StrIdx{idxList: index.NewSkipList()}
+	return &StrIdx{
+		idxList: index.NewSkipList(),
+		patches: make(map[string][]bytePatch),
+		owned:   make(map[string]*index.Indexer),
+	}
+}
+
+//reclaimer 保留有效的字符串，并合并 SetBit 在其后设置的字节
+//keeps the valid strings, and merges the bytes set by SetBit after them
+func (si *StrIdx) reclaimer(db *kDB) reclaimer {
+	return strReclaimer{db: db}
+}
+
+type strReclaimer struct {
+	db *kDB
+}
+
+func (r strReclaimer) reclaim(e *storage.Entry, valid bool) *storage.Entry {
+	if !valid {
+		return nil
+	}
+	//the bytes set by SetBit after the entry are merged into it
+	if e.Mark == StringSet {
+		if val, err := r.db.Get(e.Meta.Key); err == nil {
+			e.Meta.Value = val
+			e.Meta.ValueSize = uint32(len(val))
+		}
+	}
+	return e
+}
+
+func (r strReclaimer) snapshot() []*storage.Entry {
+	return nil
+}
+
+//rewritten points the indexer of the key to the rewritten value
+func (r strReclaimer) rewritten(e *storage.Entry, fileId uint32, offset int64) {
+	if e.Mark != StringSet {
+		return
+	}
+	item := r.db.strIndex.idxList.Get(e.Meta.Key)
+	idx := item.Value().(*index.Indexer)
+	idx.Offset = offset
+	idx.FileId = fileId
+	r.db.strIndex.idxList.Put(idx.Meta.Key, idx)
+	delete(r.db.strIndex.patches, string(idx.Meta.Key))
 }
 
 //Set set key to hold the string value
@@ -49,42 +105,78 @@ func (db *kDB) Get(key []byte) ([]byte, error) {
 		return nil, ErrEmptyKey
 	}
 
-	node := db.strIndex.idxList.Get(key)
-	if node == nil {
-		return nil, ErrKeyNotExist
+	db.strIndex.mu.RLock()
+	val, err := db.readVal(key, true)
+	db.strIndex.mu.RUnlock()
+
+	if err == ErrKeyExpired {
+		db.removeExpired(key)
 	}
-	//Value returns interface{}
-	//change it into Indexer
-	idx := node.Value().(*index.Indexer)
-	if idx == nil {
-		return nil, ErrNilIndexer
+	return val, err
+}
+
+//MGet 返回所有给定key的值，key不存在或已过期时对应的值为nil
+//returns the values of all specified keys, nil for the key that does not exist or is expired
+func (db *kDB) MGet(keys ...[]byte) ([][]byte, error) {
+	for _, key := range keys {
+		if err := db.checkKeyValue(key, nil); err != nil {
+			return nil, err
+		}
 	}
 
+	values := make([][]byte, len(keys))
+	var expired [][]byte
 	db.strIndex.mu.RLock()
-	defer db.strIndex.mu.RUnlock()
+	for i, key := range keys {
+		val, err := db.readVal(key, true)
+		if err == ErrKeyExpired {
+			expired = append(expired, key)
+		} else if err != nil && err != ErrKeyNotExist {
+			db.strIndex.mu.RUnlock()
+			return nil, err
+		}
+		values[i] = val
+	}
+	db.strIndex.mu.RUnlock()
 
-	//check if key is expired
-	if db.expireIfNeeded(key) {
-		return nil, ErrKeyExpired
+	db.removeExpired(expired...)
+	return values, nil
+}
+
+//MSet 同时设置一个或多个 key-value 对，所有的值在一个批次中写入
+//pairs 为 key1, value1, key2, value2 ...
+//sets the given keys to their respective values in one batch, the keys lose their ttl like Set
+func (db *kDB) MSet(pairs ...[]byte) error {
+	if err := db.checkPairs(pairs); err != nil {
+		return err
 	}
 
-	if db.config.IdxMode == KeyValueRamMode {
-		return idx.Meta.Value, nil
+	db.strIndex.mu.Lock()
+	defer db.strIndex.mu.Unlock()
+
+	return db.doMSet(pairs)
+}
+
+//MSetNx 同时设置一个或多个 key-value 对，当且仅当所有给定key都不存在
+//sets the given keys to their respective values only if none of the keys exists
+func (db *kDB) MSetNx(pairs ...[]byte) (bool, error) {
+	if err := db.checkPairs(pairs); err != nil {
+		return false, err
 	}
 
-	if db.config.IdxMode == KeyOnlyRamMode {
-		df := db.activeFile
-		if idx.FileId != db.activeFileID {
-			df = db.archFiles[idx.FileId]
-		}
+	db.strIndex.mu.Lock()
+	defer db.strIndex.mu.Unlock()
 
-		e, err := df.Read(idx.Offset)
-		if err != nil {
-			return nil, err
+	for i := 0; i < len(pairs); i += 2 {
+		if db.strIndex.idxList.Exist(pairs[i]) && !db.expireIfNeeded(pairs[i]) {
+			return false, nil
 		}
-		return e.Meta.Value, nil
 	}
-	return nil, ErrKeyNotExist
+
+	if err := db.doMSet(pairs); err != nil {
+		return false, err
+	}
+	return true, nil
 }
 
 //GetSet 将key的值设置味value， 并返回key在设置前的旧value
@@ -104,13 +196,11 @@ func (db *kDB) Append(key, value []byte) error {
 	if err := db.checkKeyValue(key, value); err != nil {
 		return err
 	}
+	//Get removes the expired key, and returns ErrKeyExpired for it
 	e, err := db.Get(key)
 	if err != nil && err != ErrKeyNotExist {
 		return err
 	}
-	if db.expireIfNeeded(key) {
-		return ErrKeyExpired
-	}
 
 	appendExist := false
 	if e != nil {
@@ -129,24 +219,210 @@ func (db *kDB) Append(key, value []byte) error {
 	return nil
 }
 
+//Incr 将key中储存的数字值加一，key不存在时先初始化为0
+//increments the number stored at key by one
+func (db *kDB) Incr(key []byte) (int64, error) {
+	return db.incrBy(key, 1)
+}
+
+//IncrBy 将key中储存的数字值加上增量 incr
+//increments the number stored at key by incr
+func (db *kDB) IncrBy(key []byte, incr int64) (int64, error) {
+	return db.incrBy(key, incr)
+}
+
+//Decr 将key中储存的数字值减一
+//decrements the number stored at key by one
+func (db *kDB) Decr(key []byte) (int64, error) {
+	return db.incrBy(key, -1)
+}
+
+//DecrBy 将key中储存的数字值减去减量 decr
+//decrements the number stored at key by decr
+func (db *kDB) DecrBy(key []byte, decr int64) (int64, error) {
+	if decr == math.MinInt64 {
+		return 0, ErrIncrOverflow
+	}
+	return db.incrBy(key, -decr)
+}
+
+//IncrByFloat 将key中储存的浮点数值加上增量 incr
+//increments the float number stored at key by incr
+func (db *kDB) IncrByFloat(key []byte, incr float64) (res float64, err error) {
+	if err = db.checkKeyValue(key, nil); err != nil {
+		return
+	}
+
+	db.strIndex.mu.Lock()
+	defer db.strIndex.mu.Unlock()
+
+	val, err := db.getNumber(key)
+	if err != nil {
+		return
+	}
+	if val != nil {
+		if res, err = utils.StrToFloat64(string(val)); err != nil {
+			return 0, ErrValueNotFloat
+		}
+	}
+
+	res += incr
+	if math.IsNaN(res) || math.IsInf(res, 0) {
+		return 0, ErrValueNotFloat
+	}
+	err = db.setVal(key, []byte(utils.Float64ToStr(res)))
+	return
+}
+
+//SetEx 将值value关联到key，并将key的过期时间设为seconds秒，两步操作是原子的
+//sets key to hold the value and set key to timeout after the given number of seconds atomically
+func (db *kDB) SetEx(key, value []byte, seconds uint32) error {
+	return db.PSetEx(key, value, uint64(seconds)*1000)
+}
+
+//PSetEx 和 SetEx 相同，但以毫秒为单位设置过期时间
+//works exactly like SetEx with the ttl in milliseconds
+func (db *kDB) PSetEx(key, value []byte, milliseconds uint64) error {
+	if milliseconds == 0 || milliseconds > math.MaxInt32*1000 {
+		return ErrInvalidTTL
+	}
+	return db.setWithTTL(key, value, milliseconds)
+}
+
+//GetDel 获取key的值并删除key
+//get the value of key and delete the key
+func (db *kDB) GetDel(key []byte) ([]byte, error) {
+	if err := db.checkKeyValue(key, nil); err != nil {
+		return nil, err
+	}
+
+	db.strIndex.mu.Lock()
+	defer db.strIndex.mu.Unlock()
+
+	val, err := db.getVal(key)
+	if err != nil {
+		return nil, err
+	}
+	if err = db.remVal(key); err != nil {
+		return nil, err
+	}
+	return val, nil
+}
+
+//GetExOption GetEx 的选项，TTL 和 Persist 都未设置时不修改key的过期时间
+//the options of GetEx, the ttl of the key is not changed if neither TTL nor Persist is set
+type GetExOption struct {
+	TTL     time.Duration // set the ttl of the key, in milliseconds precision
+	Persist bool          // remove the ttl of the key
+}
+
+//GetEx 获取key的值，并根据opt设置或清除过期时间
+//get the value of key, and set or remove its ttl according to opt
+func (db *kDB) GetEx(key []byte, opt GetExOption) ([]byte, error) {
+	if err := db.checkKeyValue(key, nil); err != nil {
+		return nil, err
+	}
+	milliseconds := opt.TTL.Milliseconds()
+	if opt.TTL != 0 && (milliseconds <= 0 || milliseconds > math.MaxInt32*1000 || opt.Persist) {
+		return nil, ErrInvalidTTL
+	}
+
+	db.strIndex.mu.Lock()
+	defer db.strIndex.mu.Unlock()
+
+	val, err := db.getVal(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if milliseconds > 0 {
+		err = db.expireAt(key, time.Now().UnixNano()/int64(time.Millisecond)+milliseconds)
+	} else if opt.Persist {
+		err = db.persist(key)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return val, nil
+}
+
+//GetRange 返回key中字符串值的子字符串，start和end均包含在内，负数表示从末尾开始计算
+//returns the substring of the string value stored at key, determined by the offsets start and end (both are inclusive)
+//negative offsets can be used in order to provide an offset starting from the end of the string
+func (db *kDB) GetRange(key []byte, start, end int) ([]byte, error) {
+	if err := db.checkKeyValue(key, nil); err != nil {
+		return nil, err
+	}
+
+	var res []byte
+	err := db.viewVal(key, func(val []byte) {
+		if start, end, ok := byteRange(len(val), start, end); ok {
+			res = append([]byte(nil), val[start:end+1]...)
+		}
+	})
+	return res, err
+}
+
+//SetRange 从偏移量offset开始，用value覆写key中储存的字符串值，超出原长度的部分用0补齐
+//返回覆写后字符串的长度
+//overwrites part of the string stored at key, starting at the specified offset, for the entire length of value
+//if the offset is larger than the current length of the string, the string is padded with zero-bytes
+func (db *kDB) SetRange(key []byte, offset int, value []byte) (int, error) {
+	if err := db.checkKeyValue(key, nil); err != nil {
+		return 0, err
+	}
+	if offset < 0 {
+		return 0, ErrOffsetOutOfRange
+	}
+
+	db.strIndex.mu.Lock()
+	defer db.strIndex.mu.Unlock()
+
+	val, err := db.peekVal(key)
+	if err != nil && err != ErrKeyNotExist && err != ErrKeyExpired {
+		return 0, err
+	}
+	if len(value) == 0 {
+		return len(val), nil
+	}
+
+	length := offset + len(value)
+	if uint64(length) > uint64(db.config.MaxValueSize) {
+		return 0, ErrValueTooLarge
+	}
+	if length < len(val) {
+		length = len(val)
+	}
+
+	newVal := make([]byte, length)
+	copy(newVal, val)
+	copy(newVal[offset:], value)
+	if err = db.setVal(key, newVal); err != nil {
+		return 0, err
+	}
+	return length, nil
+}
+
 //StrLen return the length of the string value stored at key
 func (db *kDB) StrLen(key []byte) int {
 	if err := db.checkKeyValue(key, nil); err != nil {
 		return 0
 	}
 
+	size := 0
 	db.strIndex.mu.RLock()
-	defer db.strIndex.mu.RUnlock()
-
 	e := db.strIndex.idxList.Get(key)
-	if e != nil {
-		if db.expireIfNeeded(key) {
-			return 0
-		}
+	expired := e != nil && db.expired(key)
+	if e != nil && !expired {
 		idx := e.Value().(*index.Indexer)
-		return int(idx.Meta.ValueSize)
+		size = int(idx.Meta.ValueSize)
 	}
-	return 0
+	db.strIndex.mu.RUnlock()
+
+	if expired {
+		db.removeExpired(key)
+	}
+	return size
 }
 
 // StrExists check whether the key exists
@@ -156,13 +432,14 @@ func (db *kDB) StrExists(key []byte) bool {
 	}
 
 	db.strIndex.mu.RLock()
-	defer db.strIndex.mu.RUnlock()
-
 	exist := db.strIndex.idxList.Exist(key)
-	if exist && !db.expireIfNeeded(key) {
-		return true
+	expired := exist && db.expired(key)
+	db.strIndex.mu.RUnlock()
+
+	if expired {
+		db.removeExpired(key)
 	}
-	return false
+	return exist && !expired
 }
 
 //StrRem remove the value stored at key
@@ -174,15 +451,7 @@ func (db *kDB) StrRem(key []byte) error {
 	db.strIndex.mu.Lock()
 	defer db.strIndex.mu.Unlock()
 
-	if ele := db.strIndex.idxList.Remove(key); ele != nil {
-		delete(db.expires, string(key))
-		e := storage.NewEntryNoExtra(key, nil, String, StringRem)
-		if err := db.store(e); err != nil {
-			return err
-		}
-	}
-
-	return nil
+	return db.remVal(key)
 }
 
 //PrefixScan 根据前缀查找所有匹配的 key 对应的 value
@@ -199,6 +468,11 @@ func (db *kDB) PrefixScan(prefix string, limit, offset int) (val [][]byte, err e
 		return
 	}
 
+	//the expired keys are removed after the read lock is released
+	var expired [][]byte
+	defer func() {
+		db.removeExpired(expired...)
+	}()
 	db.strIndex.mu.RLock()
 	defer db.strIndex.mu.RUnlock()
 
@@ -209,26 +483,19 @@ func (db *kDB) PrefixScan(prefix string, limit, offset int) (val [][]byte, err e
 		}
 	}
 	for e != nil && strings.HasPrefix(string(e.Key()), prefix) && limit != 0 {
-		item := e.Value().(*index.Indexer)
-		var value []byte
-
-		if db.config.IdxMode == KeyOnlyRamMode {
-			value, err = db.Get(e.Key())
-			if err != nil {
-				return
-			}
-		} else {
-			if item != nil {
-				value = item.Meta.Value
-			}
-		}
-
-		expired := db.expireIfNeeded(e.Key())
-		if !expired {
-			val = append(val, value)
+		value, rerr := db.readVal(e.Key(), true)
+		if rerr == ErrKeyExpired {
+			expired = append(expired, e.Key())
 			e = e.Next()
+			continue
 		}
-		if limit > 0 && !expired {
+		if rerr != nil {
+			return nil, rerr
+		}
+
+		val = append(val, value)
+		e = e.Next()
+		if limit > 0 {
 			limit--
 		}
 	}
@@ -237,28 +504,28 @@ func (db *kDB) PrefixScan(prefix string, limit, offset int) (val [][]byte, err e
 
 //RangeScan 范围扫描， 查找key 从start 到 end之间的数据
 func (db *kDB) RangeScan(start, end []byte) (vals [][]byte, err error) {
+	//the expired keys are removed after the read lock is released
+	var expired [][]byte
+	defer func() {
+		db.removeExpired(expired...)
+	}()
+	db.strIndex.mu.RLock()
+	defer db.strIndex.mu.RUnlock()
+
 	node := db.strIndex.idxList.Get(start)
 	if node == nil {
 		return nil, ErrKeyNotExist
 	}
 
-	db.strIndex.mu.RLock()
-	defer db.strIndex.mu.RUnlock()
-
 	for node != nil && bytes.Compare(node.Key(), end) <= 0 {
-		if db.expireIfNeeded(node.Key()) {
+		value, rerr := db.readVal(node.Key(), true)
+		if rerr == ErrKeyExpired {
+			expired = append(expired, node.Key())
 			node = node.Next()
 			continue
 		}
-
-		var value []byte
-		if db.config.IdxMode == KeyOnlyRamMode {
-			value, err = db.Get(node.Key())
-			if err != nil {
-				return nil, err
-			}
-		} else {
-			value = node.Value().(*index.Indexer).Meta.Value
+		if rerr != nil {
+			return nil, rerr
 		}
 		vals = append(vals, value)
 		node = node.Next()
@@ -278,9 +545,7 @@ func (db *kDB) Expire(key []byte, seconds uint32) (err error) {
 	db.strIndex.mu.Lock()
 	defer db.strIndex.mu.Unlock()
 
-	deadline := uint32(time.Now().Unix()) + seconds
-	db.expires[string(key)] = deadline
-	return
+	return db.expireAt(key, time.Now().UnixNano()/int64(time.Millisecond)+int64(seconds)*1000)
 }
 
 //Persist 清除key的过期时间
@@ -288,7 +553,9 @@ func (db *kDB) Persist(key []byte) {
 	db.strIndex.mu.Lock()
 	defer db.strIndex.mu.Unlock()
 
-	delete(db.expires, string(key))
+	if err := db.persist(key); err != nil {
+		log.Printf("persist key err [%+v] [%+v]\n", key, err)
+	}
 }
 
 //TTL 获取key的过期时间
@@ -304,9 +571,10 @@ func (db *kDB) TTL(key []byte) (ttl uint32) {
 	if !exist {
 		return
 	}
-	now := uint32(time.Now().Unix())
+	//the remaining milliseconds are rounded up to seconds
+	now := time.Now().UnixNano() / int64(time.Millisecond)
 	if deadline > now {
-		ttl = deadline - now
+		ttl = uint32((deadline - now + 999) / 1000)
 	}
 	return
 }
@@ -314,17 +582,12 @@ func (db *kDB) TTL(key []byte) (ttl uint32) {
 //expireIfNeeded
 //check whether key is expired and delete it
 func (db *kDB) expireIfNeeded(key []byte) (expired bool) {
-	deadline := db.expires[string(key)]
-	if deadline <= 0 {
-		return
-	}
-
-	if time.Now().Unix() > int64(deadline) {
-		expired = true
+	if expired = db.expired(key); expired {
 		// 删除过期字典对应的key
 		delete(db.expires, string(key))
 
 		if ele := db.strIndex.idxList.Remove(key); ele != nil {
+			db.strIndex.reset(string(key))
 			e := storage.NewEntryNoExtra(key, nil, String, StringRem)
 			if err := db.store(e); err != nil {
 				log.Printf("remove expired key err [%+v] [%+v]\n", key, err)
@@ -334,6 +597,50 @@ func (db *kDB) expireIfNeeded(key []byte) (expired bool) {
 	return
 }
 
+//expired 检查key是否已过期，不删除key，持有 strIndex.mu 的读锁即可调用
+//check whether key is expired without removing it, the read lock of strIndex.mu is enough
+func (db *kDB) expired(key []byte) bool {
+	deadline := db.expires[string(key)]
+	return deadline > 0 && time.Now().UnixNano()/int64(time.Millisecond) > deadline
+}
+
+//removeExpired 删除读取时发现已过期的key，读操作在释放读锁后调用，写锁下会再次检查key是否过期
+//remove the keys found expired by a reader, which calls it after releasing the read lock of strIndex.mu,
+//the keys are checked again under the write lock, as they may be set again in between
+func (db *kDB) removeExpired(keys ...[]byte) {
+	if len(keys) == 0 {
+		return
+	}
+
+	db.strIndex.mu.Lock()
+	defer db.strIndex.mu.Unlock()
+
+	for _, key := range keys {
+		db.expireIfNeeded(key)
+	}
+}
+
+//viewVal 持有读锁时以key的值调用fn，key不存在或已过期时值为nil，fn不能修改或保留该值，已过期的key在释放读锁后删除
+//call fn with the value of key under the read lock of strIndex.mu, the value is nil if the key does not exist or is expired.
+//fn must not modify the value or keep it, the expired key is removed after the read lock is released
+func (db *kDB) viewVal(key []byte, fn func(val []byte)) error {
+	db.strIndex.mu.RLock()
+	val, err := db.readVal(key, false)
+	if err == nil || err == ErrKeyNotExist || err == ErrKeyExpired {
+		fn(val)
+	}
+	db.strIndex.mu.RUnlock()
+
+	switch err {
+	case ErrKeyExpired:
+		db.removeExpired(key)
+	case ErrKeyNotExist:
+	default:
+		return err
+	}
+	return nil
+}
+
 func (db *kDB) doSet(key, value []byte) (err error) {
 	if err = db.checkKeyValue(key, value); err != nil {
 		return err
@@ -348,23 +655,322 @@ func (db *kDB) doSet(key, value []byte) (err error) {
 	db.strIndex.mu.Lock()
 	defer db.strIndex.mu.Unlock()
 
+	return db.setVal(key, value)
+}
+
+//getVal 获取key的值并删除已过期的key，调用方需持有 strIndex.mu 的写锁
+//get the value of key and remove the key if it is expired, the caller must hold the write lock of strIndex.mu
+func (db *kDB) getVal(key []byte) ([]byte, error) {
+	if db.expireIfNeeded(key) {
+		return nil, ErrKeyExpired
+	}
+	return db.readVal(key, true)
+}
+
+//peekVal 获取key的值并删除已过期的key，KeyValueRamMode 下返回索引持有的值，调用方需持有 strIndex.mu 的写锁，且只能在持有锁时读取该值
+//get the value of key and remove the key if it is expired, the value is the one held by the index in KeyValueRamMode.
+//The caller must hold the write lock of strIndex.mu, and must not modify the value or keep it after the lock is released.
+func (db *kDB) peekVal(key []byte) ([]byte, error) {
+	if db.expireIfNeeded(key) {
+		return nil, ErrKeyExpired
+	}
+	return db.readVal(key, false)
+}
+
+//readVal 获取key的值，已过期的key返回 ErrKeyExpired 但不删除，持有 strIndex.mu 的读锁即可调用
+//detach 为 true 时复制由 SetBit 原地修改的值
+//get the value of key, ErrKeyExpired is returned for the expired key without removing it, the read lock of strIndex.mu is enough.
+//The value set in place by SetBit is copied if detach is true
+func (db *kDB) readVal(key []byte, detach bool) ([]byte, error) {
+	node := db.strIndex.idxList.Get(key)
+	if node == nil {
+		return nil, ErrKeyNotExist
+	}
+	//Value returns interface{}
+	//change it into Indexer
+	idx := node.Value().(*index.Indexer)
+	if idx == nil {
+		return nil, ErrNilIndexer
+	}
+
+	//check if key is expired
+	if db.expired(key) {
+		return nil, ErrKeyExpired
+	}
+
+	if db.config.IdxMode == KeyValueRamMode {
+		if detach {
+			return db.strIndex.value(key, idx), nil
+		}
+		return idx.Meta.Value, nil
+	}
+
+	if db.config.IdxMode == KeyOnlyRamMode {
+		df := db.activeFile
+		if idx.FileId != db.activeFileID {
+			df = db.archFiles[idx.FileId]
+		}
+
+		e, err := df.Read(idx.Offset)
+		if err != nil {
+			return nil, err
+		}
+		return db.strIndex.applyPatches(key, e.Meta.Value), nil
+	}
+	return nil, ErrKeyNotExist
+}
+
+//setByte 将key的值在offset处的字节设为b，值的长度不足时用0补齐
+//set the byte at offset of the value of key, the value is padded with zero-bytes if it is not long enough
+func (si *StrIdx) setByte(key []byte, offset int, b byte, mode DataIndexMode) {
+	node := si.idxList.Get(key)
+	if node == nil {
+		return
+	}
+	idx := node.Value().(*index.Indexer)
+
+	//the value may be shared with the caller of Set, so it is copied once, and then set in place
+	if mode == KeyValueRamMode {
+		val := idx.Meta.Value
+		if si.owned[string(key)] != idx {
+			val = append([]byte(nil), val...)
+			si.owned[string(key)] = idx
+		}
+		if offset >= len(val) {
+			val = append(val, make([]byte, offset+1-len(val))...)
+		}
+		val[offset] = b
+		idx.Meta.Value = val
+		idx.Meta.ValueSize = uint32(len(val))
+		return
+	}
+
+	si.patches[string(key)] = append(si.patches[string(key)], bytePatch{offset: offset, value: b})
+	if uint32(offset) >= idx.Meta.ValueSize {
+		idx.Meta.ValueSize = uint32(offset + 1)
+	}
+}
+
+//value 返回索引中key的值，由 SetBit 原地修改的值会被复制，以免在调用方读取时被修改
+//returns the value of key in the index, the value set in place by SetBit is copied,
+//so that it does not change under the caller
+func (si *StrIdx) value(key []byte, idx *index.Indexer) []byte {
+	if si.owned[string(key)] == idx {
+		return append([]byte(nil), idx.Meta.Value...)
+	}
+	return idx.Meta.Value
+}
+
+//reset 丢弃key的值之后由 SetBit 设置的字节，以及索引对值的持有
+//drops the bytes set by SetBit after the value of key, and the ownership of the value
+func (si *StrIdx) reset(key string) {
+	delete(si.patches, key)
+	delete(si.owned, key)
+}
+
+//applyPatches 将SetBit修改的字节应用到从文件读取的值上
+//apply the bytes set by SetBit to the value read from db file
+func (si *StrIdx) applyPatches(key, val []byte) []byte {
+	patches := si.patches[string(key)]
+	if len(patches) == 0 {
+		return val
+	}
+
+	length := len(val)
+	for _, p := range patches {
+		if p.offset >= length {
+			length = p.offset + 1
+		}
+	}
+
+	res := make([]byte, length)
+	copy(res, val)
+	for _, p := range patches {
+		res[p.offset] = p.value
+	}
+	return res
+}
+
+//setWithTTL 以一个批次写入key的值及其过期时间
+//store the value of key and its deadline as one batch
+func (db *kDB) setWithTTL(key, value []byte, milliseconds uint64) error {
+	if err := db.checkKeyValue(key, value); err != nil {
+		return err
+	}
+
+	db.strIndex.mu.Lock()
+	defer db.strIndex.mu.Unlock()
+
+	deadline := time.Now().UnixNano()/int64(time.Millisecond) + int64(milliseconds)
 	e := storage.NewEntryNoExtra(key, value, String, StringSet)
-	if err := db.store(e); err != nil {
+	idxes, err := db.storeBatch(e, expireEntry(key, deadline))
+	if err != nil {
+		return err
+	}
+	if err = db.buildIndex(e, idxes[0]); err != nil {
 		return err
 	}
+	db.expires[string(key)] = deadline
+	return nil
+}
 
-	//数据索引
-	idx := &index.Indexer{
-		Meta: &storage.Meta{
-			KeySize: uint32(len(e.Meta.Key)),
-			Key:     e.Meta.Key,
-		},
-		FileId:    db.activeFileID,
-		EntrySize: e.Size(),
-		Offset:    db.activeFile.Offset - int64(e.Size()),
-	}
-	if err = db.buildIndex(e, idx); err != nil {
+//expireAt 记录并设置key的过期时间，调用方需持有 strIndex.mu
+//log and set the deadline of key in unix milliseconds, the caller must hold strIndex.mu
+func (db *kDB) expireAt(key []byte, deadline int64) error {
+	if err := db.store(expireEntry(key, deadline)); err != nil {
+		return err
+	}
+	db.expires[string(key)] = deadline
+	return nil
+}
+
+//persist 记录并清除key的过期时间，调用方需持有 strIndex.mu
+//log and remove the deadline of key, the caller must hold strIndex.mu
+func (db *kDB) persist(key []byte) error {
+	if _, exist := db.expires[string(key)]; !exist {
+		return nil
+	}
+	if err := db.store(storage.NewEntryNoExtra(key, nil, String, StringPersist)); err != nil {
+		return err
+	}
+	delete(db.expires, string(key))
+	return nil
+}
+
+//expireEntry 记录key过期时间的日志
+//the log entry of the deadline of key
+func expireEntry(key []byte, deadline int64) *storage.Entry {
+	return storage.NewEntryNoExtra(key, []byte(strconv.FormatInt(deadline, 10)), String, StringExpire)
+}
+
+//removeExpiredKeys 加载数据文件后删除已过期的key，过期的操作已记录在日志中
+//remove the expired keys after the db files are loaded, the expiration is in the log already
+func (db *kDB) removeExpiredKeys() {
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+	for key, deadline := range db.expires {
+		if deadline <= now {
+			db.strIndex.idxList.Remove([]byte(key))
+			db.strIndex.reset(key)
+			delete(db.expires, key)
+		}
+	}
+}
+
+//remVal 删除key，调用方需持有 strIndex.mu
+//remove the key, the caller must hold strIndex.mu
+func (db *kDB) remVal(key []byte) error {
+	if ele := db.strIndex.idxList.Remove(key); ele != nil {
+		delete(db.expires, string(key))
+		db.strIndex.reset(string(key))
+		e := storage.NewEntryNoExtra(key, nil, String, StringRem)
+		if err := db.store(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//checkPairs 检查 key-value 对是否有效
+func (db *kDB) checkPairs(pairs [][]byte) error {
+	if len(pairs) == 0 || len(pairs)%2 != 0 {
+		return ErrWrongNumberOfArgs
+	}
+
+	for i := 0; i < len(pairs); i += 2 {
+		if err := db.checkKeyValue(pairs[i], pairs[i+1]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//doMSet 以一个批次写入多个key的值并清除它们的过期时间，调用方需持有 strIndex.mu
+//store the key value pairs and remove their deadlines as one batch, the caller must hold strIndex.mu
+func (db *kDB) doMSet(pairs [][]byte) error {
+	var entries []*storage.Entry
+	for i := 0; i < len(pairs); i += 2 {
+		if _, exist := db.expires[string(pairs[i])]; exist {
+			entries = append(entries, storage.NewEntryNoExtra(pairs[i], nil, String, StringPersist))
+		}
+		entries = append(entries, storage.NewEntryNoExtra(pairs[i], pairs[i+1], String, StringSet))
+	}
+
+	idxes, err := db.storeBatch(entries...)
+	if err != nil {
 		return err
 	}
+	for i, e := range entries {
+		if e.Mark == StringPersist {
+			delete(db.expires, string(e.Meta.Key))
+			continue
+		}
+		if err = db.buildIndex(e, idxes[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//incrBy 原子地增加key中储存的整数值，保留key的过期时间
+func (db *kDB) incrBy(key []byte, incr int64) (res int64, err error) {
+	if err = db.checkKeyValue(key, nil); err != nil {
+		return
+	}
+
+	db.strIndex.mu.Lock()
+	defer db.strIndex.mu.Unlock()
+
+	val, err := db.getNumber(key)
+	if err != nil {
+		return
+	}
+	if val != nil {
+		if res, err = strconv.ParseInt(string(val), 10, 64); err != nil {
+			return 0, ErrValueNotInteger
+		}
+	}
+
+	if (incr > 0 && res > math.MaxInt64-incr) || (incr < 0 && res < math.MinInt64-incr) {
+		return 0, ErrIncrOverflow
+	}
+	res += incr
+	err = db.setVal(key, []byte(strconv.FormatInt(res, 10)))
 	return
 }
+
+//getNumber 获取数值操作的原值，key不存在或已过期时返回nil
+func (db *kDB) getNumber(key []byte) ([]byte, error) {
+	val, err := db.getVal(key)
+	if err == ErrKeyNotExist || err == ErrKeyExpired {
+		return nil, nil
+	}
+	return val, err
+}
+
+//setVal 写入key的值并建立索引，调用方需持有 strIndex.mu
+//store the value of key and build the index, the caller must hold strIndex.mu
+func (db *kDB) setVal(key, value []byte) error {
+	return db.setVals(key, value)
+}
+
+//setVals 以一个批次写入多个key的值并建立索引，调用方需持有 strIndex.mu
+//store the key value pairs as one batch and build the indexes, the caller must hold strIndex.mu
+func (db *kDB) setVals(pairs ...[]byte) error {
+	var entries []*storage.Entry
+	for i := 0; i < len(pairs); i += 2 {
+		entries = append(entries, storage.NewEntryNoExtra(pairs[i], pairs[i+1], String, StringSet))
+	}
+
+	idxes, err := db.storeBatch(entries...)
+	if err != nil {
+		return err
+	}
+
+	//数据索引
+	for i, e := range entries {
+		if err = db.buildIndex(e, idxes[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
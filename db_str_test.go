@@ -2,9 +2,13 @@ package kDB
 
 import (
 	"fmt"
+	"github.com/KarlvenK/kDB/storage"
 	"log"
+	"math"
 	"math/rand"
+	"os"
 	"strconv"
+	"sync"
 	"testing"
 	"time"
 )
@@ -85,6 +89,7 @@ func TestKDB_Get(t *testing.T) {
 
 	t.Run("reopen and get", func(t *testing.T) {
 		db := ReopenDb()
+		defer db.Close()
 		t.Log("reopen db...")
 
 		val, _ := db.Get([]byte("test_key_924252"))
@@ -145,6 +150,362 @@ func TestKDB_Append(t *testing.T) {
 	t.Log(string(val))
 }
 
+func TestKDB_Incr(t *testing.T) {
+	db := InitDb()
+	defer db.Close()
+
+	key := []byte("test_counter")
+	_ = db.StrRem(key)
+
+	if res, err := db.Incr(key); err != nil || res != 1 {
+		t.Errorf("incr new key got %d, %v", res, err)
+	}
+	if res, err := db.IncrBy(key, 10); err != nil || res != 11 {
+		t.Errorf("incrby got %d, %v", res, err)
+	}
+	if res, err := db.Decr(key); err != nil || res != 10 {
+		t.Errorf("decr got %d, %v", res, err)
+	}
+	if res, err := db.DecrBy(key, 20); err != nil || res != -10 {
+		t.Errorf("decrby got %d, %v", res, err)
+	}
+
+	_ = db.Expire(key, 100)
+	_, _ = db.Incr(key)
+	if db.TTL(key) == 0 {
+		t.Error("incr should keep the ttl of key")
+	}
+
+	_ = db.Set([]byte("test_not_number"), []byte("abc"))
+	if _, err := db.Incr([]byte("test_not_number")); err != ErrValueNotInteger {
+		t.Errorf("incr not number, err = %v", err)
+	}
+
+	_ = db.Set(key, []byte(strconv.FormatInt(math.MaxInt64, 10)))
+	if _, err := db.Incr(key); err != ErrIncrOverflow {
+		t.Errorf("incr overflow, err = %v", err)
+	}
+}
+
+func TestKDB_IncrByFloat(t *testing.T) {
+	db := InitDb()
+	defer db.Close()
+
+	key := []byte("test_float_counter")
+	_ = db.Set(key, []byte("10.5"))
+
+	if res, err := db.IncrByFloat(key, 0.1); err != nil || res != 10.6 {
+		t.Errorf("incrbyfloat got %v, %v", res, err)
+	}
+	if res, err := db.IncrByFloat(key, -5); err != nil || res != 5.6 {
+		t.Errorf("incrbyfloat got %v, %v", res, err)
+	}
+	if val, _ := db.Get(key); string(val) != "5.6" {
+		t.Errorf("get float counter got %s", val)
+	}
+
+	_ = db.Set([]byte("test_not_number"), []byte("abc"))
+	if _, err := db.IncrByFloat([]byte("test_not_number"), 1); err != ErrValueNotFloat {
+		t.Errorf("incrbyfloat not number, err = %v", err)
+	}
+}
+
+func TestKDB_MSet(t *testing.T) {
+	db, config := OpenDb(t, "/tmp/kdb/db-mset", KeyOnlyRamMode)
+
+	err := db.MSet([]byte("m_key_1"), []byte("m_val_1"), []byte("m_key_2"), []byte("m_val_2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.MSet([]byte("m_key_3")); err != ErrWrongNumberOfArgs {
+		t.Errorf("mset without value, err = %v", err)
+	}
+
+	// an unfinished batch is dropped when replaying
+	e := storage.NewEntryNoExtra([]byte("m_key_broken"), []byte("m_val"), String, StringSet)
+	e.Continued = true
+	if err := db.activeFile.Write(e); err != nil {
+		t.Fatal(err)
+	}
+	db.meta.ActiveWriteOff = db.activeFile.Offset
+	db.Close()
+
+	for i := 0; i < 2; i++ {
+		if db, err = Open(config); err != nil {
+			t.Fatal(err)
+		}
+
+		values, err := db.MGet([]byte("m_key_1"), []byte("m_key_not_exist"), []byte("m_key_2"), []byte("m_key_broken"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(values[0]) != "m_val_1" || values[1] != nil || string(values[2]) != "m_val_2" || values[3] != nil {
+			t.Errorf("mget got %q", values)
+		}
+
+		// the writes after reopen do not complete the broken batch
+		_ = db.Set([]byte("m_key_3"), []byte("m_val_3"))
+		db.Close()
+	}
+}
+
+func TestKDB_MSetNx(t *testing.T) {
+	db := InitDb()
+	defer db.Close()
+
+	_ = db.StrRem([]byte("m_nx_key_1"))
+	_ = db.StrRem([]byte("m_nx_key_2"))
+	_ = db.Set([]byte("m_nx_key_3"), []byte("exist"))
+
+	ok, err := db.MSetNx([]byte("m_nx_key_1"), []byte("v1"), []byte("m_nx_key_2"), []byte("v2"))
+	if err != nil || !ok {
+		t.Errorf("msetnx got %v, %v", ok, err)
+	}
+
+	ok, err = db.MSetNx([]byte("m_nx_key_2"), []byte("new"), []byte("m_nx_key_3"), []byte("new"))
+	if err != nil || ok {
+		t.Errorf("msetnx with existing key got %v, %v", ok, err)
+	}
+	if val, _ := db.Get([]byte("m_nx_key_2")); string(val) != "v2" {
+		t.Errorf("msetnx should apply nothing, got %s", val)
+	}
+}
+
+func TestKDB_GetRange(t *testing.T) {
+	db := InitDb()
+	defer db.Close()
+
+	key := []byte("test_range")
+	_ = db.Set(key, []byte("This is a string"))
+
+	cases := []struct {
+		start, end int
+		want       string
+	}{
+		{0, 3, "This"},
+		{-3, -1, "ing"},
+		{0, -1, "This is a string"},
+		{10, 100, "string"},
+		{5, 2, ""},
+	}
+	for _, c := range cases {
+		if val, err := db.GetRange(key, c.start, c.end); err != nil || string(val) != c.want {
+			t.Errorf("getrange %d %d got %q, %v", c.start, c.end, val, err)
+		}
+	}
+
+	if val, err := db.GetRange([]byte("test_range_not_exist"), 0, -1); err != nil || val != nil {
+		t.Errorf("getrange not exist key got %q, %v", val, err)
+	}
+}
+
+func TestKDB_ReadExpiredConcurrently(t *testing.T) {
+	db, _ := OpenDb(t, "/tmp/kdb/db-expire-reads", KeyValueRamMode)
+	defer db.Close()
+
+	keys := make([][]byte, 50)
+	for i := range keys {
+		keys[i] = []byte(fmt.Sprintf("expire_read_key_%d", i))
+		if err := db.PSetEx(keys[i], []byte("expire_read_val"), 20); err != nil {
+			t.Fatal(err)
+		}
+	}
+	time.Sleep(30 * time.Millisecond)
+
+	// the readers find the same keys expired, and remove them after releasing the read lock
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			values, err := db.MGet(keys...)
+			if err != nil {
+				t.Error(err)
+			}
+			for j, val := range values {
+				if val != nil {
+					t.Errorf("mget expired key %s got %q", keys[j], val)
+				}
+			}
+			for _, key := range keys {
+				if val, err := db.GetRange(key, 0, -1); err != nil || val != nil {
+					t.Errorf("getrange expired key %s got %q, %v", key, val, err)
+				}
+				if bit, err := db.GetBit(key, 1); err != nil || bit != 0 {
+					t.Errorf("getbit expired key %s got %d, %v", key, bit, err)
+				}
+				if n := db.StrLen(key); n != 0 {
+					t.Errorf("strlen expired key %s got %d", key, n)
+				}
+				_, _ = db.Get(key)
+			}
+			if values, err := db.PrefixScan("expire_read_key_", -1, 0); err != nil || len(values) != 0 {
+				t.Errorf("prefixscan expired keys got %q, %v", values, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	for _, key := range keys {
+		if db.strIndex.idxList.Exist(key) {
+			t.Errorf("expired key %s is not removed", key)
+		}
+		if _, ok := db.expires[string(key)]; ok {
+			t.Errorf("the ttl of expired key %s is not removed", key)
+		}
+	}
+}
+
+func TestKDB_SetRange(t *testing.T) {
+	db := InitDb()
+	defer db.Close()
+
+	key := []byte("test_set_range")
+	_ = db.Set(key, []byte("Hello World"))
+
+	if n, err := db.SetRange(key, 6, []byte("Redis")); err != nil || n != 11 {
+		t.Errorf("setrange got %d, %v", n, err)
+	}
+	if val, _ := db.Get(key); string(val) != "Hello Redis" {
+		t.Errorf("get after setrange got %q", val)
+	}
+
+	_ = db.StrRem(key)
+	if n, err := db.SetRange(key, 3, []byte("abc")); err != nil || n != 6 {
+		t.Errorf("setrange with padding got %d, %v", n, err)
+	}
+	if val, _ := db.Get(key); string(val) != "\x00\x00\x00abc" {
+		t.Errorf("get after setrange got %q", val)
+	}
+
+	if _, err := db.SetRange(key, -1, []byte("a")); err != ErrOffsetOutOfRange {
+		t.Errorf("setrange negative offset, err = %v", err)
+	}
+	if _, err := db.SetRange(key, int(db.config.MaxValueSize), []byte("a")); err != ErrValueTooLarge {
+		t.Errorf("setrange too large, err = %v", err)
+	}
+}
+
+func TestKDB_SetEx(t *testing.T) {
+	db := InitDb()
+	defer db.Close()
+
+	key := []byte("test_set_ex")
+	if err := db.SetEx(key, []byte("val"), 100); err != nil {
+		t.Fatal(err)
+	}
+	if ttl := db.TTL(key); ttl == 0 || ttl > 100 {
+		t.Errorf("ttl after setex got %d", ttl)
+	}
+	if err := db.SetEx(key, []byte("val"), 0); err != ErrInvalidTTL {
+		t.Errorf("setex with zero ttl, err = %v", err)
+	}
+
+	if err := db.PSetEx(key, []byte("val"), 1500); err != nil {
+		t.Fatal(err)
+	}
+	if ttl := db.TTL(key); ttl != 2 {
+		t.Errorf("ttl after psetex got %d", ttl)
+	}
+	//the deadline is kept in milliseconds
+	if left := db.expires[string(key)] - time.Now().UnixNano()/int64(time.Millisecond); left <= 1000 || left > 1500 {
+		t.Errorf("expected the deadline 1500ms later, got %dms", left)
+	}
+}
+
+func TestKDB_SetExReplay(t *testing.T) {
+	config := DefaultConfig()
+	config.DirPath = "/tmp/kdb/db-setex-replay"
+	config.IdxMode = KeyOnlyRamMode
+	config.BlockSize = 128
+	config.ReclaimThreshold = 1
+	_ = os.RemoveAll(config.DirPath)
+
+	db, err := Open(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = db.SetEx([]byte("setex"), []byte("val"), 100)
+	_ = db.PSetEx([]byte("psetex"), []byte("val"), 50)
+	_ = db.SetEx([]byte("persisted"), []byte("val"), 100)
+	db.Persist([]byte("persisted"))
+	_ = db.Set([]byte("getex"), []byte("val"))
+	_, _ = db.GetEx([]byte("getex"), GetExOption{TTL: 100 * time.Second})
+	_ = db.SetEx([]byte("mset"), []byte("val"), 100)
+	_ = db.MSet([]byte("mset"), []byte("val2"))
+	_ = db.Close()
+
+	//the deadlines are in the log, not only in the expires file saved by Close
+	_ = os.Remove(config.DirPath + expireFile)
+	time.Sleep(100 * time.Millisecond)
+
+	if db, err = Open(config); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for _, key := range []string{"setex", "getex"} {
+		if ttl := db.TTL([]byte(key)); ttl == 0 || ttl > 100 {
+			t.Errorf("ttl of %s after reopen got %d", key, ttl)
+		}
+	}
+	if db.StrExists([]byte("psetex")) {
+		t.Error("the expired key is replayed")
+	}
+	for _, key := range []string{"persisted", "mset"} {
+		if !db.StrExists([]byte(key)) || db.TTL([]byte(key)) != 0 {
+			t.Errorf("expected %s without ttl after reopen, got %d", key, db.TTL([]byte(key)))
+		}
+	}
+
+	//only the current deadlines are kept by Reclaim
+	if err := db.Reclaim(); err != nil {
+		t.Fatal(err)
+	}
+	_ = db.Close()
+	_ = os.Remove(config.DirPath + expireFile)
+	if db, err = Open(config); err != nil {
+		t.Fatal(err)
+	}
+	if ttl := db.TTL([]byte("setex")); ttl == 0 || ttl > 100 {
+		t.Errorf("ttl after reclaim got %d", ttl)
+	}
+	if db.TTL([]byte("persisted")) != 0 {
+		t.Error("the removed ttl is back after reclaim")
+	}
+}
+
+func TestKDB_GetEx(t *testing.T) {
+	db := InitDb()
+	defer db.Close()
+
+	key := []byte("test_get_ex")
+	_ = db.Set(key, []byte("val"))
+
+	if val, err := db.GetEx(key, GetExOption{TTL: 100 * time.Second}); err != nil || string(val) != "val" {
+		t.Errorf("getex got %q, %v", val, err)
+	}
+	if db.TTL(key) != 100 {
+		t.Errorf("getex should set the ttl, got %d", db.TTL(key))
+	}
+	if val, err := db.GetEx(key, GetExOption{}); err != nil || string(val) != "val" || db.TTL(key) != 100 {
+		t.Errorf("getex without options should keep the ttl, got %q, %v, ttl %d", val, err, db.TTL(key))
+	}
+	if _, err := db.GetEx(key, GetExOption{TTL: time.Second, Persist: true}); err != ErrInvalidTTL {
+		t.Errorf("getex with ttl and persist, err = %v", err)
+	}
+	_, _ = db.GetEx(key, GetExOption{Persist: true})
+	if db.TTL(key) != 0 {
+		t.Error("getex should remove the ttl")
+	}
+
+	if val, err := db.GetDel(key); err != nil || string(val) != "val" {
+		t.Errorf("getdel got %q, %v", val, err)
+	}
+	if _, err := db.GetDel(key); err != ErrKeyNotExist {
+		t.Errorf("getdel removed key, err = %v", err)
+	}
+}
+
 func TestKDB_StrLen(t *testing.T) {
 	db := ReopenDb()
 	defer db.Close()
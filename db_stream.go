@@ -0,0 +1,416 @@
+package kDB
+
+import (
+	"github.com/KarlvenK/kDB/ds/stream"
+	"github.com/KarlvenK/kDB/storage"
+	"math"
+	"sync"
+	"time"
+)
+
+// StreamIdx the stream idx
+type StreamIdx struct {
+	mu      sync.RWMutex
+	indexes *stream.Streams
+}
+
+func newStreamIdx() *StreamIdx {
+	return &StreamIdx{indexes: stream.New()}
+}
+
+//reclaimer 保留有效的 XAdd，丢弃的 entries 替换为一个包含最后的ID和消费组的 entry
+//keeps the valid XAdds, and replaces the dropped entries of a stream by one entry of its last ID and groups
+func (si *StreamIdx) reclaimer() reclaimer {
+	return &keySnapshotReclaimer{
+		keys: make(map[string]bool),
+		dump: func(e *storage.Entry) {
+			si.mu.RLock()
+			e.Meta.Value = si.indexes.Snapshot(string(e.Meta.Key))
+			si.mu.RUnlock()
+			e.Meta.ValueSize = uint32(len(e.Meta.Value))
+			e.Meta.Extra = nil
+			e.Meta.ExtraSize = 0
+			e.Mark = StreamXSnapshot
+		},
+	}
+}
+
+// XAdd 向流中添加一个元素，fields 为 field-value 交替排列，返回元素的ID
+// id 为 * 时自动生成，为 ms-* 时自动生成序号，否则必须大于流中最大的ID
+// Appends an entry with the field-value pairs to the stream stored at key, returns the ID of the entry.
+// The ID is generated if id is *, the sequence is generated if id is ms-*,
+// otherwise id must be greater than any ID in the stream.
+func (db *kDB) XAdd(key []byte, id string, fields ...[]byte) (string, error) {
+	if err := db.checkKeyValue(key, fields...); err != nil {
+		return "", err
+	}
+	if len(fields) == 0 || len(fields)%2 != 0 {
+		return "", ErrWrongNumberOfArgs
+	}
+
+	db.streamIndex.mu.Lock()
+	defer db.streamIndex.mu.Unlock()
+
+	lastID, _ := db.streamIndex.indexes.LastID(string(key))
+	newID, err := nextStreamID(id, lastID)
+	if err != nil {
+		return "", err
+	}
+
+	e := storage.NewEntry(key, stream.EncodeFields(fields), []byte(newID.String()), Stream, StreamXAdd)
+	if err := db.store(e); err != nil {
+		return "", err
+	}
+
+	db.streamIndex.indexes.XAdd(string(key), newID, fields)
+	return newID.String(), nil
+}
+
+// XRange 返回ID在[start, end]中的元素，- 和 + 分别表示最小和最大的ID，count <= 0 时返回全部
+// Returns the entries with IDs between start and end (both inclusive),
+// - and + are the smallest and the greatest ID, all entries are returned if count <= 0.
+func (db *kDB) XRange(key []byte, start, end string, count int) ([]stream.Entry, error) {
+	if err := db.checkKeyValue(key, nil); err != nil {
+		return nil, err
+	}
+
+	startID, endID, err := parseStreamRange(start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	db.streamIndex.mu.RLock()
+	defer db.streamIndex.mu.RUnlock()
+
+	return db.streamIndex.indexes.XRange(string(key), startID, endID, count), nil
+}
+
+// XRevRange 与XRange相同，但是逆序返回元素
+// Same as XRange, but returns the entries in reverse order, starting with the greatest ID.
+func (db *kDB) XRevRange(key []byte, end, start string, count int) ([]stream.Entry, error) {
+	if err := db.checkKeyValue(key, nil); err != nil {
+		return nil, err
+	}
+
+	startID, endID, err := parseStreamRange(start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	db.streamIndex.mu.RLock()
+	defer db.streamIndex.mu.RUnlock()
+
+	return db.streamIndex.indexes.XRevRange(string(key), endID, startID, count), nil
+}
+
+// XLen 返回流中元素的个数
+// Returns the number of entries of the stream stored at key.
+func (db *kDB) XLen(key []byte) int {
+	if err := db.checkKeyValue(key, nil); err != nil {
+		return 0
+	}
+
+	db.streamIndex.mu.RLock()
+	defer db.streamIndex.mu.RUnlock()
+
+	return db.streamIndex.indexes.XLen(string(key))
+}
+
+// XTrim 删除最早的元素，只保留maxLen个，返回删除的元素个数
+// Evicts the oldest entries so that at most maxLen entries are kept, returns the number of evicted entries.
+func (db *kDB) XTrim(key []byte, maxLen int) (int, error) {
+	if err := db.checkKeyValue(key, nil); err != nil {
+		return 0, err
+	}
+	if maxLen < 0 {
+		return 0, ErrWrongNumberOfArgs
+	}
+
+	db.streamIndex.mu.Lock()
+	defer db.streamIndex.mu.Unlock()
+
+	k := string(key)
+	if db.streamIndex.indexes.XLen(k) <= maxLen {
+		return 0, nil
+	}
+
+	//the smallest ID kept is logged, so that the trim can be replayed on any state
+	lastID, _ := db.streamIndex.indexes.LastID(k)
+	minID := lastID.Next()
+	if maxLen > 0 {
+		entries := db.streamIndex.indexes.XRevRange(k, stream.MaxID, stream.MinID, maxLen)
+		minID = entries[len(entries)-1].ID
+	}
+
+	e := storage.NewEntry(key, nil, []byte(minID.String()), Stream, StreamXTrim)
+	if err := db.store(e); err != nil {
+		return 0, err
+	}
+	return db.streamIndex.indexes.XTrimMinID(k, minID), nil
+}
+
+// XGroupCreate 创建消费者组，id 为组最后投递的ID，$ 表示流中最大的ID
+// 流不存在时，mkStream 为 true 则创建一个空的流
+// Creates a consumer group whose last delivered ID is id, $ means the greatest ID of the stream.
+// An empty stream is created if it does not exist and mkStream is true.
+func (db *kDB) XGroupCreate(key []byte, group, id string, mkStream bool) error {
+	if err := db.checkKeyValue(key, nil); err != nil {
+		return err
+	}
+
+	db.streamIndex.mu.Lock()
+	defer db.streamIndex.mu.Unlock()
+
+	k := string(key)
+	if !db.streamIndex.indexes.XExists(k) && !mkStream {
+		return ErrKeyNotExist
+	}
+	if db.streamIndex.indexes.GroupExists(k, group) {
+		return ErrGroupExists
+	}
+
+	lastDelivered, _ := db.streamIndex.indexes.LastID(k)
+	if id != "$" {
+		var err error
+		if lastDelivered, err = stream.ParseID(id, 0); err != nil {
+			return err
+		}
+	}
+
+	return db.applyGroup(key, &stream.GroupUpdate{Group: group, LastDelivered: lastDelivered})
+}
+
+// XReadGroup 以消费者组中consumer的身份读取元素
+// id 为 > 时返回从未投递给组内任何消费者的元素，并记录到待确认列表中（noAck 为 true 时不记录）
+// 否则返回consumer的待确认列表中ID大于id的元素，已被删除的元素Fields为nil
+// Reads the entries as consumer of the consumer group.
+// If id is >, the entries never delivered to any consumer of the group are returned and added
+// to the pending entries list unless noAck is true. Otherwise the pending entries of the consumer
+// with IDs greater than id are returned, Fields of the entries deleted from the stream are nil.
+func (db *kDB) XReadGroup(key []byte, group, consumer, id string, count int, noAck bool) ([]stream.Entry, error) {
+	if err := db.checkKeyValue(key, nil); err != nil {
+		return nil, err
+	}
+
+	db.streamIndex.mu.Lock()
+	defer db.streamIndex.mu.Unlock()
+
+	k := string(key)
+	if !db.streamIndex.indexes.GroupExists(k, group) {
+		return nil, ErrNoSuchGroup
+	}
+
+	if id != ">" {
+		start, err := stream.ParseID(id, 0)
+		if err != nil {
+			return nil, err
+		}
+		return db.streamIndex.indexes.ReadPending(k, group, consumer, start, count), nil
+	}
+
+	entries := db.streamIndex.indexes.ReadNew(k, group, count)
+	if len(entries) == 0 {
+		return nil, nil
+	}
+
+	u := &stream.GroupUpdate{
+		Group:         group,
+		LastDelivered: entries[len(entries)-1].ID,
+		Consumers:     []string{consumer},
+	}
+	if !noAck {
+		now := time.Now().UnixNano() / int64(time.Millisecond)
+		for _, e := range entries {
+			u.Pending = append(u.Pending, stream.PendingEntry{
+				ID:            e.ID,
+				Consumer:      consumer,
+				DeliveryTime:  now,
+				DeliveryCount: 1,
+			})
+		}
+	}
+
+	if err := db.applyGroup(key, u); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// XAck 从消费者组的待确认列表中删除元素，返回删除的个数
+// Removes the entries from the pending entries list of the consumer group, returns the number of them.
+func (db *kDB) XAck(key []byte, group string, ids ...string) (int, error) {
+	if err := db.checkKeyValue(key, nil); err != nil {
+		return 0, err
+	}
+
+	streamIds, err := parseStreamIDs(ids)
+	if err != nil {
+		return 0, err
+	}
+
+	db.streamIndex.mu.Lock()
+	defer db.streamIndex.mu.Unlock()
+
+	k := string(key)
+	u := &stream.GroupUpdate{Group: group}
+	for _, id := range streamIds {
+		if _, ok := db.streamIndex.indexes.PendingEntry(k, group, id); ok {
+			u.Acked = append(u.Acked, id)
+		}
+	}
+	if len(u.Acked) == 0 {
+		return 0, nil
+	}
+
+	if err := db.applyGroup(key, u); err != nil {
+		return 0, err
+	}
+	return len(u.Acked), nil
+}
+
+// XPending 返回消费者组中ID在[start, end]中的待确认元素，consumer 不为空时只返回该消费者的
+// Returns the pending entries of the consumer group with IDs between start and end,
+// only the ones of consumer are returned if it is not empty.
+func (db *kDB) XPending(key []byte, group, start, end string, count int, consumer string) ([]stream.PendingEntry, error) {
+	if err := db.checkKeyValue(key, nil); err != nil {
+		return nil, err
+	}
+
+	startID, endID, err := parseStreamRange(start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	db.streamIndex.mu.RLock()
+	defer db.streamIndex.mu.RUnlock()
+
+	if !db.streamIndex.indexes.GroupExists(string(key), group) {
+		return nil, ErrNoSuchGroup
+	}
+	return db.streamIndex.indexes.XPending(string(key), group, startID, endID, count, consumer), nil
+}
+
+// XClaim 将空闲时间不少于minIdle的待确认元素转移给consumer，并返回这些元素
+// 已从流中删除的元素会被从待确认列表中移除
+// Changes the owner of the pending entries idle for at least minIdle to consumer, and returns them.
+// The pending entries deleted from the stream are removed from the pending entries list.
+func (db *kDB) XClaim(key []byte, group, consumer string, minIdle time.Duration, ids ...string) ([]stream.Entry, error) {
+	if err := db.checkKeyValue(key, nil); err != nil {
+		return nil, err
+	}
+
+	streamIds, err := parseStreamIDs(ids)
+	if err != nil {
+		return nil, err
+	}
+
+	db.streamIndex.mu.Lock()
+	defer db.streamIndex.mu.Unlock()
+
+	k := string(key)
+	if !db.streamIndex.indexes.GroupExists(k, group) {
+		return nil, ErrNoSuchGroup
+	}
+
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+	u := &stream.GroupUpdate{Group: group, Consumers: []string{consumer}}
+	var res []stream.Entry
+	for _, id := range streamIds {
+		p, ok := db.streamIndex.indexes.PendingEntry(k, group, id)
+		if !ok || time.Duration(now-p.DeliveryTime)*time.Millisecond < minIdle {
+			continue
+		}
+
+		entries := db.streamIndex.indexes.XRange(k, id, id, 1)
+		if len(entries) == 0 {
+			u.Acked = append(u.Acked, id)
+			continue
+		}
+
+		p.Consumer = consumer
+		p.DeliveryTime = now
+		p.DeliveryCount++
+		u.Pending = append(u.Pending, p)
+		res = append(res, entries[0])
+	}
+	if len(u.Pending) == 0 && len(u.Acked) == 0 {
+		return nil, nil
+	}
+
+	if err := db.applyGroup(key, u); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// applyGroup 记录并应用对消费者组的修改，调用者需持有锁
+func (db *kDB) applyGroup(key []byte, u *stream.GroupUpdate) error {
+	e := storage.NewEntryNoExtra(key, u.Encode(), Stream, StreamXGroup)
+	if err := db.store(e); err != nil {
+		return err
+	}
+
+	db.streamIndex.indexes.ApplyGroup(string(key), u)
+	return nil
+}
+
+// nextStreamID 根据XAdd的参数生成新元素的ID
+func nextStreamID(id string, lastID stream.ID) (stream.ID, error) {
+	if id == "*" {
+		now := uint64(time.Now().UnixNano() / int64(time.Millisecond))
+		if now > lastID.Ms {
+			return stream.ID{Ms: now}, nil
+		}
+		if lastID == stream.MaxID {
+			return stream.ID{}, ErrStreamIDTooSmall
+		}
+		return lastID.Next(), nil
+	}
+
+	var newID stream.ID
+	var err error
+	if n := len(id); n > 2 && id[n-2:] == "-*" {
+		if newID, err = stream.ParseID(id[:n-2], 0); err != nil {
+			return newID, err
+		}
+		if newID.Ms == lastID.Ms {
+			if lastID.Seq == math.MaxUint64 {
+				return newID, ErrStreamIDTooSmall
+			}
+			newID.Seq = lastID.Seq + 1
+		}
+	} else if newID, err = stream.ParseID(id, 0); err != nil {
+		return newID, err
+	}
+
+	//0-0 is never a valid ID
+	if !lastID.Less(newID) {
+		return newID, ErrStreamIDTooSmall
+	}
+	return newID, nil
+}
+
+// parseStreamRange 解析区间的起止ID，- 和 + 分别表示最小和最大的ID
+func parseStreamRange(start, end string) (startID, endID stream.ID, err error) {
+	startID, endID = stream.MinID, stream.MaxID
+	if start != "-" {
+		if startID, err = stream.ParseID(start, 0); err != nil {
+			return
+		}
+	}
+	if end != "+" {
+		endID, err = stream.ParseID(end, math.MaxUint64)
+	}
+	return
+}
+
+func parseStreamIDs(ids []string) ([]stream.ID, error) {
+	res := make([]stream.ID, len(ids))
+	for i, id := range ids {
+		var err error
+		if res[i], err = stream.ParseID(id, 0); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
@@ -0,0 +1,220 @@
+package kDB
+
+import (
+	"github.com/KarlvenK/kDB/ds/stream"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func streamIds(entries []stream.Entry) (res []string) {
+	for _, e := range entries {
+		res = append(res, e.ID.String())
+	}
+	return
+}
+
+func TestKDB_XAdd(t *testing.T) {
+	db, _ := OpenDb(t, "/tmp/kdb/db-stream", KeyValueRamMode)
+	defer db.Close()
+
+	key := []byte("my_stream")
+	if id, err := db.XAdd(key, "1-1", []byte("name"), []byte("kdb")); err != nil || id != "1-1" {
+		t.Errorf("xadd got %s, %v", id, err)
+	}
+	if id, _ := db.XAdd(key, "1-*", []byte("name"), []byte("kdb")); id != "1-2" {
+		t.Errorf("xadd with generated sequence got %s", id)
+	}
+	if _, err := db.XAdd(key, "1-2", []byte("name"), []byte("kdb")); err != ErrStreamIDTooSmall {
+		t.Errorf("xadd an old ID, err = %v", err)
+	}
+	if _, err := db.XAdd(key, "*", []byte("name")); err != ErrWrongNumberOfArgs {
+		t.Errorf("xadd odd fields, err = %v", err)
+	}
+	if _, err := db.XAdd(key, "abc", []byte("name"), []byte("kdb")); err != stream.ErrInvalidID {
+		t.Errorf("xadd an invalid ID, err = %v", err)
+	}
+	if _, err := db.XAdd([]byte("empty_stream"), "0-0", []byte("name"), []byte("kdb")); err != ErrStreamIDTooSmall {
+		t.Errorf("xadd 0-0, err = %v", err)
+	}
+
+	id, err := db.XAdd(key, "*", []byte("name"), []byte("kdb"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if db.XLen(key) != 3 {
+		t.Errorf("xlen got %d", db.XLen(key))
+	}
+
+	entries, _ := db.XRange(key, "-", "+", 0)
+	if got := streamIds(entries); !reflect.DeepEqual(got, []string{"1-1", "1-2", id}) {
+		t.Errorf("xrange got %v", got)
+	}
+	if string(entries[0].Fields[1]) != "kdb" {
+		t.Errorf("xrange fields got %q", entries[0].Fields)
+	}
+
+	entries, _ = db.XRevRange(key, "+", "1", 2)
+	if got := streamIds(entries); !reflect.DeepEqual(got, []string{id, "1-2"}) {
+		t.Errorf("xrevrange got %v", got)
+	}
+	entries, _ = db.XRange(key, "1", "1", 0)
+	if len(entries) != 2 {
+		t.Errorf("xrange of a millisecond got %v", streamIds(entries))
+	}
+
+	if n, _ := db.XTrim(key, 1); n != 2 || db.XLen(key) != 1 {
+		t.Errorf("xtrim got %d, xlen %d", n, db.XLen(key))
+	}
+	if _, err := db.XAdd(key, "1-3", []byte("name"), []byte("kdb")); err != ErrStreamIDTooSmall {
+		t.Errorf("xadd an ID smaller than the trimmed ones, err = %v", err)
+	}
+}
+
+func TestKDB_XReadGroup(t *testing.T) {
+	db, _ := OpenDb(t, "/tmp/kdb/db-stream", KeyValueRamMode)
+	defer db.Close()
+
+	key := []byte("my_stream")
+	for i := 1; i <= 5; i++ {
+		_, _ = db.XAdd(key, strconv.Itoa(i), []byte("n"), []byte(strconv.Itoa(i)))
+	}
+
+	if err := db.XGroupCreate([]byte("not_exist"), "g", "$", false); err != ErrKeyNotExist {
+		t.Errorf("xgroup create on a missing stream, err = %v", err)
+	}
+	if err := db.XGroupCreate(key, "g", "0", false); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.XGroupCreate(key, "g", "0", false); err != ErrGroupExists {
+		t.Errorf("xgroup create twice, err = %v", err)
+	}
+	if _, err := db.XReadGroup(key, "not_exist", "alice", ">", 0, false); err != ErrNoSuchGroup {
+		t.Errorf("xreadgroup of a missing group, err = %v", err)
+	}
+
+	entries, _ := db.XReadGroup(key, "g", "alice", ">", 2, false)
+	if got := streamIds(entries); !reflect.DeepEqual(got, []string{"1-0", "2-0"}) {
+		t.Errorf("xreadgroup alice got %v", got)
+	}
+	entries, _ = db.XReadGroup(key, "g", "bob", ">", 0, false)
+	if got := streamIds(entries); !reflect.DeepEqual(got, []string{"3-0", "4-0", "5-0"}) {
+		t.Errorf("xreadgroup bob got %v", got)
+	}
+	if entries, _ = db.XReadGroup(key, "g", "bob", ">", 0, false); len(entries) != 0 {
+		t.Errorf("xreadgroup with nothing new got %v", streamIds(entries))
+	}
+
+	//the history of alice
+	entries, _ = db.XReadGroup(key, "g", "alice", "0", 0, false)
+	if got := streamIds(entries); !reflect.DeepEqual(got, []string{"1-0", "2-0"}) {
+		t.Errorf("xreadgroup history of alice got %v", got)
+	}
+
+	if n, _ := db.XAck(key, "g", "1-0", "3-0", "9-0"); n != 2 {
+		t.Errorf("xack got %d", n)
+	}
+	pending, _ := db.XPending(key, "g", "-", "+", 0, "")
+	if len(pending) != 3 || pending[0].ID.String() != "2-0" || pending[0].Consumer != "alice" {
+		t.Errorf("xpending got %v", pending)
+	}
+	pending, _ = db.XPending(key, "g", "-", "+", 0, "bob")
+	if len(pending) != 2 {
+		t.Errorf("xpending of bob got %v", pending)
+	}
+
+	if entries, _ = db.XClaim(key, "g", "carol", time.Hour, "2-0"); len(entries) != 0 {
+		t.Errorf("xclaim entries not idle enough got %v", streamIds(entries))
+	}
+	entries, _ = db.XClaim(key, "g", "carol", 0, "2-0", "4-0")
+	if got := streamIds(entries); !reflect.DeepEqual(got, []string{"2-0", "4-0"}) {
+		t.Errorf("xclaim got %v", got)
+	}
+	pending, _ = db.XPending(key, "g", "-", "+", 0, "carol")
+	if len(pending) != 2 || pending[0].DeliveryCount != 2 {
+		t.Errorf("xpending of carol got %v", pending)
+	}
+
+	//the claimed entry deleted from the stream is removed from the pending entries list
+	_, _ = db.XTrim(key, 0)
+	if entries, _ = db.XClaim(key, "g", "carol", 0, "5-0"); len(entries) != 0 {
+		t.Errorf("xclaim a deleted entry got %v", streamIds(entries))
+	}
+	if pending, _ = db.XPending(key, "g", "-", "+", 0, ""); len(pending) != 2 {
+		t.Errorf("xpending after xclaim a deleted entry got %v", pending)
+	}
+}
+
+func TestKDB_StreamReplay(t *testing.T) {
+	replay := func(t *testing.T, mode DataIndexMode) {
+		db, config := OpenDb(t, "/tmp/kdb/db-stream-replay", mode)
+
+		key := []byte("my_replay_stream")
+		_ = db.XGroupCreate(key, "g", "$", true)
+		for i := 1; i <= 3000; i++ {
+			_, _ = db.XAdd(key, strconv.Itoa(i), []byte("field"), []byte("some value of the entry "+strconv.Itoa(i)))
+			if i%10 == 0 {
+				_, _ = db.XReadGroup(key, "g", "consumer_"+strconv.Itoa(i%3), ">", 10, false)
+			}
+			if i%20 == 0 {
+				_, _ = db.XAck(key, "g", strconv.Itoa(i-15))
+			}
+		}
+		_, _ = db.XTrim(key, 100)
+		_, _ = db.XClaim(key, "g", "claimer", 0, "2995")
+
+		type state struct {
+			entries []stream.Entry
+			pending []stream.PendingEntry
+			next    []stream.Entry
+		}
+		snapshot := func() state {
+			entries, _ := db.XRange(key, "-", "+", 0)
+			pending, _ := db.XPending(key, "g", "-", "+", 0, "")
+			next, _ := db.XRange(key, "2991", "+", 0)
+			return state{entries, pending, next}
+		}
+		want := snapshot()
+		if len(want.entries) != 100 || len(want.pending) == 0 {
+			t.Fatalf("unexpected state, %d entries, %d pending", len(want.entries), len(want.pending))
+		}
+
+		check := func(step string) {
+			if got := snapshot(); !reflect.DeepEqual(got, want) {
+				t.Errorf("%s: stream is not rebuilt correctly", step)
+			}
+			if _, err := db.XAdd(key, "2999", []byte("f"), []byte("v")); err != ErrStreamIDTooSmall {
+				t.Errorf("%s: the last ID is lost, err = %v", step, err)
+			}
+		}
+		check("before reopen")
+		db.Close()
+
+		var err error
+		if db, err = Open(config); err != nil {
+			t.Fatal(err)
+		}
+		check("after reopen")
+
+		if err = db.Reclaim(); err != nil {
+			t.Fatal(err)
+		}
+		check("after reclaim")
+		db.Close()
+
+		if db, err = Open(config); err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+		check("reopen after reclaim")
+	}
+
+	t.Run("KeyValueRamMode", func(t *testing.T) {
+		replay(t, KeyValueRamMode)
+	})
+
+	t.Run("KeyOnlyRamMode", func(t *testing.T) {
+		replay(t, KeyOnlyRamMode)
+	})
+}
@@ -0,0 +1,228 @@
+package kDB
+
+import (
+	"github.com/KarlvenK/kDB/ds/timeseries"
+	"github.com/KarlvenK/kDB/storage"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TSAutoTimestamp TSAdd 使用当前时间作为样本的时间戳
+// TSAdd uses the current time as the timestamp of the sample
+const TSAutoTimestamp int64 = -1
+
+type (
+	// TimeSeriesIdx the time series idx
+	TimeSeriesIdx struct {
+		mu      sync.RWMutex
+		indexes *timeseries.TimeSeries
+	}
+
+	// TSOption 创建时间序列的选项，Retention 为 0 时样本永久保留
+	// the options to create a time series, the samples are kept forever if Retention is 0
+	TSOption struct {
+		Retention time.Duration
+		Labels    map[string]string
+	}
+)
+
+func newTimeSeriesIdx() *TimeSeriesIdx {
+	return &TimeSeriesIdx{indexes: timeseries.New()}
+}
+
+//reclaimer 重放时间序列的操作，快照为每个时间序列的 dump
+//replays the time series operations, the snapshot is the dump of each series
+func (ti *TimeSeriesIdx) reclaimer() reclaimer {
+	series := timeseries.New()
+	return &replayReclaimer{
+		apply: func(e *storage.Entry) {
+			applyTimeSeries(series, string(e.Meta.Key), e.Mark, string(e.Meta.Extra), e.Meta.Value)
+		},
+		keys: series.Keys,
+		dump: func(key string) []*storage.Entry {
+			return []*storage.Entry{storage.NewEntryNoExtra([]byte(key), series.Dump(key), TimeSeries, TimeSeriesRestore)}
+		},
+	}
+}
+
+// TSCreate 创建一个时间序列
+// Creates a time series with the retention and labels.
+func (db *kDB) TSCreate(key []byte, opt TSOption) error {
+	if err := db.checkKeyValue(key, nil); err != nil {
+		return err
+	}
+	if opt.Retention < 0 {
+		return ErrInvalidTTL
+	}
+
+	db.timeSeriesIndex.mu.Lock()
+	defer db.timeSeriesIndex.mu.Unlock()
+
+	if db.timeSeriesIndex.indexes.Exists(string(key)) {
+		return timeseries.ErrSeriesExists
+	}
+
+	e := newTSCreateEntry(key, opt)
+	if err := db.store(e); err != nil {
+		return err
+	}
+	return db.timeSeriesIndex.indexes.Create(string(key), opt.Retention.Milliseconds(), opt.Labels)
+}
+
+// TSAdd 添加一个样本，时间戳为毫秒，TSAutoTimestamp 表示当前时间，序列不存在时以默认选项创建
+// 返回样本的时间戳，时间戳相同的样本被覆盖
+// Adds a sample with the timestamp in milliseconds, TSAutoTimestamp means the current time.
+// The series is created with the default options if it does not exist.
+// Returns the timestamp of the sample, the sample with the same timestamp is overwritten.
+func (db *kDB) TSAdd(key []byte, timestamp int64, value float64) (int64, error) {
+	if err := db.checkKeyValue(key, nil); err != nil {
+		return 0, err
+	}
+	if timestamp == TSAutoTimestamp {
+		timestamp = time.Now().UnixNano() / int64(time.Millisecond)
+	}
+
+	db.timeSeriesIndex.mu.Lock()
+	defer db.timeSeriesIndex.mu.Unlock()
+
+	k := string(key)
+	var entries []*storage.Entry
+	if !db.timeSeriesIndex.indexes.Exists(k) {
+		//the series is created in the same batch as the sample
+		if timestamp < 0 {
+			return 0, timeseries.ErrInvalidTimestamp
+		}
+		entries = append(entries, newTSCreateEntry(key, TSOption{}))
+	} else if err := db.timeSeriesIndex.indexes.CheckTimestamp(k, timestamp); err != nil {
+		return 0, err
+	}
+
+	extra := strconv.FormatInt(timestamp, 10)
+	entries = append(entries, storage.NewEntry(key, []byte(strconv.FormatFloat(value, 'g', -1, 64)), []byte(extra), TimeSeries, TimeSeriesAdd))
+	if _, err := db.storeBatch(entries...); err != nil {
+		return 0, err
+	}
+
+	if len(entries) > 1 {
+		_ = db.timeSeriesIndex.indexes.Create(k, 0, nil)
+	}
+	return timestamp, db.timeSeriesIndex.indexes.Add(k, timestamp, value)
+}
+
+// TSGet 返回最新的样本，序列中没有样本时返回nil
+// Returns the latest sample, nil if the series has no samples.
+func (db *kDB) TSGet(key []byte) (*timeseries.Sample, error) {
+	if err := db.checkKeyValue(key, nil); err != nil {
+		return nil, err
+	}
+
+	db.timeSeriesIndex.mu.RLock()
+	defer db.timeSeriesIndex.mu.RUnlock()
+
+	sample, ok, err := db.timeSeriesIndex.indexes.Get(string(key))
+	if err == timeseries.ErrSeriesNotExist {
+		return nil, ErrKeyNotExist
+	}
+	if !ok {
+		return nil, err
+	}
+	return &sample, nil
+}
+
+// TSRange 返回时间戳在[from, to]中的样本，agg 不为 timeseries.AggNone 时按 bucket 聚合，聚合结果的时间戳为桶的起始时间
+// Returns the samples with timestamps between from and to, aggregated in buckets unless agg is timeseries.AggNone.
+// The timestamps of the aggregations are the starts of the buckets.
+func (db *kDB) TSRange(key []byte, from, to int64, agg timeseries.Aggregation, bucket time.Duration) ([]timeseries.Sample, error) {
+	if err := db.checkKeyValue(key, nil); err != nil {
+		return nil, err
+	}
+
+	db.timeSeriesIndex.mu.RLock()
+	defer db.timeSeriesIndex.mu.RUnlock()
+
+	res, err := db.timeSeriesIndex.indexes.Range(string(key), from, to, agg, bucket.Milliseconds())
+	if err == timeseries.ErrSeriesNotExist {
+		return nil, ErrKeyNotExist
+	}
+	return res, err
+}
+
+// TSMRange 返回标签匹配所有过滤条件的序列在[from, to]中的样本，按key排序
+// 过滤条件为 label=value、label!=value、label=（没有该标签）或 label!=（有该标签），至少需要一个 label=value
+// Returns the samples between from and to of the series whose labels match all filters, sorted by key.
+// The filters are label=value, label!=value, label= (without the label) or label!= (with the label),
+// and at least one label=value is required.
+func (db *kDB) TSMRange(from, to int64, filters []string, agg timeseries.Aggregation, bucket time.Duration) ([]timeseries.Result, error) {
+	db.timeSeriesIndex.mu.RLock()
+	defer db.timeSeriesIndex.mu.RUnlock()
+
+	return db.timeSeriesIndex.indexes.MRange(from, to, filters, agg, bucket.Milliseconds())
+}
+
+// TSCreateRule 创建压缩规则，src 的每个时间桶结束时被聚合为 dest 的一个样本，dest 必须已经存在
+// Creates a compaction rule, each bucket of src is aggregated as a sample of dest when it is closed.
+// The dest series must exist, and it can not be the destination of another rule.
+func (db *kDB) TSCreateRule(src, dest []byte, agg timeseries.Aggregation, bucket time.Duration) error {
+	if err := db.checkKeyValue(src, nil); err != nil {
+		return err
+	}
+	if err := db.checkKeyValue(dest, nil); err != nil {
+		return err
+	}
+	if strings.Contains(string(dest), ExtraSeparator) {
+		return ErrExtraContainsSeparator
+	}
+
+	db.timeSeriesIndex.mu.Lock()
+	defer db.timeSeriesIndex.mu.Unlock()
+
+	err := db.timeSeriesIndex.indexes.CheckRule(string(src), string(dest), agg, bucket.Milliseconds())
+	if err == timeseries.ErrSeriesNotExist {
+		return ErrKeyNotExist
+	}
+	if err != nil {
+		return err
+	}
+
+	extra := string(dest) + ExtraSeparator + strconv.Itoa(int(agg)) + ExtraSeparator + strconv.FormatInt(bucket.Milliseconds(), 10)
+	e := storage.NewEntry(src, nil, []byte(extra), TimeSeries, TimeSeriesCreateRule)
+	if err := db.store(e); err != nil {
+		return err
+	}
+	return db.timeSeriesIndex.indexes.CreateRule(string(src), string(dest), agg, bucket.Milliseconds())
+}
+
+// TSDeleteRule 删除压缩规则，dest 中已有的样本被保留
+// Deletes the compaction rule, the samples already in dest are kept.
+func (db *kDB) TSDeleteRule(src, dest []byte) error {
+	if err := db.checkKeyValue(src, nil); err != nil {
+		return err
+	}
+
+	db.timeSeriesIndex.mu.Lock()
+	defer db.timeSeriesIndex.mu.Unlock()
+
+	if !db.timeSeriesIndex.indexes.Exists(string(src)) {
+		return ErrKeyNotExist
+	}
+	found := false
+	for _, rule := range db.timeSeriesIndex.indexes.Rules(string(src)) {
+		found = found || rule.DestKey == string(dest)
+	}
+	if !found {
+		return timeseries.ErrRuleNotExist
+	}
+
+	e := storage.NewEntry(src, nil, dest, TimeSeries, TimeSeriesDeleteRule)
+	if err := db.store(e); err != nil {
+		return err
+	}
+	return db.timeSeriesIndex.indexes.DeleteRule(string(src), string(dest))
+}
+
+func newTSCreateEntry(key []byte, opt TSOption) *storage.Entry {
+	extra := strconv.FormatInt(opt.Retention.Milliseconds(), 10)
+	return storage.NewEntry(key, timeseries.EncodeLabels(opt.Labels), []byte(extra), TimeSeries, TimeSeriesCreate)
+}
@@ -0,0 +1,221 @@
+package kDB
+
+import (
+	"github.com/KarlvenK/kDB/ds/timeseries"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestKDB_TSAdd(t *testing.T) {
+	db, _ := OpenDb(t, "/tmp/kdb/db-timeseries", KeyValueRamMode)
+	defer db.Close()
+
+	key := []byte("my_ts")
+	if _, err := db.TSGet(key); err != ErrKeyNotExist {
+		t.Errorf("get a missing series, err = %v", err)
+	}
+
+	//the series is created by the first sample
+	if ts, err := db.TSAdd(key, 1000, 1.5); ts != 1000 || err != nil {
+		t.Errorf("add got %d, %v", ts, err)
+	}
+	if err := db.TSCreate(key, TSOption{}); err != timeseries.ErrSeriesExists {
+		t.Errorf("create twice, err = %v", err)
+	}
+
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+	ts, _ := db.TSAdd(key, TSAutoTimestamp, 2)
+	if ts < now {
+		t.Errorf("expected the current time, got %d", ts)
+	}
+	if sample, _ := db.TSGet(key); sample == nil || sample.Timestamp != ts || sample.Value != 2 {
+		t.Errorf("get got %v", sample)
+	}
+	if _, err := db.TSAdd(key, -2, 1); err != timeseries.ErrInvalidTimestamp {
+		t.Errorf("add a negative timestamp, err = %v", err)
+	}
+
+	_ = db.TSCreate([]byte("empty"), TSOption{})
+	if sample, err := db.TSGet([]byte("empty")); sample != nil || err != nil {
+		t.Errorf("get an empty series got %v, %v", sample, err)
+	}
+}
+
+func TestKDB_TSRange(t *testing.T) {
+	db, _ := OpenDb(t, "/tmp/kdb/db-timeseries", KeyValueRamMode)
+	defer db.Close()
+
+	key := []byte("my_ts")
+	if err := db.TSCreate(key, TSOption{Retention: time.Second}); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 30; i++ {
+		_, _ = db.TSAdd(key, int64(i*100), float64(i))
+	}
+
+	//the samples older than the retention are dropped
+	res, _ := db.TSRange(key, 0, 10000, timeseries.AggNone, 0)
+	if len(res) != 11 || res[0].Timestamp != 1900 {
+		t.Errorf("range got %v", res)
+	}
+	if _, err := db.TSAdd(key, 1000, 0); err != timeseries.ErrTimestampTooOld {
+		t.Errorf("add an old sample, err = %v", err)
+	}
+
+	res, _ = db.TSRange(key, 2000, 2900, timeseries.AggSum, 500*time.Millisecond)
+	if !reflect.DeepEqual(res, []timeseries.Sample{{Timestamp: 2000, Value: 20 + 21 + 22 + 23 + 24}, {Timestamp: 2500, Value: 25 + 26 + 27 + 28 + 29}}) {
+		t.Errorf("range sum got %v", res)
+	}
+	if _, err := db.TSRange([]byte("missing"), 0, 1, timeseries.AggNone, 0); err != ErrKeyNotExist {
+		t.Errorf("range a missing series, err = %v", err)
+	}
+}
+
+func TestKDB_TSMRange(t *testing.T) {
+	db, _ := OpenDb(t, "/tmp/kdb/db-timeseries", KeyValueRamMode)
+	defer db.Close()
+
+	_ = db.TSCreate([]byte("cpu:1"), TSOption{Labels: map[string]string{"metric": "cpu", "host": "1"}})
+	_ = db.TSCreate([]byte("cpu:2"), TSOption{Labels: map[string]string{"metric": "cpu", "host": "2"}})
+	_ = db.TSCreate([]byte("mem:1"), TSOption{Labels: map[string]string{"metric": "mem", "host": "1"}})
+	for i := 0; i < 10; i++ {
+		for _, key := range []string{"cpu:1", "cpu:2", "mem:1"} {
+			_, _ = db.TSAdd([]byte(key), int64(i), float64(i))
+		}
+	}
+
+	res, err := db.TSMRange(0, 100, []string{"metric=cpu"}, timeseries.AggMax, 5*time.Millisecond)
+	if err != nil || len(res) != 2 || res[0].Key != "cpu:1" || res[1].Key != "cpu:2" {
+		t.Fatalf("mrange got %v, %v", res, err)
+	}
+	if !reflect.DeepEqual(res[1].Samples, []timeseries.Sample{{Timestamp: 0, Value: 4}, {Timestamp: 5, Value: 9}}) || res[1].Labels["host"] != "2" {
+		t.Errorf("mrange got %v", res[1])
+	}
+
+	if res, _ = db.TSMRange(0, 100, []string{"host=1", "metric!=cpu"}, timeseries.AggNone, 0); len(res) != 1 || res[0].Key != "mem:1" {
+		t.Errorf("mrange got %v", res)
+	}
+	if _, err = db.TSMRange(0, 100, []string{"host!=1"}, timeseries.AggNone, 0); err != timeseries.ErrInvalidFilter {
+		t.Errorf("mrange without a matcher, err = %v", err)
+	}
+}
+
+func TestKDB_TSCreateRule(t *testing.T) {
+	db, _ := OpenDb(t, "/tmp/kdb/db-timeseries", KeyValueRamMode)
+	defer db.Close()
+
+	src, dest := []byte("raw"), []byte("avg")
+	_ = db.TSCreate(src, TSOption{})
+	if err := db.TSCreateRule(src, dest, timeseries.AggAvg, time.Minute); err != ErrKeyNotExist {
+		t.Errorf("create a rule to a missing series, err = %v", err)
+	}
+	_ = db.TSCreate(dest, TSOption{})
+	if err := db.TSCreateRule(src, dest, timeseries.AggAvg, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.TSCreateRule(dest, []byte("other"), timeseries.AggAvg, 0); err == nil {
+		t.Error("expected an error for a zero bucket")
+	}
+
+	minute := int64(time.Minute / time.Millisecond)
+	for i := int64(0); i < 3*minute; i += 1000 {
+		_, _ = db.TSAdd(src, i, float64(i/minute))
+	}
+	res, _ := db.TSRange(dest, 0, 3*minute, timeseries.AggNone, 0)
+	if !reflect.DeepEqual(res, []timeseries.Sample{{Timestamp: 0, Value: 0}, {Timestamp: minute, Value: 1}}) {
+		t.Errorf("compacted got %v", res)
+	}
+
+	if err := db.TSDeleteRule(src, dest); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.TSDeleteRule(src, dest); err != timeseries.ErrRuleNotExist {
+		t.Errorf("delete a missing rule, err = %v", err)
+	}
+	_, _ = db.TSAdd(src, 5*minute, 5)
+	if res, _ = db.TSRange(dest, 0, 10*minute, timeseries.AggNone, 0); len(res) != 2 {
+		t.Errorf("dest is changed after the rule is deleted, got %v", res)
+	}
+}
+
+func TestKDB_TimeSeriesReplay(t *testing.T) {
+	replay := func(t *testing.T, mode DataIndexMode) {
+		db, config := OpenDb(t, "/tmp/kdb/db-timeseries-replay", mode)
+
+		src, sum, kept := []byte("src"), []byte("sum"), []byte("kept")
+		_ = db.TSCreate(src, TSOption{Retention: 20 * time.Second, Labels: map[string]string{"type": "raw"}})
+		_ = db.TSCreate(sum, TSOption{Labels: map[string]string{"type": "sum"}})
+		_ = db.TSCreate(kept, TSOption{})
+		if err := db.TSCreateRule(src, sum, timeseries.AggSum, time.Second); err != nil {
+			t.Fatal(err)
+		}
+
+		//enough operations to fill the archived files, the last ones are in the active file
+		for i := 0; i < 3000; i++ {
+			ts := int64(i * 37)
+			if i%10 == 0 {
+				//out of order samples change the closed buckets
+				ts -= 2000
+			}
+			_, _ = db.TSAdd(src, ts, float64(i%17))
+			_, _ = db.TSAdd(kept, int64(i), float64(i))
+			if i == 1500 {
+				_ = db.TSDeleteRule(src, sum)
+			}
+			if i == 2000 {
+				_ = db.TSCreateRule(src, sum, timeseries.AggCount, 2*time.Second)
+			}
+		}
+		_, _ = db.TSAdd([]byte("auto"), 1, 1)
+		if len(db.archFiles) == 0 {
+			t.Fatal("expected archived files")
+		}
+
+		keys := []string{"src", "sum", "kept", "auto"}
+		want := map[string][]byte{}
+		for _, key := range keys {
+			want[key] = db.timeSeriesIndex.indexes.Dump(key)
+		}
+		check := func(step string) {
+			for _, key := range keys {
+				if got := db.timeSeriesIndex.indexes.Dump(key); string(got) != string(want[key]) {
+					t.Errorf("%s: %s is not rebuilt correctly", step, key)
+				}
+			}
+		}
+		check("before reopen")
+		db.Close()
+
+		var err error
+		if db, err = Open(config); err != nil {
+			t.Fatal(err)
+		}
+		check("after reopen")
+
+		if err = db.Reclaim(); err != nil {
+			t.Fatal(err)
+		}
+		check("after reclaim")
+		db.Close()
+
+		if db, err = Open(config); err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+		check("reopen after reclaim")
+
+		res, _ := db.TSMRange(0, 1<<40, []string{"type=raw"}, timeseries.AggNone, 0)
+		if len(res) != 1 || len(res[0].Samples) == 0 {
+			t.Errorf("mrange after reclaim got %v", res)
+		}
+	}
+
+	t.Run("KeyValueRamMode", func(t *testing.T) {
+		replay(t, KeyValueRamMode)
+	})
+
+	t.Run("KeyOnlyRamMode", func(t *testing.T) {
+		replay(t, KeyOnlyRamMode)
+	})
+}
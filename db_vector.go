@@ -0,0 +1,173 @@
+package kDB
+
+import (
+	"github.com/KarlvenK/kDB/ds/vector"
+	"github.com/KarlvenK/kDB/storage"
+	"strconv"
+	"sync"
+)
+
+// VectorIdx the vector idx
+type VectorIdx struct {
+	mu      sync.RWMutex
+	indexes *vector.Vectors
+}
+
+func newVectorIdx() *VectorIdx {
+	return &VectorIdx{indexes: vector.New()}
+}
+
+//reclaimer 重放向量索引的操作，快照为创建索引并按相同的顺序再次添加向量
+//replays the vector operations, the snapshot creates each index and adds the vectors again in the same order
+func (vi *VectorIdx) reclaimer() reclaimer {
+	vectors := vector.New()
+	return &replayReclaimer{
+		apply: func(e *storage.Entry) {
+			applyVector(vectors, string(e.Meta.Key), e.Mark, string(e.Meta.Extra), e.Meta.Value)
+		},
+		keys: vectors.Keys,
+		dump: func(name string) []*storage.Entry {
+			dim, metric, _ := vectors.Info(name)
+			entries := []*storage.Entry{newVCreateEntry([]byte(name), dim, metric)}
+			for _, key := range vectors.Members(name) {
+				vec, meta, _ := vectors.Get(name, key)
+				entries = append(entries, storage.NewEntryNoExtra([]byte(name), vector.EncodeMember(key, vec, meta), Vector, VectorAdd))
+			}
+			return entries
+		},
+	}
+}
+
+// VCreate 创建一个向量索引，向量的维度为dim，按metric计算距离
+// Creates a vector index of dim dimensions, the distances are measured by metric.
+func (db *kDB) VCreate(index []byte, dim int, metric vector.Metric) error {
+	if err := db.checkKeyValue(index, nil); err != nil {
+		return err
+	}
+	if dim <= 0 || metric < vector.Cosine || metric > vector.InnerProduct {
+		return vector.ErrInvalidParams
+	}
+
+	db.vectorIndex.mu.Lock()
+	defer db.vectorIndex.mu.Unlock()
+
+	if db.vectorIndex.indexes.Exists(string(index)) {
+		return vector.ErrIndexExists
+	}
+
+	if err := db.store(newVCreateEntry(index, dim, metric)); err != nil {
+		return err
+	}
+	return db.vectorIndex.indexes.Create(string(index), dim, metric)
+}
+
+// VAdd 添加或替换索引中key的向量和元数据
+// Adds or replaces the vector and metadata of key in the index.
+func (db *kDB) VAdd(index, key []byte, vec []float32, meta map[string]string) error {
+	if err := db.checkKeyValue(index, key); err != nil {
+		return err
+	}
+
+	db.vectorIndex.mu.Lock()
+	defer db.vectorIndex.mu.Unlock()
+
+	if err := db.checkVector(index, vec); err != nil {
+		return err
+	}
+
+	e := storage.NewEntryNoExtra(index, vector.EncodeMember(string(key), vec, meta), Vector, VectorAdd)
+	if err := db.store(e); err != nil {
+		return err
+	}
+	return db.vectorIndex.indexes.Add(string(index), string(key), vec, meta)
+}
+
+// VDel 删除索引中key的向量
+// Deletes the vector of key in the index.
+func (db *kDB) VDel(index, key []byte) error {
+	if err := db.checkKeyValue(index, key); err != nil {
+		return err
+	}
+
+	db.vectorIndex.mu.Lock()
+	defer db.vectorIndex.mu.Unlock()
+
+	if !db.vectorIndex.indexes.Exists(string(index)) {
+		return ErrKeyNotExist
+	}
+	if _, _, ok := db.vectorIndex.indexes.Get(string(index), string(key)); !ok {
+		return ErrMemberNotExist
+	}
+
+	e := storage.NewEntryNoExtra(index, key, Vector, VectorDel)
+	if err := db.store(e); err != nil {
+		return err
+	}
+	_, err := db.vectorIndex.indexes.Del(string(index), string(key))
+	return err
+}
+
+// VGet 返回索引中key的向量和元数据
+// Returns the vector and metadata of key in the index.
+func (db *kDB) VGet(index, key []byte) ([]float32, map[string]string, error) {
+	if err := db.checkKeyValue(index, key); err != nil {
+		return nil, nil, err
+	}
+
+	db.vectorIndex.mu.RLock()
+	defer db.vectorIndex.mu.RUnlock()
+
+	if !db.vectorIndex.indexes.Exists(string(index)) {
+		return nil, nil, ErrKeyNotExist
+	}
+	vec, meta, ok := db.vectorIndex.indexes.Get(string(index), string(key))
+	if !ok {
+		return nil, nil, ErrMemberNotExist
+	}
+	return vec, meta, nil
+}
+
+// VCard returns the number of vectors in the index
+func (db *kDB) VCard(index []byte) int {
+	if err := db.checkKeyValue(index, nil); err != nil {
+		return 0
+	}
+
+	db.vectorIndex.mu.RLock()
+	defer db.vectorIndex.mu.RUnlock()
+
+	return db.vectorIndex.indexes.Card(string(index))
+}
+
+// VSearch 返回与vec最近的k个向量，按距离从小到大排列，filter 不为空时只返回元数据包含其中所有键值对的向量
+// 向量较少时结果是精确的，较多时使用 HNSW 图近似搜索
+// Returns the k nearest vectors to vec, ordered by distance from the smallest.
+// Only the vectors whose metadata contains all pairs of filter are returned if it is not empty.
+// The results are exact for small indexes, and approximated by the HNSW graph for large ones.
+func (db *kDB) VSearch(index []byte, vec []float32, k int, filter map[string]string) ([]vector.Result, error) {
+	if err := db.checkKeyValue(index, nil); err != nil {
+		return nil, err
+	}
+
+	db.vectorIndex.mu.RLock()
+	defer db.vectorIndex.mu.RUnlock()
+
+	if err := db.checkVector(index, vec); err != nil {
+		return nil, err
+	}
+	return db.vectorIndex.indexes.Search(string(index), vec, k, filter)
+}
+
+// checkVector 检查向量能否用于索引，调用者需持有锁
+func (db *kDB) checkVector(index []byte, vec []float32) error {
+	err := db.vectorIndex.indexes.CheckVector(string(index), vec)
+	if err == vector.ErrIndexNotExist {
+		return ErrKeyNotExist
+	}
+	return err
+}
+
+func newVCreateEntry(index []byte, dim int, metric vector.Metric) *storage.Entry {
+	extra := strconv.Itoa(dim) + ExtraSeparator + strconv.Itoa(int(metric))
+	return storage.NewEntry(index, nil, []byte(extra), Vector, VectorCreate)
+}
@@ -0,0 +1,148 @@
+package kDB
+
+import (
+	"github.com/KarlvenK/kDB/ds/vector"
+	"math/rand"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestKDB_VAdd(t *testing.T) {
+	db, _ := OpenDb(t, "/tmp/kdb/db-vector", KeyValueRamMode)
+	defer db.Close()
+
+	index := []byte("my_index")
+	if err := db.VAdd(index, []byte("a"), []float32{1, 0}, nil); err != ErrKeyNotExist {
+		t.Errorf("add to a missing index, err = %v", err)
+	}
+	if err := db.VCreate(index, 2, vector.Cosine); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.VCreate(index, 2, vector.L2); err != vector.ErrIndexExists {
+		t.Errorf("create twice, err = %v", err)
+	}
+	if err := db.VAdd(index, []byte("a"), []float32{1, 0, 0}, nil); err != vector.ErrDimensionMismatch {
+		t.Errorf("add a vector of a wrong dimension, err = %v", err)
+	}
+
+	_ = db.VAdd(index, []byte("a"), []float32{1, 0}, map[string]string{"lang": "go"})
+	_ = db.VAdd(index, []byte("b"), []float32{0, 1}, nil)
+	if vec, meta, err := db.VGet(index, []byte("a")); err != nil || !reflect.DeepEqual(vec, []float32{1, 0}) || meta["lang"] != "go" {
+		t.Errorf("get got %v, %v, %v", vec, meta, err)
+	}
+	if db.VCard(index) != 2 {
+		t.Errorf("expected 2 vectors, got %d", db.VCard(index))
+	}
+
+	if err := db.VDel(index, []byte("a")); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.VDel(index, []byte("a")); err != ErrMemberNotExist {
+		t.Errorf("delete a missing vector, err = %v", err)
+	}
+	if _, _, err := db.VGet(index, []byte("a")); err != ErrMemberNotExist {
+		t.Errorf("get a deleted vector, err = %v", err)
+	}
+}
+
+func TestKDB_VSearch(t *testing.T) {
+	db, _ := OpenDb(t, "/tmp/kdb/db-vector", KeyValueRamMode)
+	defer db.Close()
+
+	index := []byte("my_index")
+	_ = db.VCreate(index, 2, vector.L2)
+	for i := 0; i < 10; i++ {
+		meta := map[string]string{"even": strconv.FormatBool(i%2 == 0)}
+		_ = db.VAdd(index, []byte(strconv.Itoa(i)), []float32{float32(i), 0}, meta)
+	}
+
+	res, err := db.VSearch(index, []float32{3.2, 0}, 3, nil)
+	if err != nil || len(res) != 3 || res[0].Key != "3" || res[1].Key != "4" || res[2].Key != "2" {
+		t.Errorf("search got %v, %v", res, err)
+	}
+	res, _ = db.VSearch(index, []float32{3.2, 0}, 2, map[string]string{"even": "false"})
+	if len(res) != 2 || res[0].Key != "3" || res[1].Key != "5" {
+		t.Errorf("search with filter got %v", res)
+	}
+	if _, err := db.VSearch([]byte("missing"), []float32{0, 0}, 1, nil); err != ErrKeyNotExist {
+		t.Errorf("search a missing index, err = %v", err)
+	}
+}
+
+func TestKDB_VectorReplay(t *testing.T) {
+	replay := func(t *testing.T, mode DataIndexMode) {
+		db, config := OpenDb(t, "/tmp/kdb/db-vector-replay", mode)
+
+		index := []byte("embeddings")
+		if err := db.VCreate(index, 64, vector.Cosine); err != nil {
+			t.Fatal(err)
+		}
+
+		//enough operations to fill the archived files, the last ones are in the active file
+		r := rand.New(rand.NewSource(1))
+		for i := 0; i < 600; i++ {
+			vec := make([]float32, 64)
+			for j := range vec {
+				vec[j] = float32(r.NormFloat64())
+			}
+			key := []byte(strconv.Itoa(i % 240))
+			_ = db.VAdd(index, key, vec, map[string]string{"group": strconv.Itoa(i % 5)})
+			if i%7 == 0 {
+				_ = db.VDel(index, []byte(strconv.Itoa(i%220)))
+			}
+		}
+		if len(db.archFiles) == 0 {
+			t.Fatal("expected archived files")
+		}
+
+		query := make([]float32, 64)
+		for j := range query {
+			query[j] = float32(j)
+		}
+		members := db.vectorIndex.indexes.Members(string(index))
+		want, _ := db.VSearch(index, query, 10, map[string]string{"group": "3"})
+		check := func(step string) {
+			if got := db.vectorIndex.indexes.Members(string(index)); !reflect.DeepEqual(got, members) {
+				t.Errorf("%s: members are not rebuilt correctly", step)
+			}
+			for _, key := range members {
+				v1, m1, _ := db.vectorIndex.indexes.Get(string(index), key)
+				if v2, m2, err := db.VGet(index, []byte(key)); err != nil || !reflect.DeepEqual(v1, v2) || !reflect.DeepEqual(m1, m2) {
+					t.Fatalf("%s: %s is not rebuilt correctly", step, key)
+				}
+			}
+			if got, _ := db.VSearch(index, query, 10, map[string]string{"group": "3"}); !reflect.DeepEqual(got, want) {
+				t.Errorf("%s: search got %v", step, got)
+			}
+		}
+		check("before reopen")
+		db.Close()
+
+		var err error
+		if db, err = Open(config); err != nil {
+			t.Fatal(err)
+		}
+		check("after reopen")
+
+		if err = db.Reclaim(); err != nil {
+			t.Fatal(err)
+		}
+		check("after reclaim")
+		db.Close()
+
+		if db, err = Open(config); err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+		check("reopen after reclaim")
+	}
+
+	t.Run("KeyValueRamMode", func(t *testing.T) {
+		replay(t, KeyValueRamMode)
+	})
+
+	t.Run("KeyOnlyRamMode", func(t *testing.T) {
+		replay(t, KeyOnlyRamMode)
+	})
+}
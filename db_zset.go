@@ -4,19 +4,79 @@ import (
 	"github.com/KarlvenK/kDB/ds/zset"
 	"github.com/KarlvenK/kDB/storage"
 	"github.com/KarlvenK/kDB/utils"
+	"math"
 	"sync"
 )
 
+// ZRemRange 的一条日志中被移除成员的最大字节数
+// the max bytes of the removed members in one ZRemRange entry
+const zRemRangeEntrySize = 64 * 1024
+
 //ZsetIdx the zset idx
 type ZsetIdx struct {
 	mu      sync.RWMutex
 	indexes *zset.SortedSet
 }
 
+// ZAggOption 并集和交集的选项，Weights 为空时权重都为1，否则其长度需与key的个数相同
+// the options of the union and intersection, all weights are 1 if Weights is empty,
+// otherwise there must be a weight for each key
+type ZAggOption struct {
+	Weights   []float64
+	Aggregate zset.Aggregate
+}
+
+// ZMember 有序集的一个成员及其分值
+// a member of a sorted set with its score
+type ZMember struct {
+	Member []byte
+	Score  float64
+}
+
+// ZRangeOption 范围查询的选项，跳过前 Offset 个成员，最多返回 Count 个，Count 不大于0时不限制个数
+// WithScores 为 false 时不返回分值
+// the options of the range queries, which skip Offset members and return at most Count members.
+// There is no limit if Count is not positive, and the scores are left zero unless WithScores is true.
+type ZRangeOption struct {
+	WithScores bool
+	Offset     int
+	Count      int
+}
+
+// ZAddOption ZAddMembers 的选项
+// the options of ZAddMembers
+type ZAddOption struct {
+	NX   bool // only add new members, never update the existing ones
+	XX   bool // only update the existing members, never add new ones
+	GT   bool // only update the existing members if the new score is greater
+	LT   bool // only update the existing members if the new score is lower
+	CH   bool // count the updated members as well as the added ones
+	Incr bool // increment the score of the only member like ZIncrBy
+}
+
+// ZAddResult ZAddMembers 的结果
+// the result of ZAddMembers
+type ZAddResult struct {
+	// Count 新增的成员个数，设置 CH 时包括更新了分值的成员
+	// the number of added members, and the updated ones if CH is set
+	Count int
+
+	// Score 设置 Incr 时成员的新分值，Applied 为 false 表示选项阻止了更新
+	// the new score of the member if Incr is set, Applied is false if the update is prevented by the options
+	Score   float64
+	Applied bool
+}
+
 func newZsetIdx() *ZsetIdx {
 	return &ZsetIdx{indexes: zset.New()}
 }
 
+//reclaimer 保留有效的有序集 entry
+//keeps the valid sorted set entries
+func (zi *ZsetIdx) reclaimer() reclaimer {
+	return validReclaimer{}
+}
+
 // ZAdd 将 member 元素及其 score 值加入到有序集 key 当中
 // Adds the specified member with the specified score to the sorted set stored at key
 func (db *kDB) ZAdd(key []byte, score float64, member []byte) error {
@@ -37,6 +97,86 @@ func (db *kDB) ZAdd(key []byte, score float64, member []byte) error {
 	return nil
 }
 
+// ZAddMembers 按选项将多个成员及其分值加入到有序集 key 当中，所有成员只加锁一次并作为一个批次写入
+// Adds all the specified members with the specified scores to the sorted set stored at key, under the options.
+// The members are added under one lock and written in one batch.
+func (db *kDB) ZAddMembers(key []byte, opt ZAddOption, members ...ZMember) (res ZAddResult, err error) {
+	if err = db.checkKeyValue(key, nil); err != nil {
+		return
+	}
+	if len(members) == 0 {
+		return res, ErrWrongNumberOfArgs
+	}
+	if (opt.NX && (opt.XX || opt.GT || opt.LT)) || (opt.GT && opt.LT) || (opt.Incr && len(members) > 1) {
+		return res, ErrInvalidZAddFlags
+	}
+	for _, m := range members {
+		if err = db.checkKeyValue(key, m.Member); err != nil {
+			return
+		}
+		if math.IsNaN(m.Score) {
+			return res, ErrValueNotFloat
+		}
+	}
+
+	db.zsetIndex.mu.Lock()
+	defer db.zsetIndex.mu.Unlock()
+
+	//the scores decided in this call, a member may be given more than once
+	pending := make(map[string]float64)
+	var added, updated int
+	var entries []*storage.Entry
+	var changed []ZMember
+	for _, m := range members {
+		member := string(m.Member)
+		old, exist := pending[member]
+		if !exist && db.zsetIndex.indexes.ZIsMember(string(key), member) {
+			old, exist = db.zsetIndex.indexes.ZScore(string(key), member), true
+		}
+		if (exist && opt.NX) || (!exist && opt.XX) {
+			continue
+		}
+
+		score := m.Score
+		if opt.Incr && exist {
+			score += old
+		}
+		if math.IsNaN(score) {
+			return ZAddResult{}, ErrValueNotFloat
+		}
+		if exist && ((opt.GT && score <= old) || (opt.LT && score >= old)) {
+			continue
+		}
+
+		res.Score, res.Applied = score, true
+		if !exist {
+			added++
+		} else if score != old {
+			updated++
+		} else {
+			continue
+		}
+		pending[member] = score
+		entries = append(entries, storage.NewEntry(key, m.Member, []byte(utils.Float64ToStr(score)), ZSet, ZSetZAdd))
+		changed = append(changed, ZMember{Member: m.Member, Score: score})
+	}
+
+	if len(entries) > 0 {
+		if _, err = db.storeBatch(entries...); err != nil {
+			return ZAddResult{}, err
+		}
+	}
+	for _, m := range changed {
+		db.zsetIndex.indexes.ZAdd(string(key), m.Score, string(m.Member))
+	}
+
+	res.Count = added
+	if opt.CH {
+		res.Count += updated
+	}
+	return
+}
+
 // ZScore 返回集合key中对应member的score值，如果不存在则返回负无穷
 // Returns the score of member in the sorted set at key.
 func (db *kDB) ZScore(key, member []byte) float64 {
@@ -112,7 +252,16 @@ func (db *kDB) ZIncrBy(key []byte, increment float64, member []byte) (float64, e
 // ZRange 返回有序集 key 中，指定区间内的成员，其中成员的位置按 score 值递增(从小到大)来排序
 // 具有相同 score 值的成员按字典序(lexicographical order )来排列
 // Returns the specified range of elements in the sorted set stored at <key>.
+//
+// Deprecated: use ZRangeMembers instead.
 func (db *kDB) ZRange(key []byte, start, stop int) []interface{} {
+	return zmembersToPairs(db.ZRangeMembers(key, start, stop, true))
+}
+
+// ZRangeMembers 返回有序集 key 中排名介于 start 和 stop 之间的成员，按 score 值递增排列，withScores 为 false 时不返回分值
+// Returns the members with ranks between start and stop ordered from the lowest score,
+// negative ranks count from the highest score. The scores are left zero unless withScores is true.
+func (db *kDB) ZRangeMembers(key []byte, start, stop int, withScores bool) []ZMember {
 	if err := db.checkKeyValue(key, nil); err != nil {
 		return nil
 	}
@@ -120,7 +269,7 @@ func (db *kDB) ZRange(key []byte, start, stop int) []interface{} {
 	db.zsetIndex.mu.RLock()
 	defer db.zsetIndex.mu.RUnlock()
 
-	return db.zsetIndex.indexes.ZRange(string(key), start, stop)
+	return toZMembers(db.zsetIndex.indexes.ZRangeMembers(string(key), start, stop), withScores)
 }
 
 // ZRevRange 返回有序集 key 中，指定区间内的成员，其中成员的位置按 score 值递减(从大到小)来排列
@@ -128,7 +277,16 @@ func (db *kDB) ZRange(key []byte, start, stop int) []interface{} {
 // Returns the specified range of elements in the sorted set stored at key.
 // The elements are considered to be ordered from the highest to the lowest score.
 // Descending lexicographical order is used for elements with equal score.
+//
+// Deprecated: use ZRevRangeMembers instead.
 func (db *kDB) ZRevRange(key []byte, start, stop int) []interface{} {
+	return zmembersToPairs(db.ZRevRangeMembers(key, start, stop, true))
+}
+
+// ZRevRangeMembers 返回有序集 key 中排名介于 start 和 stop 之间的成员，按 score 值递减排列，withScores 为 false 时不返回分值
+// Returns the members with ranks between start and stop ordered from the highest score.
+// The scores are left zero unless withScores is true.
+func (db *kDB) ZRevRangeMembers(key []byte, start, stop int, withScores bool) []ZMember {
 	if err := db.checkKeyValue(key, nil); err != nil {
 		return nil
 	}
@@ -136,7 +294,7 @@ func (db *kDB) ZRevRange(key []byte, start, stop int) []interface{} {
 	db.zsetIndex.mu.RLock()
 	defer db.zsetIndex.mu.RUnlock()
 
-	return db.zsetIndex.indexes.ZRevRange(string(key), start, stop)
+	return toZMembers(db.zsetIndex.indexes.ZRevRangeMembers(string(key), start, stop), withScores)
 }
 
 // ZRem 移除有序集 key 中的 member 成员，不存在则将被忽略
@@ -163,6 +321,8 @@ func (db *kDB) ZRem(key, member []byte) (ok bool, err error) {
 // ZGetByRank 根据排名获取member及分值信息，从小到大排列遍历，即分值最低排名为0，依次类推
 // get the member at key by rank, the rank is ordered from lowest to highest.
 // The rank of lowest is 0 and so on.
+//
+// Deprecated: use ZMemberByRank instead.
 func (db *kDB) ZGetByRank(key []byte, rank int) []interface{} {
 	db.zsetIndex.mu.RLock()
 	defer db.zsetIndex.mu.RUnlock()
@@ -170,9 +330,24 @@ func (db *kDB) ZGetByRank(key []byte, rank int) []interface{} {
 	return db.zsetIndex.indexes.ZGetByRank(string(key), rank)
 }
 
+// ZMemberByRank 返回排名为 rank 的成员，分值最低排名为0，成员不存在时返回 false
+// Returns the member of the rank ordered from the lowest score, which has rank 0. ok is false if there is no such member.
+func (db *kDB) ZMemberByRank(key []byte, rank int) (ZMember, bool) {
+	db.zsetIndex.mu.RLock()
+	defer db.zsetIndex.mu.RUnlock()
+
+	e, ok := db.zsetIndex.indexes.ZMemberByRank(string(key), rank)
+	if !ok {
+		return ZMember{}, false
+	}
+	return ZMember{Member: []byte(e.Member), Score: e.Score}, true
+}
+
 // ZRevGetByRank 根据排名获取member及分值信息，从大到小排列遍历，即分值最高排名为0，依次类推
 // get the member at key by rank, the rank is ordered from highest to lowest.
 // The rank of highest is 0 and so on.
+//
+// Deprecated: use ZRevMemberByRank instead.
 func (db *kDB) ZRevGetByRank(key []byte, rank int) []interface{} {
 	db.zsetIndex.mu.RLock()
 	defer db.zsetIndex.mu.RUnlock()
@@ -180,11 +355,34 @@ func (db *kDB) ZRevGetByRank(key []byte, rank int) []interface{} {
 	return db.zsetIndex.indexes.ZRevGetByRank(string(key), rank)
 }
 
+// ZRevMemberByRank 返回排名为 rank 的成员，分值最高排名为0，成员不存在时返回 false
+// Returns the member of the rank ordered from the highest score, which has rank 0. ok is false if there is no such member.
+func (db *kDB) ZRevMemberByRank(key []byte, rank int) (ZMember, bool) {
+	db.zsetIndex.mu.RLock()
+	defer db.zsetIndex.mu.RUnlock()
+
+	e, ok := db.zsetIndex.indexes.ZRevMemberByRank(string(key), rank)
+	if !ok {
+		return ZMember{}, false
+	}
+	return ZMember{Member: []byte(e.Member), Score: e.Score}, true
+}
+
 // ZScoreRange 返回有序集 key 中，所有 score 值介于 min 和 max 之间(包括等于 min 或 max )的成员
 // 有序集成员按 score 值递增(从小到大)次序排列
 // Returns all the elements in the sorted set at key with a score between min and max (including elements with score equal to min or max).
 // The elements are considered to be ordered from low to high scores.
+//
+// Deprecated: use ZRangeByScore instead.
 func (db *kDB) ZScoreRange(key []byte, min, max float64) []interface{} {
+	return zmembersToPairs(db.ZRangeByScore(key, zset.Inclusive(min), zset.Inclusive(max), ZRangeOption{WithScores: true}))
+}
+
+// ZRangeByScore 返回有序集 key 中 score 值介于 min 和 max 之间的成员，按 score 值递增排列
+// 范围的两端可以不包含，如 zset.Exclusive(1.5)，可以通过 opt 跳过前面的成员并限制返回的个数
+// Returns the members with a score between min and max ordered from the lowest score.
+// The bounds may be exclusive like zset.Exclusive(1.5), and opt may skip and limit the members.
+func (db *kDB) ZRangeByScore(key []byte, min, max zset.ScoreBound, opt ZRangeOption) []ZMember {
 	if err := db.checkKeyValue(key, nil); err != nil {
 		return nil
 	}
@@ -192,14 +390,24 @@ func (db *kDB) ZScoreRange(key []byte, min, max float64) []interface{} {
 	db.zsetIndex.mu.RLock()
 	defer db.zsetIndex.mu.RUnlock()
 
-	return db.zsetIndex.indexes.ZScoreRange(string(key), min, max)
+	elems := db.zsetIndex.indexes.ZRangeByScore(string(key), min, max, opt.limit())
+	return toZMembers(elems, opt.WithScores)
 }
 
 // ZRevScoreRange 返回有序集 key 中， score 值介于 max 和 min 之间(包括等于 max 或 min )的所有的成员
 // 有序集成员按 score 值递减(从大到小)的次序排列
 // Returns all the elements in the sorted set at key with a score between max and min (including elements with score equal to max or min).
 // In contrary to the default ordering of sorted sets, for this command the elements are considered to be ordered from high to low scores.
+//
+// Deprecated: use ZRevRangeByScore instead.
 func (db *kDB) ZRevScoreRange(key []byte, max, min float64) []interface{} {
+	return zmembersToPairs(db.ZRevRangeByScore(key, zset.Inclusive(max), zset.Inclusive(min), ZRangeOption{WithScores: true}))
+}
+
+// ZRevRangeByScore 返回有序集 key 中 score 值介于 max 和 min 之间的成员，按 score 值递减排列
+// Returns the members with a score between max and min ordered from the highest score.
+// The bounds may be exclusive, and opt may skip and limit the members.
+func (db *kDB) ZRevRangeByScore(key []byte, max, min zset.ScoreBound, opt ZRangeOption) []ZMember {
 	if err := db.checkKeyValue(key, nil); err != nil {
 		return nil
 	}
@@ -207,5 +415,362 @@ func (db *kDB) ZRevScoreRange(key []byte, max, min float64) []interface{} {
 	db.zsetIndex.mu.RLock()
 	defer db.zsetIndex.mu.RUnlock()
 
-	return db.zsetIndex.indexes.ZRevScoreRange(string(key), max, min)
+	elems := db.zsetIndex.indexes.ZRevRangeByScore(string(key), max, min, opt.limit())
+	return toZMembers(elems, opt.WithScores)
+}
+
+// ZUnion 返回给定有序集的并集，结果按 score 值递增排列，与 ZRange 的格式相同
+// Returns the union of the sorted sets, the scores of a member are weighted and aggregated by opt.
+// The result is ordered from low to high scores, in the same format as ZRange.
+//
+// Deprecated: use ZUnionMembers instead.
+func (db *kDB) ZUnion(keys [][]byte, opt ZAggOption) ([]interface{}, error) {
+	members, err := db.ZUnionMembers(keys, opt)
+	return zmembersToPairs(members), err
+}
+
+// ZUnionMembers 返回给定有序集的并集，结果按 score 值递增排列
+// Returns the union of the sorted sets, the scores of a member are weighted and aggregated by opt.
+// The result is ordered from low to high scores.
+func (db *kDB) ZUnionMembers(keys [][]byte, opt ZAggOption) ([]ZMember, error) {
+	if err := checkZAggKeys(keys, opt); err != nil {
+		return nil, err
+	}
+
+	db.zsetIndex.mu.RLock()
+	defer db.zsetIndex.mu.RUnlock()
+
+	return toZMembers(db.zsetIndex.indexes.ZUnionMembers(keysToStrings(keys), opt.Weights, opt.Aggregate), true), nil
+}
+
+// ZInter 返回给定有序集的交集，结果按 score 值递增排列，与 ZRange 的格式相同
+// Returns the intersection of the sorted sets, the scores of a member are weighted and aggregated by opt.
+// The result is ordered from low to high scores, in the same format as ZRange.
+//
+// Deprecated: use ZInterMembers instead.
+func (db *kDB) ZInter(keys [][]byte, opt ZAggOption) ([]interface{}, error) {
+	members, err := db.ZInterMembers(keys, opt)
+	return zmembersToPairs(members), err
+}
+
+// ZInterMembers 返回给定有序集的交集，结果按 score 值递增排列
+// Returns the intersection of the sorted sets, the scores of a member are weighted and aggregated by opt.
+// The result is ordered from low to high scores.
+func (db *kDB) ZInterMembers(keys [][]byte, opt ZAggOption) ([]ZMember, error) {
+	if err := checkZAggKeys(keys, opt); err != nil {
+		return nil, err
+	}
+
+	db.zsetIndex.mu.RLock()
+	defer db.zsetIndex.mu.RUnlock()
+
+	return toZMembers(db.zsetIndex.indexes.ZInterMembers(keysToStrings(keys), opt.Weights, opt.Aggregate), true), nil
+}
+
+// ZUnionStore 将给定有序集的并集保存到 dst，dst 已存在时被覆盖，返回结果集的元素个数
+// Stores the union of the sorted sets in dst, which is overwritten if it exists.
+// Returns the number of members in the resulting sorted set.
+func (db *kDB) ZUnionStore(dst []byte, keys [][]byte, opt ZAggOption) (int, error) {
+	if err := checkZAggKeys(keys, opt); err != nil {
+		return 0, err
+	}
+	return db.zsetStore(dst, func() []zset.Element {
+		return db.zsetIndex.indexes.ZUnionMembers(keysToStrings(keys), opt.Weights, opt.Aggregate)
+	})
+}
+
+// ZInterStore 将给定有序集的交集保存到 dst，dst 已存在时被覆盖，返回结果集的元素个数
+// Stores the intersection of the sorted sets in dst, which is overwritten if it exists.
+// Returns the number of members in the resulting sorted set.
+func (db *kDB) ZInterStore(dst []byte, keys [][]byte, opt ZAggOption) (int, error) {
+	if err := checkZAggKeys(keys, opt); err != nil {
+		return 0, err
+	}
+	return db.zsetStore(dst, func() []zset.Element {
+		return db.zsetIndex.indexes.ZInterMembers(keysToStrings(keys), opt.Weights, opt.Aggregate)
+	})
+}
+
+// ZDiffStore 将第一个有序集中不在其余有序集中的成员保存到 dst，dst 已存在时被覆盖，返回结果集的元素个数
+// Stores the members of the first sorted set not in the successive ones in dst, which is overwritten if it exists.
+// Returns the number of members in the resulting sorted set.
+func (db *kDB) ZDiffStore(dst []byte, keys ...[]byte) (int, error) {
+	if len(keys) == 0 {
+		return 0, ErrWrongNumberOfArgs
+	}
+	return db.zsetStore(dst, func() []zset.Element {
+		return db.zsetIndex.indexes.ZDiffMembers(keysToStrings(keys)...)
+	})
+}
+
+// zsetStore 计算结果集并将清空 dst 和添加成员作为一个批次写入，结果为空时 dst 被删除
+// computes the resulting sorted set, and writes clearing dst and adding the members in one batch.
+// dst is deleted if the result is empty.
+func (db *kDB) zsetStore(dst []byte, op func() []zset.Element) (int, error) {
+	if err := db.checkKeyValue(dst, nil); err != nil {
+		return 0, err
+	}
+
+	db.zsetIndex.mu.Lock()
+	defer db.zsetIndex.mu.Unlock()
+
+	elems := op()
+	entries := []*storage.Entry{storage.NewEntryNoExtra(dst, nil, ZSet, ZSetZClear)}
+	for _, e := range elems {
+		extra := []byte(utils.Float64ToStr(e.Score))
+		entries = append(entries, storage.NewEntry(dst, []byte(e.Member), extra, ZSet, ZSetZAdd))
+	}
+	if _, err := db.storeBatch(entries...); err != nil {
+		return 0, err
+	}
+
+	db.zsetIndex.indexes.ZClear(string(dst))
+	for _, e := range elems {
+		db.zsetIndex.indexes.ZAdd(string(dst), e.Score, e.Member)
+	}
+	return len(elems), nil
+}
+
+func checkZAggKeys(keys [][]byte, opt ZAggOption) error {
+	if len(keys) == 0 || (len(opt.Weights) > 0 && len(opt.Weights) != len(keys)) {
+		return ErrWrongNumberOfArgs
+	}
+	if opt.Aggregate > zset.AggregateMax {
+		return ErrInvalidAggregate
+	}
+	return nil
+}
+
+// ZCount 返回有序集 key 中 score 值介于 min 和 max 之间(包括等于 min 或 max )的成员个数
+// Returns the number of elements in the sorted set at key with a score between min and max.
+func (db *kDB) ZCount(key []byte, min, max float64) int {
+	if err := db.checkKeyValue(key, nil); err != nil {
+		return 0
+	}
+
+	db.zsetIndex.mu.RLock()
+	defer db.zsetIndex.mu.RUnlock()
+
+	return db.zsetIndex.indexes.ZCount(string(key), min, max)
+}
+
+// ZLexCount 返回有序集 key 中成员介于 min 和 max 之间的个数，所有成员的 score 值应该相同
+// min 和 max 为 - 、+ 或以 [ (包含)、( (不包含)开头的成员
+// Returns the number of elements in the sorted set at key with a value between min and max,
+// when all the elements are inserted with the same score.
+// min and max are -, +, or a member started with [ (inclusive) or ( (exclusive).
+func (db *kDB) ZLexCount(key, min, max []byte) (int, error) {
+	if err := db.checkKeyValue(key, nil); err != nil {
+		return 0, err
+	}
+
+	db.zsetIndex.mu.RLock()
+	defer db.zsetIndex.mu.RUnlock()
+
+	return db.zsetIndex.indexes.ZLexCount(string(key), string(min), string(max))
+}
+
+// ZRangeByLex 返回有序集 key 中成员介于 min 和 max 之间的成员，按字典序排列
+// Returns all the elements in the sorted set at key with a value between min and max,
+// when all the elements are inserted with the same score.
+//
+// Deprecated: use ZRangeByLexMembers instead.
+func (db *kDB) ZRangeByLex(key, min, max []byte) ([]interface{}, error) {
+	members, err := db.ZRangeByLexMembers(key, min, max, ZRangeOption{WithScores: true})
+	return zmembersToPairs(members), err
+}
+
+// ZRangeByLexMembers 返回有序集 key 中成员介于 min 和 max 之间的成员，按字典序排列，可以通过 opt 跳过前面的成员并限制返回的个数
+// Returns the members between min and max in lexicographical order when all the members have the same score,
+// opt may skip and limit the members.
+func (db *kDB) ZRangeByLexMembers(key, min, max []byte, opt ZRangeOption) ([]ZMember, error) {
+	if err := db.checkKeyValue(key, nil); err != nil {
+		return nil, err
+	}
+
+	db.zsetIndex.mu.RLock()
+	defer db.zsetIndex.mu.RUnlock()
+
+	elems, err := db.zsetIndex.indexes.ZRangeByLexMembers(string(key), string(min), string(max), opt.limit())
+	return toZMembers(elems, opt.WithScores), err
+}
+
+// ZRevRangeByLex 返回有序集 key 中成员介于 max 和 min 之间的成员，按字典序的逆序排列
+// Returns all the elements in the sorted set at key with a value between max and min,
+// in reverse lexicographical order.
+//
+// Deprecated: use ZRevRangeByLexMembers instead.
+func (db *kDB) ZRevRangeByLex(key, max, min []byte) ([]interface{}, error) {
+	members, err := db.ZRevRangeByLexMembers(key, max, min, ZRangeOption{WithScores: true})
+	return zmembersToPairs(members), err
+}
+
+// ZRevRangeByLexMembers 返回有序集 key 中成员介于 max 和 min 之间的成员，按字典序的逆序排列
+// Returns the members between max and min in reverse lexicographical order, opt may skip and limit the members.
+func (db *kDB) ZRevRangeByLexMembers(key, max, min []byte, opt ZRangeOption) ([]ZMember, error) {
+	if err := db.checkKeyValue(key, nil); err != nil {
+		return nil, err
+	}
+
+	db.zsetIndex.mu.RLock()
+	defer db.zsetIndex.mu.RUnlock()
+
+	elems, err := db.zsetIndex.indexes.ZRevRangeByLexMembers(string(key), string(max), string(min), opt.limit())
+	return toZMembers(elems, opt.WithScores), err
+}
+
+// ZRemRangeByScore 移除有序集 key 中 score 值介于 min 和 max 之间(包括等于 min 或 max )的成员，返回被移除的成员个数
+// Removes all elements in the sorted set stored at key with a score between min and max (inclusive).
+// Returns the number of elements removed.
+func (db *kDB) ZRemRangeByScore(key []byte, min, max float64) (int, error) {
+	return db.zRemRange(key, func() ([]zset.Element, error) {
+		return db.zsetIndex.indexes.ZRangeByScore(string(key), zset.Inclusive(min), zset.Inclusive(max), zset.Limit{}), nil
+	})
+}
+
+// ZRemRangeByRank 移除有序集 key 中排名介于 start 和 stop 之间的成员，负数表示从最高分开始计数，返回被移除的成员个数
+// Removes all elements in the sorted set stored at key with rank between start and stop.
+// Negative ranks count from the element with the highest score. Returns the number of elements removed.
+func (db *kDB) ZRemRangeByRank(key []byte, start, stop int) (int, error) {
+	return db.zRemRange(key, func() ([]zset.Element, error) {
+		return db.zsetIndex.indexes.ZRangeMembers(string(key), start, stop), nil
+	})
+}
+
+// ZRemRangeByLex 移除有序集 key 中成员介于 min 和 max 之间的成员，返回被移除的成员个数
+// Removes all elements in the sorted set stored at key between the lexicographical range specified by min and max.
+// Returns the number of elements removed.
+func (db *kDB) ZRemRangeByLex(key, min, max []byte) (int, error) {
+	return db.zRemRange(key, func() ([]zset.Element, error) {
+		return db.zsetIndex.indexes.ZRangeByLexMembers(string(key), string(min), string(max), zset.Limit{})
+	})
+}
+
+// ZPopMin 移除并返回有序集 key 中 score 值最小的 count 个成员，按 score 值递增排列
+// Removes and returns up to count members with the lowest scores in the sorted set stored at key.
+//
+// Deprecated: use ZPopMinMembers instead.
+func (db *kDB) ZPopMin(key []byte, count int) ([]interface{}, error) {
+	members, err := db.ZPopMinMembers(key, count)
+	return zmembersToPairs(members), err
+}
+
+// ZPopMinMembers 移除并返回有序集 key 中 score 值最小的 count 个成员，按 score 值递增排列
+// Removes and returns up to count members with the lowest scores in the sorted set stored at key.
+func (db *kDB) ZPopMinMembers(key []byte, count int) ([]ZMember, error) {
+	return db.zPop(key, count, false)
+}
+
+// ZPopMax 移除并返回有序集 key 中 score 值最大的 count 个成员，按 score 值递减排列
+// Removes and returns up to count members with the highest scores in the sorted set stored at key.
+//
+// Deprecated: use ZPopMaxMembers instead.
+func (db *kDB) ZPopMax(key []byte, count int) ([]interface{}, error) {
+	members, err := db.ZPopMaxMembers(key, count)
+	return zmembersToPairs(members), err
+}
+
+// ZPopMaxMembers 移除并返回有序集 key 中 score 值最大的 count 个成员，按 score 值递减排列
+// Removes and returns up to count members with the highest scores in the sorted set stored at key.
+func (db *kDB) ZPopMaxMembers(key []byte, count int) ([]ZMember, error) {
+	return db.zPop(key, count, true)
+}
+
+func (db *kDB) zPop(key []byte, count int, max bool) ([]ZMember, error) {
+	if count <= 0 {
+		return nil, db.checkKeyValue(key, nil)
+	}
+
+	var elems []zset.Element
+	_, err := db.zRemRange(key, func() ([]zset.Element, error) {
+		if max {
+			elems = db.zsetIndex.indexes.ZRevRangeMembers(string(key), 0, count-1)
+		} else {
+			elems = db.zsetIndex.indexes.ZRangeMembers(string(key), 0, count-1)
+		}
+		return elems, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return toZMembers(elems, true), nil
+}
+
+// zRemRange 移除 find 返回的成员，被移除的成员作为一个批次写入日志，重放时与范围的计算无关
+// removes the members returned by find, and writes them as one batch,
+// so that replaying it does not depend on how the range was computed
+func (db *kDB) zRemRange(key []byte, find func() ([]zset.Element, error)) (int, error) {
+	if err := db.checkKeyValue(key, nil); err != nil {
+		return 0, err
+	}
+
+	db.zsetIndex.mu.Lock()
+	defer db.zsetIndex.mu.Unlock()
+
+	elems, err := find()
+	if err != nil || len(elems) == 0 {
+		return 0, err
+	}
+
+	members := make([]string, len(elems))
+	for i, e := range elems {
+		members[i] = e.Member
+	}
+	if _, err = db.storeBatch(db.zRemRangeEntries(key, members)...); err != nil {
+		return 0, err
+	}
+
+	for _, m := range members {
+		db.zsetIndex.indexes.ZRem(string(key), m)
+	}
+	return len(members), nil
+}
+
+// zRemRangeEntries 将被移除的成员分为多条日志，每条日志中成员的大小不超过 zRemRangeEntrySize 和数据文件的一半
+// splits the removed members into entries, the members in each entry take at most zRemRangeEntrySize bytes
+// and half of a db file
+func (db *kDB) zRemRangeEntries(key []byte, members []string) (entries []*storage.Entry) {
+	limit := zRemRangeEntrySize
+	if half := int(db.config.BlockSize / 2); half < limit {
+		limit = half
+	}
+
+	//the encoded members are concatenated, so they can be split between any two of them
+	var buf []byte
+	for _, m := range members {
+		enc := zset.EncodeMembers([]string{m})
+		if len(buf) > 0 && len(buf)+len(enc) > limit {
+			entries = append(entries, storage.NewEntryNoExtra(key, buf, ZSet, ZSetZRemRange))
+			buf = nil
+		}
+		buf = append(buf, enc...)
+	}
+	return append(entries, storage.NewEntryNoExtra(key, buf, ZSet, ZSetZRemRange))
+}
+
+func (opt ZRangeOption) limit() zset.Limit {
+	return zset.Limit{Offset: opt.Offset, Count: opt.Count}
+}
+
+func toZMembers(elems []zset.Element, withScores bool) []ZMember {
+	if len(elems) == 0 {
+		return nil
+	}
+	members := make([]ZMember, len(elems))
+	for i, e := range elems {
+		members[i].Member = []byte(e.Member)
+		if withScores {
+			members[i].Score = e.Score
+		}
+	}
+	return members
+}
+
+// zmembersToPairs 转换为成员和分值交替排列的格式，用于已废弃的函数
+// converts the members to members and scores in turn, for the deprecated functions
+func zmembersToPairs(members []ZMember) (val []interface{}) {
+	for _, m := range members {
+		val = append(val, string(m.Member), m.Score)
+	}
+	return
 }
@@ -1,6 +1,13 @@
 package kDB
 
 import (
+	"fmt"
+	"github.com/KarlvenK/kDB/ds/zset"
+	"github.com/KarlvenK/kDB/storage"
+	"math"
+	"os"
+	"reflect"
+	"strconv"
 	"testing"
 )
 
@@ -190,3 +197,381 @@ func TestKDB_ZRevScoreRange(t *testing.T) {
 	recScoreRange(200, 100)
 	recScoreRange(500, 200)
 }
+
+func TestKDB_ZUnion(t *testing.T) {
+	db, _ := OpenDb(t, "/tmp/kdb/db-zset", KeyValueRamMode)
+	defer db.Close()
+
+	_ = db.ZAdd([]byte("z1"), 1, []byte("a"))
+	_ = db.ZAdd([]byte("z1"), 2, []byte("b"))
+	_ = db.ZAdd([]byte("z2"), 3, []byte("b"))
+	_ = db.ZAdd([]byte("z2"), 4, []byte("c"))
+	keys := [][]byte{[]byte("z1"), []byte("z2")}
+
+	res, err := db.ZUnion(keys, ZAggOption{Weights: []float64{1, 2}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []interface{}{"a", 1.0, "b", 8.0, "c", 8.0}; !reflect.DeepEqual(res, want) {
+		t.Errorf("got %v, want %v", res, want)
+	}
+
+	res, err = db.ZInter(keys, ZAggOption{Aggregate: zset.AggregateMin})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []interface{}{"b", 2.0}; !reflect.DeepEqual(res, want) {
+		t.Errorf("got %v, want %v", res, want)
+	}
+
+	if _, err = db.ZUnion(keys, ZAggOption{Weights: []float64{1}}); err != ErrWrongNumberOfArgs {
+		t.Errorf("expected ErrWrongNumberOfArgs, got %v", err)
+	}
+	if _, err = db.ZInter(nil, ZAggOption{}); err != ErrWrongNumberOfArgs {
+		t.Errorf("expected ErrWrongNumberOfArgs, got %v", err)
+	}
+	if _, err = db.ZInter(keys, ZAggOption{Aggregate: 10}); err != ErrInvalidAggregate {
+		t.Errorf("expected ErrInvalidAggregate, got %v", err)
+	}
+}
+
+func TestKDB_ZStore(t *testing.T) {
+	db, _ := OpenDb(t, "/tmp/kdb/db-zset", KeyValueRamMode)
+	defer db.Close()
+
+	_ = db.ZAdd([]byte("z1"), 1, []byte("a"))
+	_ = db.ZAdd([]byte("z1"), 2, []byte("b"))
+	_ = db.ZAdd([]byte("z2"), 3, []byte("b"))
+	_ = db.ZAdd([]byte("dst"), 9, []byte("old"))
+	keys := [][]byte{[]byte("z1"), []byte("z2")}
+
+	n, err := db.ZUnionStore([]byte("dst"), keys, ZAggOption{Aggregate: zset.AggregateMax})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []interface{}{"a", 1.0, "b", 3.0}; n != 2 || !reflect.DeepEqual(db.ZRange([]byte("dst"), 0, -1), want) {
+		t.Errorf("unexpected union %v", db.ZRange([]byte("dst"), 0, -1))
+	}
+
+	if n, err = db.ZInterStore([]byte("dst"), keys, ZAggOption{}); err != nil || n != 1 || db.ZScore([]byte("dst"), []byte("b")) != 5 {
+		t.Errorf("unexpected intersection %v", db.ZRange([]byte("dst"), 0, -1))
+	}
+	if n, err = db.ZDiffStore([]byte("z1"), keys...); err != nil || n != 1 || db.ZCard([]byte("z1")) != 1 {
+		t.Errorf("unexpected difference %v", db.ZRange([]byte("z1"), 0, -1))
+	}
+	if n, _ = db.ZInterStore([]byte("dst"), [][]byte{[]byte("z1"), []byte("not_exist")}, ZAggOption{}); n != 0 || db.ZCard([]byte("dst")) != 0 {
+		t.Error("dst should be deleted by an empty result")
+	}
+	if _, err = db.ZDiffStore([]byte("dst")); err != ErrWrongNumberOfArgs {
+		t.Errorf("expected ErrWrongNumberOfArgs, got %v", err)
+	}
+}
+
+func TestKDB_ZsetReplay(t *testing.T) {
+	replay := func(t *testing.T, mode DataIndexMode) {
+		db, config := OpenDb(t, "/tmp/kdb/db-zset-replay", mode)
+
+		keys := [][]byte{[]byte("z1"), []byte("z2"), []byte("z3")}
+		//enough operations to fill the archived files, the last ones are in the active file
+		for i := 0; i < 3000; i++ {
+			member := []byte("m" + strconv.Itoa(i%40))
+			switch i % 5 {
+			case 0:
+				_ = db.ZAdd(keys[i%3], float64(i%17), member)
+			case 1:
+				_, _ = db.ZAddMembers(keys[i%3], ZAddOption{GT: true}, ZMember{Member: member, Score: float64(i % 13)},
+					ZMember{Member: []byte("m" + strconv.Itoa(i%31)), Score: float64(i % 11)})
+			case 2:
+				switch i % 4 {
+				case 0:
+					_, _ = db.ZRem(keys[(i+1)%3], member)
+				case 1:
+					_, _ = db.ZRemRangeByRank(keys[(i+1)%3], 1, 2)
+				case 2:
+					_, _ = db.ZPopMax(keys[(i+1)%3], 2)
+				default:
+					_, _ = db.ZRemRangeByScore(keys[(i+1)%3], float64(i%17), float64(i%17+1))
+				}
+			case 3:
+				_, _ = db.ZUnionStore([]byte("union"), keys[:2], ZAggOption{Weights: []float64{1, 0.5}})
+			default:
+				_, _ = db.ZDiffStore(keys[i%3], keys[i%3], []byte("union"))
+				_, _ = db.ZInterStore([]byte("inter"), keys, ZAggOption{Aggregate: zset.AggregateMax})
+			}
+		}
+		if len(db.archFiles) == 0 {
+			t.Fatal("expected archived files")
+		}
+
+		all := append(keys, []byte("union"), []byte("inter"))
+		want := make(map[string][]interface{})
+		for _, k := range all {
+			want[string(k)] = db.ZRange(k, 0, -1)
+		}
+		check := func(step string) {
+			for _, k := range all {
+				if got := db.ZRange(k, 0, -1); !reflect.DeepEqual(got, want[string(k)]) {
+					t.Errorf("%s: sorted set %s is not rebuilt correctly", step, k)
+				}
+			}
+		}
+		check("before reopen")
+		db.Close()
+
+		var err error
+		if db, err = Open(config); err != nil {
+			t.Fatal(err)
+		}
+		check("after reopen")
+
+		if err = db.Reclaim(); err != nil {
+			t.Fatal(err)
+		}
+		check("after reclaim")
+		db.Close()
+
+		if db, err = Open(config); err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+		check("reopen after reclaim")
+	}
+
+	t.Run("KeyValueRamMode", func(t *testing.T) {
+		replay(t, KeyValueRamMode)
+	})
+
+	t.Run("KeyOnlyRamMode", func(t *testing.T) {
+		replay(t, KeyOnlyRamMode)
+	})
+}
+
+func TestKDB_ZCount(t *testing.T) {
+	db, _ := OpenDb(t, "/tmp/kdb/db-zset", KeyValueRamMode)
+	defer db.Close()
+
+	key := []byte("my_zset")
+	for i, m := range []string{"a", "b", "c", "d", "e"} {
+		_ = db.ZAdd(key, float64(i), []byte(m))
+		_ = db.ZAdd([]byte("lex"), 0, []byte(m))
+	}
+
+	if n := db.ZCount(key, 1, 3); n != 3 {
+		t.Errorf("expected 3, got %d", n)
+	}
+	if n, err := db.ZLexCount([]byte("lex"), []byte("(a"), []byte("[c")); err != nil || n != 2 {
+		t.Errorf("expected 2, got %d %v", n, err)
+	}
+	res, err := db.ZRangeByLex([]byte("lex"), []byte("[d"), []byte("+"))
+	if want := []interface{}{"d", 0.0, "e", 0.0}; err != nil || !reflect.DeepEqual(res, want) {
+		t.Errorf("got %v, want %v", res, want)
+	}
+	res, err = db.ZRevRangeByLex([]byte("lex"), []byte("+"), []byte("[d"))
+	if want := []interface{}{"e", 0.0, "d", 0.0}; err != nil || !reflect.DeepEqual(res, want) {
+		t.Errorf("got %v, want %v", res, want)
+	}
+	if _, err = db.ZLexCount([]byte("lex"), []byte("a"), []byte("+")); err != zset.ErrInvalidLexRange {
+		t.Errorf("expected ErrInvalidLexRange, got %v", err)
+	}
+}
+
+func TestKDB_ZRemRangeLarge(t *testing.T) {
+	config := DefaultConfig()
+	config.DirPath = "/tmp/kdb/db-zset-remrange"
+	config.IdxMode = KeyValueRamMode
+	config.RwMethod = storage.MMap
+	config.BlockSize = 4 * 1024
+	_ = os.RemoveAll(config.DirPath)
+
+	db, err := Open(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := []byte("large_zset")
+	for i := 0; i < 500; i++ {
+		if err = db.ZAdd(key, float64(i), []byte(fmt.Sprintf("member_%04d", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	//the removed members take more than a db file, so they are split into several entries
+	if n, err := db.ZRemRangeByRank(key, 0, 449); err != nil || n != 450 {
+		t.Fatalf("expected 450 removed, got %d %v", n, err)
+	}
+	_ = db.Close()
+
+	if db, err = Open(config); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if n := db.ZCard(key); n != 50 {
+		t.Errorf("expected 50 members after reopen, got %d", n)
+	}
+	if want := []interface{}{"member_0450", 450.0}; !reflect.DeepEqual(db.ZRange(key, 0, 0), want) {
+		t.Errorf("got %v, want %v", db.ZRange(key, 0, 0), want)
+	}
+}
+
+func TestKDB_ZRemRange(t *testing.T) {
+	db, _ := OpenDb(t, "/tmp/kdb/db-zset", KeyValueRamMode)
+	defer db.Close()
+
+	key := []byte("my_zset")
+	for i, m := range []string{"a", "b", "c", "d", "e", "f", "g"} {
+		_ = db.ZAdd(key, float64(i), []byte(m))
+	}
+
+	if n, err := db.ZRemRangeByScore(key, 1, 2); err != nil || n != 2 {
+		t.Errorf("expected 2 removed, got %d %v", n, err)
+	}
+	if n, err := db.ZRemRangeByRank(key, -2, -1); err != nil || n != 2 {
+		t.Errorf("expected 2 removed, got %d %v", n, err)
+	}
+	if n, err := db.ZRemRangeByLex(key, []byte("[e"), []byte("+")); err != nil || n != 1 {
+		t.Errorf("expected 1 removed, got %d %v", n, err)
+	}
+	if want := []interface{}{"a", 0.0, "d", 3.0}; !reflect.DeepEqual(db.ZRange(key, 0, -1), want) {
+		t.Errorf("got %v, want %v", db.ZRange(key, 0, -1), want)
+	}
+	if n, err := db.ZRemRangeByRank(key, 5, 10); err != nil || n != 0 {
+		t.Errorf("expected 0 removed, got %d %v", n, err)
+	}
+}
+
+func TestKDB_ZPop(t *testing.T) {
+	db, _ := OpenDb(t, "/tmp/kdb/db-zset", KeyValueRamMode)
+	defer db.Close()
+
+	key := []byte("my_zset")
+	for i, m := range []string{"a", "b", "c", "d"} {
+		_ = db.ZAdd(key, float64(i), []byte(m))
+	}
+
+	res, err := db.ZPopMin(key, 2)
+	if want := []interface{}{"a", 0.0, "b", 1.0}; err != nil || !reflect.DeepEqual(res, want) {
+		t.Errorf("got %v, want %v", res, want)
+	}
+	res, err = db.ZPopMax(key, 5)
+	if want := []interface{}{"d", 3.0, "c", 2.0}; err != nil || !reflect.DeepEqual(res, want) {
+		t.Errorf("got %v, want %v", res, want)
+	}
+	if db.ZCard(key) != 0 {
+		t.Error("the sorted set should be empty")
+	}
+	if res, err = db.ZPopMin(key, 1); err != nil || len(res) != 0 {
+		t.Errorf("unexpected pop %v %v", res, err)
+	}
+}
+
+func TestKDB_ZAddMembers(t *testing.T) {
+	db, _ := OpenDb(t, "/tmp/kdb/db-zset", KeyValueRamMode)
+	defer db.Close()
+
+	key := []byte("my_zset")
+	members := func(pairs ...interface{}) (res []ZMember) {
+		for i := 0; i < len(pairs); i += 2 {
+			res = append(res, ZMember{Member: []byte(pairs[i].(string)), Score: pairs[i+1].(float64)})
+		}
+		return
+	}
+
+	res, err := db.ZAddMembers(key, ZAddOption{}, members("a", 1.0, "b", 2.0, "c", 3.0)...)
+	if err != nil || res.Count != 3 {
+		t.Fatalf("expected 3 added, got %+v %v", res, err)
+	}
+
+	tests := []struct {
+		name    string
+		opt     ZAddOption
+		members []ZMember
+		count   int
+		want    []interface{}
+	}{
+		{"nx", ZAddOption{NX: true}, members("a", 10.0, "d", 4.0), 1, []interface{}{"a", 1.0, "b", 2.0, "c", 3.0, "d", 4.0}},
+		{"xx", ZAddOption{XX: true, CH: true}, members("a", 5.0, "e", 5.0), 1, []interface{}{"b", 2.0, "c", 3.0, "d", 4.0, "a", 5.0}},
+		{"gt", ZAddOption{GT: true, CH: true}, members("a", 1.0, "b", 6.0, "f", 0.0), 2, []interface{}{"f", 0.0, "c", 3.0, "d", 4.0, "a", 5.0, "b", 6.0}},
+		{"lt", ZAddOption{LT: true}, members("c", 1.0, "d", 9.0), 0, []interface{}{"f", 0.0, "c", 1.0, "d", 4.0, "a", 5.0, "b", 6.0}},
+		{"duplicates", ZAddOption{CH: true}, members("g", 7.0, "g", 8.0), 2, []interface{}{"f", 0.0, "c", 1.0, "d", 4.0, "a", 5.0, "b", 6.0, "g", 8.0}},
+	}
+	for _, tt := range tests {
+		res, err := db.ZAddMembers(key, tt.opt, tt.members...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Count != tt.count {
+			t.Errorf("%s: expected count %d, got %d", tt.name, tt.count, res.Count)
+		}
+		if !reflect.DeepEqual(db.ZRange(key, 0, -1), tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, db.ZRange(key, 0, -1), tt.want)
+		}
+	}
+	res, err = db.ZAddMembers(key, ZAddOption{Incr: true}, members("a", 2.5)...)
+	if err != nil || !res.Applied || res.Score != 7.5 || db.ZScore(key, []byte("a")) != 7.5 {
+		t.Errorf("unexpected incr result %+v %v", res, err)
+	}
+	res, err = db.ZAddMembers(key, ZAddOption{Incr: true, GT: true}, members("a", -1.0)...)
+	if err != nil || res.Applied {
+		t.Errorf("the incr should be prevented by gt, got %+v %v", res, err)
+	}
+
+	invalid := []ZAddOption{{NX: true, XX: true}, {NX: true, GT: true}, {GT: true, LT: true}}
+	for _, opt := range invalid {
+		if _, err = db.ZAddMembers(key, opt, members("a", 1.0)...); err != ErrInvalidZAddFlags {
+			t.Errorf("expected ErrInvalidZAddFlags for %+v, got %v", opt, err)
+		}
+	}
+	if _, err = db.ZAddMembers(key, ZAddOption{Incr: true}, members("a", 1.0, "b", 1.0)...); err != ErrInvalidZAddFlags {
+		t.Errorf("expected ErrInvalidZAddFlags, got %v", err)
+	}
+	if _, err = db.ZAddMembers(key, ZAddOption{}); err != ErrWrongNumberOfArgs {
+		t.Errorf("expected ErrWrongNumberOfArgs, got %v", err)
+	}
+	if _, err = db.ZAddMembers(key, ZAddOption{}, members("a", math.NaN())...); err != ErrValueNotFloat {
+		t.Errorf("expected ErrValueNotFloat, got %v", err)
+	}
+}
+
+func TestKDB_ZRangeMembers(t *testing.T) {
+	db, _ := OpenDb(t, "/tmp/kdb/db-zset", KeyValueRamMode)
+	defer db.Close()
+
+	key := []byte("my_zset")
+	for i, m := range []string{"a", "b", "c", "d", "e"} {
+		_ = db.ZAdd(key, float64(i)+0.5, []byte(m))
+	}
+
+	got := db.ZRangeMembers(key, 1, 2, true)
+	if want := []ZMember{{Member: []byte("b"), Score: 1.5}, {Member: []byte("c"), Score: 2.5}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	got = db.ZRevRangeMembers(key, 0, 0, false)
+	if want := []ZMember{{Member: []byte("e")}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	got = db.ZRangeByScore(key, zset.Exclusive(1.5), zset.Inclusive(math.Inf(1)), ZRangeOption{WithScores: true, Offset: 1, Count: 2})
+	if want := []ZMember{{Member: []byte("d"), Score: 3.5}, {Member: []byte("e"), Score: 4.5}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	got = db.ZRevRangeByScore(key, zset.Exclusive(4.5), zset.Exclusive(1.5), ZRangeOption{})
+	if want := []ZMember{{Member: []byte("d")}, {Member: []byte("c")}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	if m, ok := db.ZMemberByRank(key, 4); !ok || string(m.Member) != "e" || m.Score != 4.5 {
+		t.Errorf("unexpected member %v", m)
+	}
+	if _, ok := db.ZRevMemberByRank(key, 5); ok {
+		t.Error("the rank is out of range")
+	}
+
+	popped, err := db.ZPopMinMembers(key, 1)
+	if want := []ZMember{{Member: []byte("a"), Score: 0.5}}; err != nil || !reflect.DeepEqual(popped, want) {
+		t.Errorf("got %v, want %v", popped, want)
+	}
+
+	//the deprecated functions keep the old format
+	if want := []interface{}{"b", 1.5}; !reflect.DeepEqual(db.ZScoreRange(key, 1, 2), want) {
+		t.Errorf("got %v, want %v", db.ZScoreRange(key, 1, 2), want)
+	}
+}
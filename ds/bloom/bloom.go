@@ -0,0 +1,262 @@
+package bloom
+
+import (
+	"errors"
+	"hash/fnv"
+	"math"
+)
+
+// 概率型的成员判断：布隆过滤器和布谷鸟过滤器，只保存元素的哈希而不保存元素本身
+// 布隆过滤器不能删除元素，布谷鸟过滤器可以删除和计数
+// 两种过滤器都是可扩展的，容量用完后添加一个新的子过滤器
+// Probabilistic membership: bloom filters and cuckoo filters, which keep the hashes of the items instead of the items.
+// Items cannot be deleted from a bloom filter, while a cuckoo filter supports deleting and counting.
+// Both filters are scalable, a new sub filter is added when the capacity is used up.
+
+// default parameters of the filters created implicitly
+const (
+	DefaultErrorRate       = 0.01
+	DefaultCapacity        = 100
+	DefaultExpansion       = 2
+	DefaultCuckooCapacity  = 1024
+	DefaultBucketSize      = 2
+	DefaultCuckooExpansion = 1
+	DefaultMaxIterations   = 20
+)
+
+var (
+	// ErrInvalidParams the error rate, the capacity or other parameters are invalid
+	ErrInvalidParams = errors.New("ds/bloom: invalid filter parameters")
+
+	// ErrFilterExists the key already holds a filter
+	ErrFilterExists = errors.New("ds/bloom: filter already exists")
+
+	// ErrFilterNotExist the key does not hold a filter
+	ErrFilterNotExist = errors.New("ds/bloom: filter does not exist")
+
+	// ErrWrongType the key holds a filter of the other kind
+	ErrWrongType = errors.New("ds/bloom: key holds a filter of the other kind")
+
+	// ErrFilterFull the filter is full and not scalable
+	ErrFilterFull = errors.New("ds/bloom: filter is full")
+
+	// ErrInvalidData the dumped filter is invalid
+	ErrInvalidData = errors.New("ds/bloom: invalid filter data")
+)
+
+type (
+	Record map[string]filter
+
+	// Filters bloom and cuckoo filters struct
+	Filters struct {
+		record Record
+	}
+
+	filter interface {
+		encode(w *writer)
+	}
+
+	// Bloom 可扩展的布隆过滤器，新的子过滤器的容量为上一个的expansion倍，错误率为上一个的一半
+	// expansion 为 0 时不可扩展
+	// a scalable bloom filter, each new layer has expansion times the capacity and half the error rate of the last one.
+	// The filter is not scalable if expansion is 0.
+	Bloom struct {
+		errorRate float64
+		expansion uint64
+		layers    []*bloomLayer
+	}
+
+	bloomLayer struct {
+		bits     []byte
+		m        uint64 // the number of bits
+		k        uint64 // the number of hash functions
+		capacity uint64
+		count    uint64
+	}
+)
+
+// New new filters
+func New() *Filters {
+	return &Filters{make(Record)}
+}
+
+// BFReserve 创建一个布隆过滤器，errorRate 为期望的错误率，capacity 为第一个子过滤器的容量
+// creates a bloom filter with the expected error rate and the capacity of the first layer
+func (f *Filters) BFReserve(key string, errorRate float64, capacity, expansion uint64) error {
+	if errorRate <= 0 || errorRate >= 1 || capacity == 0 {
+		return ErrInvalidParams
+	}
+	if _, exist := f.record[key]; exist {
+		return ErrFilterExists
+	}
+
+	f.record[key] = &Bloom{
+		errorRate: errorRate,
+		expansion: expansion,
+		layers:    []*bloomLayer{newBloomLayer(capacity, errorRate)},
+	}
+	return nil
+}
+
+// BFAdd 添加元素，返回元素是否是新添加的，已经可能存在的元素不会被添加
+// adds the item, returns false if the item may exist already
+func (f *Filters) BFAdd(key string, item []byte) (bool, error) {
+	b, err := f.bloom(key)
+	if err != nil {
+		return false, err
+	}
+	return b.add(item)
+}
+
+// BFExists 判断元素是否可能存在，返回 false 时一定不存在
+// whether the item may exist, false means the item definitely does not exist
+func (f *Filters) BFExists(key string, item []byte) (bool, error) {
+	b, err := f.bloom(key)
+	if err != nil {
+		if err == ErrFilterNotExist {
+			return false, nil
+		}
+		return false, err
+	}
+	return b.exists(item), nil
+}
+
+// Exists whether the key holds a filter
+func (f *Filters) Exists(key string) bool {
+	_, exist := f.record[key]
+	return exist
+}
+
+// IsBloom whether the key holds a bloom filter
+func (f *Filters) IsBloom(key string) bool {
+	_, ok := f.record[key].(*Bloom)
+	return ok
+}
+
+// IsCuckoo whether the key holds a cuckoo filter
+func (f *Filters) IsCuckoo(key string) bool {
+	_, ok := f.record[key].(*Cuckoo)
+	return ok
+}
+
+// Dump returns the encoded filter of key, nil if not exists
+func (f *Filters) Dump(key string) []byte {
+	flt, exist := f.record[key]
+	if !exist {
+		return nil
+	}
+
+	var w writer
+	flt.encode(&w)
+	return w.buf
+}
+
+// Restore 用Dump的结果替换key的过滤器
+// replaces the filter of key with the dumped one
+func (f *Filters) Restore(key string, data []byte) error {
+	flt, err := decode(data)
+	if err != nil {
+		return err
+	}
+	f.record[key] = flt
+	return nil
+}
+
+// Keys returns all keys
+func (f *Filters) Keys() (keys []string) {
+	for k := range f.record {
+		keys = append(keys, k)
+	}
+	return
+}
+
+func (f *Filters) bloom(key string) (*Bloom, error) {
+	flt, exist := f.record[key]
+	if !exist {
+		return nil, ErrFilterNotExist
+	}
+	b, ok := flt.(*Bloom)
+	if !ok {
+		return nil, ErrWrongType
+	}
+	return b, nil
+}
+
+func (b *Bloom) add(item []byte) (bool, error) {
+	if b.exists(item) {
+		return false, nil
+	}
+
+	last := b.layers[len(b.layers)-1]
+	if last.count >= last.capacity {
+		if b.expansion == 0 {
+			return false, ErrFilterFull
+		}
+		//the error rate is tightened so that the total one is bounded by twice of it
+		errorRate := b.errorRate * math.Pow(0.5, float64(len(b.layers)))
+		last = newBloomLayer(last.capacity*b.expansion, errorRate)
+		b.layers = append(b.layers, last)
+	}
+
+	h1, h2 := hash(item)
+	for i := uint64(0); i < last.k; i++ {
+		pos := (h1 + i*h2) % last.m
+		last.bits[pos/8] |= 1 << (pos % 8)
+	}
+	last.count++
+	return true, nil
+}
+
+func (b *Bloom) exists(item []byte) bool {
+	h1, h2 := hash(item)
+	for _, l := range b.layers {
+		if l.test(h1, h2) {
+			return true
+		}
+	}
+	return false
+}
+
+// newBloomLayer 根据容量和错误率计算位数和哈希函数个数
+// m = -n*ln(p) / ln(2)^2, k = -log2(p)
+func newBloomLayer(capacity uint64, errorRate float64) *bloomLayer {
+	m := uint64(math.Ceil(-float64(capacity) * math.Log(errorRate) / (math.Ln2 * math.Ln2)))
+	m = (m + 63) / 64 * 64
+	k := uint64(math.Ceil(-math.Log2(errorRate)))
+	return &bloomLayer{bits: make([]byte, m/8), m: m, k: k, capacity: capacity}
+}
+
+func (l *bloomLayer) test(h1, h2 uint64) bool {
+	for i := uint64(0); i < l.k; i++ {
+		pos := (h1 + i*h2) % l.m
+		if l.bits[pos/8]&(1<<(pos%8)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// hash 返回元素的两个64位哈希值，用于生成k个哈希函数
+// returns two 64 bits hashes of the item, the k hash functions are h1 + i*h2
+func hash(item []byte) (uint64, uint64) {
+	h := fnv.New128a()
+	_, _ = h.Write(item)
+	sum := h.Sum(nil)
+
+	var h1, h2 uint64
+	for i := 0; i < 8; i++ {
+		h1 = h1<<8 | uint64(sum[i])
+		h2 = h2<<8 | uint64(sum[i+8])
+	}
+	return fmix64(h1), fmix64(h2) | 1
+}
+
+// fmix64 the finalizer of murmur3, fnv does not spread the last bytes of the item to all bits
+func fmix64(h uint64) uint64 {
+	h ^= h >> 33
+	h *= 0xff51afd7ed558ccd
+	h ^= h >> 33
+	h *= 0xc4ceb9fe1a85ec53
+	h ^= h >> 33
+	return h
+}
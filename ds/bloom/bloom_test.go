@@ -0,0 +1,210 @@
+package bloom
+
+import (
+	"strconv"
+	"testing"
+)
+
+func item(prefix string, i int) []byte {
+	return []byte(prefix + strconv.Itoa(i))
+}
+
+func TestFilters_BFReserve(t *testing.T) {
+	f := New()
+	if err := f.BFReserve("bf", 0.01, 100, DefaultExpansion); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.BFReserve("bf", 0.01, 100, DefaultExpansion); err != ErrFilterExists {
+		t.Error("expected ErrFilterExists, got ", err)
+	}
+	for _, rate := range []float64{0, 1, -0.1} {
+		if err := f.BFReserve("invalid", rate, 100, DefaultExpansion); err != ErrInvalidParams {
+			t.Errorf("reserve with error rate %f, err = %v", rate, err)
+		}
+	}
+	if err := f.BFReserve("invalid", 0.01, 0, DefaultExpansion); err != ErrInvalidParams {
+		t.Error("expected ErrInvalidParams, got ", err)
+	}
+}
+
+func TestFilters_BFAdd(t *testing.T) {
+	f := New()
+	_ = f.BFReserve("bf", 0.01, 1000, DefaultExpansion)
+
+	if ok, _ := f.BFAdd("bf", []byte("a")); !ok {
+		t.Error("expected a new item")
+	}
+	if ok, _ := f.BFAdd("bf", []byte("a")); ok {
+		t.Error("expected an existing item")
+	}
+	if ok, _ := f.BFExists("bf", []byte("a")); !ok {
+		t.Error("expected a to exist")
+	}
+	if ok, _ := f.BFExists("bf", []byte("b")); ok {
+		t.Error("expected b not to exist")
+	}
+	if ok, err := f.BFExists("missing", []byte("a")); ok || err != nil {
+		t.Errorf("exists in a missing filter got %v, %v", ok, err)
+	}
+	if _, err := f.BFAdd("missing", []byte("a")); err != ErrFilterNotExist {
+		t.Error("expected ErrFilterNotExist, got ", err)
+	}
+}
+
+func TestFilters_BFScaling(t *testing.T) {
+	f := New()
+	_ = f.BFReserve("bf", 0.01, 1000, DefaultExpansion)
+
+	n := 100000
+	for i := 0; i < n; i++ {
+		if _, err := f.BFAdd("bf", item("member", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < n; i++ {
+		if ok, _ := f.BFExists("bf", item("member", i)); !ok {
+			t.Fatalf("false negative of %d", i)
+		}
+	}
+
+	//the total error rate is bounded by twice of the first one
+	fp := 0
+	for i := 0; i < n; i++ {
+		if ok, _ := f.BFExists("bf", item("other", i)); ok {
+			fp++
+		}
+	}
+	if rate := float64(fp) / float64(n); rate > 0.02 {
+		t.Errorf("false positive rate %f", rate)
+	}
+
+	//far smaller than the members themselves
+	if size := len(f.Dump("bf")); size > 300*1024 {
+		t.Errorf("unexpected size %d", size)
+	}
+}
+
+func TestFilters_BFNonScaling(t *testing.T) {
+	f := New()
+	_ = f.BFReserve("bf", 0.01, 10, 0)
+
+	var err error
+	for i := 0; i < 100 && err == nil; i++ {
+		_, err = f.BFAdd("bf", item("member", i))
+	}
+	if err != ErrFilterFull {
+		t.Error("expected ErrFilterFull, got ", err)
+	}
+}
+
+func TestFilters_CFAdd(t *testing.T) {
+	f := New()
+	if err := f.CFReserve("cf", 1000, DefaultBucketSize, DefaultCuckooExpansion, DefaultMaxIterations); err != nil {
+		t.Fatal(err)
+	}
+
+	_ = f.CFAdd("cf", []byte("a"))
+	_ = f.CFAdd("cf", []byte("a"))
+	if n, _ := f.CFCount("cf", []byte("a")); n != 2 {
+		t.Errorf("count got %d", n)
+	}
+	if ok, _ := f.CFAddNX("cf", []byte("a")); ok {
+		t.Error("expected addnx to fail")
+	}
+	if ok, _ := f.CFAddNX("cf", []byte("b")); !ok {
+		t.Error("expected addnx to succeed")
+	}
+
+	if ok, _ := f.CFDel("cf", []byte("a")); !ok {
+		t.Error("expected a to be deleted")
+	}
+	if ok, _ := f.CFExists("cf", []byte("a")); !ok {
+		t.Error("expected a to exist")
+	}
+	_, _ = f.CFDel("cf", []byte("a"))
+	if ok, _ := f.CFExists("cf", []byte("a")); ok {
+		t.Error("expected a not to exist")
+	}
+	if ok, _ := f.CFDel("cf", []byte("a")); ok {
+		t.Error("expected nothing to delete")
+	}
+
+	if _, err := f.BFAdd("cf", []byte("a")); err != ErrWrongType {
+		t.Error("expected ErrWrongType, got ", err)
+	}
+	if err := f.CFAdd("missing", []byte("a")); err != ErrFilterNotExist {
+		t.Error("expected ErrFilterNotExist, got ", err)
+	}
+}
+
+func TestFilters_CFScaling(t *testing.T) {
+	f := New()
+	_ = f.CFReserve("cf", 1000, DefaultBucketSize, DefaultCuckooExpansion, DefaultMaxIterations)
+
+	n := 20000
+	for i := 0; i < n; i++ {
+		if err := f.CFAdd("cf", item("member", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < n; i++ {
+		if ok, _ := f.CFExists("cf", item("member", i)); !ok {
+			t.Fatalf("false negative of %d", i)
+		}
+	}
+	for i := 0; i < n; i += 2 {
+		if ok, _ := f.CFDel("cf", item("member", i)); !ok {
+			t.Fatalf("failed to delete %d", i)
+		}
+	}
+	for i := 1; i < n; i += 2 {
+		if ok, _ := f.CFExists("cf", item("member", i)); !ok {
+			t.Fatalf("false negative of %d after deleting", i)
+		}
+	}
+
+	noScale := New()
+	_ = noScale.CFReserve("cf", 16, DefaultBucketSize, 0, DefaultMaxIterations)
+	var err error
+	for i := 0; i < 100 && err == nil; i++ {
+		err = noScale.CFAdd("cf", item("member", i))
+	}
+	if err != ErrFilterFull {
+		t.Error("expected ErrFilterFull, got ", err)
+	}
+}
+
+func TestFilters_DumpRestore(t *testing.T) {
+	f := New()
+	_ = f.BFReserve("bf", 0.001, 100, DefaultExpansion)
+	_ = f.CFReserve("cf", 100, 4, DefaultCuckooExpansion, DefaultMaxIterations)
+	for i := 0; i < 1000; i++ {
+		_, _ = f.BFAdd("bf", item("member", i))
+		_ = f.CFAdd("cf", item("member", i))
+	}
+
+	g := New()
+	for _, key := range []string{"bf", "cf"} {
+		if err := g.Restore(key, f.Dump(key)); err != nil {
+			t.Fatal(err)
+		}
+		if string(g.Dump(key)) != string(f.Dump(key)) {
+			t.Errorf("%s is not restored", key)
+		}
+	}
+
+	//the restored cuckoo filter evicts the same fingerprints
+	for i := 1000; i < 2000; i++ {
+		_ = f.CFAdd("cf", item("member", i))
+		_ = g.CFAdd("cf", item("member", i))
+	}
+	if string(g.Dump("cf")) != string(f.Dump("cf")) {
+		t.Error("the restored filter diverges")
+	}
+
+	for _, data := range [][]byte{nil, {9}, f.Dump("bf")[:10]} {
+		if err := g.Restore("bad", data); err != ErrInvalidData {
+			t.Errorf("restore %v, err = %v", data, err)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package bloom
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+// kinds of a dumped filter
+const (
+	kindBloom byte = iota + 1
+	kindCuckoo
+)
+
+func (b *Bloom) encode(w *writer) {
+	w.buf = append(w.buf, kindBloom)
+	w.uvarint(math.Float64bits(b.errorRate))
+	w.uvarint(b.expansion)
+	w.uvarint(uint64(len(b.layers)))
+	for _, l := range b.layers {
+		w.uvarint(l.m)
+		w.uvarint(l.k)
+		w.uvarint(l.capacity)
+		w.uvarint(l.count)
+		w.bytes(l.bits)
+	}
+}
+
+func (c *Cuckoo) encode(w *writer) {
+	w.buf = append(w.buf, kindCuckoo)
+	w.uvarint(c.bucketSize)
+	w.uvarint(c.expansion)
+	w.uvarint(c.maxIterations)
+	w.uvarint(c.kicks)
+	w.uvarint(c.count)
+	w.uvarint(uint64(len(c.layers)))
+	for _, l := range c.layers {
+		w.uvarint(l.numBuckets)
+		w.bytes(l.slots)
+	}
+}
+
+// decode the filter encoded by encode
+func decode(data []byte) (filter, error) {
+	if len(data) == 0 {
+		return nil, ErrInvalidData
+	}
+	r := reader{buf: data[1:]}
+
+	switch data[0] {
+	case kindBloom:
+		b := &Bloom{
+			errorRate: math.Float64frombits(r.uvarint()),
+			expansion: r.uvarint(),
+		}
+		n := r.uvarint()
+		for i := uint64(0); i < n && r.err == nil; i++ {
+			l := &bloomLayer{m: r.uvarint(), k: r.uvarint(), capacity: r.uvarint(), count: r.uvarint(), bits: r.bytes()}
+			if r.err == nil && (l.m == 0 || uint64(len(l.bits))*8 != l.m) {
+				return nil, ErrInvalidData
+			}
+			b.layers = append(b.layers, l)
+		}
+		if r.err != nil || len(b.layers) == 0 {
+			return nil, ErrInvalidData
+		}
+		return b, nil
+	case kindCuckoo:
+		c := &Cuckoo{
+			bucketSize:    r.uvarint(),
+			expansion:     r.uvarint(),
+			maxIterations: r.uvarint(),
+			kicks:         r.uvarint(),
+			count:         r.uvarint(),
+		}
+		n := r.uvarint()
+		for i := uint64(0); i < n && r.err == nil; i++ {
+			l := &cuckooLayer{numBuckets: r.uvarint(), slots: r.bytes()}
+			if r.err == nil && (l.numBuckets == 0 || l.numBuckets&(l.numBuckets-1) != 0 ||
+				uint64(len(l.slots)) != l.numBuckets*c.bucketSize) {
+				return nil, ErrInvalidData
+			}
+			c.layers = append(c.layers, l)
+		}
+		if r.err != nil || len(c.layers) == 0 || c.bucketSize == 0 {
+			return nil, ErrInvalidData
+		}
+		return c, nil
+	}
+	return nil, ErrInvalidData
+}
+
+type writer struct {
+	buf []byte
+}
+
+func (w *writer) uvarint(v uint64) {
+	var b [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(b[:], v)
+	w.buf = append(w.buf, b[:n]...)
+}
+
+func (w *writer) bytes(b []byte) {
+	w.uvarint(uint64(len(b)))
+	w.buf = append(w.buf, b...)
+}
+
+// reader 读取writer写入的数据，出错后后续读取均返回零值
+// reads the data written by writer, the reads after an error return zero values
+type reader struct {
+	buf []byte
+	err error
+}
+
+func (r *reader) uvarint() uint64 {
+	if r.err != nil {
+		return 0
+	}
+
+	v, n := binary.Uvarint(r.buf)
+	if n <= 0 {
+		r.err = ErrInvalidData
+		return 0
+	}
+	r.buf = r.buf[n:]
+	return v
+}
+
+func (r *reader) bytes() []byte {
+	n := r.uvarint()
+	if r.err != nil {
+		return nil
+	}
+	if uint64(len(r.buf)) < n {
+		r.err = ErrInvalidData
+		return nil
+	}
+
+	b := make([]byte, n)
+	copy(b, r.buf)
+	r.buf = r.buf[n:]
+	return b
+}
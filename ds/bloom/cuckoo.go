@@ -0,0 +1,238 @@
+package bloom
+
+type (
+	// Cuckoo 可扩展的布谷鸟过滤器，每个桶有bucketSize个8位的指纹，元素可以放在两个候选桶之一
+	// 插入失败时添加一个桶数为上一个expansion倍的子过滤器，expansion 为 0 时不可扩展
+	// 剔除指纹时按计数器依次选择位置而不是随机选择，所以重放日志可以得到相同的过滤器
+	// a scalable cuckoo filter, each bucket has bucketSize 8 bits fingerprints, an item is in one of its two buckets.
+	// A new layer with expansion times the buckets of the last one is added if an insertion fails,
+	// the filter is not scalable if expansion is 0.
+	// The evicted fingerprints are chosen by a counter instead of randomly, so that replaying the log gets the same filter.
+	Cuckoo struct {
+		bucketSize    uint64
+		expansion     uint64
+		maxIterations uint64
+		kicks         uint64
+		count         uint64
+		layers        []*cuckooLayer
+	}
+
+	cuckooLayer struct {
+		numBuckets uint64 // power of 2
+		slots      []byte // numBuckets*bucketSize fingerprints, 0 means empty
+	}
+)
+
+// CFReserve 创建一个布谷鸟过滤器，capacity 为第一个子过滤器的容量
+// creates a cuckoo filter with the capacity of the first layer
+func (f *Filters) CFReserve(key string, capacity, bucketSize, expansion, maxIterations uint64) error {
+	if capacity == 0 || bucketSize == 0 || bucketSize > 255 || maxIterations == 0 {
+		return ErrInvalidParams
+	}
+	if _, exist := f.record[key]; exist {
+		return ErrFilterExists
+	}
+
+	numBuckets := uint64(1)
+	for numBuckets*bucketSize < capacity {
+		numBuckets <<= 1
+	}
+	f.record[key] = &Cuckoo{
+		bucketSize:    bucketSize,
+		expansion:     expansion,
+		maxIterations: maxIterations,
+		layers:        []*cuckooLayer{newCuckooLayer(numBuckets, bucketSize)},
+	}
+	return nil
+}
+
+// CFAdd 添加元素，同一个元素可以添加多次
+// adds the item, an item can be added more than once
+func (f *Filters) CFAdd(key string, item []byte) error {
+	c, err := f.cuckoo(key)
+	if err != nil {
+		return err
+	}
+	return c.add(item)
+}
+
+// CFAddNX 元素可能不存在时才添加，返回是否添加
+// adds the item only if it does not exist, returns whether it is added
+func (f *Filters) CFAddNX(key string, item []byte) (bool, error) {
+	c, err := f.cuckoo(key)
+	if err != nil {
+		return false, err
+	}
+	if c.countItem(item) > 0 {
+		return false, nil
+	}
+	return true, c.add(item)
+}
+
+// CFExists 判断元素是否可能存在
+// whether the item may exist
+func (f *Filters) CFExists(key string, item []byte) (bool, error) {
+	n, err := f.CFCount(key, item)
+	return n > 0, err
+}
+
+// CFCount 返回元素可能被添加的次数
+// returns the number of times the item may have been added
+func (f *Filters) CFCount(key string, item []byte) (int, error) {
+	c, err := f.cuckoo(key)
+	if err != nil {
+		if err == ErrFilterNotExist {
+			return 0, nil
+		}
+		return 0, err
+	}
+	return c.countItem(item), nil
+}
+
+// CFDel 删除元素的一次添加，返回是否删除
+// 只能删除确实被添加过的元素，否则可能删除其它元素的指纹
+// deletes one occurrence of the item, returns whether it is deleted.
+// Only the items which are really added can be deleted, otherwise the fingerprint of another item may be deleted.
+func (f *Filters) CFDel(key string, item []byte) (bool, error) {
+	c, err := f.cuckoo(key)
+	if err != nil {
+		if err == ErrFilterNotExist {
+			return false, nil
+		}
+		return false, err
+	}
+
+	fp, h := fingerprint(item)
+	for i := len(c.layers) - 1; i >= 0; i-- {
+		l := c.layers[i]
+		i1 := h & (l.numBuckets - 1)
+		for _, b := range []uint64{i1, l.alt(i1, fp)} {
+			if pos, ok := l.find(b, c.bucketSize, fp); ok {
+				l.slots[pos] = 0
+				c.count--
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+func (f *Filters) cuckoo(key string) (*Cuckoo, error) {
+	flt, exist := f.record[key]
+	if !exist {
+		return nil, ErrFilterNotExist
+	}
+	c, ok := flt.(*Cuckoo)
+	if !ok {
+		return nil, ErrWrongType
+	}
+	return c, nil
+}
+
+func (c *Cuckoo) add(item []byte) error {
+	fp, h := fingerprint(item)
+
+	//look for an empty slot in all layers, the newest first
+	for i := len(c.layers) - 1; i >= 0; i-- {
+		l := c.layers[i]
+		i1 := h & (l.numBuckets - 1)
+		if l.insert(i1, c.bucketSize, fp) || l.insert(l.alt(i1, fp), c.bucketSize, fp) {
+			c.count++
+			return nil
+		}
+	}
+
+	last := c.layers[len(c.layers)-1]
+	if c.kickOut(last, h&(last.numBuckets-1), fp) {
+		c.count++
+		return nil
+	}
+
+	if c.expansion == 0 {
+		return ErrFilterFull
+	}
+	last = newCuckooLayer(last.numBuckets*c.expansion, c.bucketSize)
+	c.layers = append(c.layers, last)
+	last.insert(h&(last.numBuckets-1), c.bucketSize, fp)
+	c.count++
+	return nil
+}
+
+// kickOut 依次剔除指纹并放到它的另一个桶中，失败时恢复被剔除的指纹
+// evicts fingerprints to their other buckets in turn, the evictions are reverted if it fails
+func (c *Cuckoo) kickOut(l *cuckooLayer, b uint64, fp byte) bool {
+	var path []uint64
+	for n := uint64(0); n < c.maxIterations; n++ {
+		pos := b*c.bucketSize + c.kicks%c.bucketSize
+		c.kicks++
+		fp, l.slots[pos] = l.slots[pos], fp
+		path = append(path, pos)
+
+		b = l.alt(b, fp)
+		if l.insert(b, c.bucketSize, fp) {
+			return true
+		}
+	}
+
+	for i := len(path) - 1; i >= 0; i-- {
+		fp, l.slots[path[i]] = l.slots[path[i]], fp
+	}
+	return false
+}
+
+func (c *Cuckoo) countItem(item []byte) int {
+	fp, h := fingerprint(item)
+	n := 0
+	for _, l := range c.layers {
+		i1 := h & (l.numBuckets - 1)
+		i2 := l.alt(i1, fp)
+		n += l.countFp(i1, c.bucketSize, fp)
+		if i2 != i1 {
+			n += l.countFp(i2, c.bucketSize, fp)
+		}
+	}
+	return n
+}
+
+func newCuckooLayer(numBuckets, bucketSize uint64) *cuckooLayer {
+	return &cuckooLayer{numBuckets: numBuckets, slots: make([]byte, numBuckets*bucketSize)}
+}
+
+// alt 返回指纹的另一个桶，alt(alt(b, fp), fp) == b
+// returns the other bucket of the fingerprint
+func (l *cuckooLayer) alt(b uint64, fp byte) uint64 {
+	return (b ^ (uint64(fp) * 0x5bd1e995)) & (l.numBuckets - 1)
+}
+
+func (l *cuckooLayer) insert(b, bucketSize uint64, fp byte) bool {
+	if pos, ok := l.find(b, bucketSize, 0); ok {
+		l.slots[pos] = fp
+		return true
+	}
+	return false
+}
+
+func (l *cuckooLayer) find(b, bucketSize uint64, fp byte) (uint64, bool) {
+	for pos := b * bucketSize; pos < (b+1)*bucketSize; pos++ {
+		if l.slots[pos] == fp {
+			return pos, true
+		}
+	}
+	return 0, false
+}
+
+func (l *cuckooLayer) countFp(b, bucketSize uint64, fp byte) int {
+	n := 0
+	for pos := b * bucketSize; pos < (b+1)*bucketSize; pos++ {
+		if l.slots[pos] == fp {
+			n++
+		}
+	}
+	return n
+}
+
+// fingerprint returns the non-zero 8 bits fingerprint and the hash of the buckets of the item
+func fingerprint(item []byte) (byte, uint64) {
+	h1, h2 := hash(item)
+	return byte(h2>>56%255) + 1, h1
+}
@@ -0,0 +1,400 @@
+package document
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"math"
+	"sort"
+	"strconv"
+)
+
+// JSON文档的实现，文档解析后保存在内存中，修改通过路径定位到文档中的值
+// 数字以 json.Number 保存以避免精度丢失，对象的成员按名称排序输出
+// JSON documents, which are kept parsed in memory and changed at the values located by paths.
+// Numbers are kept as json.Number to avoid losing precision, members of objects are output sorted by name.
+
+var (
+	// ErrInvalidPath the path is invalid
+	ErrInvalidPath = errors.New("ds/document: invalid path")
+
+	// ErrInvalidValue the value is not a valid JSON
+	ErrInvalidValue = errors.New("ds/document: invalid JSON value")
+
+	// ErrPathNotExist nothing matches the path
+	ErrPathNotExist = errors.New("ds/document: path does not exist")
+
+	// ErrNotRoot a new document can only be set at the root
+	ErrNotRoot = errors.New("ds/document: new document must be set at the root")
+)
+
+type (
+	Record map[string]interface{}
+
+	// Documents json documents struct
+	Documents struct {
+		record Record
+	}
+
+	// action 访问路径匹配的值之后对其进行的操作
+	action uint8
+
+	// visitor 访问路径匹配的值，exists 为 false 表示值不存在但是可以被创建
+	visitor func(v interface{}, exists bool) (interface{}, action)
+)
+
+const (
+	keep action = iota
+	replace
+	remove
+)
+
+// New new json documents
+func New() *Documents {
+	return &Documents{make(Record)}
+}
+
+// Validate 检查路径和值是否有效
+// checks whether the path and the values are valid
+func Validate(path string, values ...[]byte) error {
+	if _, err := parsePath(path); err != nil {
+		return err
+	}
+	for _, value := range values {
+		if _, err := parse(value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// IsRoot whether the path is the root
+func IsRoot(path string) bool {
+	segs, err := parsePath(path)
+	return err == nil && len(segs) == 0
+}
+
+// Set 将路径匹配的值设为value，对象中不存在的最后一级成员会被创建，返回修改的个数
+// key不存在时只能设置根节点
+// Set the values matched by path to value, the missing last member of an object is created.
+// Returns the number of values set. A missing key can only be set at the root.
+func (d *Documents) Set(key, path string, value []byte) (int, error) {
+	segs, err := parsePath(path)
+	if err != nil {
+		return 0, err
+	}
+	v, err := parse(value)
+	if err != nil {
+		return 0, err
+	}
+
+	doc, exist := d.record[key]
+	if !exist {
+		if len(segs) > 0 {
+			return 0, ErrNotRoot
+		}
+		d.record[key] = v
+		return 1, nil
+	}
+
+	n := 0
+	//every match gets its own copy, so that the values are not shared
+	d.record[key], _ = walk(doc, segs, true, func(interface{}, bool) (interface{}, action) {
+		n++
+		if n == 1 {
+			return v, replace
+		}
+		cp, _ := parse(value)
+		return cp, replace
+	})
+	return n, nil
+}
+
+// Get 返回路径匹配的值
+// 没有路径时返回整个文档，一个路径时返回匹配的值组成的数组，多个路径时返回路径到数组的对象
+// Returns the values matched by the paths: the whole document without paths,
+// an array of the matches of one path, or an object of each path to its matches.
+func (d *Documents) Get(key string, paths ...string) ([]byte, bool, error) {
+	doc, exist := d.record[key]
+	if !exist {
+		return nil, false, nil
+	}
+	if len(paths) == 0 {
+		b, err := marshal(doc)
+		return b, true, err
+	}
+
+	res := make(map[string]interface{})
+	for _, p := range paths {
+		matches, err := d.find(doc, p)
+		if err != nil {
+			return nil, true, err
+		}
+		res[p] = matches
+	}
+
+	if len(paths) == 1 {
+		b, err := marshal(res[paths[0]])
+		return b, true, err
+	}
+	b, err := marshal(res)
+	return b, true, err
+}
+
+// Del 删除路径匹配的值，路径为根节点时删除整个文档，返回删除的个数
+// Delete the values matched by path, the whole document is deleted if path is the root.
+// Returns the number of deleted values.
+func (d *Documents) Del(key, path string) (int, error) {
+	segs, err := parsePath(path)
+	if err != nil {
+		return 0, err
+	}
+
+	doc, exist := d.record[key]
+	if !exist {
+		return 0, nil
+	}
+	if len(segs) == 0 {
+		delete(d.record, key)
+		return 1, nil
+	}
+
+	n := 0
+	d.record[key], _ = walk(doc, segs, false, func(interface{}, bool) (interface{}, action) {
+		n++
+		return nil, remove
+	})
+	return n, nil
+}
+
+// NumIncrBy 将路径匹配的数字加上by，返回新的值组成的数组，不是数字的值对应的结果为null
+// 整数与整数相加的结果仍为整数
+// Increment the numbers matched by path by by, returns an array of the new values, null for non-numbers.
+// The sum of integers is still an integer.
+func (d *Documents) NumIncrBy(key, path string, by []byte) ([]byte, error) {
+	segs, err := parsePath(path)
+	if err != nil {
+		return nil, err
+	}
+	incr, err := parse(by)
+	if err != nil {
+		return nil, err
+	}
+	num, ok := incr.(json.Number)
+	if !ok {
+		return nil, ErrInvalidValue
+	}
+
+	doc, exist := d.record[key]
+	if !exist {
+		return nil, ErrPathNotExist
+	}
+
+	var res []interface{}
+	d.record[key], _ = walk(doc, segs, false, func(v interface{}, _ bool) (interface{}, action) {
+		old, ok := v.(json.Number)
+		if !ok {
+			res = append(res, nil)
+			return v, keep
+		}
+
+		sum := add(old, num)
+		res = append(res, sum)
+		return sum, replace
+	})
+	return marshal(res)
+}
+
+// ArrAppend 将values添加到路径匹配的数组末尾，返回数组新的长度，不是数组的值对应的结果为-1
+// Append the values to the arrays matched by path, returns the new lengths, -1 for non-arrays.
+func (d *Documents) ArrAppend(key, path string, values ...[]byte) ([]int, error) {
+	segs, err := parsePath(path)
+	if err != nil {
+		return nil, err
+	}
+	for _, value := range values {
+		if _, err := parse(value); err != nil {
+			return nil, err
+		}
+	}
+
+	doc, exist := d.record[key]
+	if !exist {
+		return nil, ErrPathNotExist
+	}
+
+	var res []int
+	d.record[key], _ = walk(doc, segs, false, func(v interface{}, _ bool) (interface{}, action) {
+		arr, ok := v.([]interface{})
+		if !ok {
+			res = append(res, -1)
+			return v, keep
+		}
+
+		for _, value := range values {
+			elem, _ := parse(value)
+			arr = append(arr, elem)
+		}
+		res = append(res, len(arr))
+		return arr, replace
+	})
+	return res, nil
+}
+
+// Exists whether the document of key exists
+func (d *Documents) Exists(key string) bool {
+	_, exist := d.record[key]
+	return exist
+}
+
+// Keys returns all keys
+func (d *Documents) Keys() (keys []string) {
+	for k := range d.record {
+		keys = append(keys, k)
+	}
+	return
+}
+
+// find returns the values matched by path
+func (d *Documents) find(doc interface{}, path string) ([]interface{}, error) {
+	segs, err := parsePath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	matches := make([]interface{}, 0)
+	walk(doc, segs, false, func(v interface{}, _ bool) (interface{}, action) {
+		matches = append(matches, v)
+		return v, keep
+	})
+	return matches, nil
+}
+
+// walk 访问v中路径segs匹配的值，返回修改后的v
+// create 为 true 时，对象中不存在的最后一级成员也会被访问
+// visits the values matched by segs in v, and returns the changed v.
+// The missing last member of an object is visited too if create is true.
+func walk(v interface{}, segs []segment, create bool, fn visitor) (interface{}, action) {
+	if len(segs) == 0 {
+		return fn(v, true)
+	}
+
+	seg, rest := segs[0], segs[1:]
+	switch node := v.(type) {
+	case map[string]interface{}:
+		var names []string
+		switch seg.kind {
+		case segName:
+			if _, ok := node[seg.name]; !ok {
+				if create && len(rest) == 0 {
+					if nv, act := fn(nil, false); act == replace {
+						node[seg.name] = nv
+					}
+				}
+				return node, keep
+			}
+			names = []string{seg.name}
+		case segWildcard:
+			for name := range node {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+		}
+
+		for _, name := range names {
+			nv, act := walk(node[name], rest, create, fn)
+			switch act {
+			case replace:
+				node[name] = nv
+			case remove:
+				delete(node, name)
+			}
+		}
+		return node, replace
+	case []interface{}:
+		var indexes []int
+		switch seg.kind {
+		case segIndex:
+			i := seg.index
+			if i < 0 {
+				i += len(node)
+			}
+			if i < 0 || i >= len(node) {
+				return node, keep
+			}
+			indexes = []int{i}
+		case segWildcard:
+			for i := range node {
+				indexes = append(indexes, i)
+			}
+		}
+
+		removed := make(map[int]bool)
+		for _, i := range indexes {
+			nv, act := walk(node[i], rest, create, fn)
+			switch act {
+			case replace:
+				node[i] = nv
+			case remove:
+				removed[i] = true
+			}
+		}
+		if len(removed) == 0 {
+			return node, replace
+		}
+
+		res := make([]interface{}, 0, len(node)-len(removed))
+		for i, elem := range node {
+			if !removed[i] {
+				res = append(res, elem)
+			}
+		}
+		return res, replace
+	}
+	return v, keep
+}
+
+// parse the JSON value, numbers are kept as json.Number
+func parse(data []byte) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, ErrInvalidValue
+	}
+	if dec.More() {
+		return nil, ErrInvalidValue
+	}
+	return v, nil
+}
+
+// marshal the value without escaping HTML characters
+func marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimRight(buf.Bytes(), "\n"), nil
+}
+
+// add the numbers, integers are added as integers unless overflow
+func add(a, b json.Number) json.Number {
+	x, errX := a.Int64()
+	y, errY := b.Int64()
+	if errX == nil && errY == nil {
+		if sum := x + y; (sum > x) == (y > 0) {
+			return json.Number(strconv.FormatInt(sum, 10))
+		}
+	}
+
+	fx, _ := a.Float64()
+	fy, _ := b.Float64()
+	sum := fx + fy
+	if math.IsInf(sum, 0) || math.IsNaN(sum) {
+		return a
+	}
+	return json.Number(strconv.FormatFloat(sum, 'g', -1, 64))
+}
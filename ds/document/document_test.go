@@ -0,0 +1,148 @@
+package document
+
+import (
+	"reflect"
+	"testing"
+)
+
+const sample = `{"name":"kdb","tags":["a","b"],"stats":{"count":1,"ratio":0.5},"items":[{"price":10},{"price":20}]}`
+
+func newSample(t *testing.T) *Documents {
+	d := New()
+	if _, err := d.Set("doc", "$", []byte(sample)); err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+func get(t *testing.T, d *Documents, key string, paths ...string) string {
+	b, _, err := d.Get(key, paths...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestParsePath(t *testing.T) {
+	tests := []struct {
+		path string
+		want []segment
+	}{
+		{"$", nil},
+		{"", nil},
+		{"$.a.b", []segment{{kind: segName, name: "a"}, {kind: segName, name: "b"}}},
+		{"a.b", []segment{{kind: segName, name: "a"}, {kind: segName, name: "b"}}},
+		{"$['a.b']", []segment{{kind: segName, name: "a.b"}}},
+		{`$["x]"][-1]`, []segment{{kind: segName, name: "x]"}, {kind: segIndex, index: -1}}},
+		{"$.*[*]", []segment{{kind: segWildcard}, {kind: segWildcard}}},
+	}
+	for _, tt := range tests {
+		segs, err := parsePath(tt.path)
+		if err != nil || !reflect.DeepEqual(segs, tt.want) {
+			t.Errorf("parse %q got %v, %v", tt.path, segs, err)
+		}
+	}
+
+	for _, path := range []string{"$..a", "$[a]", "$[1", "$['a]", "$x"} {
+		if _, err := parsePath(path); err != ErrInvalidPath {
+			t.Errorf("parse %q, err = %v", path, err)
+		}
+	}
+}
+
+func TestDocuments_Set(t *testing.T) {
+	d := newSample(t)
+
+	if n, _ := d.Set("doc", "$.stats.count", []byte("2")); n != 1 {
+		t.Errorf("set got %d", n)
+	}
+	if n, _ := d.Set("doc", "$.stats.new", []byte(`"v"`)); n != 1 {
+		t.Errorf("set a new member got %d", n)
+	}
+	if n, _ := d.Set("doc", "$.missing.new", []byte("1")); n != 0 {
+		t.Errorf("set under a missing member got %d", n)
+	}
+	if n, _ := d.Set("doc", "$.items[*].price", []byte("0")); n != 2 {
+		t.Errorf("set by wildcard got %d", n)
+	}
+	if got := get(t, d, "doc", "$.stats", "$.items[*].price"); got != `{"$.items[*].price":[0,0],"$.stats":[{"count":2,"new":"v","ratio":0.5}]}` {
+		t.Errorf("get got %s", got)
+	}
+
+	if _, err := d.Set("other", "$.a", []byte("1")); err != ErrNotRoot {
+		t.Errorf("set a missing key not at the root, err = %v", err)
+	}
+	if _, err := d.Set("doc", "$", []byte("{")); err != ErrInvalidValue {
+		t.Errorf("set an invalid value, err = %v", err)
+	}
+}
+
+func TestDocuments_Get(t *testing.T) {
+	d := newSample(t)
+
+	if got := get(t, d, "doc", "$.tags[-1]"); got != `["b"]` {
+		t.Errorf("get got %s", got)
+	}
+	if got := get(t, d, "doc", "$.stats.*"); got != `[1,0.5]` {
+		t.Errorf("get by wildcard got %s", got)
+	}
+	if got := get(t, d, "doc", "$.nothing"); got != `[]` {
+		t.Errorf("get a missing path got %s", got)
+	}
+	if _, ok, _ := d.Get("missing"); ok {
+		t.Error("expected a missing key")
+	}
+}
+
+func TestDocuments_Del(t *testing.T) {
+	d := newSample(t)
+
+	if n, _ := d.Del("doc", "$.tags[0]"); n != 1 {
+		t.Errorf("del got %d", n)
+	}
+	if n, _ := d.Del("doc", "$.items[*]"); n != 2 {
+		t.Errorf("del by wildcard got %d", n)
+	}
+	if got := get(t, d, "doc", "$.tags", "$.items"); got != `{"$.items":[[]],"$.tags":[["b"]]}` {
+		t.Errorf("get got %s", got)
+	}
+
+	if n, _ := d.Del("doc", "$"); n != 1 || d.Exists("doc") {
+		t.Errorf("del the root got %d", n)
+	}
+}
+
+func TestDocuments_NumIncrBy(t *testing.T) {
+	d := newSample(t)
+
+	if res, _ := d.NumIncrBy("doc", "$.stats.*", []byte("2")); string(res) != `[3,2.5]` {
+		t.Errorf("numincrby got %s", res)
+	}
+	if res, _ := d.NumIncrBy("doc", "$.name", []byte("1")); string(res) != `[null]` {
+		t.Errorf("numincrby a string got %s", res)
+	}
+	if res, _ := d.NumIncrBy("doc", "$.stats.count", []byte("9223372036854775807")); string(res) != `[9.223372036854776e+18]` {
+		t.Errorf("numincrby overflow got %s", res)
+	}
+	if _, err := d.NumIncrBy("doc", "$.stats.count", []byte(`"1"`)); err != ErrInvalidValue {
+		t.Errorf("numincrby by a string, err = %v", err)
+	}
+}
+
+func TestDocuments_ArrAppend(t *testing.T) {
+	d := newSample(t)
+
+	res, err := d.ArrAppend("doc", "$.*", []byte(`"c"`), []byte(`{"d":1}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(res, []int{4, -1, -1, 4}) {
+		t.Errorf("arrappend got %v", res)
+	}
+	if got := get(t, d, "doc", "$.tags"); got != `[["a","b","c",{"d":1}]]` {
+		t.Errorf("get got %s", got)
+	}
+	if _, err := d.ArrAppend("missing", "$", []byte("1")); err != ErrPathNotExist {
+		t.Errorf("arrappend a missing key, err = %v", err)
+	}
+}
@@ -0,0 +1,106 @@
+package document
+
+import (
+	"strconv"
+	"strings"
+)
+
+// JSONPath 的一个子集:
+//   $             根节点
+//   .name ['name'] 对象的成员
+//   [n]           数组的元素，负数表示从末尾开始计算
+//   .* [*]        对象的所有成员或者数组的所有元素
+// 不以 $ 开头的路径被视为相对于根节点，例如 .a.b 和 a.b 等价于 $.a.b
+//
+// a subset of JSONPath:
+//   $               the root
+//   .name ['name']  the member of an object
+//   [n]             the element of an array, negative index counts from the end
+//   .* [*]          all members of an object or all elements of an array
+// paths not starting with $ are relative to the root, e.g. .a.b and a.b are the same as $.a.b
+
+type segmentKind uint8
+
+const (
+	segName segmentKind = iota
+	segIndex
+	segWildcard
+)
+
+type segment struct {
+	kind  segmentKind
+	name  string
+	index int
+}
+
+// parsePath parse the path into segments, the root is an empty slice
+func parsePath(path string) ([]segment, error) {
+	switch {
+	case path == "" || path == "." || path == "$":
+		return nil, nil
+	case path[0] == '$':
+		path = path[1:]
+	case path[0] != '.' && path[0] != '[':
+		path = "." + path
+	}
+
+	var segs []segment
+	for len(path) > 0 {
+		switch path[0] {
+		case '.':
+			path = path[1:]
+			end := strings.IndexAny(path, ".[")
+			if end < 0 {
+				end = len(path)
+			}
+			name := path[:end]
+			path = path[end:]
+
+			switch name {
+			case "":
+				return nil, ErrInvalidPath
+			case "*":
+				segs = append(segs, segment{kind: segWildcard})
+			default:
+				segs = append(segs, segment{kind: segName, name: name})
+			}
+		case '[':
+			seg, rest, err := parseBracket(path)
+			if err != nil {
+				return nil, err
+			}
+			segs = append(segs, seg)
+			path = rest
+		default:
+			return nil, ErrInvalidPath
+		}
+	}
+	return segs, nil
+}
+
+// parseBracket parse the leading [...] of path, returns the segment and the rest of path
+func parseBracket(path string) (segment, string, error) {
+	end := strings.IndexByte(path, ']')
+	if end < 0 {
+		return segment{}, "", ErrInvalidPath
+	}
+
+	inner := path[1:end]
+	if len(inner) >= 2 && (inner[0] == '\'' || inner[0] == '"') {
+		//the quoted name may contain ], look for the closing quote instead
+		closing := strings.IndexByte(path[2:], inner[0])
+		if closing < 0 || len(path) < closing+4 || path[closing+3] != ']' {
+			return segment{}, "", ErrInvalidPath
+		}
+		return segment{kind: segName, name: path[2 : closing+2]}, path[closing+4:], nil
+	}
+
+	if inner == "*" {
+		return segment{kind: segWildcard}, path[end+1:], nil
+	}
+	i, err := strconv.Atoi(strings.TrimSpace(inner))
+	if err != nil {
+		return segment{}, "", ErrInvalidPath
+	}
+	return segment{kind: segIndex, index: i}, path[end+1:], nil
+}
@@ -0,0 +1,176 @@
+package geo
+
+import (
+	"math"
+)
+
+// 经纬度的geohash编码，与 Redis 的实现一致
+// 经度和纬度各使用26位，交错组成52位的整数，可以无损地作为有序集合的score
+// 按范围查询时，以圆心所在的格子及其周围的8个格子作为score的区间，再按实际距离过滤
+// geohash of coordinates, the same as Redis does.
+// Longitude and latitude take 26 bits each, interleaved as a 52 bits integer which is exact as a sorted set score.
+// A search queries the score ranges of the cell of the center and its 8 neighbors, then filters by the exact distance.
+
+const (
+	// Step 每个坐标的位数 bits of each coordinate
+	Step = 26
+
+	// 纬度的范围与 EPSG:900913 / EPSG:3785 / OSGEO:41001 一致
+	// the latitude limits are the ones of EPSG:900913 / EPSG:3785 / OSGEO:41001
+	MinLatitude  = -85.05112878
+	MaxLatitude  = 85.05112878
+	MinLongitude = -180.0
+	MaxLongitude = 180.0
+
+	// 地球半径(米) the earth radius in meters
+	earthRadius = 6372797.560856
+)
+
+// Range geohash的区间 [Min, Max]
+// a range of geohashes, both inclusive
+type Range struct {
+	Min uint64
+	Max uint64
+}
+
+// ValidCoordinates whether the coordinates can be encoded
+func ValidCoordinates(lon, lat float64) bool {
+	return lon >= MinLongitude && lon <= MaxLongitude && lat >= MinLatitude && lat <= MaxLatitude
+}
+
+// Encode 编码经纬度为52位的geohash
+// encode the coordinates as a 52 bits geohash
+func Encode(lon, lat float64) uint64 {
+	lonBits, latBits := cell(lon, lat, Step)
+	return interleave(latBits, lonBits)
+}
+
+// Decode 返回geohash对应格子的中心点
+// returns the center of the cell of the geohash
+func Decode(hash uint64) (lon, lat float64) {
+	latBits, lonBits := deinterleave(hash)
+	n := float64(uint64(1) << Step)
+
+	lat = MinLatitude + (float64(latBits)+0.5)/n*(MaxLatitude-MinLatitude)
+	lon = MinLongitude + (float64(lonBits)+0.5)/n*(MaxLongitude-MinLongitude)
+	return math.Max(MinLongitude, math.Min(MaxLongitude, lon)), math.Max(MinLatitude, math.Min(MaxLatitude, lat))
+}
+
+// Distance 返回两点间的球面距离(米)
+// returns the great circle distance between the two points in meters
+func Distance(lon1, lat1, lon2, lat2 float64) float64 {
+	lat1r, lon1r := rad(lat1), rad(lon1)
+	lat2r, lon2r := rad(lat2), rad(lon2)
+	u := math.Sin((lat2r - lat1r) / 2)
+	v := math.Sin((lon2r - lon1r) / 2)
+	return 2 * earthRadius * math.Asin(math.Sqrt(u*u+math.Cos(lat1r)*math.Cos(lat2r)*v*v))
+}
+
+// InBox 判断点是否在以(lon, lat)为中心，宽width高height(米)的矩形中，并返回到中心的距离
+// whether the point is in the box centered at (lon, lat) with width and height in meters,
+// and returns the distance to the center
+func InBox(lon, lat, width, height, plon, plat float64) (float64, bool) {
+	if Distance(plon, plat, plon, lat) > height/2 || Distance(plon, plat, lon, plat) > width/2 {
+		return 0, false
+	}
+	return Distance(lon, lat, plon, plat), true
+}
+
+// RadiusRanges 返回覆盖以(lon, lat)为圆心，半径为radius(米)的圆的geohash区间
+// returns the geohash ranges covering the circle centered at (lon, lat) with radius in meters
+func RadiusRanges(lon, lat, radius float64) []Range {
+	return ranges(lon, lat, radius, radius)
+}
+
+// BoxRanges 返回覆盖以(lon, lat)为中心，宽width高height(米)的矩形的geohash区间
+// returns the geohash ranges covering the box centered at (lon, lat) with width and height in meters
+func BoxRanges(lon, lat, width, height float64) []Range {
+	return ranges(lon, lat, width/2, height/2)
+}
+
+// ranges 选择格子不小于查询范围的精度，返回中心所在的格子及其周围8个格子的区间
+// chooses the precision whose cells are not smaller than the searched area,
+// returns the ranges of the cell of the center and its 8 neighbors
+func ranges(lon, lat, halfWidth, halfHeight float64) []Range {
+	latDelta := deg(halfHeight / earthRadius)
+
+	//the longitude delta is the widest at the latitude farthest from the equator
+	farthest := math.Max(math.Abs(lat-latDelta), math.Abs(lat+latDelta))
+	lonDelta := MaxLongitude
+	if farthest < 90 {
+		lonDelta = math.Min(MaxLongitude, deg(halfWidth/(earthRadius*math.Cos(rad(farthest)))))
+	}
+
+	step := uint(Step)
+	for step > 0 {
+		n := float64(uint64(1) << step)
+		if (MaxLatitude-MinLatitude)/n >= latDelta && (MaxLongitude-MinLongitude)/n >= lonDelta {
+			break
+		}
+		step--
+	}
+	if step == 0 {
+		return []Range{{Min: 0, Max: 1<<(2*Step) - 1}}
+	}
+
+	lonBits, latBits := cell(lon, lat, step)
+	n := int64(1) << step
+	shift := 2 * (Step - step)
+
+	var res []Range
+	seen := make(map[uint64]bool)
+	for dlat := int64(-1); dlat <= 1; dlat++ {
+		y := int64(latBits) + dlat
+		if y < 0 || y >= n {
+			continue
+		}
+		for dlon := int64(-1); dlon <= 1; dlon++ {
+			//the longitude wraps around the antimeridian
+			x := (int64(lonBits) + dlon + n) % n
+			h := interleave(uint32(y), uint32(x))
+			if seen[h] {
+				continue
+			}
+			seen[h] = true
+			res = append(res, Range{Min: h << shift, Max: (h+1)<<shift - 1})
+		}
+	}
+	return res
+}
+
+// cell returns the cell of the coordinates at the precision of step
+func cell(lon, lat float64, step uint) (lonBits, latBits uint32) {
+	n := float64(uint64(1) << step)
+	max := uint32(1)<<step - 1
+
+	latBits = uint32(math.Min(float64(max), (lat-MinLatitude)/(MaxLatitude-MinLatitude)*n))
+	lonBits = uint32(math.Min(float64(max), (lon-MinLongitude)/(MaxLongitude-MinLongitude)*n))
+	return
+}
+
+// interleave x in the even bits and y in the odd bits
+func interleave(x, y uint32) uint64 {
+	var res uint64
+	for i := uint(0); i < 32; i++ {
+		res |= uint64(x>>i&1) << (2 * i)
+		res |= uint64(y>>i&1) << (2*i + 1)
+	}
+	return res
+}
+
+// deinterleave is the reverse of interleave
+func deinterleave(v uint64) (x, y uint32) {
+	for i := uint(0); i < 32; i++ {
+		x |= uint32(v>>(2*i)&1) << i
+		y |= uint32(v>>(2*i+1)&1) << i
+	}
+	return
+}
+
+func rad(d float64) float64 {
+	return d * math.Pi / 180
+}
+
+func deg(r float64) float64 {
+	return r * 180 / math.Pi
+}
@@ -0,0 +1,104 @@
+package geo
+
+import (
+	"math"
+	"testing"
+)
+
+// the coordinates of the examples of Redis
+var (
+	palermo = [2]float64{13.361389, 38.115556}
+	catania = [2]float64{15.087269, 37.502669}
+)
+
+func TestEncode(t *testing.T) {
+	if h := Encode(palermo[0], palermo[1]); h != 3479099956230698 {
+		t.Error("expected 3479099956230698, got ", h)
+	}
+	if h := Encode(catania[0], catania[1]); h != 3479447370796909 {
+		t.Error("expected 3479447370796909, got ", h)
+	}
+	if h := Encode(MaxLongitude, MaxLatitude); h != 1<<(2*Step)-1 {
+		t.Error("expected the max geohash, got ", h)
+	}
+}
+
+func TestDecode(t *testing.T) {
+	for _, p := range [][2]float64{palermo, catania, {-122.27652, 37.805186}, {0, 0}, {179.99, -85}} {
+		lon, lat := Decode(Encode(p[0], p[1]))
+		if d := Distance(p[0], p[1], lon, lat); d > 1 {
+			t.Errorf("decode %v got %v, %v, %f meters away", p, lon, lat, d)
+		}
+	}
+}
+
+func TestDistance(t *testing.T) {
+	// Redis measures the distance between the decoded positions
+	lon1, lat1 := Decode(Encode(palermo[0], palermo[1]))
+	lon2, lat2 := Decode(Encode(catania[0], catania[1]))
+	d := Distance(lon1, lat1, lon2, lat2)
+	if math.Abs(d-166274.1516) > 0.0001 {
+		t.Error("expected 166274.1516, got ", d)
+	}
+	if d := Distance(10, 10, 10, 10); d != 0 {
+		t.Error("expected 0, got ", d)
+	}
+}
+
+func TestInBox(t *testing.T) {
+	if _, ok := InBox(15, 37, 400*1000, 400*1000, palermo[0], palermo[1]); !ok {
+		t.Error("expected palermo in the box")
+	}
+	if _, ok := InBox(15, 37, 200*1000, 200*1000, palermo[0], palermo[1]); ok {
+		t.Error("expected palermo out of the box")
+	}
+}
+
+func TestRadiusRanges(t *testing.T) {
+	inRanges := func(rs []Range, h uint64) bool {
+		for _, r := range rs {
+			if h >= r.Min && h <= r.Max {
+				return true
+			}
+		}
+		return false
+	}
+
+	// every point within the radius must be covered by the ranges
+	centers := [][2]float64{{15, 37}, {179.9, 0}, {-179.9, 60}, {0, 84}, {100, -80}}
+	for _, c := range centers {
+		for _, radius := range []float64{100, 5000, 200 * 1000, 2000 * 1000} {
+			rs := RadiusRanges(c[0], c[1], radius)
+			if len(rs) == 0 || len(rs) > 9 {
+				t.Fatalf("unexpected number of ranges %d", len(rs))
+			}
+			for a := 0.0; a < 360; a += 15 {
+				for _, f := range []float64{0.2, 0.6, 0.99} {
+					lon, lat := destination(c[0], c[1], radius*f, a)
+					if !ValidCoordinates(lon, lat) {
+						continue
+					}
+					if !inRanges(rs, Encode(lon, lat)) {
+						t.Errorf("center %v radius %v: (%v, %v) is not covered", c, radius, lon, lat)
+					}
+				}
+			}
+		}
+	}
+
+	if rs := RadiusRanges(0, 0, 30000*1000); len(rs) != 1 || rs[0].Max != 1<<(2*Step)-1 {
+		t.Error("expected the whole world, got ", rs)
+	}
+}
+
+// destination returns the point at distance meters from (lon, lat) in the direction of bearing degrees
+func destination(lon, lat, distance, bearing float64) (float64, float64) {
+	d := distance / earthRadius
+	b := rad(bearing)
+	lat1, lon1 := rad(lat), rad(lon)
+
+	lat2 := math.Asin(math.Sin(lat1)*math.Cos(d) + math.Cos(lat1)*math.Sin(d)*math.Cos(b))
+	lon2 := lon1 + math.Atan2(math.Sin(b)*math.Sin(d)*math.Cos(lat1), math.Cos(d)-math.Sin(lat1)*math.Sin(lat2))
+	lon2 = math.Mod(deg(lon2)+540, 360) - 180
+	return lon2, deg(lat2)
+}
@@ -0,0 +1,112 @@
+package hash
+
+import (
+	"github.com/KarlvenK/kDB/ds/listpack"
+)
+
+// encodings of a hash
+const (
+	EncodingListpack  = "listpack"
+	EncodingHashtable = "hashtable"
+)
+
+// fields 一个哈希表的域，域较少且较短时使用紧凑编码，超过上限后转换为 map，不再转换回来
+// the fields of a hash, which are packed while they are few and short,
+// and converted to a map once the limits are exceeded, never back
+type fields struct {
+	dict map[string][]byte // nil while the fields are packed
+	lp   listpack.Listpack // fields and values in turn
+}
+
+func (f *fields) get(field string) ([]byte, bool) {
+	if f.dict != nil {
+		v, ok := f.dict[field]
+		return v, ok
+	}
+	if i := f.lp.Find(field, 0, 2); i >= 0 {
+		return f.lp.Get(i + 1), true
+	}
+	return nil, false
+}
+
+// set sets the field to value, returns whether the field is new
+func (f *fields) set(field string, value []byte, limits listpack.Limits) bool {
+	if f.dict == nil {
+		i := f.lp.Find(field, 0, 2)
+		size := len(value)
+		if len(field) > size {
+			size = len(field)
+		}
+		if i >= 0 && limits.Fits(f.len(), size) {
+			f.lp.Replace(i+1, value)
+			return false
+		}
+		if i < 0 && limits.Fits(f.len()+1, size) {
+			f.lp.Append([]byte(field), value)
+			return true
+		}
+		f.convert()
+	}
+
+	_, exist := f.dict[field]
+	f.dict[field] = value
+	return !exist
+}
+
+func (f *fields) del(field string) bool {
+	if f.dict != nil {
+		_, exist := f.dict[field]
+		delete(f.dict, field)
+		return exist
+	}
+	if i := f.lp.Find(field, 0, 2); i >= 0 {
+		f.lp.Remove(i, 2)
+		return true
+	}
+	return false
+}
+
+func (f *fields) len() int {
+	if f.dict != nil {
+		return len(f.dict)
+	}
+	return f.lp.Len() / 2
+}
+
+// each calls fn on the fields and their values
+func (f *fields) each(fn func(field string, value []byte)) {
+	if f.dict != nil {
+		for field, value := range f.dict {
+			fn(field, value)
+		}
+		return
+	}
+
+	var field string
+	f.lp.Iterate(func(i int, val []byte) bool {
+		if i%2 == 0 {
+			field = string(val)
+		} else {
+			fn(field, val)
+		}
+		return true
+	})
+}
+
+func (f *fields) encoding() string {
+	if f.dict != nil {
+		return EncodingHashtable
+	}
+	return EncodingListpack
+}
+
+// convert moves the packed fields to a map
+func (f *fields) convert() {
+	dict := make(map[string][]byte, f.len()+1)
+	f.each(func(field string, value []byte) {
+		v := make([]byte, len(value))
+		copy(v, value)
+		dict[field] = v
+	})
+	f.dict, f.lp = dict, listpack.Listpack{}
+}
@@ -1,33 +1,76 @@
 package hash
 
+import (
+	"errors"
+	"github.com/KarlvenK/kDB/ds/listpack"
+	"math"
+	"math/rand"
+	"strconv"
+	"time"
+)
+
+var (
+	// ErrNotInteger the value of the field is not an integer
+	ErrNotInteger = errors.New("ds/hash: value is not an integer or out of range")
+
+	// ErrNotFloat the value of the field is not a valid float
+	ErrNotFloat = errors.New("ds/hash: value is not a valid float")
+
+	// ErrOverflow increment would overflow
+	ErrOverflow = errors.New("ds/hash: increment would overflow")
+)
+
 type (
-	Record map[string]map[string][]byte
+	Record map[string]*fields
 
+	// Hash 哈希表，域可以设置过期时间，写入域的值时清除它的过期时间
+	// 过期的域对读操作不可见，在写操作或 DeleteExpired 时被删除
+	// hash tables whose fields may have deadlines, writing the value of a field clears its deadline.
+	// The expired fields are hidden from the reads, and deleted by the writes or DeleteExpired.
 	Hash struct {
-		record Record
+		record  Record
+		expires map[string]map[string]int64 // the deadlines of the fields in unix milliseconds
+		limits  listpack.Limits             // the limits of the compact encoding
 	}
 )
 
 func New() *Hash {
-	return &Hash{make(Record)}
+	return &Hash{record: make(Record), expires: make(map[string]map[string]int64), limits: listpack.DefaultLimits}
+}
+
+// SetLimits 设置哈希表使用紧凑编码的上限，只影响之后写入的哈希表
+// sets the limits of the compact encoding, which only affects the hashes written afterwards
+func (h *Hash) SetLimits(limits listpack.Limits) {
+	h.limits = limits
+}
+
+// Encoding 返回哈希表 key 的编码，listpack 或 hashtable，不存在时返回空字符串
+// returns the encoding of the hash, listpack or hashtable, an empty string if it does not exist
+func (h *Hash) Encoding(key string) string {
+	if !h.exist(key) {
+		return ""
+	}
+	return h.record[key].encoding()
 }
 
 func (h *Hash) HSet(key string, field string, value []byte) int {
 	if !h.exist(key) {
-		h.record[key] = make(map[string][]byte)
+		h.record[key] = &fields{}
 	}
 
-	h.record[key][field] = value
-	return len(h.record[key])
+	h.record[key].set(field, value, h.limits)
+	h.HPersist(key, field)
+	return h.HLen(key)
 }
 
 func (h *Hash) HSetNx(key string, field string, value []byte) bool {
 	if !h.exist(key) {
-		h.record[key] = make(map[string][]byte)
+		h.record[key] = &fields{}
 	}
+	h.expireIfNeeded(key, field)
 	// 如果不存在则赋值value否则不赋值
-	if _, exist := h.record[key][field]; !exist {
-		h.record[key][field] = value
+	if _, exist := h.record[key].get(field); !exist {
+		h.record[key].set(field, value, h.limits)
 		return true
 	}
 
@@ -35,10 +78,11 @@ func (h *Hash) HSetNx(key string, field string, value []byte) bool {
 }
 
 func (h *Hash) HGet(key, field string) []byte {
-	if !h.exist(key) {
+	if !h.exist(key) || h.expired(key, field) {
 		return nil
 	}
-	return h.record[key][field]
+	v, _ := h.record[key].get(field)
+	return v
 }
 
 func (h *Hash) HGetAll(key string) (res [][]byte) {
@@ -46,9 +90,11 @@ func (h *Hash) HGetAll(key string) (res [][]byte) {
 		return
 	}
 
-	for k, v := range h.record[key] {
-		res = append(res, []byte(k), v)
-	}
+	h.record[key].each(func(k string, v []byte) {
+		if !h.expired(key, k) {
+			res = append(res, []byte(k), v)
+		}
+	})
 	return
 }
 
@@ -56,9 +102,10 @@ func (h *Hash) HDel(key, filed string) bool {
 	if !h.exist(key) {
 		return false
 	}
-	if _, exist := h.record[key][filed]; exist {
-		delete(h.record[key], filed)
-		return true
+	expired := h.expired(key, filed)
+	if h.record[key].del(filed) {
+		h.HPersist(key, filed)
+		return !expired
 	}
 	return false
 }
@@ -68,8 +115,8 @@ func (h *Hash) HExists(key, field string) bool {
 	if !h.exist(key) {
 		return false
 	}
-	_, exist := h.record[key][field]
-	return exist
+	_, exist := h.record[key].get(field)
+	return exist && !h.expired(key, field)
 }
 
 func (h *Hash) HLen(key string) int {
@@ -77,7 +124,13 @@ func (h *Hash) HLen(key string) int {
 		return 0
 	}
 
-	return len(h.record[key])
+	n := h.record[key].len()
+	for field := range h.expires[key] {
+		if h.expired(key, field) {
+			n--
+		}
+	}
+	return n
 }
 
 func (h *Hash) HKeys(key string) (value []string) {
@@ -85,9 +138,11 @@ func (h *Hash) HKeys(key string) (value []string) {
 		return
 	}
 
-	for k := range h.record[key] {
-		value = append(value, k)
-	}
+	h.record[key].each(func(k string, _ []byte) {
+		if !h.expired(key, k) {
+			value = append(value, k)
+		}
+	})
 	return
 }
 
@@ -96,12 +151,222 @@ func (h *Hash) HValues(key string) (value [][]byte) {
 		return
 	}
 
-	for _, v := range h.record[key] {
-		value = append(value, v)
+	h.record[key].each(func(k string, v []byte) {
+		if !h.expired(key, k) {
+			value = append(value, v)
+		}
+	})
+	return
+}
+
+// HMSet 设置多个域的值，pairs 为 field value 交替排列，返回新增的域的个数
+// sets the fields to the values, pairs are fields and values in turn, returns the number of new fields
+func (h *Hash) HMSet(key string, pairs ...[]byte) int {
+	if !h.exist(key) {
+		h.record[key] = &fields{}
+	}
+
+	added := 0
+	for i := 0; i+1 < len(pairs); i += 2 {
+		field := string(pairs[i])
+		h.expireIfNeeded(key, field)
+		if h.record[key].set(field, pairs[i+1], h.limits) {
+			added++
+		}
+		h.HPersist(key, field)
+	}
+	return added
+}
+
+// HMGet 返回多个域的值，不存在的域为nil
+// returns the values of the fields, nil for the fields not exist
+func (h *Hash) HMGet(key string, fields ...string) [][]byte {
+	res := make([][]byte, len(fields))
+	for i, field := range fields {
+		res[i] = h.HGet(key, field)
+	}
+	return res
+}
+
+// HIncrBy 将域的整数值加上incr，域不存在时视为0，保留域的过期时间
+// increments the integer value of the field by incr, the field not exist is taken as 0. The deadline is kept.
+func (h *Hash) HIncrBy(key, field string, incr int64) (int64, error) {
+	val, err := h.HIncrByResult(key, field, incr)
+	if err != nil {
+		return 0, err
+	}
+	h.HUpdate(key, field, []byte(strconv.FormatInt(val, 10)))
+	return val, nil
+}
+
+// HIncrByResult 返回域的整数值加上incr的结果，不修改域
+// returns the result of HIncrBy without changing the field
+func (h *Hash) HIncrByResult(key, field string, incr int64) (int64, error) {
+	h.expireIfNeeded(key, field)
+	var val int64
+	if v := h.HGet(key, field); v != nil {
+		var err error
+		if val, err = strconv.ParseInt(string(v), 10, 64); err != nil {
+			return 0, ErrNotInteger
+		}
+	}
+
+	if (incr > 0 && val > math.MaxInt64-incr) || (incr < 0 && val < math.MinInt64-incr) {
+		return 0, ErrOverflow
+	}
+	return val + incr, nil
+}
+
+// HIncrByFloat 将域的浮点数值加上incr，域不存在时视为0，保留域的过期时间
+// increments the float value of the field by incr, the field not exist is taken as 0. The deadline is kept.
+func (h *Hash) HIncrByFloat(key, field string, incr float64) (float64, error) {
+	val, err := h.HIncrByFloatResult(key, field, incr)
+	if err != nil {
+		return 0, err
+	}
+	h.HUpdate(key, field, []byte(strconv.FormatFloat(val, 'f', -1, 64)))
+	return val, nil
+}
+
+// HIncrByFloatResult 返回域的浮点数值加上incr的结果，不修改域
+// returns the result of HIncrByFloat without changing the field
+func (h *Hash) HIncrByFloatResult(key, field string, incr float64) (float64, error) {
+	h.expireIfNeeded(key, field)
+	var val float64
+	if v := h.HGet(key, field); v != nil {
+		var err error
+		if val, err = strconv.ParseFloat(string(v), 64); err != nil {
+			return 0, ErrNotFloat
+		}
+	}
+
+	val += incr
+	if math.IsNaN(val) || math.IsInf(val, 0) {
+		return 0, ErrNotFloat
+	}
+	return val, nil
+}
+
+// HUpdate 设置域的值，和 HSet 不同，保留域的过期时间
+// sets the value of the field, unlike HSet the deadline of the field is kept
+func (h *Hash) HUpdate(key, field string, value []byte) {
+	if !h.exist(key) {
+		h.record[key] = &fields{}
+	}
+	h.record[key].set(field, value, h.limits)
+}
+
+// HStrLen returns the length of the value of the field, 0 if not exists
+func (h *Hash) HStrLen(key, field string) int {
+	return len(h.HGet(key, field))
+}
+
+// HRandField 随机返回count个域，count为正数时域各不相同，为负数时可能重复，withValues为true时域和值交替排列
+// returns count random fields, which are distinct if count is positive and may repeat if count is negative.
+// The fields and values are in turn if withValues is true.
+func (h *Hash) HRandField(key string, count int, withValues bool) (res [][]byte) {
+	if !h.exist(key) || count == 0 {
+		return
+	}
+
+	fields := h.HKeys(key)
+	if len(fields) == 0 {
+		return
+	}
+	if count > 0 {
+		rand.Shuffle(len(fields), func(i, j int) { fields[i], fields[j] = fields[j], fields[i] })
+		if count < len(fields) {
+			fields = fields[:count]
+		}
+	} else {
+		picked := make([]string, -count)
+		for i := range picked {
+			picked[i] = fields[rand.Intn(len(fields))]
+		}
+		fields = picked
+	}
+
+	for _, field := range fields {
+		res = append(res, []byte(field))
+		if withValues {
+			res = append(res, h.HGet(key, field))
+		}
 	}
 	return
 }
 
+// HExpire 设置域的过期时间，deadline 为毫秒级的unix时间戳，域不存在时返回false
+// sets the deadline of the field in unix milliseconds, returns false if the field does not exist
+func (h *Hash) HExpire(key, field string, deadline int64) bool {
+	if !h.HExists(key, field) {
+		return false
+	}
+	if _, ok := h.expires[key]; !ok {
+		h.expires[key] = make(map[string]int64)
+	}
+	h.expires[key][field] = deadline
+	return true
+}
+
+// HPersist 清除域的过期时间，返回域是否设置了过期时间
+// clears the deadline of the field, returns whether the field had a deadline
+func (h *Hash) HPersist(key, field string) bool {
+	if _, ok := h.expires[key][field]; !ok {
+		return false
+	}
+	delete(h.expires[key], field)
+	if len(h.expires[key]) == 0 {
+		delete(h.expires, key)
+	}
+	return true
+}
+
+// HDeadline returns the deadline of the field, false if the field does not exist or has no deadline
+func (h *Hash) HDeadline(key, field string) (int64, bool) {
+	if !h.HExists(key, field) {
+		return 0, false
+	}
+	deadline, ok := h.expires[key][field]
+	return deadline, ok
+}
+
+// DeleteExpired 删除最多limit个已过期的域，返回删除的个数
+// deletes at most limit expired fields, returns the number of deleted ones
+func (h *Hash) DeleteExpired(limit int) int {
+	n, now := 0, nowMillis()
+	for key, fields := range h.expires {
+		for field, deadline := range fields {
+			if n >= limit {
+				return n
+			}
+			if deadline <= now {
+				h.record[key].del(field)
+				h.HPersist(key, field)
+				n++
+			}
+		}
+	}
+	return n
+}
+
+// expired whether the field has a deadline which is passed
+func (h *Hash) expired(key, field string) bool {
+	deadline, ok := h.expires[key][field]
+	return ok && deadline <= nowMillis()
+}
+
+// expireIfNeeded deletes the field if it is expired, called before the writes
+func (h *Hash) expireIfNeeded(key, field string) {
+	if h.expired(key, field) {
+		h.record[key].del(field)
+		h.HPersist(key, field)
+	}
+}
+
+func nowMillis() int64 {
+	return time.Now().UnixNano() / int64(time.Millisecond)
+}
+
 func (h *Hash) exist(key string) bool {
 	_, exist := h.record[key]
 	return exist
@@ -1,6 +1,12 @@
 package hash
 
-import "testing"
+import (
+	"github.com/KarlvenK/kDB/ds/listpack"
+	"math"
+	"reflect"
+	"strconv"
+	"testing"
+)
 
 var key = "my_hash"
 
@@ -84,3 +90,188 @@ func TestHash_HLen(t *testing.T) {
 	hash := InitHash()
 	t.Log(hash.HLen(key))
 }
+
+func TestHash_HMSet(t *testing.T) {
+	hash := InitHash()
+
+	if n := hash.HMSet(key, []byte("a"), []byte("new a"), []byte("d"), []byte("d")); n != 1 {
+		t.Errorf("expected 1 new field, got %d", n)
+	}
+	res := hash.HMGet(key, "a", "d", "none")
+	if !reflect.DeepEqual(res, [][]byte{[]byte("new a"), []byte("d"), nil}) {
+		t.Errorf("hmget got %q", res)
+	}
+	if n := hash.HStrLen(key, "a"); n != 5 {
+		t.Errorf("expected length 5, got %d", n)
+	}
+}
+
+func TestHash_HIncrBy(t *testing.T) {
+	hash := InitHash()
+
+	if val, err := hash.HIncrBy(key, "n", 5); val != 5 || err != nil {
+		t.Errorf("incrby got %d, %v", val, err)
+	}
+	if val, _ := hash.HIncrBy(key, "n", -7); val != -2 {
+		t.Errorf("incrby got %d", val)
+	}
+	if _, err := hash.HIncrBy(key, "a", 1); err != ErrNotInteger {
+		t.Error("expected ErrNotInteger, got ", err)
+	}
+	hash.HSet(key, "max", []byte(strconv.FormatInt(math.MaxInt64, 10)))
+	if _, err := hash.HIncrBy(key, "max", 1); err != ErrOverflow {
+		t.Error("expected ErrOverflow, got ", err)
+	}
+
+	if val, err := hash.HIncrByFloat(key, "n", 0.5); val != -1.5 || err != nil {
+		t.Errorf("incrbyfloat got %v, %v", val, err)
+	}
+	if string(hash.HGet(key, "n")) != "-1.5" {
+		t.Errorf("expected -1.5, got %s", hash.HGet(key, "n"))
+	}
+	if _, err := hash.HIncrByFloat(key, "n", math.Inf(1)); err != ErrNotFloat {
+		t.Error("expected ErrNotFloat, got ", err)
+	}
+
+	//the results are not set, and the deadline is kept by the increments
+	if val, _ := hash.HIncrByResult(key, "n2", 3); val != 3 || hash.HExists(key, "n2") {
+		t.Errorf("incrbyresult got %d and set the field", val)
+	}
+	hash.HSet(key, "ttl", []byte("1"))
+	hash.HExpire(key, "ttl", nowMillis()+100000)
+	_, _ = hash.HIncrBy(key, "ttl", 1)
+	_, _ = hash.HIncrByFloat(key, "ttl", 1)
+	if _, ok := hash.HDeadline(key, "ttl"); !ok || string(hash.HGet(key, "ttl")) != "3" {
+		t.Errorf("expected the deadline to be kept, got %s", hash.HGet(key, "ttl"))
+	}
+}
+
+func TestHash_HRandField(t *testing.T) {
+	hash := InitHash()
+
+	res := hash.HRandField(key, 10, false)
+	seen := make(map[string]bool)
+	for _, f := range res {
+		seen[string(f)] = true
+	}
+	if len(res) != 3 || len(seen) != 3 {
+		t.Errorf("expected 3 distinct fields, got %q", res)
+	}
+
+	res = hash.HRandField(key, -5, true)
+	if len(res) != 10 {
+		t.Fatalf("expected 5 fields with values, got %q", res)
+	}
+	for i := 0; i < len(res); i += 2 {
+		if string(hash.HGet(key, string(res[i]))) != string(res[i+1]) {
+			t.Errorf("%s is not followed by its value", res[i])
+		}
+	}
+	if res = hash.HRandField("no", 1, false); len(res) != 0 {
+		t.Errorf("expected nothing, got %q", res)
+	}
+}
+
+func TestHash_HExpire(t *testing.T) {
+	hash := InitHash()
+	now := nowMillis()
+
+	if hash.HExpire(key, "none", now+1000) {
+		t.Error("expected false for a missing field")
+	}
+	_ = hash.HExpire(key, "a", now-1)
+	_ = hash.HExpire(key, "b", now+60000)
+
+	//the expired field is hidden
+	if hash.HGet(key, "a") != nil || hash.HExists(key, "a") || hash.HLen(key) != 2 {
+		t.Error("expected a to be expired")
+	}
+	if len(hash.HKeys(key)) != 2 || len(hash.HValues(key)) != 2 || len(hash.HGetAll(key)) != 4 {
+		t.Error("expected the expired field to be hidden")
+	}
+	if hash.HDel(key, "a") {
+		t.Error("expected false to delete an expired field")
+	}
+	if deadline, ok := hash.HDeadline(key, "b"); !ok || deadline != now+60000 {
+		t.Errorf("deadline got %d, %v", deadline, ok)
+	}
+
+	//writing the value clears the deadline
+	hash.HSet(key, "b", []byte("new b"))
+	if _, ok := hash.HDeadline(key, "b"); ok {
+		t.Error("expected the deadline to be cleared")
+	}
+	_ = hash.HExpire(key, "b", now+60000)
+	if !hash.HPersist(key, "b") || hash.HPersist(key, "b") {
+		t.Error("expected the deadline to be cleared once")
+	}
+
+	//the expired field can be set again
+	_ = hash.HExpire(key, "c", now-1)
+	if !hash.HSetNx(key, "c", []byte("new c")) || string(hash.HGet(key, "c")) != "new c" {
+		t.Error("expected c to be set again")
+	}
+}
+
+func TestHash_DeleteExpired(t *testing.T) {
+	hash := New()
+	now := nowMillis()
+	for i := 0; i < 10; i++ {
+		field := strconv.Itoa(i)
+		hash.HSet(key, field, []byte(field))
+		if i < 6 {
+			_ = hash.HExpire(key, field, now-1)
+		} else {
+			_ = hash.HExpire(key, field, now+60000)
+		}
+	}
+
+	if n := hash.DeleteExpired(4); n != 4 {
+		t.Errorf("expected 4 fields to be deleted, got %d", n)
+	}
+	if n := hash.DeleteExpired(100); n != 2 {
+		t.Errorf("expected 2 fields to be deleted, got %d", n)
+	}
+	if hash.record[key].len() != 4 || len(hash.expires[key]) != 4 || hash.HLen(key) != 4 {
+		t.Errorf("expected 4 fields left, got %d", hash.record[key].len())
+	}
+}
+
+func TestHash_Encoding(t *testing.T) {
+	hash := New()
+	hash.SetLimits(listpack.Limits{MaxEntries: 3, MaxValue: 5})
+
+	hash.HSet(key, "a", []byte("1"))
+	hash.HMSet(key, []byte("b"), []byte("2"), []byte("c"), []byte("3"))
+	hash.HSet(key, "a", []byte("4"))
+	if hash.Encoding(key) != EncodingListpack {
+		t.Errorf("expected listpack, got %s", hash.Encoding(key))
+	}
+	if !hash.HDel(key, "b") || hash.HLen(key) != 2 || string(hash.HGet(key, "a")) != "4" {
+		t.Error("unexpected fields of the packed hash")
+	}
+
+	hash.HSet(key, "b", []byte("long value"))
+	if hash.Encoding(key) != EncodingHashtable {
+		t.Errorf("expected hashtable for a long value, got %s", hash.Encoding(key))
+	}
+	want := map[string]string{"a": "4", "b": "long value", "c": "3"}
+	got := make(map[string]string)
+	all := hash.HGetAll(key)
+	for i := 0; i < len(all); i += 2 {
+		got[string(all[i])] = string(all[i+1])
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v after the conversion, got %v", want, got)
+	}
+
+	for i := 0; i < 4; i++ {
+		hash.HSet("many", strconv.Itoa(i), nil)
+	}
+	if hash.Encoding("many") != EncodingHashtable || hash.HLen("many") != 4 {
+		t.Errorf("expected hashtable for too many fields, got %s", hash.Encoding("many"))
+	}
+	if hash.Encoding("missing") != "" {
+		t.Error("expected no encoding for a missing key")
+	}
+}
@@ -0,0 +1,427 @@
+package hll
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"sort"
+)
+
+// HyperLogLog 基数估计的实现，每个key的sketch有稀疏和稠密两种编码
+// 元素较少时使用稀疏编码，只保存非零的寄存器，超过阈值后转换为稠密编码
+// 标准误差约为 0.81%，详细可参考 http://algo.inria.fr/flajolet/Publications/FlFuGaMe07.pdf
+
+const (
+	// 寄存器索引的位数 the number of bits of the register index
+	precision = 14
+
+	// 寄存器个数 the number of registers
+	registers = 1 << precision
+
+	// 每个寄存器的位数 bits of each register
+	registerBits = 6
+
+	registerMax = 1<<registerBits - 1
+
+	// 稠密编码的字节数 bytes of dense encoding: 12KB
+	denseSize = registers * registerBits / 8
+
+	// 稀疏编码的最大字节数，超过后转换为稠密编码
+	// the max bytes of sparse encoding, the sketch is converted to dense beyond it
+	sparseMaxBytes = 3000
+
+	// 稀疏编码中每个寄存器占用的字节数：index(2) + value(1)
+	sparseEntrySize = 3
+)
+
+// encoding of a dumped sketch
+const (
+	sparse byte = iota
+	dense
+)
+
+var (
+	// ErrInvalidSketch the dumped sketch is invalid
+	ErrInvalidSketch = errors.New("ds/hll: invalid sketch")
+)
+
+type (
+	Record map[string]*Sketch
+
+	// HyperLogLog hyperloglog struct
+	HyperLogLog struct {
+		record Record
+	}
+
+	// Sketch 一个key的寄存器，sparse 不为 nil 时为稀疏编码
+	// the registers of a key, in sparse encoding if sparse is not nil
+	Sketch struct {
+		sparse []uint32 // sorted index<<8 | value of the non-zero registers
+		dense  []byte   // packed 6 bits registers
+	}
+)
+
+// New new a hyperloglog
+func New() *HyperLogLog {
+	return &HyperLogLog{make(Record)}
+}
+
+// PFAdd 将元素添加到key的sketch中，返回是否有寄存器被修改
+// add the element to the sketch of key, returns whether any register is changed
+func (h *HyperLogLog) PFAdd(key string, element []byte) bool {
+	sk := h.sketch(key)
+	idx, count := position(element)
+	return sk.update(idx, count)
+}
+
+// PFCount 返回给定key的并集的基数估计值
+// returns the approximated cardinality of the union of the sketches of keys
+func (h *HyperLogLog) PFCount(keys ...string) uint64 {
+	if len(keys) == 1 {
+		if sk, ok := h.record[keys[0]]; ok {
+			return sk.Count()
+		}
+		return 0
+	}
+
+	union := NewSketch()
+	for _, k := range keys {
+		if sk, ok := h.record[k]; ok {
+			union.Merge(sk)
+		}
+	}
+	return union.Count()
+}
+
+// PFMerge 将给定key的sketch合并到dest中
+// merge the sketches of keys into dest
+func (h *HyperLogLog) PFMerge(dest string, keys ...string) {
+	sk := h.sketch(dest)
+	for _, k := range keys {
+		if src, ok := h.record[k]; ok && k != dest {
+			sk.Merge(src)
+		}
+	}
+}
+
+// PFExists whether the sketch of key exists
+func (h *HyperLogLog) PFExists(key string) bool {
+	_, exist := h.record[key]
+	return exist
+}
+
+// Dump 返回key的sketch的编码，key不存在时返回nil
+// returns the encoded sketch of key, nil if the key does not exist
+func (h *HyperLogLog) Dump(key string) []byte {
+	if sk, ok := h.record[key]; ok {
+		return sk.Bytes()
+	}
+	return nil
+}
+
+// Restore 将Dump返回的sketch合并到key中
+// merge the sketch returned by Dump into key
+func (h *HyperLogLog) Restore(key string, data []byte) error {
+	src, err := Decode(data)
+	if err != nil {
+		return err
+	}
+
+	h.sketch(key).Merge(src)
+	return nil
+}
+
+// Keys returns all keys
+func (h *HyperLogLog) Keys() (keys []string) {
+	for k := range h.record {
+		keys = append(keys, k)
+	}
+	return
+}
+
+func (h *HyperLogLog) sketch(key string) *Sketch {
+	sk, ok := h.record[key]
+	if !ok {
+		sk = NewSketch()
+		h.record[key] = sk
+	}
+	return sk
+}
+
+// NewSketch new an empty sketch in sparse encoding
+func NewSketch() *Sketch {
+	return &Sketch{sparse: make([]uint32, 0)}
+}
+
+// IsSparse whether the sketch is in sparse encoding
+func (sk *Sketch) IsSparse() bool {
+	return sk.sparse != nil
+}
+
+// Count 返回基数估计值
+// returns the approximated cardinality
+// the estimator of Otmar Ertl: https://arxiv.org/abs/1702.01284
+func (sk *Sketch) Count() uint64 {
+	const q = 64 - precision
+	var hist [q + 2]int
+
+	if sk.IsSparse() {
+		hist[0] = registers - len(sk.sparse)
+		for _, r := range sk.sparse {
+			hist[r&0xff]++
+		}
+	} else {
+		for i := 0; i < registers; i++ {
+			hist[sk.get(i)]++
+		}
+	}
+
+	m := float64(registers)
+	z := m * tau((m-float64(hist[q+1]))/m)
+	for k := q; k >= 1; k-- {
+		z += float64(hist[k])
+		z *= 0.5
+	}
+	z += m * sigma(float64(hist[0])/m)
+	return uint64(math.Round(0.5 / math.Ln2 * m * m / z))
+}
+
+// Merge 将src的寄存器合并到sk中，每个寄存器取两者的最大值
+// merge the registers of src into sk, each register takes the max value
+func (sk *Sketch) Merge(src *Sketch) {
+	if src.IsSparse() {
+		for _, r := range src.sparse {
+			sk.update(int(r>>8), uint8(r&0xff))
+		}
+		return
+	}
+
+	if sk.IsSparse() {
+		sk.toDense()
+	}
+	for i := 0; i < registers; i++ {
+		if v := src.get(i); v > sk.get(i) {
+			sk.set(i, v)
+		}
+	}
+}
+
+// Bytes 编码sketch，第一个字节为编码方式
+// encode the sketch, the first byte is the encoding
+func (sk *Sketch) Bytes() []byte {
+	if !sk.IsSparse() {
+		buf := make([]byte, 1+denseSize)
+		buf[0] = dense
+		copy(buf[1:], sk.dense)
+		return buf
+	}
+
+	buf := make([]byte, 1+len(sk.sparse)*sparseEntrySize)
+	buf[0] = sparse
+	for i, r := range sk.sparse {
+		off := 1 + i*sparseEntrySize
+		binary.BigEndian.PutUint16(buf[off:], uint16(r>>8))
+		buf[off+2] = byte(r)
+	}
+	return buf
+}
+
+// Decode 解码Bytes返回的数据
+// decode the data returned by Bytes
+func Decode(data []byte) (*Sketch, error) {
+	if len(data) == 0 {
+		return nil, ErrInvalidSketch
+	}
+
+	switch data[0] {
+	case dense:
+		if len(data) != 1+denseSize {
+			return nil, ErrInvalidSketch
+		}
+		sk := &Sketch{dense: make([]byte, denseSize)}
+		copy(sk.dense, data[1:])
+		return sk, nil
+	case sparse:
+		if (len(data)-1)%sparseEntrySize != 0 {
+			return nil, ErrInvalidSketch
+		}
+		sk := NewSketch()
+		for off := 1; off < len(data); off += sparseEntrySize {
+			idx := int(binary.BigEndian.Uint16(data[off:]))
+			val := data[off+2]
+			if idx >= registers || val > registerMax {
+				return nil, ErrInvalidSketch
+			}
+			sk.update(idx, val)
+		}
+		return sk, nil
+	}
+	return nil, ErrInvalidSketch
+}
+
+// update 寄存器的值小于val时更新，返回是否被修改
+func (sk *Sketch) update(idx int, val uint8) bool {
+	if !sk.IsSparse() {
+		if val > sk.get(idx) {
+			sk.set(idx, val)
+			return true
+		}
+		return false
+	}
+
+	i := sort.Search(len(sk.sparse), func(i int) bool {
+		return int(sk.sparse[i]>>8) >= idx
+	})
+	r := uint32(idx)<<8 | uint32(val)
+	if i < len(sk.sparse) && int(sk.sparse[i]>>8) == idx {
+		if uint8(sk.sparse[i]) >= val {
+			return false
+		}
+		sk.sparse[i] = r
+		return true
+	}
+
+	sk.sparse = append(sk.sparse, 0)
+	copy(sk.sparse[i+1:], sk.sparse[i:])
+	sk.sparse[i] = r
+	if len(sk.sparse)*sparseEntrySize > sparseMaxBytes {
+		sk.toDense()
+	}
+	return true
+}
+
+// toDense 转换为稠密编码
+func (sk *Sketch) toDense() {
+	sk.dense = make([]byte, denseSize)
+	for _, r := range sk.sparse {
+		sk.set(int(r>>8), uint8(r&0xff))
+	}
+	sk.sparse = nil
+}
+
+// get the register of dense encoding
+func (sk *Sketch) get(idx int) uint8 {
+	bit := idx * registerBits
+	b0, shift := bit/8, uint(bit%8)
+	v := uint16(sk.dense[b0])
+	if b0+1 < denseSize {
+		v |= uint16(sk.dense[b0+1]) << 8
+	}
+	return uint8(v>>shift) & registerMax
+}
+
+// set the register of dense encoding
+func (sk *Sketch) set(idx int, val uint8) {
+	bit := idx * registerBits
+	b0, shift := bit/8, uint(bit%8)
+	v := uint16(sk.dense[b0])
+	if b0+1 < denseSize {
+		v |= uint16(sk.dense[b0+1]) << 8
+	}
+
+	v = v&^(registerMax<<shift) | uint16(val)<<shift
+	sk.dense[b0] = byte(v)
+	if b0+1 < denseSize {
+		sk.dense[b0+1] = byte(v >> 8)
+	}
+}
+
+// position 返回元素对应的寄存器索引，以及哈希值剩余位中第一个1出现的位置
+// returns the register index of the element, and the position of the first 1 bit of the rest hash bits
+func position(element []byte) (int, uint8) {
+	hash := murmurHash64A(element, 0xadc83b19)
+	idx := int(hash & (registers - 1))
+
+	hash >>= precision
+	hash |= 1 << (64 - precision)
+	count := uint8(1)
+	for hash&1 == 0 {
+		count++
+		hash >>= 1
+	}
+	return idx, count
+}
+
+func sigma(x float64) float64 {
+	if x == 1 {
+		return math.Inf(1)
+	}
+
+	y, z := 1.0, x
+	for {
+		x *= x
+		prev := z
+		z += x * y
+		y += y
+		if z == prev {
+			return z
+		}
+	}
+}
+
+func tau(x float64) float64 {
+	if x == 0 || x == 1 {
+		return 0
+	}
+
+	y, z := 1.0, 1-x
+	for {
+		x = math.Sqrt(x)
+		prev := z
+		y *= 0.5
+		z -= math.Pow(1-x, 2) * y
+		if z == prev {
+			return z / 3
+		}
+	}
+}
+
+// murmurHash64A MurmurHash2 的 64 位版本，与 Redis 的实现一致
+// 64 bit version of MurmurHash2, the same as Redis uses
+func murmurHash64A(data []byte, seed uint64) uint64 {
+	const (
+		m = 0xc6a4a7935bd1e995
+		r = 47
+	)
+
+	h := seed ^ uint64(len(data))*m
+	for len(data) >= 8 {
+		k := binary.LittleEndian.Uint64(data)
+		k *= m
+		k ^= k >> r
+		k *= m
+
+		h ^= k
+		h *= m
+		data = data[8:]
+	}
+
+	switch len(data) {
+	case 7:
+		h ^= uint64(data[6]) << 48
+		fallthrough
+	case 6:
+		h ^= uint64(data[5]) << 40
+		fallthrough
+	case 5:
+		h ^= uint64(data[4]) << 32
+		fallthrough
+	case 4:
+		h ^= uint64(data[3]) << 24
+		fallthrough
+	case 3:
+		h ^= uint64(data[2]) << 16
+		fallthrough
+	case 2:
+		h ^= uint64(data[1]) << 8
+		fallthrough
+	case 1:
+		h ^= uint64(data[0])
+		h *= m
+	}
+
+	h ^= h >> r
+	h *= m
+	h ^= h >> r
+	return h
+}
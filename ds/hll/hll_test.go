@@ -0,0 +1,101 @@
+package hll
+
+import (
+	"math"
+	"strconv"
+	"testing"
+)
+
+var key = "my_hll"
+
+func InitHll(n int) *HyperLogLog {
+	h := New()
+	for i := 0; i < n; i++ {
+		h.PFAdd(key, []byte("element-"+strconv.Itoa(i)))
+	}
+	return h
+}
+
+func checkError(t *testing.T, n int, count uint64) {
+	if e := math.Abs(float64(count)-float64(n)) / float64(n); e > 0.02 {
+		t.Errorf("n = %d, count = %d, error = %.4f", n, count, e)
+	}
+}
+
+func TestHyperLogLog_PFAdd(t *testing.T) {
+	h := New()
+
+	t.Log(h.PFAdd(key, []byte("a")))
+	t.Log(h.PFAdd(key, []byte("b")))
+	if h.PFAdd(key, []byte("a")) {
+		t.Error("add the same element again should not change the sketch")
+	}
+	if count := h.PFCount(key); count != 2 {
+		t.Error("expected 2, got ", count)
+	}
+}
+
+func TestHyperLogLog_PFCount(t *testing.T) {
+	for _, n := range []int{10, 100, 1000, 10000, 100000} {
+		h := InitHll(n)
+		count := h.PFCount(key)
+		t.Log(n, count)
+		checkError(t, n, count)
+	}
+
+	if count := New().PFCount("not exist"); count != 0 {
+		t.Error("expected 0, got ", count)
+	}
+}
+
+func TestHyperLogLog_Encoding(t *testing.T) {
+	h := InitHll(100)
+	if !h.record[key].IsSparse() {
+		t.Error("expected sparse encoding")
+	}
+
+	h = InitHll(10000)
+	if h.record[key].IsSparse() {
+		t.Error("expected dense encoding")
+	}
+}
+
+func TestHyperLogLog_PFMerge(t *testing.T) {
+	h := New()
+	for i := 0; i < 20000; i++ {
+		h.PFAdd("k1", []byte(strconv.Itoa(i)))
+	}
+	for i := 10000; i < 30000; i++ {
+		h.PFAdd("k2", []byte(strconv.Itoa(i)))
+	}
+
+	checkError(t, 30000, h.PFCount("k1", "k2"))
+
+	h.PFMerge("dest", "k1", "k2", "not exist")
+	checkError(t, 30000, h.PFCount("dest"))
+	if h.PFCount("k1", "k2") != h.PFCount("dest") {
+		t.Error("merged count differs from union count")
+	}
+}
+
+func TestHyperLogLog_Restore(t *testing.T) {
+	for _, n := range []int{50, 50000} {
+		h := InitHll(n)
+		data := h.Dump(key)
+
+		h2 := New()
+		if err := h2.Restore(key, data); err != nil {
+			t.Fatal(err)
+		}
+		if h.PFCount(key) != h2.PFCount(key) {
+			t.Errorf("expected %d, got %d", h.PFCount(key), h2.PFCount(key))
+		}
+	}
+
+	if err := New().Restore(key, []byte{dense, 1, 2}); err != ErrInvalidSketch {
+		t.Error("expected ErrInvalidSketch, got ", err)
+	}
+	if New().Dump("not exist") != nil {
+		t.Error("expected nil")
+	}
+}
@@ -1,8 +1,7 @@
 package list
 
 import (
-	"container/list"
-	"reflect"
+	"bytes"
 )
 
 //InsertOption insert option for LInsert
@@ -14,8 +13,19 @@ const (
 	After
 )
 
+//Direction the end of a list for LMove
+type Direction uint8
+
+// list ends
+const (
+	Left Direction = iota
+	Right
+)
+
 type (
-	Record map[string]*list.List
+	// Record 每个键对应一个 quicklist
+	// each key holds a quicklist
+	Record map[string]*quicklist
 	List   struct {
 		record Record
 	}
@@ -51,14 +61,7 @@ func (myList *List) LIndex(key string, index int) []byte {
 		return nil
 	}
 
-	index = newIndex
-
-	var val []byte
-	e := myList.index(key, index)
-	if e != nil {
-		val = e.Value.([]byte)
-	}
-	return val
+	return myList.record[key].index(newIndex)
 }
 
 // LRem 根据count的值，remove和val相等的值
@@ -73,44 +76,23 @@ func (myList *List) LRem(key string, val []byte, count int) int {
 		return 0
 	}
 
-	var ele []*list.Element
-	if count == 0 {
-		for p := item.Front(); p != nil; p = p.Next() {
-			if reflect.DeepEqual(p.Value.([]byte), val) {
-				ele = append(ele, p)
-			}
-		}
+	reverse := count < 0
+	if reverse {
+		count = -count
 	}
+	removed := item.remove(func(v []byte) bool {
+		return bytes.Equal(v, val)
+	}, count, reverse)
 
-	if count > 0 {
-		for p := item.Front(); p != nil && len(ele) < count; p = p.Next() {
-			if reflect.DeepEqual(p.Value.([]byte), val) {
-				ele = append(ele, p)
-			}
-		}
-	}
-
-	if count < 0 {
-		for p := item.Back(); p != nil && len(ele) < (-count); p = p.Prev() {
-			if reflect.DeepEqual(p.Value.([]byte), val) {
-				ele = append(ele, p)
-			}
-		}
-	}
-
-	for _, e := range ele {
-		item.Remove(e)
-	}
-	length := len(ele)
-	ele = nil
-	return length
+	myList.clearEmpty(key)
+	return removed
 }
 
 //LInsert insert val to list of key, in the front or back of pivot
 //如果命令成功返回插入后列表的长度， 如果没有找到pivot，返回 -1
 func (myList *List) LInsert(key string, option InsertOption, pivot, val []byte) int {
-	e := myList.find(key, pivot)
-	if e == nil {
+	index := myList.find(key, pivot)
+	if index < 0 {
 		return -1
 	}
 
@@ -118,9 +100,9 @@ func (myList *List) LInsert(key string, option InsertOption, pivot, val []byte)
 
 	switch option {
 	case Before:
-		item.InsertBefore(val, e)
+		item.insert(index, val)
 	case After:
-		item.InsertAfter(val, e)
+		item.insert(index+1, val)
 	}
 
 	return item.Len()
@@ -128,12 +110,12 @@ func (myList *List) LInsert(key string, option InsertOption, pivot, val []byte)
 
 //LSet change the element of index to val
 func (myList *List) LSet(key string, index int, val []byte) bool {
-	e := myList.index(key, index)
-	if e == nil {
+	ok, newIndex := myList.validIndex(key, index)
+	if !ok {
 		return false
 	}
 
-	e.Value = val
+	myList.record[key].set(newIndex, val)
 	return true
 }
 
@@ -146,32 +128,15 @@ func (myList *List) LRange(key string, start, end int) (values [][]byte) {
 	if item == nil || item.Len() <= 0 {
 		return
 	}
-	length := item.Len()
-	start, end = myList.handleIndex(length, start, end)
-
-	mid := length >> 1
+	start, end = myList.handleIndex(item.Len(), start, end)
 
-	if end <= mid || end-mid < mid-start {
-		flag := 0
-		for p := item.Front(); p != nil && flag <= end; p, flag = p.Next(), flag+1 {
-			if flag >= start {
-				values = append(values, p.Value.([]byte))
-			}
-		}
-	} else {
-		flag := length - 1
-		for p := item.Back(); p != nil && flag >= start; p, flag = p.Prev(), flag-1 {
-			if flag <= end {
-				values = append(values, p.Value.([]byte))
-			}
+	item.each(start, func(i int, val []byte) bool {
+		if i > end {
+			return false
 		}
-
-		if len(values) > 0 {
-			for i, j := 0, len(values)-1; i < j; i, j = i+1, j-1 {
-				values[i], values[j] = values[j], values[i]
-			}
-		}
-	}
+		values = append(values, copyBytes(val))
+		return true
+	})
 
 	return
 }
@@ -192,121 +157,160 @@ func (myList *List) LTrim(key string, start, end int) bool {
 	}
 	//look below
 	if start > end || start >= length {
-		myList.record[key] = nil
+		delete(myList.record, key)
 		return true
 	}
 
-	startEle, endEle := myList.index(key, start), myList.index(key, end)
+	item.trim(start, end)
+	return true
+}
 
-	if end-start+1 < (length >> 1) {
-		newList := list.New()
-		for p := startEle; p != endEle.Next(); p = p.Next() {
-			newList.PushBack(p.Value)
-		}
+// LPopCount 从表头移除并返回最多count个元素
+// removes and returns at most count elements from the head
+func (myList *List) LPopCount(key string, count int) [][]byte {
+	return myList.popCount(true, key, count)
+}
 
-		item = nil
-		myList.record[key] = newList
-	} else {
-		var ele []*list.Element
-		for p := item.Front(); p != startEle; p = p.Next() {
-			ele = append(ele, p)
-		}
-		for p := item.Back(); p != endEle; p = p.Prev() {
-			ele = append(ele, p)
-		}
-		for _, v := range ele {
-			item.Remove(v)
-		}
-		ele = nil
-	}
-	return true
+// RPopCount 从表尾移除并返回最多count个元素
+// removes and returns at most count elements from the tail
+func (myList *List) RPopCount(key string, count int) [][]byte {
+	return myList.popCount(false, key, count)
 }
 
-// LLen 返回key的list的元素个数
-func (myList *List) LLen(key string) int {
-	length := 0
-	if myList.record[key] != nil {
-		length = myList.record[key].Len()
+// LMove 从 src 的 from 端移除一个元素并插入到 dst 的 to 端，返回该元素，src 为空时返回nil
+// removes an element at the from end of src and pushes it at the to end of dst, returns nil if src is empty
+func (myList *List) LMove(src, dst string, from, to Direction) []byte {
+	val := myList.pop(from == Left, src)
+	if val != nil {
+		myList.push(to == Left, dst, val)
 	}
-	return length
+	return val
 }
 
-func (myList *List) find(key string, val []byte) *list.Element {
+// LPos 返回与val相等的元素的下标，rank 为负数时从表尾开始查找并跳过前 |rank|-1 个匹配的元素
+// 最多返回count个下标，count 为0时返回所有的下标，maxLen 不为0时最多比较maxLen个元素
+// returns the indexes of the elements equal to val, searching from the tail if rank is negative,
+// and skipping the first |rank|-1 matches. At most count indexes are returned, all of them if count is 0,
+// and at most maxLen elements are compared if maxLen is not 0.
+func (myList *List) LPos(key string, val []byte, rank, count, maxLen int) (res []int) {
 	item := myList.record[key]
-	var e *list.Element
+	if item == nil || rank == 0 {
+		return
+	}
 
-	if item != nil {
-		for p := item.Front(); p != nil; p = p.Next() {
-			if reflect.DeepEqual(p.Value.([]byte), val) {
-				e = p
-				break
+	skip := rank - 1
+	if rank < 0 {
+		skip = -rank - 1
+	}
+	compared := 0
+	match := func(i int, v []byte) bool {
+		if maxLen != 0 && compared >= maxLen {
+			return false
+		}
+		compared++
+		if bytes.Equal(v, val) {
+			if skip > 0 {
+				skip--
+			} else {
+				res = append(res, i)
+				if len(res) == count {
+					return false
+				}
 			}
 		}
+		return true
 	}
 
-	return e
+	if rank < 0 {
+		item.eachReverse(item.Len()-1, match)
+	} else {
+		item.each(0, match)
+	}
+	return
 }
 
-func (myList *List) index(key string, index int) *list.Element {
-	ok, newIndex := myList.validIndex(key, index)
-	if !ok {
-		return nil
+// Keys returns the keys of all lists not empty
+func (myList *List) Keys() (keys []string) {
+	for k, item := range myList.record {
+		if item != nil && item.Len() > 0 {
+			keys = append(keys, k)
+		}
 	}
+	return
+}
 
-	index = newIndex
-	item := myList.record[key]
-	var e *list.Element
+// LLen 返回key的list的元素个数
+func (myList *List) LLen(key string) int {
+	length := 0
+	if myList.record[key] != nil {
+		length = myList.record[key].Len()
+	}
+	return length
+}
 
-	if item != nil && item.Len() > 0 {
-		if index <= (item.Len() >> 1) {
-			val := item.Front()
-			for i := 0; i < index; i++ {
-				val = val.Next()
+// find returns the index of the first element equal to val, -1 if not found
+func (myList *List) find(key string, val []byte) int {
+	index := -1
+	if item := myList.record[key]; item != nil {
+		item.each(0, func(i int, v []byte) bool {
+			if bytes.Equal(v, val) {
+				index = i
+				return false
 			}
-			e = val
-		} else {
-			val := item.Back()
-			for i := item.Len() - 1; i > index; i-- {
-				val = val.Prev()
-			}
-			e = val
-		}
+			return true
+		})
 	}
-	return e
+
+	return index
 }
 
 func (myList *List) push(pushFront bool, key string, val ...[]byte) int {
 	if myList.record[key] == nil {
-		myList.record[key] = list.New()
+		myList.record[key] = newQuicklist()
 	}
 
+	item := myList.record[key]
 	for _, v := range val {
 		if pushFront {
-			myList.record[key].PushFront(v)
+			item.pushFront(v)
 		} else {
-			myList.record[key].PushBack(v)
+			item.pushBack(v)
 		}
 	}
 
-	return myList.record[key].Len()
+	return item.Len()
 }
 
 func (myList *List) pop(popFront bool, key string) (value []byte) {
 	item := myList.record[key]
 
 	if item != nil && item.Len() > 0 {
-		var e *list.Element
-
 		if popFront {
-			e = item.Front()
+			value = item.popFront()
 		} else {
-			e = item.Back()
+			value = item.popBack()
 		}
+		myList.clearEmpty(key)
+	}
 
-		value = e.Value.([]byte)
-		item.Remove(e)
+	return
+}
+
+// clearEmpty removes the list of key if it is empty
+func (myList *List) clearEmpty(key string) {
+	if item := myList.record[key]; item != nil && item.Len() == 0 {
+		delete(myList.record, key)
 	}
+}
 
+func (myList *List) popCount(popFront bool, key string, count int) (values [][]byte) {
+	for i := 0; i < count; i++ {
+		val := myList.pop(popFront, key)
+		if val == nil {
+			break
+		}
+		values = append(values, val)
+	}
 	return
 }
 
@@ -2,6 +2,7 @@ package list
 
 import (
 	"fmt"
+	"reflect"
 	"testing"
 )
 
@@ -22,8 +23,8 @@ func PrintListData(lis *List) {
 		return
 	}
 
-	for p := lis.record[key].Front(); p != nil; p = p.Next() {
-		fmt.Print(string(p.Value.([]byte)), " ")
+	for _, val := range lis.LRange(key, 0, -1) {
+		fmt.Print(string(val), " ")
 	}
 
 	fmt.Println()
@@ -238,3 +239,64 @@ func TestList_LTrim(t *testing.T) {
 	//	PrintListData(newLIst)
 	//})
 }
+
+func TestList_LPopCount(t *testing.T) {
+	list := InitList()
+
+	if got := list.LPopCount(key, 2); !reflect.DeepEqual(got, [][]byte{[]byte("f"), []byte("e")}) {
+		t.Errorf("unexpected elements %q", got)
+	}
+	if got := list.RPopCount(key, 10); len(got) != 4 || string(got[0]) != "a" {
+		t.Errorf("unexpected elements %q", got)
+	}
+	if list.LLen(key) != 0 || list.LPopCount(key, 1) != nil {
+		t.Error("the list should be empty")
+	}
+}
+
+func TestList_LMove(t *testing.T) {
+	list := InitList()
+
+	if val := list.LMove(key, "dst", Right, Left); string(val) != "a" {
+		t.Errorf("expected a, got %s", val)
+	}
+	if val := list.LMove(key, "dst", Left, Right); string(val) != "f" {
+		t.Errorf("expected f, got %s", val)
+	}
+	if got := list.LRange("dst", 0, -1); !reflect.DeepEqual(got, [][]byte{[]byte("a"), []byte("f")}) {
+		t.Errorf("unexpected elements %q", got)
+	}
+	//rotate the list
+	list.LMove(key, key, Left, Right)
+	if got := list.LRange(key, 0, -1); string(got[len(got)-1]) != "e" {
+		t.Errorf("unexpected elements %q", got)
+	}
+	if list.LMove("not_exist", "dst", Left, Left) != nil {
+		t.Error("nothing should be moved from the list not exist")
+	}
+}
+
+func TestList_LPos(t *testing.T) {
+	list := New()
+	for _, v := range []string{"a", "b", "c", "b", "d", "b"} {
+		list.RPush(key, []byte(v))
+	}
+
+	tests := []struct {
+		rank, count, maxLen int
+		want                []int
+	}{
+		{1, 1, 0, []int{1}},
+		{2, 1, 0, []int{3}},
+		{1, 0, 0, []int{1, 3, 5}},
+		{-1, 2, 0, []int{5, 3}},
+		{1, 0, 3, []int{1}},
+		{4, 1, 0, nil},
+		{0, 1, 0, nil},
+	}
+	for _, tt := range tests {
+		if got := list.LPos(key, []byte("b"), tt.rank, tt.count, tt.maxLen); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("LPos(rank %d, count %d, maxLen %d) = %v, want %v", tt.rank, tt.count, tt.maxLen, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,414 @@
+package list
+
+import (
+	"encoding/binary"
+)
+
+const (
+	// maxNodeSize 节点中编码后元素的最大字节数，更大的元素独占一个节点
+	// the max bytes of the packed entries of a node, a larger entry gets a node of its own
+	maxNodeSize = 8 * 1024
+
+	// maxNodeEntries 节点中元素的最大个数
+	// the max number of entries of a node
+	maxNodeEntries = 128
+)
+
+// quicklist 由节点组成的双向链表，每个节点将若干元素紧凑地编码在一个字节数组中，并记录元素个数
+// 按下标访问时按节点的元素个数跳过整个节点，复杂度为 O(n/maxNodeEntries)
+// a doubly linked list of nodes, each node packs some entries into one byte slice and keeps their count.
+// Positional access skips whole nodes by their counts, so it is O(n/maxNodeEntries).
+type quicklist struct {
+	head, tail *qnode
+	length     int
+}
+
+// qnode 每个元素编码为 uvarint 长度 + 数据
+// each entry is packed as its uvarint length followed by its data
+type qnode struct {
+	prev, next *qnode
+	buf        []byte
+	count      int
+}
+
+func newQuicklist() *quicklist {
+	return &quicklist{}
+}
+
+// Len returns the number of entries, 0 for a nil quicklist
+func (q *quicklist) Len() int {
+	if q == nil {
+		return 0
+	}
+	return q.length
+}
+
+func (q *quicklist) pushFront(val []byte) {
+	n := q.head
+	if n == nil || !n.fits(entrySize(val)) {
+		n = &qnode{}
+		q.link(nil, n)
+	}
+	buf := make([]byte, 0, entrySize(val)+len(n.buf))
+	buf = appendEntry(buf, val)
+	n.buf = append(buf, n.buf...)
+	n.count++
+	q.length++
+}
+
+func (q *quicklist) pushBack(val []byte) {
+	n := q.tail
+	if n == nil || !n.fits(entrySize(val)) {
+		n = &qnode{}
+		q.link(q.tail, n)
+	}
+	n.buf = appendEntry(n.buf, val)
+	n.count++
+	q.length++
+}
+
+func (q *quicklist) popFront() []byte {
+	n := q.head
+	if n == nil {
+		return nil
+	}
+	val, size := decodeEntry(n.buf)
+	val = copyBytes(val)
+	n.buf = n.buf[size:]
+	n.count--
+	q.length--
+	if n.count == 0 {
+		q.unlink(n)
+	}
+	return val
+}
+
+func (q *quicklist) popBack() []byte {
+	n := q.tail
+	if n == nil {
+		return nil
+	}
+	var off, size int
+	for i := 0; i < n.count; i++ {
+		off += size
+		_, size = decodeEntry(n.buf[off:])
+	}
+	val, _ := decodeEntry(n.buf[off:])
+	val = copyBytes(val)
+	n.buf = n.buf[:off]
+	n.count--
+	q.length--
+	if n.count == 0 {
+		q.unlink(n)
+	}
+	return val
+}
+
+// index returns a copy of the entry at index, which must be in [0, Len())
+func (q *quicklist) index(index int) []byte {
+	n, i := q.locate(index)
+	return copyBytes(n.entry(i))
+}
+
+// set replaces the entry at index, which must be in [0, Len())
+func (q *quicklist) set(index int, val []byte) {
+	n, i := q.locate(index)
+	entries := n.entries()
+	entries[i] = val
+	q.replaceAndMerge(n, entries)
+}
+
+// insert inserts val at index, which must be in [0, Len()]
+func (q *quicklist) insert(index int, val []byte) {
+	if index == q.length {
+		q.pushBack(val)
+		return
+	}
+	n, i := q.locate(index)
+	entries := n.entries()
+	entries = append(entries, nil)
+	copy(entries[i+1:], entries[i:])
+	entries[i] = val
+	q.replaceAndMerge(n, entries)
+}
+
+// each calls fn on the entries from index start to the tail until fn returns false.
+// The entry passed to fn is only valid during the call.
+func (q *quicklist) each(start int, fn func(i int, val []byte) bool) {
+	if start < 0 || start >= q.length {
+		return
+	}
+	n, j := q.locate(start)
+	for i := start; n != nil; n, j = n.next, 0 {
+		for _, val := range n.entries()[j:] {
+			if !fn(i, val) {
+				return
+			}
+			i++
+		}
+	}
+}
+
+// eachReverse calls fn on the entries from index start to the head until fn returns false.
+// The entry passed to fn is only valid during the call.
+func (q *quicklist) eachReverse(start int, fn func(i int, val []byte) bool) {
+	if start < 0 || start >= q.length {
+		return
+	}
+	n, j := q.locate(start)
+	for i := start; n != nil; n = n.prev {
+		entries := n.entries()
+		if j < 0 {
+			j = len(entries) - 1
+		}
+		for ; j >= 0; j-- {
+			if !fn(i, entries[j]) {
+				return
+			}
+			i--
+		}
+	}
+}
+
+// remove removes at most count entries matched by match, from the tail if reverse is true,
+// all of them if count is 0. Returns the number of removed entries.
+func (q *quicklist) remove(match func(val []byte) bool, count int, reverse bool) int {
+	removed := 0
+	n := q.head
+	if reverse {
+		n = q.tail
+	}
+	for n != nil && (count == 0 || removed < count) {
+		next := n.next
+		if reverse {
+			next = n.prev
+		}
+
+		entries := n.entries()
+		keep := make([]bool, len(entries))
+		changed := false
+		for k := range entries {
+			j := k
+			if reverse {
+				j = len(entries) - 1 - k
+			}
+			if (count == 0 || removed < count) && match(entries[j]) {
+				removed++
+				changed = true
+			} else {
+				keep[j] = true
+			}
+		}
+		if changed {
+			kept := entries[:0:0]
+			for j, val := range entries {
+				if keep[j] {
+					kept = append(kept, val)
+				}
+			}
+			q.replace(n, kept)
+		}
+		n = next
+	}
+	if removed > 0 {
+		q.compact()
+	}
+	return removed
+}
+
+// trim keeps the entries in [start, end] only, which must be a valid range
+func (q *quicklist) trim(start, end int) {
+	for q.head != nil && q.head.count <= start {
+		start -= q.head.count
+		end -= q.head.count
+		q.unlink(q.head)
+	}
+	if start > 0 {
+		q.replace(q.head, q.head.entries()[start:])
+		end -= start
+	}
+
+	for q.tail != nil && q.length-q.tail.count > end {
+		q.unlink(q.tail)
+	}
+	if drop := q.length - 1 - end; drop > 0 {
+		entries := q.tail.entries()
+		q.replace(q.tail, entries[:len(entries)-drop])
+	}
+	q.compact()
+}
+
+// locate returns the node holding the entry at index and its position in the node,
+// walking from the nearer end of the list
+func (q *quicklist) locate(index int) (*qnode, int) {
+	if index < q.length>>1 {
+		n := q.head
+		for index >= n.count {
+			index -= n.count
+			n = n.next
+		}
+		return n, index
+	}
+
+	n, rest := q.tail, q.length-1-index
+	for rest >= n.count {
+		rest -= n.count
+		n = n.prev
+	}
+	return n, n.count - 1 - rest
+}
+
+// replace repacks entries into new nodes in place of n, splitting them as needed.
+// The entries may refer to the buffer of n. Returns the first and the last new nodes, nil if entries is empty.
+func (q *quicklist) replace(n *qnode, entries [][]byte) (first, last *qnode) {
+	at := n.prev
+	q.unlink(n)
+
+	cur := &qnode{}
+	for _, val := range entries {
+		if cur.count > 0 && !cur.fits(entrySize(val)) {
+			q.link(at, cur)
+			if first == nil {
+				first = cur
+			}
+			at, cur = cur, &qnode{}
+		}
+		cur.buf = appendEntry(cur.buf, val)
+		cur.count++
+	}
+	if cur.count > 0 {
+		q.link(at, cur)
+		if first == nil {
+			first = cur
+		}
+		last = cur
+	}
+	return
+}
+
+// replaceAndMerge replaces n by entries and merges the new nodes with their neighbors if they fit,
+// so that repeated splits do not leave small nodes behind
+func (q *quicklist) replaceAndMerge(n *qnode, entries [][]byte) {
+	prev := n.prev
+	first, last := q.replace(n, entries)
+	if first == nil {
+		return
+	}
+	q.merge(last)
+	if prev != nil {
+		q.merge(prev)
+	}
+}
+
+// compact merges the adjacent nodes which fit in one node
+func (q *quicklist) compact() {
+	for n := q.head; n != nil && n.next != nil; {
+		if !q.merge(n) {
+			n = n.next
+		}
+	}
+}
+
+// merge merges the next node into n if they fit in one node
+func (q *quicklist) merge(n *qnode) bool {
+	next := n.next
+	if next == nil || n.count+next.count > maxNodeEntries || len(n.buf)+len(next.buf) > maxNodeSize {
+		return false
+	}
+
+	buf := make([]byte, 0, len(n.buf)+len(next.buf))
+	buf = append(append(buf, n.buf...), next.buf...)
+	count := n.count + next.count
+	q.unlink(next)
+	n.buf = buf
+	q.length += count - n.count
+	n.count = count
+	return true
+}
+
+// link inserts n after at, or at the head if at is nil
+func (q *quicklist) link(at, n *qnode) {
+	n.prev = at
+	if at == nil {
+		n.next = q.head
+		q.head = n
+	} else {
+		n.next = at.next
+		at.next = n
+	}
+	if n.next == nil {
+		q.tail = n
+	} else {
+		n.next.prev = n
+	}
+	q.length += n.count
+}
+
+func (q *quicklist) unlink(n *qnode) {
+	if n.prev == nil {
+		q.head = n.next
+	} else {
+		n.prev.next = n.next
+	}
+	if n.next == nil {
+		q.tail = n.prev
+	} else {
+		n.next.prev = n.prev
+	}
+	n.prev, n.next = nil, nil
+	q.length -= n.count
+}
+
+func (n *qnode) fits(size int) bool {
+	return n.count < maxNodeEntries && len(n.buf)+size <= maxNodeSize
+}
+
+// entries decodes the entries of the node, which refer to its buffer
+func (n *qnode) entries() [][]byte {
+	entries := make([][]byte, 0, n.count)
+	for off := 0; off < len(n.buf); {
+		val, size := decodeEntry(n.buf[off:])
+		entries = append(entries, val)
+		off += size
+	}
+	return entries
+}
+
+// entry decodes the i-th entry of the node, which refers to its buffer
+func (n *qnode) entry(i int) []byte {
+	off := 0
+	for ; i > 0; i-- {
+		_, size := decodeEntry(n.buf[off:])
+		off += size
+	}
+	val, _ := decodeEntry(n.buf[off:])
+	return val
+}
+
+func entrySize(val []byte) int {
+	size := 1
+	for x := uint64(len(val)); x >= 0x80; x >>= 7 {
+		size++
+	}
+	return size + len(val)
+}
+
+func appendEntry(buf, val []byte) []byte {
+	var l [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(l[:], uint64(len(val)))
+	buf = append(buf, l[:n]...)
+	return append(buf, val...)
+}
+
+// decodeEntry returns the first entry of buf and its encoded size
+func decodeEntry(buf []byte) ([]byte, int) {
+	l, n := binary.Uvarint(buf)
+	end := n + int(l)
+	return buf[n:end:end], end
+}
+
+func copyBytes(val []byte) []byte {
+	res := make([]byte, len(val))
+	copy(res, val)
+	return res
+}
@@ -0,0 +1,180 @@
+package list
+
+import (
+	"bytes"
+	"math/rand"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+// checkQuicklist checks the links and the counts of the nodes, and compares the entries with want
+func checkQuicklist(t *testing.T, q *quicklist, want [][]byte) {
+	t.Helper()
+
+	length := 0
+	var prev *qnode
+	for n := q.head; n != nil; prev, n = n, n.next {
+		if n.prev != prev {
+			t.Fatal("broken prev link")
+		}
+		if n.count == 0 || n.count != len(n.entries()) {
+			t.Fatalf("node count %d does not match its %d entries", n.count, len(n.entries()))
+		}
+		if n.count > 1 && (n.count > maxNodeEntries || len(n.buf) > maxNodeSize) {
+			t.Fatalf("node of %d entries and %d bytes is too large", n.count, len(n.buf))
+		}
+		length += n.count
+	}
+	if q.tail != prev {
+		t.Fatal("broken tail")
+	}
+	if length != q.Len() || length != len(want) {
+		t.Fatalf("expected %d entries, nodes hold %d, length is %d", len(want), length, q.Len())
+	}
+
+	var got [][]byte
+	q.each(0, func(i int, val []byte) bool {
+		got = append(got, copyBytes(val))
+		return true
+	})
+	for i := range want {
+		if !bytes.Equal(got[i], want[i]) {
+			t.Fatalf("entry %d: expected %q, got %q", i, want[i], got[i])
+		}
+	}
+}
+
+func TestQuicklist(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	q := newQuicklist()
+	var want [][]byte
+
+	value := func(i int) []byte {
+		if rnd.Intn(50) == 0 {
+			//larger than a node
+			return bytes.Repeat([]byte{byte(i)}, maxNodeSize+rnd.Intn(100))
+		}
+		return []byte("v" + strconv.Itoa(i%100))
+	}
+
+	for i := 0; i < 20000; i++ {
+		switch op := rnd.Intn(10); {
+		case op < 3:
+			v := value(i)
+			q.pushBack(v)
+			want = append(want, v)
+		case op < 5:
+			v := value(i)
+			q.pushFront(v)
+			want = append([][]byte{v}, want...)
+		case op == 5 && len(want) > 0:
+			if got := q.popFront(); !bytes.Equal(got, want[0]) {
+				t.Fatalf("popFront expected %q, got %q", want[0], got)
+			}
+			want = want[1:]
+		case op == 6 && len(want) > 0:
+			if got := q.popBack(); !bytes.Equal(got, want[len(want)-1]) {
+				t.Fatalf("popBack expected %q, got %q", want[len(want)-1], got)
+			}
+			want = want[:len(want)-1]
+		case op == 7:
+			v, idx := value(i), rnd.Intn(len(want)+1)
+			q.insert(idx, v)
+			want = append(want[:idx], append([][]byte{v}, want[idx:]...)...)
+		case op == 8 && len(want) > 0:
+			v, idx := value(i), rnd.Intn(len(want))
+			q.set(idx, v)
+			want[idx] = v
+			if got := q.index(idx); !bytes.Equal(got, v) {
+				t.Fatalf("index %d expected %q, got %q", idx, v, got)
+			}
+		case op == 9 && i%100 == 9:
+			target := []byte("v" + strconv.Itoa(rnd.Intn(100)))
+			match := func(val []byte) bool { return bytes.Equal(val, target) }
+			count, reverse := rnd.Intn(3), rnd.Intn(2) == 0
+
+			var kept [][]byte
+			removed := 0
+			for k := range want {
+				j := k
+				if reverse {
+					j = len(want) - 1 - k
+				}
+				if (count == 0 || removed < count) && match(want[j]) {
+					removed++
+					continue
+				}
+				kept = append(kept, want[j])
+			}
+			if reverse {
+				for a, b := 0, len(kept)-1; a < b; a, b = a+1, b-1 {
+					kept[a], kept[b] = kept[b], kept[a]
+				}
+			}
+			if got := q.remove(match, count, reverse); got != removed {
+				t.Fatalf("remove expected %d, got %d", removed, got)
+			}
+			want = kept
+		}
+		if i%500 == 0 {
+			checkQuicklist(t, q, want)
+		}
+	}
+	checkQuicklist(t, q, want)
+}
+
+func TestQuicklist_Trim(t *testing.T) {
+	for _, tt := range [][2]int{{0, 999}, {1, 998}, {130, 700}, {500, 500}, {0, 0}, {999, 999}, {127, 128}} {
+		q := newQuicklist()
+		var want [][]byte
+		for i := 0; i < 1000; i++ {
+			v := []byte(strconv.Itoa(i))
+			q.pushBack(v)
+			want = append(want, v)
+		}
+
+		q.trim(tt[0], tt[1])
+		checkQuicklist(t, q, want[tt[0]:tt[1]+1])
+	}
+}
+
+func TestQuicklist_Each(t *testing.T) {
+	q := newQuicklist()
+	for i := 0; i < 300; i++ {
+		q.pushBack([]byte(strconv.Itoa(i)))
+	}
+
+	var got []int
+	q.eachReverse(200, func(i int, val []byte) bool {
+		if strconv.Itoa(i) != string(val) {
+			t.Fatalf("entry %d is %s", i, val)
+		}
+		got = append(got, i)
+		return i > 60
+	})
+	if len(got) != 141 || got[0] != 200 || got[140] != 60 {
+		t.Errorf("unexpected reverse iteration from %d to %d", got[0], got[len(got)-1])
+	}
+
+	got = got[:0]
+	q.each(250, func(i int, val []byte) bool {
+		got = append(got, i)
+		return true
+	})
+	if !reflect.DeepEqual(got[:3], []int{250, 251, 252}) || len(got) != 50 {
+		t.Errorf("unexpected iteration %v", got)
+	}
+}
+
+func BenchmarkList_LIndex(b *testing.B) {
+	l := New()
+	for i := 0; i < 1000000; i++ {
+		l.RPush(key, []byte(strconv.Itoa(i)))
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		l.LIndex(key, i%1000000)
+	}
+}
@@ -0,0 +1,158 @@
+package listpack
+
+import (
+	"encoding/binary"
+)
+
+// Listpack 紧凑列表，将若干字节串依次编码在一个字节数组中，每个元素编码为 uvarint 长度 + 数据
+// 没有每个元素的指针和哈希表的开销，查找需要遍历，适合元素较少的集合
+// 修改时不会覆盖已有的字节，Get 返回的元素在列表修改后仍然有效
+// a compact list which packs byte strings into one byte slice, each one as its uvarint length followed by its data.
+// It has no per-entry pointers or hash table overhead but lookups are linear, so it suits small collections.
+// The modifications never overwrite existing bytes, so the entries returned by Get stay valid.
+type Listpack struct {
+	buf []byte
+	n   int
+}
+
+// Limits 集合使用紧凑编码的上限，超过任意一个时转换为完整的结构
+// the limits under which a collection uses the compact encoding, it is converted to the full structure once one is exceeded
+type Limits struct {
+	MaxEntries int // the max number of members or fields
+	MaxValue   int // the max length in bytes of a member, a field or a value
+}
+
+// DefaultLimits 默认的上限，与 redis 相同
+// the default limits, the same as redis
+var DefaultLimits = Limits{MaxEntries: 128, MaxValue: 64}
+
+// Fits 判断有 entries 个成员，且新的成员或值长度为 size 时是否仍可使用紧凑编码
+// returns whether a collection of entries members, with a new member or value of size bytes, can still be compact
+func (l Limits) Fits(entries, size int) bool {
+	return entries <= l.MaxEntries && size <= l.MaxValue
+}
+
+// Len returns the number of entries
+func (lp *Listpack) Len() int {
+	return lp.n
+}
+
+// Size returns the number of bytes of the packed entries
+func (lp *Listpack) Size() int {
+	return len(lp.buf)
+}
+
+// Get returns the entry at index i, which must be in [0, Len())
+func (lp *Listpack) Get(i int) []byte {
+	val, _ := decode(lp.buf[lp.offset(i):])
+	return val
+}
+
+// Find 返回从下标 start 开始、每隔 step 个元素中第一个等于 val 的元素下标，不存在时返回-1
+// returns the index of the first entry equal to val among the ones at start, start+step, ..., -1 if not found
+func (lp *Listpack) Find(val string, start, step int) int {
+	if start >= lp.n {
+		return -1
+	}
+	off := lp.offset(start)
+	for i := start; i < lp.n; i += step {
+		entry, _ := decode(lp.buf[off:])
+		if string(entry) == val {
+			return i
+		}
+		for j := 0; j < step && i+j < lp.n; j++ {
+			_, size := decode(lp.buf[off:])
+			off += size
+		}
+	}
+	return -1
+}
+
+// Append appends the entries at the end
+func (lp *Listpack) Append(vals ...[]byte) {
+	for _, val := range vals {
+		lp.buf = appendEntry(lp.buf, val)
+	}
+	lp.n += len(vals)
+}
+
+// Insert inserts the entries before index i, which must be in [0, Len()]
+func (lp *Listpack) Insert(i int, vals ...[]byte) {
+	off := lp.offset(i)
+	size := 0
+	for _, val := range vals {
+		size += entrySize(val)
+	}
+
+	buf := make([]byte, 0, len(lp.buf)+size)
+	buf = append(buf, lp.buf[:off]...)
+	for _, val := range vals {
+		buf = appendEntry(buf, val)
+	}
+	lp.buf = append(buf, lp.buf[off:]...)
+	lp.n += len(vals)
+}
+
+// Remove removes count entries from index i, which must be in the list
+func (lp *Listpack) Remove(i, count int) {
+	start := lp.offset(i)
+	end := start
+	for j := 0; j < count; j++ {
+		_, size := decode(lp.buf[end:])
+		end += size
+	}
+
+	buf := make([]byte, 0, len(lp.buf)-(end-start))
+	buf = append(buf, lp.buf[:start]...)
+	lp.buf = append(buf, lp.buf[end:]...)
+	lp.n -= count
+}
+
+// Replace replaces the entry at index i by val
+func (lp *Listpack) Replace(i int, val []byte) {
+	lp.Remove(i, 1)
+	lp.Insert(i, val)
+}
+
+// Iterate calls fn on the entries in order until fn returns false
+func (lp *Listpack) Iterate(fn func(i int, val []byte) bool) {
+	for i, off := 0, 0; i < lp.n; i++ {
+		val, size := decode(lp.buf[off:])
+		if !fn(i, val) {
+			return
+		}
+		off += size
+	}
+}
+
+// offset returns the offset of the entry at index i in buf
+func (lp *Listpack) offset(i int) int {
+	off := 0
+	for ; i > 0; i-- {
+		_, size := decode(lp.buf[off:])
+		off += size
+	}
+	return off
+}
+
+func entrySize(val []byte) int {
+	size := 1
+	for x := uint64(len(val)); x >= 0x80; x >>= 7 {
+		size++
+	}
+	return size + len(val)
+}
+
+func appendEntry(buf, val []byte) []byte {
+	var l [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(l[:], uint64(len(val)))
+	buf = append(buf, l[:n]...)
+	return append(buf, val...)
+}
+
+// decode returns the first entry of buf and its encoded size
+func decode(buf []byte) ([]byte, int) {
+	l, n := binary.Uvarint(buf)
+	end := n + int(l)
+	return buf[n:end:end], end
+}
@@ -0,0 +1,79 @@
+package listpack
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func entries(lp *Listpack) (res []string) {
+	lp.Iterate(func(i int, val []byte) bool {
+		res = append(res, string(val))
+		return true
+	})
+	return
+}
+
+func TestListpack(t *testing.T) {
+	var lp Listpack
+	lp.Append([]byte("a"), []byte("1"), []byte("b"), []byte("2"))
+	lp.Insert(0, []byte("z"), []byte("0"))
+	lp.Insert(6, []byte(strings.Repeat("x", 200)), []byte(""))
+
+	if lp.Len() != 8 {
+		t.Fatalf("expected 8 entries, got %d", lp.Len())
+	}
+	if got := string(lp.Get(2)); got != "a" {
+		t.Errorf("expected a, got %s", got)
+	}
+	if got := lp.Get(7); got == nil || len(got) != 0 {
+		t.Errorf("expected an empty entry, got %q", got)
+	}
+
+	if i := lp.Find("b", 0, 2); i != 4 {
+		t.Errorf("expected b at 4, got %d", i)
+	}
+	//values are not matched when searching the fields
+	if i := lp.Find("1", 0, 2); i != -1 {
+		t.Errorf("expected -1, got %d", i)
+	}
+	if i := lp.Find("1", 1, 2); i != 3 {
+		t.Errorf("expected 3, got %d", i)
+	}
+	if i := lp.Find("a", 8, 2); i != -1 {
+		t.Errorf("expected -1, got %d", i)
+	}
+
+	got := lp.Get(4)
+	lp.Replace(4, []byte("c"))
+	lp.Remove(0, 2)
+	if string(got) != "b" {
+		t.Errorf("the entry returned by Get is overwritten: %s", got)
+	}
+
+	want := []string{"a", "1", "c", "2", strings.Repeat("x", 200), ""}
+	if res := entries(&lp); strings.Join(res, ",") != strings.Join(want, ",") {
+		t.Errorf("expected %v, got %v", want, res)
+	}
+	if lp.Size() != 1+1+1+1+1+1+1+1+2+200+1 {
+		t.Errorf("unexpected size %d", lp.Size())
+	}
+}
+
+func TestListpack_Get(t *testing.T) {
+	var lp Listpack
+	lp.Append([]byte("ab"), []byte("cd"))
+
+	//appending to an entry does not overwrite the next one
+	val := append(lp.Get(0), 'x')
+	if !bytes.Equal(lp.Get(1), []byte("cd")) || string(val) != "abx" {
+		t.Errorf("unexpected entries %s %s", lp.Get(1), val)
+	}
+}
+
+func TestLimits_Fits(t *testing.T) {
+	l := Limits{MaxEntries: 2, MaxValue: 3}
+	if !l.Fits(2, 3) || l.Fits(3, 1) || l.Fits(1, 4) {
+		t.Error("unexpected Fits result")
+	}
+}
@@ -0,0 +1,130 @@
+package set
+
+import (
+	"github.com/KarlvenK/kDB/ds/listpack"
+	"math/rand"
+)
+
+// encodings of a set
+const (
+	EncodingListpack  = "listpack"
+	EncodingHashtable = "hashtable"
+)
+
+// members 一个集合的成员，成员较少且较短时使用紧凑编码，超过上限后转换为 map，不再转换回来
+// the members of a set, which are packed while they are few and short,
+// and converted to a map once the limits are exceeded, never back
+type members struct {
+	dict map[string]bool // nil while the members are packed
+	lp   listpack.Listpack
+}
+
+func (m *members) has(member string) bool {
+	if m.dict != nil {
+		return m.dict[member]
+	}
+	return m.lp.Find(member, 0, 1) >= 0
+}
+
+// add adds the member, returns whether it is new
+func (m *members) add(member []byte, limits listpack.Limits) bool {
+	if m.dict == nil {
+		if m.lp.Find(string(member), 0, 1) >= 0 {
+			return false
+		}
+		if limits.Fits(m.lp.Len()+1, len(member)) {
+			m.lp.Append(member)
+			return true
+		}
+		m.convert()
+	}
+
+	if m.dict[string(member)] {
+		return false
+	}
+	m.dict[string(member)] = true
+	return true
+}
+
+func (m *members) remove(member string) bool {
+	if m.dict != nil {
+		exist := m.dict[member]
+		delete(m.dict, member)
+		return exist
+	}
+	if i := m.lp.Find(member, 0, 1); i >= 0 {
+		m.lp.Remove(i, 1)
+		return true
+	}
+	return false
+}
+
+func (m *members) len() int {
+	if m.dict != nil {
+		return len(m.dict)
+	}
+	return m.lp.Len()
+}
+
+// each calls fn on the members until fn returns false
+func (m *members) each(fn func(member string) bool) {
+	if m.dict != nil {
+		for member := range m.dict {
+			if !fn(member) {
+				return
+			}
+		}
+		return
+	}
+	m.lp.Iterate(func(_ int, val []byte) bool {
+		return fn(string(val))
+	})
+}
+
+// sample returns at most count distinct members, at random as the iteration order of a map
+func (m *members) sample(count int) (res []string) {
+	if m.dict != nil {
+		m.each(func(member string) bool {
+			res = append(res, member)
+			return len(res) < count
+		})
+		return
+	}
+
+	m.each(func(member string) bool {
+		res = append(res, member)
+		return true
+	})
+	rand.Shuffle(len(res), func(i, j int) { res[i], res[j] = res[j], res[i] })
+	if count < len(res) {
+		res = res[:count]
+	}
+	return
+}
+
+// random returns a random member of the non-empty set
+func (m *members) random() string {
+	if m.dict != nil {
+		for member := range m.dict {
+			return member
+		}
+	}
+	return string(m.lp.Get(rand.Intn(m.lp.Len())))
+}
+
+func (m *members) encoding() string {
+	if m.dict != nil {
+		return EncodingHashtable
+	}
+	return EncodingListpack
+}
+
+// convert moves the packed members to a map
+func (m *members) convert() {
+	dict := make(map[string]bool, m.len()+1)
+	m.each(func(member string) bool {
+		dict[member] = true
+		return true
+	})
+	m.dict, m.lp = dict, listpack.Listpack{}
+}
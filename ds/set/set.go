@@ -1,25 +1,45 @@
 package set
 
+import (
+	"github.com/KarlvenK/kDB/ds/listpack"
+)
+
 type (
-	Record map[string]map[string]bool
+	Record map[string]*members
 
 	Set struct {
 		record Record
+		limits listpack.Limits // the limits of the compact encoding
 	}
 )
 
 func New() *Set {
-	return &Set{make(Record)}
+	return &Set{make(Record), listpack.DefaultLimits}
+}
+
+// SetLimits 设置集合使用紧凑编码的上限，只影响之后写入的集合
+// sets the limits of the compact encoding, which only affects the sets written afterwards
+func (s *Set) SetLimits(limits listpack.Limits) {
+	s.limits = limits
+}
+
+// Encoding 返回集合 key 的编码，listpack 或 hashtable，不存在时返回空字符串
+// returns the encoding of the set, listpack or hashtable, an empty string if it does not exist
+func (s *Set) Encoding(key string) string {
+	if !s.exist(key) {
+		return ""
+	}
+	return s.record[key].encoding()
 }
 
 func (s *Set) SAdd(key string, member []byte) int {
 	if !s.exist(key) {
-		s.record[key] = make(map[string]bool)
+		s.record[key] = &members{}
 	}
 
-	s.record[key][string(member)] = true
+	s.record[key].add(member, s.limits)
 
-	return len(s.record[key])
+	return s.record[key].len()
 }
 
 func (s *Set) SPop(key string, count int) (values [][]byte) {
@@ -27,14 +47,9 @@ func (s *Set) SPop(key string, count int) (values [][]byte) {
 		return
 	}
 
-	for k := range s.record[key] {
-		delete(s.record[key], k)
-		values = append(values, []byte(k))
-
-		count--
-		if count == 0 {
-			break
-		}
+	for _, member := range s.record[key].sample(count) {
+		s.record[key].remove(member)
+		values = append(values, []byte(member))
 	}
 
 	return
@@ -45,7 +60,7 @@ func (s *Set) SIsMember(key string, member []byte) bool {
 		return false
 	}
 
-	return s.record[key][string(member)]
+	return s.record[key].has(string(member))
 }
 
 //SRandMember get rand count members in set[key]
@@ -56,19 +71,16 @@ func (s *Set) SRandMember(key string, count int) [][]byte {
 	}
 
 	if count > 0 {
-		for k := range s.record[key] {
-			values = append(values, []byte(k))
-			if len(values) == count {
-				break
-			}
+		for _, member := range s.record[key].sample(count) {
+			values = append(values, []byte(member))
 		}
 	} else {
 		count = -count
 		randomVal := func() []byte {
-			for k := range s.record[key] {
-				return []byte(k)
+			if s.record[key].len() == 0 {
+				return nil
 			}
-			return nil
+			return []byte(s.record[key].random())
 		}
 
 		for count > 0 {
@@ -86,11 +98,7 @@ func (s *Set) SRem(key string, member []byte) bool {
 		return false
 	}
 
-	if ok := s.record[key][string(member)]; ok {
-		delete(s.record[key], string(member))
-	}
-
-	return false
+	return s.record[key].remove(string(member))
 }
 
 // SMove move member from src to dst
@@ -100,11 +108,11 @@ func (s *Set) SMove(src, dst string, member []byte) bool {
 	}
 
 	if !s.exist(dst) {
-		s.record[dst] = make(map[string]bool)
+		s.record[dst] = &members{}
 	}
 
-	delete(s.record[src], string(member))
-	s.record[dst][string(member)] = true
+	s.record[src].remove(string(member))
+	s.record[dst].add(member, s.limits)
 
 	return true
 }
@@ -114,7 +122,7 @@ func (s *Set) SCard(key string) int {
 	if !s.exist(key) {
 		return 0
 	}
-	return len(s.record[key])
+	return s.record[key].len()
 }
 
 // SMembers all members in key
@@ -123,9 +131,10 @@ func (s *Set) SMembers(key string) (val [][]byte) {
 		return
 	}
 
-	for k := range s.record[key] {
-		val = append(val, []byte(k))
-	}
+	s.record[key].each(func(member string) bool {
+		val = append(val, []byte(member))
+		return true
+	})
 
 	return
 }
@@ -136,9 +145,10 @@ func (s *Set) SUnion(keys ...string) (values [][]byte) {
 	//下面for循环可以去重
 	for _, k := range keys {
 		if s.exist(k) {
-			for v := range s.record[k] {
-				m[v] = true
-			}
+			s.record[k].each(func(member string) bool {
+				m[member] = true
+				return true
+			})
 		}
 	}
 
@@ -151,15 +161,15 @@ func (s *Set) SUnion(keys ...string) (values [][]byte) {
 
 //SDiff diff two or more keys
 func (s *Set) SDiff(keys ...string) (values [][]byte) {
-	if len(keys) < 2 || !s.exist(keys[0]) {
+	if len(keys) == 0 || !s.exist(keys[0]) {
 		return
 	}
 
-	for v := range s.record[keys[0]] {
+	s.record[keys[0]].each(func(v string) bool {
 		flag := true
 
 		for i := 1; i < len(keys); i++ {
-			if s.SIsMember(keys[i], []byte(v)) {
+			if s.exist(keys[i]) && s.record[keys[i]].has(v) {
 				flag = false
 				break
 			}
@@ -167,7 +177,68 @@ func (s *Set) SDiff(keys ...string) (values [][]byte) {
 		if flag {
 			values = append(values, []byte(v))
 		}
+		return true
+	})
+	return
+}
+
+//SInter inter two or more keys
+func (s *Set) SInter(keys ...string) (values [][]byte) {
+	return s.inter(0, keys...)
+}
+
+// SInterCard 返回交集的元素个数，limit 大于0时最多计数到limit
+// returns the cardinality of the intersection, counting stops at limit if it is positive
+func (s *Set) SInterCard(limit int, keys ...string) int {
+	return len(s.inter(limit, keys...))
+}
+
+// SMIsMember 判断多个 member 是否为集合 key 的成员
+// returns whether each member is a member of the set
+func (s *Set) SMIsMember(key string, members ...[]byte) []bool {
+	res := make([]bool, len(members))
+	for i, m := range members {
+		res[i] = s.SIsMember(key, m)
+	}
+	return res
+}
+
+// SClear 删除集合 key
+// deletes the set, returns whether it existed
+func (s *Set) SClear(key string) bool {
+	if !s.exist(key) {
+		return false
+	}
+	delete(s.record, key)
+	return true
+}
+
+// inter 遍历最小的集合，检查其成员是否在其余所有集合中，limit 大于0时找到limit个成员即返回
+// iterates the smallest set and checks its members in all other sets, returns when limit members are found if it is positive
+func (s *Set) inter(limit int, keys ...string) (values [][]byte) {
+	if len(keys) == 0 {
+		return
+	}
+
+	smallest := keys[0]
+	for _, k := range keys {
+		if !s.exist(k) {
+			return
+		}
+		if s.record[k].len() < s.record[smallest].len() {
+			smallest = k
+		}
 	}
+
+	s.record[smallest].each(func(v string) bool {
+		for _, k := range keys {
+			if k != smallest && !s.record[k].has(v) {
+				return true
+			}
+		}
+		values = append(values, []byte(v))
+		return len(values) != limit
+	})
 	return
 }
 
@@ -2,6 +2,8 @@ package set
 
 import (
 	"fmt"
+	"github.com/KarlvenK/kDB/ds/listpack"
+	"sort"
 	"testing"
 )
 
@@ -21,10 +23,10 @@ func InitSet() *Set {
 }
 
 func PrintSetData(s *Set) {
-	for k, v := range s.record {
+	for k := range s.record {
 		fmt.Printf("%9s -> ", k)
-		for val := range v {
-			fmt.Print(val, " ")
+		for _, val := range s.SMembers(k) {
+			fmt.Print(string(val), " ")
 		}
 		fmt.Println()
 	}
@@ -91,6 +93,11 @@ func TestSet_SRandMember(t *testing.T) {
 func TestSet_SRem(t *testing.T) {
 	set := InitSet()
 
+	//SRem reports whether the member is removed
+	if !set.SRem(key, []byte("b")) || set.SRem(key, []byte("b")) || set.SRem("not exist", []byte("b")) {
+		t.Error("unexpected result of SRem")
+	}
+
 	n := set.SRem(key, []byte("a"))
 	n = set.SRem(key, []byte("a"))
 	n = set.SRem(key, []byte("c"))
@@ -163,3 +170,89 @@ func TestSet_SDiff(t *testing.T) {
 		t.Log(string(m))
 	}
 }
+
+func TestSet_SInter(t *testing.T) {
+	set := InitSet()
+	set.SAdd("set2", []byte("a"))
+	set.SAdd("set2", []byte("f"))
+	set.SAdd("set2", []byte("g"))
+
+	members := set.SInter(key, "set2")
+	if len(members) != 2 {
+		t.Fatalf("expected 2 members, got %d", len(members))
+	}
+	for _, m := range members {
+		if !set.SIsMember(key, m) || !set.SIsMember("set2", m) {
+			t.Errorf("%s is not in both sets", m)
+		}
+	}
+
+	if members := set.SInter(key, "not_exist"); len(members) != 0 {
+		t.Error("the intersection with a set not exist should be empty")
+	}
+	if n := set.SInterCard(0, key, "set2"); n != 2 {
+		t.Errorf("expected card 2, got %d", n)
+	}
+	if n := set.SInterCard(1, key, "set2"); n != 1 {
+		t.Errorf("expected card 1 with limit, got %d", n)
+	}
+}
+
+func TestSet_SMIsMember(t *testing.T) {
+	set := InitSet()
+
+	res := set.SMIsMember(key, []byte("a"), []byte("z"), []byte("f"))
+	if len(res) != 3 || !res[0] || res[1] || !res[2] {
+		t.Errorf("unexpected result %v", res)
+	}
+}
+
+func TestSet_SClear(t *testing.T) {
+	set := InitSet()
+
+	if !set.SClear(key) || set.SCard(key) != 0 {
+		t.Error("the set should be deleted")
+	}
+	if set.SClear(key) {
+		t.Error("the set not exist can not be deleted")
+	}
+}
+
+func TestSet_Encoding(t *testing.T) {
+	set := New()
+	set.SetLimits(listpack.Limits{MaxEntries: 3, MaxValue: 5})
+
+	set.SAdd(key, []byte("a"))
+	set.SAdd(key, []byte("b"))
+	set.SAdd(key, []byte("b"))
+	set.SAdd(key, []byte("c"))
+	if set.Encoding(key) != EncodingListpack || set.SCard(key) != 3 {
+		t.Errorf("expected 3 packed members, got %d %s", set.SCard(key), set.Encoding(key))
+	}
+	if !set.SRem(key, []byte("a")) || set.SRem(key, []byte("a")) || set.SIsMember(key, []byte("a")) {
+		t.Error("unexpected SRem of the packed set")
+	}
+	if vals := set.SPop(key, 1); len(vals) != 1 || set.SCard(key) != 1 {
+		t.Errorf("unexpected SPop of the packed set %s", vals)
+	}
+
+	set.SAdd(key, []byte("long member"))
+	if set.Encoding(key) != EncodingHashtable || set.SCard(key) != 2 {
+		t.Errorf("expected hashtable for a long member, got %s", set.Encoding(key))
+	}
+
+	set.SAdd("other", []byte("b"))
+	set.SAdd("other", []byte("c"))
+	set.SAdd("other", []byte("long member"))
+	var members []string
+	for _, m := range set.SInter(key, "other") {
+		members = append(members, string(m))
+	}
+	sort.Strings(members)
+	if len(members) != 2 || members[1] != "long member" {
+		t.Errorf("unexpected intersection %v", members)
+	}
+	if set.Encoding("missing") != "" {
+		t.Error("expected no encoding for a missing key")
+	}
+}
@@ -0,0 +1,156 @@
+package sketch
+
+import "math"
+
+// CountMin Count-Min Sketch，depth行width列的计数器，元素的估计值为各行对应计数器的最小值
+// 估计值不会小于真实值，以probability的概率误差不超过 errorRate * 总数
+// depth rows of width counters, the estimated count of an item is the minimum of its counters in all rows.
+// The estimation is never less than the real count, and the error is within errorRate * total with probability.
+type CountMin struct {
+	width    uint64
+	depth    uint64
+	total    uint64
+	counters []uint64
+}
+
+// CMSInitByDim 以给定的宽度和深度创建Count-Min Sketch
+// creates a count-min sketch with the width and depth
+func (s *Sketches) CMSInitByDim(key string, width, depth uint64) error {
+	if width == 0 || depth == 0 {
+		return ErrInvalidParams
+	}
+	if s.Exists(key) {
+		return ErrSketchExists
+	}
+
+	s.record[key] = &CountMin{width: width, depth: depth, counters: make([]uint64, width*depth)}
+	return nil
+}
+
+// CMSDimByProb 根据误差和概率计算宽度和深度
+// width = ceil(2 / errorRate), depth = ceil(log(probability) / log(0.5)),
+// probability is the desired probability of the estimation exceeding the error, e.g. 0.001
+func CMSDimByProb(errorRate, probability float64) (uint64, uint64, error) {
+	if errorRate <= 0 || errorRate >= 1 || probability <= 0 || probability >= 1 {
+		return 0, 0, ErrInvalidParams
+	}
+	width := uint64(math.Ceil(2 / errorRate))
+	depth := uint64(math.Ceil(math.Log(probability) / math.Log(0.5)))
+	return width, depth, nil
+}
+
+// CMSIncrBy 将元素的计数加上increment，返回新的估计值
+// increments the count of the item, returns the new estimation
+func (s *Sketches) CMSIncrBy(key string, item []byte, increment uint64) (uint64, error) {
+	c, err := s.cms(key)
+	if err != nil {
+		return 0, err
+	}
+
+	h1, h2 := hash(item)
+	min := uint64(math.MaxUint64)
+	for i := uint64(0); i < c.depth; i++ {
+		pos := i*c.width + (h1+i*h2)%c.width
+		c.counters[pos] = saturatingAdd(c.counters[pos], increment)
+		if c.counters[pos] < min {
+			min = c.counters[pos]
+		}
+	}
+	c.total = saturatingAdd(c.total, increment)
+	return min, nil
+}
+
+// CMSQuery 返回元素计数的估计值
+// returns the estimated count of the item
+func (s *Sketches) CMSQuery(key string, item []byte) (uint64, error) {
+	c, err := s.cms(key)
+	if err != nil {
+		return 0, err
+	}
+	return c.query(item), nil
+}
+
+// CMSMerge 将sources按权重合并到dest，dest原来的计数被覆盖，所有sketch的宽度和深度必须相同
+// merges the sources with weights into dest, overwriting the counts of dest.
+// All sketches must have the same width and depth.
+func (s *Sketches) CMSMerge(dest string, sources []string, weights []uint64) error {
+	d, err := s.cms(dest)
+	if err != nil {
+		return err
+	}
+	if len(sources) == 0 || (weights != nil && len(weights) != len(sources)) {
+		return ErrInvalidParams
+	}
+
+	srcs := make([]*CountMin, len(sources))
+	for i, key := range sources {
+		if srcs[i], err = s.cms(key); err != nil {
+			return err
+		}
+		if srcs[i].width != d.width || srcs[i].depth != d.depth {
+			return ErrDimensionMismatch
+		}
+	}
+
+	counters := make([]uint64, len(d.counters))
+	var total uint64
+	for i, src := range srcs {
+		w := uint64(1)
+		if weights != nil {
+			w = weights[i]
+		}
+		for j, v := range src.counters {
+			counters[j] = saturatingAdd(counters[j], saturatingMul(v, w))
+		}
+		total = saturatingAdd(total, saturatingMul(src.total, w))
+	}
+	d.counters, d.total = counters, total
+	return nil
+}
+
+// CMSInfo 返回宽度、深度和所有计数的总和
+// returns the width, the depth and the total count
+func (s *Sketches) CMSInfo(key string) (width, depth, total uint64, err error) {
+	c, err := s.cms(key)
+	if err != nil {
+		return
+	}
+	return c.width, c.depth, c.total, nil
+}
+
+func (s *Sketches) cms(key string) (*CountMin, error) {
+	sk, exist := s.record[key]
+	if !exist {
+		return nil, ErrSketchNotExist
+	}
+	c, ok := sk.(*CountMin)
+	if !ok {
+		return nil, ErrWrongType
+	}
+	return c, nil
+}
+
+func (c *CountMin) query(item []byte) uint64 {
+	h1, h2 := hash(item)
+	min := uint64(math.MaxUint64)
+	for i := uint64(0); i < c.depth; i++ {
+		if v := c.counters[i*c.width+(h1+i*h2)%c.width]; v < min {
+			min = v
+		}
+	}
+	return min
+}
+
+func saturatingAdd(a, b uint64) uint64 {
+	if a+b < a {
+		return math.MaxUint64
+	}
+	return a + b
+}
+
+func saturatingMul(a, b uint64) uint64 {
+	if a != 0 && b > math.MaxUint64/a {
+		return math.MaxUint64
+	}
+	return a * b
+}
@@ -0,0 +1,139 @@
+package sketch
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+// kinds of a dumped sketch
+const (
+	kindCountMin byte = iota + 1
+	kindTopK
+)
+
+func (c *CountMin) encode(w *writer) {
+	w.buf = append(w.buf, kindCountMin)
+	w.uvarint(c.width)
+	w.uvarint(c.depth)
+	w.uvarint(c.total)
+	for _, v := range c.counters {
+		w.uvarint(v)
+	}
+}
+
+func (t *TopK) encode(w *writer) {
+	w.buf = append(w.buf, kindTopK)
+	w.uvarint(t.k)
+	w.uvarint(t.width)
+	w.uvarint(t.depth)
+	w.uvarint(math.Float64bits(t.decay))
+	w.uvarint(t.rand)
+	for _, b := range t.buckets {
+		w.uvarint(uint64(b.fp))
+		w.uvarint(b.count)
+	}
+	w.uvarint(uint64(len(t.heap)))
+	for _, it := range t.heap {
+		w.bytes(it.Item)
+		w.uvarint(it.Count)
+	}
+}
+
+// decode the sketch encoded by encode
+func decode(data []byte) (sketch, error) {
+	if len(data) == 0 {
+		return nil, ErrInvalidData
+	}
+	r := reader{buf: data[1:]}
+
+	switch data[0] {
+	case kindCountMin:
+		c := &CountMin{width: r.uvarint(), depth: r.uvarint(), total: r.uvarint()}
+		if r.err != nil || c.width == 0 || c.depth == 0 || c.width*c.depth > uint64(len(r.buf)) {
+			return nil, ErrInvalidData
+		}
+		c.counters = make([]uint64, c.width*c.depth)
+		for i := range c.counters {
+			c.counters[i] = r.uvarint()
+		}
+		if r.err != nil {
+			return nil, ErrInvalidData
+		}
+		return c, nil
+	case kindTopK:
+		t := &TopK{k: r.uvarint(), width: r.uvarint(), depth: r.uvarint()}
+		t.decay = math.Float64frombits(r.uvarint())
+		t.rand = r.uvarint()
+		if r.err != nil || t.k == 0 || t.width == 0 || t.depth == 0 || 2*t.width*t.depth > uint64(len(r.buf)) {
+			return nil, ErrInvalidData
+		}
+		t.buckets = make([]bucket, t.width*t.depth)
+		for i := range t.buckets {
+			t.buckets[i] = bucket{fp: uint32(r.uvarint()), count: r.uvarint()}
+		}
+		n := r.uvarint()
+		if n > t.k {
+			return nil, ErrInvalidData
+		}
+		for i := uint64(0); i < n && r.err == nil; i++ {
+			t.heap = append(t.heap, Item{Item: r.bytes(), Count: r.uvarint()})
+		}
+		if r.err != nil {
+			return nil, ErrInvalidData
+		}
+		return t, nil
+	}
+	return nil, ErrInvalidData
+}
+
+type writer struct {
+	buf []byte
+}
+
+func (w *writer) uvarint(v uint64) {
+	var b [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(b[:], v)
+	w.buf = append(w.buf, b[:n]...)
+}
+
+func (w *writer) bytes(b []byte) {
+	w.uvarint(uint64(len(b)))
+	w.buf = append(w.buf, b...)
+}
+
+// reader 读取writer写入的数据，出错后后续读取均返回零值
+// reads the data written by writer, the reads after an error return zero values
+type reader struct {
+	buf []byte
+	err error
+}
+
+func (r *reader) uvarint() uint64 {
+	if r.err != nil {
+		return 0
+	}
+
+	v, n := binary.Uvarint(r.buf)
+	if n <= 0 {
+		r.err = ErrInvalidData
+		return 0
+	}
+	r.buf = r.buf[n:]
+	return v
+}
+
+func (r *reader) bytes() []byte {
+	n := r.uvarint()
+	if r.err != nil {
+		return nil
+	}
+	if uint64(len(r.buf)) < n {
+		r.err = ErrInvalidData
+		return nil
+	}
+
+	b := make([]byte, n)
+	copy(b, r.buf)
+	r.buf = r.buf[n:]
+	return b
+}
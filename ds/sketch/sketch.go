@@ -0,0 +1,123 @@
+package sketch
+
+import (
+	"errors"
+	"hash/fnv"
+)
+
+// 频率估计：Count-Min Sketch 估计元素出现的次数，Top-K 基于 HeavyKeeper 找出出现次数最多的k个元素
+// 两者都只保存计数器和少量元素，占用的空间与元素个数无关
+// Frequency estimation: Count-Min Sketch estimates the counts of items, and Top-K based on HeavyKeeper
+// finds the k most frequent items. Both keep counters and a few items, the space does not grow with the items.
+
+var (
+	// ErrInvalidParams the dimensions or other parameters are invalid
+	ErrInvalidParams = errors.New("ds/sketch: invalid sketch parameters")
+
+	// ErrSketchExists the key already holds a sketch
+	ErrSketchExists = errors.New("ds/sketch: sketch already exists")
+
+	// ErrSketchNotExist the key does not hold a sketch
+	ErrSketchNotExist = errors.New("ds/sketch: sketch does not exist")
+
+	// ErrWrongType the key holds a sketch of the other kind
+	ErrWrongType = errors.New("ds/sketch: key holds a sketch of the other kind")
+
+	// ErrDimensionMismatch the sketches to merge have different dimensions
+	ErrDimensionMismatch = errors.New("ds/sketch: sketches have different dimensions")
+
+	// ErrInvalidData the dumped sketch is invalid
+	ErrInvalidData = errors.New("ds/sketch: invalid sketch data")
+)
+
+type (
+	Record map[string]sketch
+
+	// Sketches count-min sketches and top-k struct
+	Sketches struct {
+		record Record
+	}
+
+	sketch interface {
+		encode(w *writer)
+	}
+)
+
+// New new sketches
+func New() *Sketches {
+	return &Sketches{make(Record)}
+}
+
+// Exists whether the key holds a sketch
+func (s *Sketches) Exists(key string) bool {
+	_, exist := s.record[key]
+	return exist
+}
+
+// IsCountMin whether the key holds a count-min sketch
+func (s *Sketches) IsCountMin(key string) bool {
+	_, ok := s.record[key].(*CountMin)
+	return ok
+}
+
+// IsTopK whether the key holds a top-k
+func (s *Sketches) IsTopK(key string) bool {
+	_, ok := s.record[key].(*TopK)
+	return ok
+}
+
+// Dump returns the encoded sketch of key, nil if not exists
+func (s *Sketches) Dump(key string) []byte {
+	sk, exist := s.record[key]
+	if !exist {
+		return nil
+	}
+
+	var w writer
+	sk.encode(&w)
+	return w.buf
+}
+
+// Restore 用Dump的结果替换key的sketch
+// replaces the sketch of key with the dumped one
+func (s *Sketches) Restore(key string, data []byte) error {
+	sk, err := decode(data)
+	if err != nil {
+		return err
+	}
+	s.record[key] = sk
+	return nil
+}
+
+// Keys returns all keys
+func (s *Sketches) Keys() (keys []string) {
+	for k := range s.record {
+		keys = append(keys, k)
+	}
+	return
+}
+
+// hash 返回元素的两个64位哈希值，第i行的位置为 h1 + i*h2
+// returns two 64 bits hashes of the item, the position in row i is h1 + i*h2
+func hash(item []byte) (uint64, uint64) {
+	h := fnv.New128a()
+	_, _ = h.Write(item)
+	sum := h.Sum(nil)
+
+	var h1, h2 uint64
+	for i := 0; i < 8; i++ {
+		h1 = h1<<8 | uint64(sum[i])
+		h2 = h2<<8 | uint64(sum[i+8])
+	}
+	return fmix64(h1), fmix64(h2) | 1
+}
+
+// fmix64 the finalizer of murmur3, fnv does not spread the last bytes of the item to all bits
+func fmix64(h uint64) uint64 {
+	h ^= h >> 33
+	h *= 0xff51afd7ed558ccd
+	h ^= h >> 33
+	h *= 0xc4ceb9fe1a85ec53
+	h ^= h >> 33
+	return h
+}
@@ -0,0 +1,167 @@
+package sketch
+
+import (
+	"math/rand"
+	"strconv"
+	"testing"
+)
+
+func TestSketches_CMSIncrBy(t *testing.T) {
+	s := New()
+	width, depth, err := CMSDimByProb(0.001, 0.01)
+	if err != nil || width != 2000 || depth != 7 {
+		t.Fatalf("dim by prob got %d, %d, %v", width, depth, err)
+	}
+	if err := s.CMSInitByDim("cms", width, depth); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.CMSInitByDim("cms", width, depth); err != ErrSketchExists {
+		t.Error("expected ErrSketchExists, got ", err)
+	}
+
+	//the estimation is never less than the real count, and close to it
+	counts := make(map[string]uint64)
+	r := rand.New(rand.NewSource(1))
+	var total uint64
+	for i := 0; i < 100000; i++ {
+		item := "item" + strconv.Itoa(int(r.ExpFloat64()*100))
+		counts[item]++
+		total++
+		if _, err := s.CMSIncrBy("cms", []byte(item), 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for item, count := range counts {
+		est, _ := s.CMSQuery("cms", []byte(item))
+		if est < count || est > count+uint64(0.001*float64(total))*2 {
+			t.Errorf("%s: real %d, estimated %d", item, count, est)
+		}
+	}
+	if _, _, n, _ := s.CMSInfo("cms"); n != total {
+		t.Errorf("total got %d", n)
+	}
+
+	if _, err := s.CMSIncrBy("missing", []byte("a"), 1); err != ErrSketchNotExist {
+		t.Error("expected ErrSketchNotExist, got ", err)
+	}
+}
+
+func TestSketches_CMSMerge(t *testing.T) {
+	s := New()
+	for _, key := range []string{"a", "b", "dest"} {
+		_ = s.CMSInitByDim(key, 100, 5)
+	}
+	_ = s.CMSInitByDim("small", 10, 5)
+	_, _ = s.CMSIncrBy("a", []byte("x"), 3)
+	_, _ = s.CMSIncrBy("b", []byte("x"), 4)
+	_, _ = s.CMSIncrBy("dest", []byte("y"), 5)
+
+	if err := s.CMSMerge("dest", []string{"a", "b"}, []uint64{1, 2}); err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := s.CMSQuery("dest", []byte("x")); n != 11 {
+		t.Errorf("query merged got %d", n)
+	}
+	if n, _ := s.CMSQuery("dest", []byte("y")); n != 0 {
+		t.Errorf("the counts of dest are not overwritten, got %d", n)
+	}
+	if err := s.CMSMerge("dest", []string{"a", "small"}, nil); err != ErrDimensionMismatch {
+		t.Error("expected ErrDimensionMismatch, got ", err)
+	}
+	if err := s.CMSMerge("dest", []string{"a"}, []uint64{1, 2}); err != ErrInvalidParams {
+		t.Error("expected ErrInvalidParams, got ", err)
+	}
+}
+
+func TestSketches_TopK(t *testing.T) {
+	s := New()
+	if err := s.TopKReserve("topk", 5, 100, 5, DefaultTopKDecay); err != nil {
+		t.Fatal(err)
+	}
+
+	//item i appears about 1000/i times
+	r := rand.New(rand.NewSource(1))
+	var items []string
+	for i := 1; i <= 200; i++ {
+		for j := 0; j < 1000/i; j++ {
+			items = append(items, "item"+strconv.Itoa(i))
+		}
+	}
+	r.Shuffle(len(items), func(i, j int) { items[i], items[j] = items[j], items[i] })
+	for _, item := range items {
+		if _, err := s.TopKIncrBy("topk", []byte(item), 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	list, _ := s.TopKList("topk")
+	if len(list) != 5 {
+		t.Fatalf("list got %d items", len(list))
+	}
+	for i, it := range list {
+		if want := "item" + strconv.Itoa(i+1); string(it.Item) != want {
+			t.Errorf("list[%d] got %s, want %s", i, it.Item, want)
+		}
+	}
+	if ok, _ := s.TopKQuery("topk", []byte("item1")); !ok {
+		t.Error("expected item1 in the top-k")
+	}
+	if ok, _ := s.TopKQuery("topk", []byte("item100")); ok {
+		t.Error("expected item100 not in the top-k")
+	}
+	if n, _ := s.TopKCount("topk", []byte("item1")); n < 900 || n > 1000 {
+		t.Errorf("count of item1 got %d", n)
+	}
+
+	if _, err := s.CMSQuery("topk", []byte("a")); err != ErrWrongType {
+		t.Error("expected ErrWrongType, got ", err)
+	}
+}
+
+func TestSketches_TopKExpelled(t *testing.T) {
+	s := New()
+	_ = s.TopKReserve("topk", 1, 8, 7, DefaultTopKDecay)
+
+	if expelled, _ := s.TopKIncrBy("topk", []byte("a"), 1); expelled != nil {
+		t.Errorf("expelled %s", expelled)
+	}
+	if expelled, _ := s.TopKIncrBy("topk", []byte("b"), 10); string(expelled) != "a" {
+		t.Errorf("expected a to be expelled, got %s", expelled)
+	}
+}
+
+func TestSketches_DumpRestore(t *testing.T) {
+	s := New()
+	_ = s.CMSInitByDim("cms", 50, 4)
+	_ = s.TopKReserve("topk", 3, 10, 4, DefaultTopKDecay)
+	for i := 0; i < 1000; i++ {
+		item := []byte("item" + strconv.Itoa(i%37))
+		_, _ = s.CMSIncrBy("cms", item, 2)
+		_, _ = s.TopKIncrBy("topk", item, 1)
+	}
+
+	c := New()
+	for _, key := range []string{"cms", "topk"} {
+		if err := c.Restore(key, s.Dump(key)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	//the restored top-k makes the same random decisions
+	for i := 0; i < 1000; i++ {
+		item := []byte("other" + strconv.Itoa(i%53))
+		_, _ = s.TopKIncrBy("topk", item, 1)
+		_, _ = c.TopKIncrBy("topk", item, 1)
+	}
+	for _, key := range []string{"cms", "topk"} {
+		if string(c.Dump(key)) != string(s.Dump(key)) {
+			t.Errorf("%s diverges after restore", key)
+		}
+	}
+
+	for _, data := range [][]byte{nil, {9}, s.Dump("cms")[:10]} {
+		if err := c.Restore("bad", data); err != ErrInvalidData {
+			t.Errorf("restore %v, err = %v", data, err)
+		}
+	}
+}
@@ -0,0 +1,217 @@
+package sketch
+
+import (
+	"bytes"
+	"math"
+	"sort"
+)
+
+type (
+	// TopK 基于 HeavyKeeper 的Top-K，depth行width列的桶保存指纹和计数，计数最大的k个元素保存在最小堆中
+	// 指纹不同的元素以 decay^count 的概率使桶的计数减一，减到0时占据这个桶
+	// 概率使用保存在sketch中的伪随机数生成器，所以重放日志可以得到相同的sketch
+	// Top-K based on HeavyKeeper, depth rows of width buckets keep fingerprints and counts,
+	// and the k items with the greatest counts are kept in a min heap.
+	// An item with a different fingerprint decrements the count of a bucket with the probability decay^count,
+	// and takes over the bucket when the count reaches 0.
+	// The probabilities use the pseudo random generator kept in the sketch, so that replaying the log gets the same sketch.
+	TopK struct {
+		k       uint64
+		width   uint64
+		depth   uint64
+		decay   float64
+		rand    uint64 // the state of the xorshift generator
+		buckets []bucket
+		heap    []Item
+	}
+
+	bucket struct {
+		fp    uint32
+		count uint64
+	}
+
+	// Item an item of Top-K and its count
+	Item struct {
+		Item  []byte
+		Count uint64
+	}
+)
+
+// default parameters of Top-K
+const (
+	DefaultTopKWidth = 8
+	DefaultTopKDepth = 7
+	DefaultTopKDecay = 0.9
+)
+
+// TopKReserve 创建一个保存k个元素的Top-K
+// creates a Top-K keeping k items
+func (s *Sketches) TopKReserve(key string, k, width, depth uint64, decay float64) error {
+	if k == 0 || width == 0 || depth == 0 || decay <= 0 || decay > 1 {
+		return ErrInvalidParams
+	}
+	if s.Exists(key) {
+		return ErrSketchExists
+	}
+
+	s.record[key] = &TopK{
+		k:       k,
+		width:   width,
+		depth:   depth,
+		decay:   decay,
+		rand:    0x9e3779b97f4a7c15,
+		buckets: make([]bucket, width*depth),
+	}
+	return nil
+}
+
+// TopKIncrBy 将元素的计数加上increment，返回被挤出Top-K的元素，没有时返回nil
+// increments the count of the item, returns the item expelled from the Top-K, nil if nothing is expelled
+func (s *Sketches) TopKIncrBy(key string, item []byte, increment uint64) ([]byte, error) {
+	t, err := s.topK(key)
+	if err != nil {
+		return nil, err
+	}
+	if increment == 0 {
+		return nil, nil
+	}
+	return t.incrBy(item, increment), nil
+}
+
+// TopKQuery 判断元素是否在Top-K中
+// whether the item is in the Top-K
+func (s *Sketches) TopKQuery(key string, item []byte) (bool, error) {
+	t, err := s.topK(key)
+	if err != nil {
+		return false, err
+	}
+	return t.find(item) >= 0, nil
+}
+
+// TopKCount 返回元素计数的估计值
+// returns the estimated count of the item
+func (s *Sketches) TopKCount(key string, item []byte) (uint64, error) {
+	t, err := s.topK(key)
+	if err != nil {
+		return 0, err
+	}
+
+	fp, h1, h2 := t.position(item)
+	var max uint64
+	for i := uint64(0); i < t.depth; i++ {
+		b := t.buckets[i*t.width+(h1+i*h2)%t.width]
+		if b.fp == fp && b.count > max {
+			max = b.count
+		}
+	}
+	return max, nil
+}
+
+// TopKList 返回Top-K中的元素，按计数从大到小排列
+// returns the items in the Top-K, ordered by count from the greatest
+func (s *Sketches) TopKList(key string) ([]Item, error) {
+	t, err := s.topK(key)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]Item, len(t.heap))
+	copy(res, t.heap)
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Count != res[j].Count {
+			return res[i].Count > res[j].Count
+		}
+		return bytes.Compare(res[i].Item, res[j].Item) < 0
+	})
+	return res, nil
+}
+
+func (s *Sketches) topK(key string) (*TopK, error) {
+	sk, exist := s.record[key]
+	if !exist {
+		return nil, ErrSketchNotExist
+	}
+	t, ok := sk.(*TopK)
+	if !ok {
+		return nil, ErrWrongType
+	}
+	return t, nil
+}
+
+func (t *TopK) incrBy(item []byte, increment uint64) []byte {
+	fp, h1, h2 := t.position(item)
+
+	var max uint64
+	for i := uint64(0); i < t.depth; i++ {
+		b := &t.buckets[i*t.width+(h1+i*h2)%t.width]
+		switch {
+		case b.count == 0:
+			b.fp, b.count = fp, increment
+		case b.fp == fp:
+			b.count = saturatingAdd(b.count, increment)
+		default:
+			for n := increment; n > 0; n-- {
+				if t.random() < math.Pow(t.decay, float64(b.count)) {
+					b.count--
+					if b.count == 0 {
+						b.fp, b.count = fp, n
+						break
+					}
+				}
+			}
+		}
+		if b.fp == fp && b.count > max {
+			max = b.count
+		}
+	}
+
+	if i := t.find(item); i >= 0 {
+		t.heap[i].Count = max
+		return nil
+	}
+	if max == 0 {
+		return nil
+	}
+
+	it := Item{Item: append([]byte(nil), item...), Count: max}
+	if uint64(len(t.heap)) < t.k {
+		t.heap = append(t.heap, it)
+		return nil
+	}
+
+	//the heap is small, so the minimum is found by a scan
+	min := 0
+	for i := range t.heap {
+		if t.heap[i].Count < t.heap[min].Count {
+			min = i
+		}
+	}
+	if max <= t.heap[min].Count {
+		return nil
+	}
+	expelled := t.heap[min].Item
+	t.heap[min] = it
+	return expelled
+}
+
+func (t *TopK) find(item []byte) int {
+	for i := range t.heap {
+		if bytes.Equal(t.heap[i].Item, item) {
+			return i
+		}
+	}
+	return -1
+}
+
+func (t *TopK) position(item []byte) (uint32, uint64, uint64) {
+	h1, h2 := hash(item)
+	return uint32(h2 >> 32), h1, h2
+}
+
+// random returns a pseudo random number in [0, 1) by xorshift64*
+func (t *TopK) random() float64 {
+	t.rand ^= t.rand >> 12
+	t.rand ^= t.rand << 25
+	t.rand ^= t.rand >> 27
+	return float64((t.rand*0x2545f4914f6cdd1d)>>11) / (1 << 53)
+}
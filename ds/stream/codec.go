@@ -0,0 +1,152 @@
+package stream
+
+import (
+	"encoding/binary"
+)
+
+// EncodeFields 编码元素的field-value，每一项以长度作为前缀
+// encode the fields of an entry, each one is prefixed with its length
+func EncodeFields(fields [][]byte) []byte {
+	var w writer
+	w.uvarint(uint64(len(fields)))
+	for _, f := range fields {
+		w.bytes(f)
+	}
+	return w.buf
+}
+
+// DecodeFields 解码EncodeFields返回的数据
+// decode the data returned by EncodeFields
+func DecodeFields(data []byte) ([][]byte, error) {
+	r := reader{buf: data}
+	n := r.uvarint()
+
+	var fields [][]byte
+	for i := uint64(0); i < n && r.err == nil; i++ {
+		fields = append(fields, r.bytes())
+	}
+	return fields, r.err
+}
+
+// Encode 编码对消费者组的修改
+// encode the change of the consumer group
+func (u *GroupUpdate) Encode() []byte {
+	var w writer
+	w.bytes([]byte(u.Group))
+	w.id(u.LastDelivered)
+
+	w.uvarint(uint64(len(u.Consumers)))
+	for _, c := range u.Consumers {
+		w.bytes([]byte(c))
+	}
+
+	w.uvarint(uint64(len(u.Pending)))
+	for _, p := range u.Pending {
+		w.id(p.ID)
+		w.bytes([]byte(p.Consumer))
+		w.uvarint(uint64(p.DeliveryTime))
+		w.uvarint(uint64(p.DeliveryCount))
+	}
+
+	w.uvarint(uint64(len(u.Acked)))
+	for _, id := range u.Acked {
+		w.id(id)
+	}
+	return w.buf
+}
+
+// DecodeGroupUpdate 解码GroupUpdate.Encode返回的数据
+// decode the data returned by GroupUpdate.Encode
+func DecodeGroupUpdate(data []byte) (*GroupUpdate, error) {
+	r := reader{buf: data}
+	u := &GroupUpdate{
+		Group:         string(r.bytes()),
+		LastDelivered: r.id(),
+	}
+
+	n := r.uvarint()
+	for i := uint64(0); i < n && r.err == nil; i++ {
+		u.Consumers = append(u.Consumers, string(r.bytes()))
+	}
+
+	n = r.uvarint()
+	for i := uint64(0); i < n && r.err == nil; i++ {
+		u.Pending = append(u.Pending, PendingEntry{
+			ID:            r.id(),
+			Consumer:      string(r.bytes()),
+			DeliveryTime:  int64(r.uvarint()),
+			DeliveryCount: int(r.uvarint()),
+		})
+	}
+
+	n = r.uvarint()
+	for i := uint64(0); i < n && r.err == nil; i++ {
+		u.Acked = append(u.Acked, r.id())
+	}
+
+	if r.err != nil {
+		return nil, r.err
+	}
+	return u, nil
+}
+
+type writer struct {
+	buf []byte
+}
+
+func (w *writer) uvarint(v uint64) {
+	var b [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(b[:], v)
+	w.buf = append(w.buf, b[:n]...)
+}
+
+func (w *writer) bytes(b []byte) {
+	w.uvarint(uint64(len(b)))
+	w.buf = append(w.buf, b...)
+}
+
+func (w *writer) id(id ID) {
+	w.uvarint(id.Ms)
+	w.uvarint(id.Seq)
+}
+
+// reader 读取writer写入的数据，出错后后续读取均返回零值
+// reads the data written by writer, the reads after an error return zero values
+type reader struct {
+	buf []byte
+	err error
+}
+
+func (r *reader) uvarint() uint64 {
+	if r.err != nil {
+		return 0
+	}
+
+	v, n := binary.Uvarint(r.buf)
+	if n <= 0 {
+		r.err = ErrInvalidData
+		return 0
+	}
+	r.buf = r.buf[n:]
+	return v
+}
+
+func (r *reader) bytes() []byte {
+	n := r.uvarint()
+	if r.err != nil {
+		return nil
+	}
+	if uint64(len(r.buf)) < n {
+		r.err = ErrInvalidData
+		return nil
+	}
+
+	b := make([]byte, n)
+	copy(b, r.buf)
+	r.buf = r.buf[n:]
+	return b
+}
+
+func (r *reader) id() ID {
+	return ID{Ms: r.uvarint(), Seq: r.uvarint()}
+}
@@ -0,0 +1,441 @@
+package stream
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Stream 仅追加的日志结构，每个元素由一个递增的ID和若干field-value组成
+// 消费者组记录最后投递的ID，以及已投递但未确认的元素（pending entries list）
+// an append-only log whose entries are identified by increasing IDs,
+// consumer groups track the last delivered ID and the entries delivered but not acknowledged yet
+
+var (
+	// ErrInvalidID the stream ID is invalid
+	ErrInvalidID = errors.New("ds/stream: invalid stream ID")
+
+	// ErrInvalidData the encoded data is invalid
+	ErrInvalidData = errors.New("ds/stream: invalid encoded data")
+)
+
+var (
+	// MinID the smallest ID
+	MinID = ID{}
+
+	// MaxID the largest ID
+	MaxID = ID{Ms: math.MaxUint64, Seq: math.MaxUint64}
+)
+
+type (
+	Record map[string]*stream
+
+	// Streams stream struct
+	Streams struct {
+		record Record
+	}
+
+	// ID 元素的ID，由毫秒时间戳和序号组成
+	// the ID of an entry, made of a millisecond timestamp and a sequence number
+	ID struct {
+		Ms  uint64
+		Seq uint64
+	}
+
+	// Entry 流中的一个元素，Fields 为 field-value 交替排列
+	// an entry of the stream, Fields are alternate fields and values
+	Entry struct {
+		ID     ID
+		Fields [][]byte
+	}
+
+	// PendingEntry 已投递给消费者但未确认的元素
+	// an entry delivered to a consumer but not acknowledged yet
+	PendingEntry struct {
+		ID            ID
+		Consumer      string
+		DeliveryTime  int64 // unix milliseconds of the last delivery
+		DeliveryCount int
+	}
+
+	// GroupUpdate 对消费者组的一次修改，重放时可以重复应用
+	// a change of a consumer group, applying it more than once has the same result
+	GroupUpdate struct {
+		Group         string
+		LastDelivered ID             // the last delivered ID only moves forward
+		Consumers     []string       // consumers to add
+		Pending       []PendingEntry // pending entries to add or overwrite
+		Acked         []ID           // pending entries to remove
+	}
+
+	stream struct {
+		entries []Entry
+		lastID  ID
+		groups  map[string]*group
+	}
+
+	group struct {
+		lastDelivered ID
+		pending       map[ID]*PendingEntry
+		consumers     map[string]struct{}
+	}
+)
+
+// New new a stream
+func New() *Streams {
+	return &Streams{make(Record)}
+}
+
+// ParseID 解析 ms-seq 格式的ID，省略 seq 时使用 defaultSeq
+// parse the ID in the form of ms-seq, defaultSeq is used if seq is omitted
+func ParseID(s string, defaultSeq uint64) (ID, error) {
+	ms, seq, hasSeq := s, "", false
+	if i := strings.IndexByte(s, '-'); i >= 0 {
+		ms, seq, hasSeq = s[:i], s[i+1:], true
+	}
+
+	var id ID
+	var err error
+	if id.Ms, err = strconv.ParseUint(ms, 10, 64); err != nil {
+		return id, ErrInvalidID
+	}
+
+	id.Seq = defaultSeq
+	if hasSeq {
+		if id.Seq, err = strconv.ParseUint(seq, 10, 64); err != nil {
+			return id, ErrInvalidID
+		}
+	}
+	return id, nil
+}
+
+// String format the ID as ms-seq
+func (id ID) String() string {
+	return strconv.FormatUint(id.Ms, 10) + "-" + strconv.FormatUint(id.Seq, 10)
+}
+
+// Less whether id is smaller than other
+func (id ID) Less(other ID) bool {
+	if id.Ms != other.Ms {
+		return id.Ms < other.Ms
+	}
+	return id.Seq < other.Seq
+}
+
+// Next returns the smallest ID greater than id
+func (id ID) Next() ID {
+	if id.Seq == math.MaxUint64 {
+		return ID{Ms: id.Ms + 1}
+	}
+	return ID{Ms: id.Ms, Seq: id.Seq + 1}
+}
+
+// XAdd 添加一个元素，ID小于最后一个元素时按顺序插入
+// add an entry, it is inserted in order if the ID is smaller than the last one
+func (s *Streams) XAdd(key string, id ID, fields [][]byte) {
+	st := s.stream(key)
+	i := st.search(id)
+	if i < len(st.entries) && st.entries[i].ID == id {
+		st.entries[i].Fields = fields
+	} else {
+		st.entries = append(st.entries, Entry{})
+		copy(st.entries[i+1:], st.entries[i:])
+		st.entries[i] = Entry{ID: id, Fields: fields}
+	}
+
+	if st.lastID.Less(id) {
+		st.lastID = id
+	}
+}
+
+// LastID 返回添加过的最大ID，包括已被删除的元素
+// returns the largest ID ever added, including the entries trimmed
+func (s *Streams) LastID(key string) (ID, bool) {
+	st, ok := s.record[key]
+	if !ok {
+		return MinID, false
+	}
+	return st.lastID, true
+}
+
+// XExists whether the stream of key exists
+func (s *Streams) XExists(key string) bool {
+	_, ok := s.record[key]
+	return ok
+}
+
+// EntryExists whether the entry of id exists
+func (s *Streams) EntryExists(key string, id ID) bool {
+	st, ok := s.record[key]
+	if !ok {
+		return false
+	}
+	i := st.search(id)
+	return i < len(st.entries) && st.entries[i].ID == id
+}
+
+// XLen returns the number of entries
+func (s *Streams) XLen(key string) int {
+	if st, ok := s.record[key]; ok {
+		return len(st.entries)
+	}
+	return 0
+}
+
+// XRange 返回ID在[start, end]中的元素，count <= 0 时返回全部
+// returns the entries with IDs between start and end (both inclusive), all of them if count <= 0
+func (s *Streams) XRange(key string, start, end ID, count int) []Entry {
+	st, ok := s.record[key]
+	if !ok || end.Less(start) {
+		return nil
+	}
+
+	var res []Entry
+	for i := st.search(start); i < len(st.entries) && !end.Less(st.entries[i].ID); i++ {
+		if count > 0 && len(res) >= count {
+			break
+		}
+		res = append(res, st.entries[i])
+	}
+	return res
+}
+
+// XRevRange 逆序返回ID在[start, end]中的元素
+// returns the entries with IDs between start and end in reverse order
+func (s *Streams) XRevRange(key string, end, start ID, count int) []Entry {
+	st, ok := s.record[key]
+	if !ok || end.Less(start) {
+		return nil
+	}
+
+	var res []Entry
+	i := sort.Search(len(st.entries), func(i int) bool {
+		return end.Less(st.entries[i].ID)
+	})
+	for i--; i >= 0 && !st.entries[i].ID.Less(start); i-- {
+		if count > 0 && len(res) >= count {
+			break
+		}
+		res = append(res, st.entries[i])
+	}
+	return res
+}
+
+// XTrim 删除最早的元素，只保留maxLen个，返回删除的个数以及保留的最小ID
+// evict the oldest entries so that at most maxLen entries are kept,
+// returns the number of removed entries and the smallest ID kept
+func (s *Streams) XTrim(key string, maxLen int) (int, ID) {
+	st, ok := s.record[key]
+	if !ok || maxLen < 0 || len(st.entries) <= maxLen {
+		return 0, MinID
+	}
+
+	minID := st.lastID.Next()
+	if maxLen > 0 {
+		minID = st.entries[len(st.entries)-maxLen].ID
+	}
+	return s.XTrimMinID(key, minID), minID
+}
+
+// XTrimMinID 删除ID小于minID的元素
+// evict the entries whose IDs are smaller than minID
+func (s *Streams) XTrimMinID(key string, minID ID) int {
+	st, ok := s.record[key]
+	if !ok {
+		return 0
+	}
+
+	n := st.search(minID)
+	st.entries = append(st.entries[:0:0], st.entries[n:]...)
+	return n
+}
+
+// GroupExists whether the consumer group exists
+func (s *Streams) GroupExists(key, group string) bool {
+	_, ok := s.group(key, group)
+	return ok
+}
+
+// ApplyGroup 修改消费者组，组或者流不存在时创建
+// apply the change to the consumer group, the group and the stream are created if not exist
+func (s *Streams) ApplyGroup(key string, u *GroupUpdate) {
+	st := s.stream(key)
+	g, ok := st.groups[u.Group]
+	if !ok {
+		g = &group{
+			pending:   make(map[ID]*PendingEntry),
+			consumers: make(map[string]struct{}),
+		}
+		st.groups[u.Group] = g
+	}
+
+	if g.lastDelivered.Less(u.LastDelivered) {
+		g.lastDelivered = u.LastDelivered
+	}
+	for _, c := range u.Consumers {
+		g.consumers[c] = struct{}{}
+	}
+	for i := range u.Pending {
+		p := u.Pending[i]
+		g.pending[p.ID] = &p
+		g.consumers[p.Consumer] = struct{}{}
+	}
+	for _, id := range u.Acked {
+		delete(g.pending, id)
+	}
+}
+
+// ReadNew 返回组中尚未投递的元素，不修改组
+// returns the entries never delivered to the group, the group is not changed
+func (s *Streams) ReadNew(key, group string, count int) []Entry {
+	g, ok := s.group(key, group)
+	if !ok {
+		return nil
+	}
+	return s.XRange(key, g.lastDelivered.Next(), MaxID, count)
+}
+
+// ReadPending 返回消费者ID大于start的待确认元素，已被删除的元素Fields为nil
+// returns the pending entries of the consumer with IDs greater than start,
+// Fields of the entries deleted from the stream are nil
+func (s *Streams) ReadPending(key, group, consumer string, start ID, count int) []Entry {
+	var res []Entry
+	for _, p := range s.XPending(key, group, start.Next(), MaxID, 0, consumer) {
+		if count > 0 && len(res) >= count {
+			break
+		}
+		e := Entry{ID: p.ID}
+		if entries := s.XRange(key, p.ID, p.ID, 1); len(entries) > 0 {
+			e = entries[0]
+		}
+		res = append(res, e)
+	}
+	return res
+}
+
+// XPending 返回ID在[start, end]中的待确认元素，consumer为空时返回所有消费者的
+// returns the pending entries with IDs between start and end, of all consumers if consumer is empty
+func (s *Streams) XPending(key, group string, start, end ID, count int, consumer string) []PendingEntry {
+	g, ok := s.group(key, group)
+	if !ok {
+		return nil
+	}
+
+	var res []PendingEntry
+	for id, p := range g.pending {
+		if id.Less(start) || end.Less(id) || (consumer != "" && p.Consumer != consumer) {
+			continue
+		}
+		res = append(res, *p)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].ID.Less(res[j].ID)
+	})
+
+	if count > 0 && len(res) > count {
+		res = res[:count]
+	}
+	return res
+}
+
+// PendingEntry 返回消费者组中id对应的待确认元素
+// returns the pending entry of id in the consumer group
+func (s *Streams) PendingEntry(key, group string, id ID) (PendingEntry, bool) {
+	g, ok := s.group(key, group)
+	if !ok {
+		return PendingEntry{}, false
+	}
+	p, ok := g.pending[id]
+	if !ok {
+		return PendingEntry{}, false
+	}
+	return *p, true
+}
+
+// Snapshot 编码流的最大ID和所有消费者组，不包括元素本身
+// encode the last ID and all consumer groups of the stream, the entries are not included
+func (s *Streams) Snapshot(key string) []byte {
+	st, ok := s.record[key]
+	if !ok {
+		return nil
+	}
+
+	var w writer
+	w.id(st.lastID)
+	w.uvarint(uint64(len(st.groups)))
+	for name, g := range st.groups {
+		u := &GroupUpdate{Group: name, LastDelivered: g.lastDelivered}
+		for c := range g.consumers {
+			u.Consumers = append(u.Consumers, c)
+		}
+		for _, p := range g.pending {
+			u.Pending = append(u.Pending, *p)
+		}
+		w.bytes(u.Encode())
+	}
+	return w.buf
+}
+
+// Restore 应用Snapshot返回的数据，流不存在时创建
+// apply the data returned by Snapshot, the stream is created if not exist
+func (s *Streams) Restore(key string, data []byte) error {
+	r := reader{buf: data}
+	lastID := r.id()
+	n := r.uvarint()
+
+	var updates []*GroupUpdate
+	for i := uint64(0); i < n && r.err == nil; i++ {
+		u, err := DecodeGroupUpdate(r.bytes())
+		if err != nil {
+			return err
+		}
+		updates = append(updates, u)
+	}
+	if r.err != nil {
+		return r.err
+	}
+
+	st := s.stream(key)
+	if st.lastID.Less(lastID) {
+		st.lastID = lastID
+	}
+	for _, u := range updates {
+		s.ApplyGroup(key, u)
+	}
+	return nil
+}
+
+// Keys returns all keys
+func (s *Streams) Keys() (keys []string) {
+	for k := range s.record {
+		keys = append(keys, k)
+	}
+	return
+}
+
+func (s *Streams) stream(key string) *stream {
+	st, ok := s.record[key]
+	if !ok {
+		st = &stream{groups: make(map[string]*group)}
+		s.record[key] = st
+	}
+	return st
+}
+
+func (s *Streams) group(key, group string) (*group, bool) {
+	st, ok := s.record[key]
+	if !ok {
+		return nil, false
+	}
+	g, ok := st.groups[group]
+	return g, ok
+}
+
+// search returns the index of the first entry whose ID is not smaller than id
+func (st *stream) search(id ID) int {
+	return sort.Search(len(st.entries), func(i int) bool {
+		return !st.entries[i].ID.Less(id)
+	})
+}
@@ -0,0 +1,183 @@
+package stream
+
+import (
+	"reflect"
+	"testing"
+)
+
+var key = "my_stream"
+
+func InitStream() *Streams {
+	s := New()
+	for i := uint64(1); i <= 5; i++ {
+		s.XAdd(key, ID{Ms: i}, [][]byte{[]byte("field"), []byte{byte('0' + i)}})
+	}
+	return s
+}
+
+func ids(entries []Entry) (res []ID) {
+	for _, e := range entries {
+		res = append(res, e.ID)
+	}
+	return
+}
+
+func TestParseID(t *testing.T) {
+	tests := []struct {
+		s   string
+		seq uint64
+		id  ID
+		err error
+	}{
+		{"5-3", 0, ID{5, 3}, nil},
+		{"5", 0, ID{5, 0}, nil},
+		{"5", 9, ID{5, 9}, nil},
+		{"5-", 0, ID{}, ErrInvalidID},
+		{"a-1", 0, ID{}, ErrInvalidID},
+	}
+	for _, tt := range tests {
+		id, err := ParseID(tt.s, tt.seq)
+		if err != tt.err || (err == nil && id != tt.id) {
+			t.Errorf("ParseID(%q) = %v, %v", tt.s, id, err)
+		}
+	}
+
+	if s := (ID{1, 2}).String(); s != "1-2" {
+		t.Error("expected 1-2, got ", s)
+	}
+	if next := (ID{1, MaxID.Seq}).Next(); next != (ID{2, 0}) {
+		t.Error("expected 2-0, got ", next)
+	}
+}
+
+func TestStreams_XAdd(t *testing.T) {
+	s := InitStream()
+	s.XAdd(key, ID{Ms: 3, Seq: 1}, nil)
+
+	if n := s.XLen(key); n != 6 {
+		t.Error("expected 6, got ", n)
+	}
+	if last, _ := s.LastID(key); last != (ID{Ms: 5}) {
+		t.Error("expected 5-0, got ", last)
+	}
+	if !s.EntryExists(key, ID{Ms: 3, Seq: 1}) {
+		t.Error("expected 3-1 to exist")
+	}
+}
+
+func TestStreams_XRange(t *testing.T) {
+	s := InitStream()
+
+	got := ids(s.XRange(key, ID{Ms: 2}, ID{Ms: 4}, 0))
+	if !reflect.DeepEqual(got, []ID{{2, 0}, {3, 0}, {4, 0}}) {
+		t.Error("xrange got ", got)
+	}
+	got = ids(s.XRange(key, MinID, MaxID, 2))
+	if !reflect.DeepEqual(got, []ID{{1, 0}, {2, 0}}) {
+		t.Error("xrange with count got ", got)
+	}
+	got = ids(s.XRevRange(key, MaxID, ID{Ms: 3}, 0))
+	if !reflect.DeepEqual(got, []ID{{5, 0}, {4, 0}, {3, 0}}) {
+		t.Error("xrevrange got ", got)
+	}
+	if res := s.XRange(key, ID{Ms: 4}, ID{Ms: 2}, 0); res != nil {
+		t.Error("expected nil, got ", res)
+	}
+}
+
+func TestStreams_XTrim(t *testing.T) {
+	s := InitStream()
+
+	n, minID := s.XTrim(key, 2)
+	if n != 3 || minID != (ID{Ms: 4}) || s.XLen(key) != 2 {
+		t.Errorf("xtrim got %d, %v, len %d", n, minID, s.XLen(key))
+	}
+	if n, _ = s.XTrim(key, 5); n != 0 {
+		t.Error("expected 0, got ", n)
+	}
+
+	n, _ = s.XTrim(key, 0)
+	if n != 2 || s.XLen(key) != 0 {
+		t.Errorf("xtrim all got %d, len %d", n, s.XLen(key))
+	}
+	if last, _ := s.LastID(key); last != (ID{Ms: 5}) {
+		t.Error("the last ID should be kept, got ", last)
+	}
+}
+
+func TestStreams_Group(t *testing.T) {
+	s := InitStream()
+	s.ApplyGroup(key, &GroupUpdate{Group: "g", LastDelivered: ID{Ms: 2}})
+
+	got := ids(s.ReadNew(key, "g", 2))
+	if !reflect.DeepEqual(got, []ID{{3, 0}, {4, 0}}) {
+		t.Error("readnew got ", got)
+	}
+
+	s.ApplyGroup(key, &GroupUpdate{
+		Group:         "g",
+		LastDelivered: ID{Ms: 4},
+		Pending: []PendingEntry{
+			{ID: ID{Ms: 3}, Consumer: "alice", DeliveryTime: 100, DeliveryCount: 1},
+			{ID: ID{Ms: 4}, Consumer: "bob", DeliveryTime: 100, DeliveryCount: 1},
+		},
+	})
+	if p := s.XPending(key, "g", MinID, MaxID, 0, ""); len(p) != 2 || p[0].ID != (ID{Ms: 3}) {
+		t.Error("xpending got ", p)
+	}
+	if p := s.XPending(key, "g", MinID, MaxID, 0, "bob"); len(p) != 1 || p[0].Consumer != "bob" {
+		t.Error("xpending of bob got ", p)
+	}
+
+	s.XTrimMinID(key, ID{Ms: 4})
+	res := s.ReadPending(key, "g", "alice", MinID, 0)
+	if len(res) != 1 || res[0].ID != (ID{Ms: 3}) || res[0].Fields != nil {
+		t.Error("readpending of a deleted entry got ", res)
+	}
+
+	s.ApplyGroup(key, &GroupUpdate{Group: "g", Acked: []ID{{Ms: 3}}})
+	if p := s.XPending(key, "g", MinID, MaxID, 0, ""); len(p) != 1 {
+		t.Error("xpending after ack got ", p)
+	}
+	if s.GroupExists(key, "not exist") {
+		t.Error("expected group not exist")
+	}
+}
+
+func TestStreams_Snapshot(t *testing.T) {
+	s := InitStream()
+	s.ApplyGroup(key, &GroupUpdate{
+		Group:         "g",
+		LastDelivered: ID{Ms: 3},
+		Consumers:     []string{"alice"},
+		Pending:       []PendingEntry{{ID: ID{Ms: 3}, Consumer: "bob", DeliveryTime: 100, DeliveryCount: 2}},
+	})
+	s.XTrim(key, 0)
+
+	s2 := New()
+	if err := s2.Restore(key, s.Snapshot(key)); err != nil {
+		t.Fatal(err)
+	}
+	if last, _ := s2.LastID(key); last != (ID{Ms: 5}) {
+		t.Error("expected 5-0, got ", last)
+	}
+	if !reflect.DeepEqual(s.XPending(key, "g", MinID, MaxID, 0, ""), s2.XPending(key, "g", MinID, MaxID, 0, "")) {
+		t.Error("the pending entries are not restored")
+	}
+	if err := s2.Restore(key, []byte{1}); err != ErrInvalidData {
+		t.Error("expected ErrInvalidData, got ", err)
+	}
+}
+
+func TestEncodeFields(t *testing.T) {
+	fields := [][]byte{[]byte("name"), []byte("kdb"), []byte(""), []byte("empty field")}
+	got, err := DecodeFields(EncodeFields(fields))
+	if err != nil || len(got) != len(fields) {
+		t.Fatal(got, err)
+	}
+	for i := range fields {
+		if string(got[i]) != string(fields[i]) {
+			t.Errorf("field %d: expected %q, got %q", i, fields[i], got[i])
+		}
+	}
+}
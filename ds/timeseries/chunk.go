@@ -0,0 +1,231 @@
+package timeseries
+
+import (
+	"math"
+	"math/bits"
+)
+
+// chunk 使用 Gorilla 编码压缩的一段连续的样本，时间戳保存二阶差分，值保存与前一个值的异或
+// 详细可参考 http://www.vldb.org/pvldb/vol8/p1816-teller.pdf
+// a run of samples compressed by the encoding of Gorilla, the timestamps are kept as delta of deltas,
+// and the values are kept as the xor with the previous ones.
+type chunk struct {
+	stream bitStream
+	count  int
+
+	//the state to append the next sample
+	first    int64
+	last     int64
+	delta    int64
+	value    uint64
+	leading  uint8
+	trailing uint8
+}
+
+// maxChunkSamples 一个chunk的最大样本数，乱序写入时需要重新编码整个chunk
+const maxChunkSamples = 256
+
+func newChunk(samples []Sample) *chunk {
+	c := &chunk{}
+	for _, s := range samples {
+		c.append(s)
+	}
+	return c
+}
+
+// append 追加一个时间戳大于最后一个样本的样本
+// appends a sample whose timestamp is greater than the last one
+func (c *chunk) append(s Sample) {
+	v := math.Float64bits(s.Value)
+	switch c.count {
+	case 0:
+		c.first = s.Timestamp
+		c.stream.writeBits(uint64(s.Timestamp), 64)
+		c.stream.writeBits(v, 64)
+		c.leading, c.trailing = 0xff, 0
+	case 1:
+		c.delta = s.Timestamp - c.last
+		c.stream.writeBits(uint64(c.delta), 64)
+		c.appendValue(v)
+	default:
+		delta := s.Timestamp - c.last
+		c.appendDod(delta - c.delta)
+		c.delta = delta
+		c.appendValue(v)
+	}
+
+	c.last, c.value = s.Timestamp, v
+	c.count++
+}
+
+// appendDod 按二阶差分的大小使用不同的位数
+// the delta of deltas is written with the bits depending on its range
+func (c *chunk) appendDod(dod int64) {
+	switch {
+	case dod == 0:
+		c.stream.writeBit(false)
+	case -64 <= dod && dod <= 63:
+		c.stream.writeBits(0b10, 2)
+		c.stream.writeBits(uint64(dod), 7)
+	case -256 <= dod && dod <= 255:
+		c.stream.writeBits(0b110, 3)
+		c.stream.writeBits(uint64(dod), 9)
+	case -2048 <= dod && dod <= 2047:
+		c.stream.writeBits(0b1110, 4)
+		c.stream.writeBits(uint64(dod), 12)
+	default:
+		c.stream.writeBits(0b1111, 4)
+		c.stream.writeBits(uint64(dod), 64)
+	}
+}
+
+// appendValue 值与前一个值相同时只写入一位，否则写入异或结果中有意义的位
+// a single bit is written if the value equals to the previous one, otherwise the meaningful bits of the xor
+func (c *chunk) appendValue(v uint64) {
+	xor := v ^ c.value
+	if xor == 0 {
+		c.stream.writeBit(false)
+		return
+	}
+	c.stream.writeBit(true)
+
+	leading := uint8(bits.LeadingZeros64(xor))
+	trailing := uint8(bits.TrailingZeros64(xor))
+	if leading > 31 {
+		leading = 31
+	}
+
+	//the meaningful bits fit in the window of the previous value
+	if c.leading != 0xff && leading >= c.leading && trailing >= c.trailing {
+		c.stream.writeBit(false)
+		c.stream.writeBits(xor>>c.trailing, 64-int(c.leading)-int(c.trailing))
+		return
+	}
+
+	c.leading, c.trailing = leading, trailing
+	sigBits := 64 - int(leading) - int(trailing)
+	c.stream.writeBit(true)
+	c.stream.writeBits(uint64(leading), 5)
+	c.stream.writeBits(uint64(sigBits), 6) // 64 is written as 0
+	c.stream.writeBits(xor>>trailing, sigBits)
+}
+
+// samples decode all samples
+func (c *chunk) samples() ([]Sample, error) {
+	res := make([]Sample, 0, c.count)
+	r := bitReader{stream: &c.stream}
+
+	var ts, delta int64
+	var v uint64
+	var leading, trailing uint8
+	for i := 0; i < c.count; i++ {
+		switch i {
+		case 0:
+			ts = int64(r.readBits(64))
+			v = r.readBits(64)
+		case 1:
+			delta = int64(r.readBits(64))
+			ts += delta
+			v = readValue(&r, v, &leading, &trailing)
+		default:
+			delta += readDod(&r)
+			ts += delta
+			v = readValue(&r, v, &leading, &trailing)
+		}
+		if r.err {
+			return nil, ErrInvalidData
+		}
+		res = append(res, Sample{Timestamp: ts, Value: math.Float64frombits(v)})
+	}
+	return res, nil
+}
+
+func readDod(r *bitReader) int64 {
+	var n int
+	switch {
+	case !r.readBit():
+		return 0
+	case !r.readBit():
+		n = 7
+	case !r.readBit():
+		n = 9
+	case !r.readBit():
+		n = 12
+	default:
+		n = 64
+	}
+
+	//sign extend the n bits value
+	v := r.readBits(n)
+	if n < 64 && v>>(n-1) == 1 {
+		v |= math.MaxUint64 << n
+	}
+	return int64(v)
+}
+
+func readValue(r *bitReader, prev uint64, leading, trailing *uint8) uint64 {
+	if !r.readBit() {
+		return prev
+	}
+	if r.readBit() {
+		*leading = uint8(r.readBits(5))
+		sigBits := uint8(r.readBits(6))
+		if sigBits == 0 {
+			sigBits = 64
+		}
+		*trailing = 64 - *leading - sigBits
+	}
+	sigBits := 64 - int(*leading) - int(*trailing)
+	return prev ^ r.readBits(sigBits)<<*trailing
+}
+
+// bitStream 按位写入的字节流
+type bitStream struct {
+	data []byte
+	bits int // the number of bits written
+}
+
+func (s *bitStream) writeBit(bit bool) {
+	if s.bits%8 == 0 {
+		s.data = append(s.data, 0)
+	}
+	if bit {
+		s.data[len(s.data)-1] |= 1 << (7 - s.bits%8)
+	}
+	s.bits++
+}
+
+// writeBits writes the lowest n bits of v, the highest bit first
+func (s *bitStream) writeBits(v uint64, n int) {
+	for i := n - 1; i >= 0; i-- {
+		s.writeBit(v>>i&1 == 1)
+	}
+}
+
+// bitReader 读取bitStream，越界后err为true
+type bitReader struct {
+	stream *bitStream
+	pos    int
+	err    bool
+}
+
+func (r *bitReader) readBit() bool {
+	if r.pos >= r.stream.bits {
+		r.err = true
+		return false
+	}
+	bit := r.stream.data[r.pos/8]>>(7-r.pos%8)&1 == 1
+	r.pos++
+	return bit
+}
+
+func (r *bitReader) readBits(n int) uint64 {
+	var v uint64
+	for i := 0; i < n; i++ {
+		v <<= 1
+		if r.readBit() {
+			v |= 1
+		}
+	}
+	return v
+}
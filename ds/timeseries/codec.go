@@ -0,0 +1,180 @@
+package timeseries
+
+import (
+	"encoding/binary"
+	"sort"
+)
+
+// Dump 返回序列的二进制表示，样本保存为压缩后的chunk
+// returns the binary representation of the series, the samples are kept as the compressed chunks
+func (t *TimeSeries) Dump(key string) []byte {
+	s, exist := t.record[key]
+	if !exist {
+		return nil
+	}
+
+	var w writer
+	w.uvarint(uint64(s.retention))
+	w.bytes(EncodeLabels(s.labels))
+	w.bytes([]byte(s.srcKey))
+	w.uvarint(uint64(len(s.rules)))
+	for _, rule := range s.rules {
+		w.bytes([]byte(rule.DestKey))
+		w.uvarint(uint64(rule.Aggregation))
+		w.uvarint(uint64(rule.BucketDuration))
+	}
+	w.uvarint(uint64(len(s.chunks)))
+	for _, c := range s.chunks {
+		w.uvarint(uint64(c.count))
+		w.uvarint(uint64(c.stream.bits))
+		w.buf = append(w.buf, c.stream.data...)
+	}
+	return w.buf
+}
+
+// Restore 用Dump的结果替换key的序列
+// replaces the series of key with the dumped one
+func (t *TimeSeries) Restore(key string, data []byte) error {
+	r := reader{buf: data}
+	s := &Series{retention: int64(r.uvarint())}
+
+	labels, err := DecodeLabels(r.bytes())
+	if err != nil {
+		return err
+	}
+	s.labels = labels
+	s.srcKey = string(r.bytes())
+
+	n := r.uvarint()
+	if n > uint64(len(r.buf)) {
+		return ErrInvalidData
+	}
+	for i := uint64(0); i < n && r.err == nil; i++ {
+		rule := Rule{DestKey: string(r.bytes())}
+		rule.Aggregation = Aggregation(r.uvarint())
+		rule.BucketDuration = int64(r.uvarint())
+		if rule.Aggregation == AggNone || rule.Aggregation > AggCount || rule.BucketDuration <= 0 {
+			return ErrInvalidData
+		}
+		s.rules = append(s.rules, rule)
+	}
+
+	n = r.uvarint()
+	if n > uint64(len(r.buf)) {
+		return ErrInvalidData
+	}
+	for i := uint64(0); i < n && r.err == nil; i++ {
+		count, bits := r.uvarint(), r.uvarint()
+		size := (bits + 7) / 8
+		if r.err != nil || count == 0 || count > maxChunkSamples || uint64(len(r.buf)) < size {
+			return ErrInvalidData
+		}
+
+		//decode and encode again to rebuild the state for appending
+		c := &chunk{stream: bitStream{data: r.buf[:size], bits: int(bits)}, count: int(count)}
+		r.buf = r.buf[size:]
+		samples, err := c.samples()
+		if err != nil {
+			return err
+		}
+		s.chunks = append(s.chunks, newChunk(samples))
+	}
+	if r.err != nil || len(r.buf) != 0 {
+		return ErrInvalidData
+	}
+
+	t.record[key] = s
+	return nil
+}
+
+// EncodeLabels 按标签名排序编码标签
+// encodes the labels sorted by name
+func EncodeLabels(labels map[string]string) []byte {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var w writer
+	w.uvarint(uint64(len(names)))
+	for _, name := range names {
+		w.bytes([]byte(name))
+		w.bytes([]byte(labels[name]))
+	}
+	return w.buf
+}
+
+// DecodeLabels decodes the labels encoded by EncodeLabels
+func DecodeLabels(data []byte) (map[string]string, error) {
+	labels := make(map[string]string)
+	if len(data) == 0 {
+		return labels, nil
+	}
+
+	r := reader{buf: data}
+	n := r.uvarint()
+	if n > uint64(len(r.buf)) {
+		return nil, ErrInvalidData
+	}
+	for i := uint64(0); i < n && r.err == nil; i++ {
+		name := string(r.bytes())
+		labels[name] = string(r.bytes())
+	}
+	if r.err != nil {
+		return nil, ErrInvalidData
+	}
+	return labels, nil
+}
+
+type writer struct {
+	buf []byte
+}
+
+func (w *writer) uvarint(v uint64) {
+	var b [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(b[:], v)
+	w.buf = append(w.buf, b[:n]...)
+}
+
+func (w *writer) bytes(b []byte) {
+	w.uvarint(uint64(len(b)))
+	w.buf = append(w.buf, b...)
+}
+
+// reader 读取writer写入的数据，出错后后续读取均返回零值
+// reads the data written by writer, the reads after an error return zero values
+type reader struct {
+	buf []byte
+	err error
+}
+
+func (r *reader) uvarint() uint64 {
+	if r.err != nil {
+		return 0
+	}
+
+	v, n := binary.Uvarint(r.buf)
+	if n <= 0 {
+		r.err = ErrInvalidData
+		return 0
+	}
+	r.buf = r.buf[n:]
+	return v
+}
+
+func (r *reader) bytes() []byte {
+	n := r.uvarint()
+	if r.err != nil {
+		return nil
+	}
+	if uint64(len(r.buf)) < n {
+		r.err = ErrInvalidData
+		return nil
+	}
+
+	b := make([]byte, n)
+	copy(b, r.buf)
+	r.buf = r.buf[n:]
+	return b
+}
@@ -0,0 +1,124 @@
+package timeseries
+
+import "sort"
+
+type (
+	// Sample a sample of a series, the timestamp is in milliseconds
+	Sample struct {
+		Timestamp int64
+		Value     float64
+	}
+
+	// Series 一个时间序列，样本按时间戳排序保存在不重叠的chunk中
+	// retention 大于0时，时间戳早于最新样本 retention 毫秒以上的样本被删除
+	// a time series, the samples are sorted by timestamp in non-overlapping chunks.
+	// If retention is greater than 0, the samples older than the latest one by more than retention milliseconds are dropped.
+	Series struct {
+		retention int64
+		labels    map[string]string
+		rules     []Rule
+		srcKey    string // the source key if the series is the destination of a rule
+		chunks    []*chunk
+	}
+
+	// Rule 压缩规则，源序列的每个时间桶被聚合为目标序列的一个样本
+	// a compaction rule, each bucket of the source series is aggregated as a sample of the destination series
+	Rule struct {
+		DestKey        string
+		Aggregation    Aggregation
+		BucketDuration int64
+	}
+)
+
+// add 添加一个样本，时间戳相同的样本被覆盖
+// adds a sample, the sample with the same timestamp is overwritten
+func (s *Series) add(sample Sample) {
+	n := len(s.chunks)
+	if n == 0 || sample.Timestamp > s.chunks[n-1].last {
+		if n == 0 || s.chunks[n-1].count >= maxChunkSamples {
+			s.chunks = append(s.chunks, &chunk{})
+			n++
+		}
+		s.chunks[n-1].append(sample)
+		return
+	}
+
+	//the sample is out of order, the chunk containing it is encoded again
+	i := sort.Search(n, func(i int) bool { return s.chunks[i].first > sample.Timestamp }) - 1
+	if i < 0 {
+		i = 0
+	}
+	samples, _ := s.chunks[i].samples()
+	j := sort.Search(len(samples), func(j int) bool { return samples[j].Timestamp >= sample.Timestamp })
+	if j < len(samples) && samples[j].Timestamp == sample.Timestamp {
+		samples[j] = sample
+	} else {
+		samples = append(samples, Sample{})
+		copy(samples[j+1:], samples[j:])
+		samples[j] = sample
+	}
+
+	if len(samples) <= maxChunkSamples {
+		s.chunks[i] = newChunk(samples)
+		return
+	}
+	half := len(samples) / 2
+	chunks := append([]*chunk{newChunk(samples[:half]), newChunk(samples[half:])}, s.chunks[i+1:]...)
+	s.chunks = append(s.chunks[:i], chunks...)
+}
+
+// trim 删除时间戳小于cutoff的样本
+// drops the samples older than cutoff
+func (s *Series) trim(cutoff int64) {
+	i := 0
+	for i < len(s.chunks) && s.chunks[i].last < cutoff {
+		i++
+	}
+	s.chunks = s.chunks[i:]
+
+	if len(s.chunks) > 0 && s.chunks[0].first < cutoff {
+		samples, _ := s.chunks[0].samples()
+		j := sort.Search(len(samples), func(j int) bool { return samples[j].Timestamp >= cutoff })
+		s.chunks[0] = newChunk(samples[j:])
+	}
+}
+
+// samples 返回时间戳在[from, to]中的样本
+// returns the samples with timestamps between from and to
+func (s *Series) samples(from, to int64) []Sample {
+	var res []Sample
+	for _, c := range s.chunks {
+		if c.last < from {
+			continue
+		}
+		if c.first > to {
+			break
+		}
+
+		samples, _ := c.samples()
+		for _, sample := range samples {
+			if sample.Timestamp >= from && sample.Timestamp <= to {
+				res = append(res, sample)
+			}
+		}
+	}
+	return res
+}
+
+// latest returns the sample with the greatest timestamp
+func (s *Series) latest() (Sample, bool) {
+	if len(s.chunks) == 0 {
+		return Sample{}, false
+	}
+	c := s.chunks[len(s.chunks)-1]
+	return Sample{Timestamp: c.last, Value: valueOf(c.value)}, true
+}
+
+// count returns the number of samples
+func (s *Series) count() int {
+	n := 0
+	for _, c := range s.chunks {
+		n += c.count
+	}
+	return n
+}
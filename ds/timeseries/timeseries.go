@@ -0,0 +1,418 @@
+package timeseries
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"strings"
+)
+
+// 时间序列的实现，每个序列有标签、保留时间和压缩规则
+// 压缩规则在源序列的一个时间桶结束时，将桶中的样本聚合后写入目标序列，乱序写入已结束的桶时重新计算这个桶
+// Time series with labels, retention and compaction rules.
+// A compaction rule aggregates the samples in a bucket of the source series into the destination series
+// when the bucket is closed, and a closed bucket is aggregated again if a sample is written into it out of order.
+
+var (
+	// ErrSeriesExists the series already exists
+	ErrSeriesExists = errors.New("ds/timeseries: series already exists")
+
+	// ErrSeriesNotExist the series does not exist
+	ErrSeriesNotExist = errors.New("ds/timeseries: series does not exist")
+
+	// ErrTimestampTooOld the timestamp is older than the retention window
+	ErrTimestampTooOld = errors.New("ds/timeseries: timestamp is older than the retention")
+
+	// ErrInvalidTimestamp the timestamp is negative
+	ErrInvalidTimestamp = errors.New("ds/timeseries: invalid timestamp")
+
+	// ErrInvalidAggregation the aggregation or the bucket duration is invalid
+	ErrInvalidAggregation = errors.New("ds/timeseries: invalid aggregation")
+
+	// ErrInvalidFilter the label filter is invalid
+	ErrInvalidFilter = errors.New("ds/timeseries: invalid label filter")
+
+	// ErrInvalidRule the compaction rule is invalid, e.g. the destination already has a source
+	ErrInvalidRule = errors.New("ds/timeseries: invalid compaction rule")
+
+	// ErrRuleNotExist the compaction rule does not exist
+	ErrRuleNotExist = errors.New("ds/timeseries: compaction rule does not exist")
+
+	// ErrInvalidData the dumped series is invalid
+	ErrInvalidData = errors.New("ds/timeseries: invalid series data")
+)
+
+// Aggregation the aggregation of the samples in a bucket
+type Aggregation uint8
+
+// aggregations
+const (
+	AggNone Aggregation = iota
+	AggAvg
+	AggMin
+	AggMax
+	AggSum
+	AggCount
+)
+
+var aggregationNames = map[string]Aggregation{
+	"avg":   AggAvg,
+	"min":   AggMin,
+	"max":   AggMax,
+	"sum":   AggSum,
+	"count": AggCount,
+}
+
+type (
+	Record map[string]*Series
+
+	// TimeSeries time series struct
+	TimeSeries struct {
+		record Record
+	}
+
+	// Result the samples of a series returned by MRange
+	Result struct {
+		Key     string
+		Labels  map[string]string
+		Samples []Sample
+	}
+)
+
+// New new time series
+func New() *TimeSeries {
+	return &TimeSeries{make(Record)}
+}
+
+// ParseAggregation parses avg, min, max, sum and count
+func ParseAggregation(name string) (Aggregation, error) {
+	if agg, ok := aggregationNames[strings.ToLower(name)]; ok {
+		return agg, nil
+	}
+	return AggNone, ErrInvalidAggregation
+}
+
+// Create 创建一个序列，retention 为保留的毫秒数，0 表示永久保留
+// creates a series, retention is in milliseconds and 0 means the samples are kept forever
+func (t *TimeSeries) Create(key string, retention int64, labels map[string]string) error {
+	if _, exist := t.record[key]; exist {
+		return ErrSeriesExists
+	}
+	if retention < 0 {
+		retention = 0
+	}
+
+	cp := make(map[string]string, len(labels))
+	for k, v := range labels {
+		cp[k] = v
+	}
+	t.record[key] = &Series{retention: retention, labels: cp}
+	return nil
+}
+
+// Exists whether the series exists
+func (t *TimeSeries) Exists(key string) bool {
+	_, exist := t.record[key]
+	return exist
+}
+
+// Add 添加一个样本，时间戳相同的样本被覆盖，并按压缩规则更新目标序列
+// adds a sample, the sample with the same timestamp is overwritten, and the destinations of the rules are updated
+func (t *TimeSeries) Add(key string, timestamp int64, value float64) error {
+	if err := t.CheckTimestamp(key, timestamp); err != nil {
+		return err
+	}
+
+	s := t.record[key]
+	latest, hasLatest := s.latest()
+	s.add(Sample{Timestamp: timestamp, Value: value})
+	if s.retention > 0 {
+		last, _ := s.latest()
+		s.trim(last.Timestamp - s.retention)
+	}
+
+	if !hasLatest {
+		return nil
+	}
+	for _, rule := range s.rules {
+		cur, prev := bucketStart(timestamp, rule.BucketDuration), bucketStart(latest.Timestamp, rule.BucketDuration)
+		switch {
+		case cur > prev:
+			//the bucket of the previous latest sample is closed
+			t.compact(s, rule, prev)
+		case cur < prev:
+			//a closed bucket is changed
+			t.compact(s, rule, cur)
+		}
+	}
+	return nil
+}
+
+// CheckTimestamp 检查样本能否添加到序列中
+// checks whether a sample with the timestamp can be added to the series
+func (t *TimeSeries) CheckTimestamp(key string, timestamp int64) error {
+	s, exist := t.record[key]
+	if !exist {
+		return ErrSeriesNotExist
+	}
+	if timestamp < 0 {
+		return ErrInvalidTimestamp
+	}
+
+	latest, ok := s.latest()
+	if ok && s.retention > 0 && timestamp < latest.Timestamp-s.retention {
+		return ErrTimestampTooOld
+	}
+	return nil
+}
+
+// Get returns the latest sample
+func (t *TimeSeries) Get(key string) (Sample, bool, error) {
+	s, exist := t.record[key]
+	if !exist {
+		return Sample{}, false, ErrSeriesNotExist
+	}
+	sample, ok := s.latest()
+	return sample, ok, nil
+}
+
+// Range 返回时间戳在[from, to]中的样本，agg 不为 AggNone 时按 bucketDuration 聚合
+// 聚合结果的时间戳为桶的起始时间
+// returns the samples with timestamps between from and to, aggregated in buckets of bucketDuration unless agg is AggNone.
+// The timestamps of the aggregations are the starts of the buckets.
+func (t *TimeSeries) Range(key string, from, to int64, agg Aggregation, bucketDuration int64) ([]Sample, error) {
+	s, exist := t.record[key]
+	if !exist {
+		return nil, ErrSeriesNotExist
+	}
+	if agg != AggNone && (agg > AggCount || bucketDuration <= 0) {
+		return nil, ErrInvalidAggregation
+	}
+	return aggregate(s.samples(from, to), agg, bucketDuration), nil
+}
+
+// MRange 返回标签匹配所有过滤条件的序列在[from, to]中的样本，按key排序
+// 过滤条件为 label=value、label!=value、label=（没有该标签）或 label!=（有该标签），至少需要一个 label=value
+// returns the samples between from and to of the series whose labels match all filters, sorted by key.
+// The filters are label=value, label!=value, label= (without the label) or label!= (with the label),
+// and at least one label=value is required.
+func (t *TimeSeries) MRange(from, to int64, filters []string, agg Aggregation, bucketDuration int64) ([]Result, error) {
+	matchers, err := parseFilters(filters)
+	if err != nil {
+		return nil, err
+	}
+	if agg != AggNone && (agg > AggCount || bucketDuration <= 0) {
+		return nil, ErrInvalidAggregation
+	}
+
+	var res []Result
+	for key, s := range t.record {
+		if !matches(s.labels, matchers) {
+			continue
+		}
+		labels := make(map[string]string, len(s.labels))
+		for k, v := range s.labels {
+			labels[k] = v
+		}
+		res = append(res, Result{Key: key, Labels: labels, Samples: aggregate(s.samples(from, to), agg, bucketDuration)})
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Key < res[j].Key })
+	return res, nil
+}
+
+// CreateRule 创建压缩规则，目标序列不能是其它规则的目标，源序列和目标序列都不能处于规则链中
+// creates a compaction rule, the destination can not be the destination of another rule,
+// and neither of the series can be in a chain of rules
+func (t *TimeSeries) CreateRule(srcKey, destKey string, agg Aggregation, bucketDuration int64) error {
+	if err := t.CheckRule(srcKey, destKey, agg, bucketDuration); err != nil {
+		return err
+	}
+
+	src, dest := t.record[srcKey], t.record[destKey]
+	src.rules = append(src.rules, Rule{DestKey: destKey, Aggregation: agg, BucketDuration: bucketDuration})
+	dest.srcKey = srcKey
+	return nil
+}
+
+// CheckRule checks whether the compaction rule can be created
+func (t *TimeSeries) CheckRule(srcKey, destKey string, agg Aggregation, bucketDuration int64) error {
+	src, exist := t.record[srcKey]
+	if !exist {
+		return ErrSeriesNotExist
+	}
+	dest, exist := t.record[destKey]
+	if !exist {
+		return ErrSeriesNotExist
+	}
+	if agg == AggNone || agg > AggCount || bucketDuration <= 0 {
+		return ErrInvalidAggregation
+	}
+	if srcKey == destKey || dest.srcKey != "" || len(dest.rules) > 0 || src.srcKey != "" {
+		return ErrInvalidRule
+	}
+	return nil
+}
+
+// DeleteRule deletes the compaction rule from src to dest
+func (t *TimeSeries) DeleteRule(srcKey, destKey string) error {
+	src, exist := t.record[srcKey]
+	if !exist {
+		return ErrSeriesNotExist
+	}
+	for i, rule := range src.rules {
+		if rule.DestKey == destKey {
+			src.rules = append(src.rules[:i], src.rules[i+1:]...)
+			if dest, ok := t.record[destKey]; ok {
+				dest.srcKey = ""
+			}
+			return nil
+		}
+	}
+	return ErrRuleNotExist
+}
+
+// Rules returns the compaction rules of the series
+func (t *TimeSeries) Rules(key string) []Rule {
+	if s, exist := t.record[key]; exist {
+		return append([]Rule(nil), s.rules...)
+	}
+	return nil
+}
+
+// Len returns the number of samples of the series
+func (t *TimeSeries) Len(key string) int {
+	if s, exist := t.record[key]; exist {
+		return s.count()
+	}
+	return 0
+}
+
+// Keys returns all keys
+func (t *TimeSeries) Keys() (keys []string) {
+	for k := range t.record {
+		keys = append(keys, k)
+	}
+	return
+}
+
+// compact 聚合源序列中起始时间为start的桶，写入目标序列
+// aggregates the bucket starting at start of the source series into the destination series
+func (t *TimeSeries) compact(src *Series, rule Rule, start int64) {
+	dest, exist := t.record[rule.DestKey]
+	if !exist {
+		return
+	}
+
+	res := aggregate(src.samples(start, start+rule.BucketDuration-1), rule.Aggregation, rule.BucketDuration)
+	for _, sample := range res {
+		latest, ok := dest.latest()
+		if ok && dest.retention > 0 && sample.Timestamp < latest.Timestamp-dest.retention {
+			continue
+		}
+		dest.add(sample)
+		if dest.retention > 0 {
+			latest, _ = dest.latest()
+			dest.trim(latest.Timestamp - dest.retention)
+		}
+	}
+}
+
+// aggregate 按桶聚合样本，样本必须按时间戳排序
+// aggregates the sorted samples in buckets
+func aggregate(samples []Sample, agg Aggregation, bucketDuration int64) []Sample {
+	if agg == AggNone || len(samples) == 0 {
+		return samples
+	}
+
+	var res []Sample
+	for i := 0; i < len(samples); {
+		start := bucketStart(samples[i].Timestamp, bucketDuration)
+		j := i
+		for j < len(samples) && samples[j].Timestamp < start+bucketDuration {
+			j++
+		}
+		res = append(res, Sample{Timestamp: start, Value: aggregateValues(samples[i:j], agg)})
+		i = j
+	}
+	return res
+}
+
+func aggregateValues(samples []Sample, agg Aggregation) float64 {
+	switch agg {
+	case AggCount:
+		return float64(len(samples))
+	case AggMin:
+		min := math.Inf(1)
+		for _, s := range samples {
+			min = math.Min(min, s.Value)
+		}
+		return min
+	case AggMax:
+		max := math.Inf(-1)
+		for _, s := range samples {
+			max = math.Max(max, s.Value)
+		}
+		return max
+	}
+
+	var sum float64
+	for _, s := range samples {
+		sum += s.Value
+	}
+	if agg == AggAvg {
+		return sum / float64(len(samples))
+	}
+	return sum
+}
+
+func bucketStart(timestamp, bucketDuration int64) int64 {
+	return timestamp - timestamp%bucketDuration
+}
+
+type matcher struct {
+	label string
+	value string
+	equal bool
+}
+
+func parseFilters(filters []string) ([]matcher, error) {
+	var res []matcher
+	hasEqual := false
+	for _, f := range filters {
+		i := strings.IndexByte(f, '=')
+		if i <= 0 {
+			return nil, ErrInvalidFilter
+		}
+
+		m := matcher{label: f[:i], value: f[i+1:], equal: true}
+		if f[i-1] == '!' {
+			m.label, m.equal = f[:i-1], false
+		}
+		if m.label == "" {
+			return nil, ErrInvalidFilter
+		}
+		if m.equal && m.value != "" {
+			hasEqual = true
+		}
+		res = append(res, m)
+	}
+	if !hasEqual {
+		return nil, ErrInvalidFilter
+	}
+	return res, nil
+}
+
+// matches 没有某个标签等价于该标签的值为空
+// a missing label is the same as the label with an empty value
+func matches(labels map[string]string, matchers []matcher) bool {
+	for _, m := range matchers {
+		if (labels[m.label] == m.value) != m.equal {
+			return false
+		}
+	}
+	return true
+}
+
+func valueOf(bits uint64) float64 {
+	return math.Float64frombits(bits)
+}
@@ -0,0 +1,251 @@
+package timeseries
+
+import (
+	"math"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func TestChunk(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	var samples []Sample
+	ts := int64(1600000000000)
+	for i := 0; i < maxChunkSamples; i++ {
+		switch i % 4 {
+		case 0:
+			ts += 1000
+		case 1:
+			ts += 1 + r.Int63n(100)
+		case 2:
+			ts += 1 + r.Int63n(5000)
+		default:
+			ts += 1 + r.Int63n(1<<40)
+		}
+		v := float64(i % 7)
+		if i%3 == 0 {
+			v = r.NormFloat64() * 1e6
+		}
+		if i == 10 {
+			v = math.Inf(-1)
+		}
+		samples = append(samples, Sample{Timestamp: ts, Value: v})
+	}
+
+	c := newChunk(samples)
+	got, err := c.samples()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, samples) {
+		t.Error("samples are not decoded correctly")
+	}
+
+	//regular samples are compressed well
+	c = &chunk{}
+	for i := 0; i < 100; i++ {
+		c.append(Sample{Timestamp: int64(i) * 1000, Value: 1})
+	}
+	if len(c.stream.data) > 64 {
+		t.Errorf("expected regular samples to be compressed, got %d bytes", len(c.stream.data))
+	}
+}
+
+func TestTimeSeries_Add(t *testing.T) {
+	ts := New()
+	if err := ts.Add("s", 1, 1); err != ErrSeriesNotExist {
+		t.Error("expected ErrSeriesNotExist, got ", err)
+	}
+	_ = ts.Create("s", 0, nil)
+	if err := ts.Create("s", 0, nil); err != ErrSeriesExists {
+		t.Error("expected ErrSeriesExists, got ", err)
+	}
+
+	//out of order samples and duplicate timestamps
+	for i := 1000; i > 0; i-- {
+		_ = ts.Add("s", int64(i*10), float64(i))
+	}
+	_ = ts.Add("s", 500, -1)
+	if ts.Len("s") != 1000 {
+		t.Errorf("expected 1000 samples, got %d", ts.Len("s"))
+	}
+
+	res, _ := ts.Range("s", 490, 520, AggNone, 0)
+	want := []Sample{{490, 49}, {500, -1}, {510, 51}, {520, 52}}
+	if !reflect.DeepEqual(res, want) {
+		t.Errorf("range got %v", res)
+	}
+	if latest, ok, _ := ts.Get("s"); !ok || latest.Timestamp != 10000 {
+		t.Errorf("get got %v", latest)
+	}
+}
+
+func TestTimeSeries_Retention(t *testing.T) {
+	ts := New()
+	_ = ts.Create("s", 100, nil)
+	for i := 0; i < 1000; i++ {
+		_ = ts.Add("s", int64(i), float64(i))
+	}
+	if ts.Len("s") != 101 {
+		t.Errorf("expected 101 samples, got %d", ts.Len("s"))
+	}
+	if err := ts.Add("s", 898, 0); err != ErrTimestampTooOld {
+		t.Error("expected ErrTimestampTooOld, got ", err)
+	}
+	if err := ts.Add("s", 899, 0); err != nil {
+		t.Error(err)
+	}
+
+	//a later sample drops the old ones
+	_ = ts.Add("s", 1050, 0)
+	if res, _ := ts.Range("s", 0, 2000, AggNone, 0); len(res) != 51 || res[0].Timestamp != 950 {
+		t.Errorf("range got %d samples", len(res))
+	}
+}
+
+func TestTimeSeries_Range(t *testing.T) {
+	ts := New()
+	_ = ts.Create("s", 0, nil)
+	for i := 0; i < 10; i++ {
+		_ = ts.Add("s", int64(i*10), float64(i))
+	}
+
+	tests := []struct {
+		agg  Aggregation
+		want []Sample
+	}{
+		{AggAvg, []Sample{{0, 1}, {30, 4}, {60, 7}, {90, 9}}},
+		{AggMin, []Sample{{0, 0}, {30, 3}, {60, 6}, {90, 9}}},
+		{AggMax, []Sample{{0, 2}, {30, 5}, {60, 8}, {90, 9}}},
+		{AggSum, []Sample{{0, 3}, {30, 12}, {60, 21}, {90, 9}}},
+		{AggCount, []Sample{{0, 3}, {30, 3}, {60, 3}, {90, 1}}},
+	}
+	for _, test := range tests {
+		if res, _ := ts.Range("s", 0, 100, test.agg, 30); !reflect.DeepEqual(res, test.want) {
+			t.Errorf("aggregation %d got %v", test.agg, res)
+		}
+	}
+	if _, err := ts.Range("s", 0, 100, AggSum, 0); err != ErrInvalidAggregation {
+		t.Error("expected ErrInvalidAggregation, got ", err)
+	}
+	if agg, err := ParseAggregation("AVG"); agg != AggAvg || err != nil {
+		t.Errorf("parse got %d, %v", agg, err)
+	}
+}
+
+func TestTimeSeries_MRange(t *testing.T) {
+	ts := New()
+	_ = ts.Create("a", 0, map[string]string{"host": "h1", "dc": "x"})
+	_ = ts.Create("b", 0, map[string]string{"host": "h2", "dc": "x"})
+	_ = ts.Create("c", 0, map[string]string{"host": "h3"})
+	for _, key := range []string{"a", "b", "c"} {
+		_ = ts.Add(key, 1, 1)
+	}
+
+	keys := func(filters ...string) []string {
+		res, err := ts.MRange(0, 10, filters, AggNone, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var keys []string
+		for _, r := range res {
+			keys = append(keys, r.Key)
+		}
+		return keys
+	}
+	if res := keys("dc=x"); !reflect.DeepEqual(res, []string{"a", "b"}) {
+		t.Errorf("dc=x got %v", res)
+	}
+	if res := keys("dc=x", "host!=h1"); !reflect.DeepEqual(res, []string{"b"}) {
+		t.Errorf("dc=x host!=h1 got %v", res)
+	}
+	if res := keys("host=h3", "dc="); !reflect.DeepEqual(res, []string{"c"}) {
+		t.Errorf("host=h3 dc= got %v", res)
+	}
+	if res := keys("host=h1", "dc!="); !reflect.DeepEqual(res, []string{"a"}) {
+		t.Errorf("host=h1 dc!= got %v", res)
+	}
+
+	for _, filters := range [][]string{nil, {"dc!=x"}, {"dc="}, {"=x"}, {"dc"}} {
+		if _, err := ts.MRange(0, 10, filters, AggNone, 0); err != ErrInvalidFilter {
+			t.Errorf("%v: expected ErrInvalidFilter, got %v", filters, err)
+		}
+	}
+}
+
+func TestTimeSeries_CreateRule(t *testing.T) {
+	ts := New()
+	for _, key := range []string{"src", "avg", "max", "other"} {
+		_ = ts.Create(key, 0, nil)
+	}
+	if err := ts.CreateRule("src", "avg", AggAvg, 10); err != nil {
+		t.Fatal(err)
+	}
+	_ = ts.CreateRule("src", "max", AggMax, 20)
+
+	for _, rule := range [][2]string{{"src", "src"}, {"other", "avg"}, {"avg", "other"}, {"other", "src"}} {
+		if err := ts.CreateRule(rule[0], rule[1], AggSum, 10); err != ErrInvalidRule {
+			t.Errorf("%v: expected ErrInvalidRule, got %v", rule, err)
+		}
+	}
+
+	for i := 0; i < 45; i++ {
+		_ = ts.Add("src", int64(i), float64(i))
+	}
+	//the buckets are written when they are closed
+	if res, _ := ts.Range("avg", 0, 100, AggNone, 0); !reflect.DeepEqual(res, []Sample{{0, 4.5}, {10, 14.5}, {20, 24.5}, {30, 34.5}}) {
+		t.Errorf("avg got %v", res)
+	}
+	if res, _ := ts.Range("max", 0, 100, AggNone, 0); !reflect.DeepEqual(res, []Sample{{0, 19}, {20, 39}}) {
+		t.Errorf("max got %v", res)
+	}
+
+	//a closed bucket is aggregated again
+	_ = ts.Add("src", 5, 100)
+	if res, _ := ts.Range("avg", 0, 0, AggNone, 0); res[0].Value != 14 {
+		t.Errorf("avg got %v", res)
+	}
+
+	if err := ts.DeleteRule("src", "avg"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ts.DeleteRule("src", "avg"); err != ErrRuleNotExist {
+		t.Error("expected ErrRuleNotExist, got ", err)
+	}
+	if err := ts.CreateRule("other", "avg", AggSum, 10); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestTimeSeries_Dump(t *testing.T) {
+	ts := New()
+	_ = ts.Create("src", 5000, map[string]string{"a": "1", "b": ""})
+	_ = ts.Create("dest", 0, nil)
+	_ = ts.CreateRule("src", "dest", AggCount, 100)
+	for i := 0; i < 2000; i++ {
+		_ = ts.Add("src", int64(i*7), float64(i%13))
+	}
+
+	other := New()
+	for _, key := range ts.Keys() {
+		if err := other.Restore(key, ts.Dump(key)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !reflect.DeepEqual(ts, other) {
+		t.Error("series are not restored correctly")
+	}
+
+	_ = ts.Add("src", 14000, 1)
+	_ = other.Add("src", 14000, 1)
+	for _, key := range ts.Keys() {
+		if string(ts.Dump(key)) != string(other.Dump(key)) {
+			t.Errorf("%s is different after adding to the restored series", key)
+		}
+	}
+
+	data := ts.Dump("src")
+	if err := other.Restore("x", data[:len(data)-1]); err == nil {
+		t.Error("expected an error for truncated data")
+	}
+}
@@ -0,0 +1,113 @@
+package vector
+
+import (
+	"encoding/binary"
+	"math"
+	"sort"
+)
+
+// EncodeMember 编码一个向量的key、向量和元数据，元数据按名称排序
+// encodes the key, the vector and the metadata of a member, the metadata is sorted by name
+func EncodeMember(key string, vec []float32, meta map[string]string) []byte {
+	var w writer
+	w.bytes([]byte(key))
+	w.uvarint(uint64(len(vec)))
+	for _, f := range vec {
+		w.uvarint(uint64(math.Float32bits(f)))
+	}
+
+	names := make([]string, 0, len(meta))
+	for name := range meta {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	w.uvarint(uint64(len(names)))
+	for _, name := range names {
+		w.bytes([]byte(name))
+		w.bytes([]byte(meta[name]))
+	}
+	return w.buf
+}
+
+// DecodeMember decodes the member encoded by EncodeMember
+func DecodeMember(data []byte) (key string, vec []float32, meta map[string]string, err error) {
+	r := reader{buf: data}
+	key = string(r.bytes())
+
+	n := r.uvarint()
+	if n > uint64(len(r.buf)) {
+		return "", nil, nil, ErrInvalidData
+	}
+	vec = make([]float32, n)
+	for i := range vec {
+		vec[i] = math.Float32frombits(uint32(r.uvarint()))
+	}
+
+	n = r.uvarint()
+	if n > uint64(len(r.buf)) {
+		return "", nil, nil, ErrInvalidData
+	}
+	if n > 0 {
+		meta = make(map[string]string, n)
+	}
+	for i := uint64(0); i < n && r.err == nil; i++ {
+		name := string(r.bytes())
+		meta[name] = string(r.bytes())
+	}
+	if r.err != nil || len(r.buf) != 0 {
+		return "", nil, nil, ErrInvalidData
+	}
+	return key, vec, meta, nil
+}
+
+type writer struct {
+	buf []byte
+}
+
+func (w *writer) uvarint(v uint64) {
+	var b [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(b[:], v)
+	w.buf = append(w.buf, b[:n]...)
+}
+
+func (w *writer) bytes(b []byte) {
+	w.uvarint(uint64(len(b)))
+	w.buf = append(w.buf, b...)
+}
+
+// reader 读取writer写入的数据，出错后后续读取均返回零值
+// reads the data written by writer, the reads after an error return zero values
+type reader struct {
+	buf []byte
+	err error
+}
+
+func (r *reader) uvarint() uint64 {
+	if r.err != nil {
+		return 0
+	}
+
+	v, n := binary.Uvarint(r.buf)
+	if n <= 0 {
+		r.err = ErrInvalidData
+		return 0
+	}
+	r.buf = r.buf[n:]
+	return v
+}
+
+func (r *reader) bytes() []byte {
+	n := r.uvarint()
+	if r.err != nil {
+		return nil
+	}
+	if uint64(len(r.buf)) < n {
+		r.err = ErrInvalidData
+		return nil
+	}
+
+	b := make([]byte, n)
+	copy(b, r.buf)
+	r.buf = r.buf[n:]
+	return b
+}
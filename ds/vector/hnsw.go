@@ -0,0 +1,309 @@
+package vector
+
+import (
+	"container/heap"
+	"hash/fnv"
+	"math"
+	"sort"
+)
+
+// HNSW 的参数，详细可参考 https://arxiv.org/abs/1603.09320
+// the parameters of HNSW
+const (
+	// hnswM the max number of links of a node in the upper levels, 2*hnswM in level 0
+	hnswM = 16
+
+	// efConstruction the number of candidates when inserting a node
+	efConstruction = 200
+
+	// efSearch the min number of candidates when searching
+	efSearch = 64
+
+	maxLevel = 16
+)
+
+type (
+	// Index 一个向量索引，删除和替换的向量在图中被标记删除，被删除的过多时重建图
+	// an index of vectors, the deleted and replaced vectors are marked in the graph,
+	// and the graph is built again when too many of them are deleted
+	Index struct {
+		dim    int
+		metric Metric
+		keys   map[string]int // key -> id of the node
+
+		nodes    []*node
+		entry    int // -1 if the graph is empty
+		level    int // the level of the entry
+		nDeleted int
+	}
+
+	node struct {
+		key     string
+		vector  []float32
+		norm    float32
+		meta    map[string]string
+		links   [][]int // the neighbors in each level
+		deleted bool
+	}
+
+	candidate struct {
+		id   int
+		dist float32
+	}
+)
+
+func newIndex(dim int, metric Metric) *Index {
+	return &Index{dim: dim, metric: metric, keys: make(map[string]int), entry: -1}
+}
+
+func (x *Index) add(key string, vec []float32, meta map[string]string) {
+	x.del(key)
+
+	n := &node{key: key, vector: append([]float32(nil), vec...), norm: norm(vec), meta: copyMeta(meta)}
+	n.links = make([][]int, randomLevel(key)+1)
+	x.nodes = append(x.nodes, n)
+	x.keys[key] = len(x.nodes) - 1
+	x.insert(len(x.nodes) - 1)
+}
+
+func (x *Index) del(key string) bool {
+	id, ok := x.keys[key]
+	if !ok {
+		return false
+	}
+	delete(x.keys, key)
+	x.nodes[id].deleted = true
+	x.nDeleted++
+
+	if x.nDeleted > len(x.keys) {
+		x.rebuild()
+	}
+	return true
+}
+
+// rebuild 只用未删除的向量重新建立图，向量的顺序不变
+// builds the graph again with the vectors not deleted, in the same order
+func (x *Index) rebuild() {
+	nodes := x.nodes
+	x.nodes, x.entry, x.level, x.nDeleted = nil, -1, 0, 0
+	for _, n := range nodes {
+		if n.deleted {
+			continue
+		}
+		n.links = make([][]int, len(n.links))
+		x.nodes = append(x.nodes, n)
+		x.keys[n.key] = len(x.nodes) - 1
+		x.insert(len(x.nodes) - 1)
+	}
+}
+
+func (x *Index) insert(id int) {
+	n := x.nodes[id]
+	level := len(n.links) - 1
+	if x.entry < 0 {
+		x.entry, x.level = id, level
+		return
+	}
+
+	eps := []candidate{{id: x.entry, dist: x.distance(n.vector, n.norm, x.nodes[x.entry])}}
+	for l := x.level; l > level; l-- {
+		eps = x.searchLayer(n.vector, n.norm, eps, 1, l)[:1]
+	}
+	for l := minInt(level, x.level); l >= 0; l-- {
+		w := x.searchLayer(n.vector, n.norm, eps, efConstruction, l)
+		maxLinks := hnswM
+		if l == 0 {
+			maxLinks = 2 * hnswM
+		}
+		for i := 0; i < len(w) && i < hnswM; i++ {
+			n.links[l] = append(n.links[l], w[i].id)
+			x.link(w[i].id, id, l, maxLinks)
+		}
+		eps = w
+	}
+
+	if level > x.level {
+		x.entry, x.level = id, level
+	}
+}
+
+// link 添加从a到b的连接，超过上限时只保留最近的
+// adds the link from a to b, only the nearest ones are kept if there are too many links
+func (x *Index) link(a, b, level, maxLinks int) {
+	n := x.nodes[a]
+	n.links[level] = append(n.links[level], b)
+	if len(n.links[level]) <= maxLinks {
+		return
+	}
+
+	cands := make([]candidate, len(n.links[level]))
+	for i, id := range n.links[level] {
+		cands[i] = candidate{id: id, dist: x.distance(n.vector, n.norm, x.nodes[id])}
+	}
+	sort.Slice(cands, func(i, j int) bool { return cands[i].less(cands[j]) })
+	n.links[level] = n.links[level][:0]
+	for _, c := range cands[:maxLinks] {
+		n.links[level] = append(n.links[level], c.id)
+	}
+}
+
+// searchLayer 在一层中从eps出发查找最近的ef个节点，按距离从小到大返回
+// finds the ef nearest nodes in a level starting from eps, ordered by distance from the smallest
+func (x *Index) searchLayer(query []float32, qnorm float32, eps []candidate, ef, level int) []candidate {
+	visited := make(map[int]bool, ef*4)
+	cands, res := &minHeap{}, &maxHeap{}
+	for _, ep := range eps {
+		visited[ep.id] = true
+		heap.Push(cands, ep)
+		heap.Push(res, ep)
+	}
+	for res.Len() > ef {
+		heap.Pop(res)
+	}
+
+	for cands.Len() > 0 {
+		c := heap.Pop(cands).(candidate)
+		if res.Len() >= ef && (*res)[0].less(c) {
+			break
+		}
+		for _, id := range x.nodes[c.id].links[level] {
+			if visited[id] {
+				continue
+			}
+			visited[id] = true
+
+			nc := candidate{id: id, dist: x.distance(query, qnorm, x.nodes[id])}
+			if res.Len() < ef || nc.less((*res)[0]) {
+				heap.Push(cands, nc)
+				heap.Push(res, nc)
+				if res.Len() > ef {
+					heap.Pop(res)
+				}
+			}
+		}
+	}
+
+	out := make([]candidate, res.Len())
+	for i := len(out) - 1; i >= 0; i-- {
+		out[i] = heap.Pop(res).(candidate)
+	}
+	return out
+}
+
+// searchGraph 在图中查找最近的k个未删除且匹配filter的节点
+// finds the k nearest nodes not deleted and matching the filter in the graph
+func (x *Index) searchGraph(query []float32, k int, filter map[string]string) []candidate {
+	if x.entry < 0 {
+		return nil
+	}
+
+	qnorm := norm(query)
+	eps := []candidate{{id: x.entry, dist: x.distance(query, qnorm, x.nodes[x.entry])}}
+	for l := x.level; l > 0; l-- {
+		eps = x.searchLayer(query, qnorm, eps, 1, l)[:1]
+	}
+
+	ef := maxInt(efSearch, k)
+	if len(filter) > 0 {
+		ef = maxInt(ef, 4*k)
+	}
+	var res []candidate
+	for _, c := range x.searchLayer(query, qnorm, eps, ef, 0) {
+		n := x.nodes[c.id]
+		if !n.deleted && matches(n.meta, filter) {
+			res = append(res, c)
+			if len(res) == k {
+				break
+			}
+		}
+	}
+	return res
+}
+
+func (x *Index) distance(query []float32, qnorm float32, n *node) float32 {
+	switch x.metric {
+	case L2:
+		var sum float32
+		for i, f := range query {
+			d := f - n.vector[i]
+			sum += d * d
+		}
+		return float32(math.Sqrt(float64(sum)))
+	case InnerProduct:
+		return -dot(query, n.vector)
+	}
+	return 1 - dot(query, n.vector)/(qnorm*n.norm)
+}
+
+func dot(a, b []float32) float32 {
+	var sum float32
+	for i, f := range a {
+		sum += f * b[i]
+	}
+	return sum
+}
+
+// randomLevel 由key的哈希值决定节点的层数，重放日志时得到相同的图
+// the level of a node is decided by the hash of the key, so that replaying the log builds the same graph
+func randomLevel(key string) int {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(key))
+	sum := h.Sum64()
+	sum ^= sum >> 33
+	sum *= 0xff51afd7ed558ccd
+	sum ^= sum >> 33
+
+	u := (float64(sum>>11) + 1) / (1 << 53)
+	level := int(-math.Log(u) / math.Log(hnswM))
+	if level > maxLevel {
+		level = maxLevel
+	}
+	return level
+}
+
+func (c candidate) less(o candidate) bool {
+	if c.dist != o.dist {
+		return c.dist < o.dist
+	}
+	return c.id < o.id
+}
+
+type minHeap []candidate
+
+func (h minHeap) Len() int            { return len(h) }
+func (h minHeap) Less(i, j int) bool  { return h[i].less(h[j]) }
+func (h minHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *minHeap) Push(x interface{}) { *h = append(*h, x.(candidate)) }
+func (h *minHeap) Pop() interface{} {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+type maxHeap []candidate
+
+func (h maxHeap) Len() int            { return len(h) }
+func (h maxHeap) Less(i, j int) bool  { return h[j].less(h[i]) }
+func (h maxHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *maxHeap) Push(x interface{}) { *h = append(*h, x.(candidate)) }
+func (h *maxHeap) Pop() interface{} {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,271 @@
+package vector
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"strings"
+)
+
+// 向量相似度搜索：每个索引保存固定维度的float32向量和元数据，按余弦、欧氏距离或内积查询最近的k个向量
+// 向量较少时遍历所有向量，较多时使用 HNSW 图做近似搜索
+// Vector similarity search: an index keeps float32 vectors of a fixed dimension with metadata,
+// and finds the k nearest vectors by cosine, L2 or inner product.
+// Small indexes are searched by brute force, and large ones by the HNSW graph approximately.
+
+var (
+	// ErrInvalidParams the dimension or the metric is invalid
+	ErrInvalidParams = errors.New("ds/vector: invalid index parameters")
+
+	// ErrIndexExists the index already exists
+	ErrIndexExists = errors.New("ds/vector: index already exists")
+
+	// ErrIndexNotExist the index does not exist
+	ErrIndexNotExist = errors.New("ds/vector: index does not exist")
+
+	// ErrDimensionMismatch the dimension of the vector is not the one of the index
+	ErrDimensionMismatch = errors.New("ds/vector: vector dimension mismatch")
+
+	// ErrInvalidVector the vector contains NaN or Inf, or is a zero vector of a cosine index
+	ErrInvalidVector = errors.New("ds/vector: invalid vector")
+
+	// ErrInvalidData the encoded vector is invalid
+	ErrInvalidData = errors.New("ds/vector: invalid vector data")
+)
+
+// Metric the distance metric of an index
+type Metric uint8
+
+// metrics
+const (
+	// Cosine the distance is 1 - cosine similarity
+	Cosine Metric = iota + 1
+	// L2 the euclidean distance
+	L2
+	// InnerProduct the distance is the negative inner product
+	InnerProduct
+)
+
+var metricNames = map[string]Metric{
+	"cosine": Cosine,
+	"l2":     L2,
+	"ip":     InnerProduct,
+}
+
+// BruteForceThreshold 向量个数不超过此值时遍历所有向量，结果是精确的
+// the indexes with no more vectors than this are searched by brute force, the results are exact
+const BruteForceThreshold = 1024
+
+type (
+	Record map[string]*Index
+
+	// Vectors vector indexes struct
+	Vectors struct {
+		record Record
+	}
+
+	// Result a vector found by Search
+	Result struct {
+		Key      string
+		Distance float32
+		Meta     map[string]string
+	}
+)
+
+// New new vector indexes
+func New() *Vectors {
+	return &Vectors{make(Record)}
+}
+
+// ParseMetric parses cosine, l2 and ip
+func ParseMetric(name string) (Metric, error) {
+	if m, ok := metricNames[strings.ToLower(name)]; ok {
+		return m, nil
+	}
+	return 0, ErrInvalidParams
+}
+
+// Create creates an index of vectors with dim dimensions
+func (v *Vectors) Create(name string, dim int, metric Metric) error {
+	if dim <= 0 || metric < Cosine || metric > InnerProduct {
+		return ErrInvalidParams
+	}
+	if _, exist := v.record[name]; exist {
+		return ErrIndexExists
+	}
+	v.record[name] = newIndex(dim, metric)
+	return nil
+}
+
+// Exists whether the index exists
+func (v *Vectors) Exists(name string) bool {
+	_, exist := v.record[name]
+	return exist
+}
+
+// Info returns the dimension and the metric of the index
+func (v *Vectors) Info(name string) (dim int, metric Metric, ok bool) {
+	x, exist := v.record[name]
+	if !exist {
+		return 0, 0, false
+	}
+	return x.dim, x.metric, true
+}
+
+// CheckVector 检查向量能否添加到索引中或用于查询
+// checks whether the vector can be added to the index or used as a query
+func (v *Vectors) CheckVector(name string, vec []float32) error {
+	x, exist := v.record[name]
+	if !exist {
+		return ErrIndexNotExist
+	}
+	if len(vec) != x.dim {
+		return ErrDimensionMismatch
+	}
+	for _, f := range vec {
+		if math.IsNaN(float64(f)) || math.IsInf(float64(f), 0) {
+			return ErrInvalidVector
+		}
+	}
+	if x.metric == Cosine && norm(vec) == 0 {
+		return ErrInvalidVector
+	}
+	return nil
+}
+
+// Add 添加或替换key的向量和元数据
+// adds or replaces the vector and metadata of key
+func (v *Vectors) Add(name, key string, vec []float32, meta map[string]string) error {
+	if err := v.CheckVector(name, vec); err != nil {
+		return err
+	}
+	v.record[name].add(key, vec, meta)
+	return nil
+}
+
+// Del deletes the vector of key, returns whether it existed
+func (v *Vectors) Del(name, key string) (bool, error) {
+	x, exist := v.record[name]
+	if !exist {
+		return false, ErrIndexNotExist
+	}
+	return x.del(key), nil
+}
+
+// Get returns a copy of the vector and metadata of key
+func (v *Vectors) Get(name, key string) ([]float32, map[string]string, bool) {
+	x, exist := v.record[name]
+	if !exist {
+		return nil, nil, false
+	}
+	id, ok := x.keys[key]
+	if !ok {
+		return nil, nil, false
+	}
+	n := x.nodes[id]
+	return append([]float32(nil), n.vector...), copyMeta(n.meta), true
+}
+
+// Card returns the number of vectors in the index
+func (v *Vectors) Card(name string) int {
+	if x, exist := v.record[name]; exist {
+		return len(x.keys)
+	}
+	return 0
+}
+
+// Members 按添加的顺序返回索引中的key
+// returns the keys in the index in the order they were added
+func (v *Vectors) Members(name string) []string {
+	x, exist := v.record[name]
+	if !exist {
+		return nil
+	}
+	keys := make([]string, 0, len(x.keys))
+	for _, n := range x.nodes {
+		if !n.deleted {
+			keys = append(keys, n.key)
+		}
+	}
+	return keys
+}
+
+// Search 返回与query最近的k个向量，按距离从小到大排列，filter 不为空时只返回元数据与之匹配的向量
+// returns the k nearest vectors to the query, ordered by distance from the smallest.
+// Only the vectors whose metadata contains all pairs of filter are returned if it is not empty.
+func (v *Vectors) Search(name string, query []float32, k int, filter map[string]string) ([]Result, error) {
+	if err := v.CheckVector(name, query); err != nil {
+		return nil, err
+	}
+	if k <= 0 {
+		return nil, nil
+	}
+
+	x := v.record[name]
+	var found []candidate
+	if len(x.keys) > BruteForceThreshold {
+		found = x.searchGraph(query, k, filter)
+	}
+	//the graph may not find enough vectors matching the filter
+	if len(found) < k && len(found) < len(x.keys) {
+		found = x.bruteForce(query, k, filter)
+	}
+
+	res := make([]Result, len(found))
+	for i, c := range found {
+		n := x.nodes[c.id]
+		res[i] = Result{Key: n.key, Distance: c.dist, Meta: copyMeta(n.meta)}
+	}
+	return res, nil
+}
+
+// Keys returns all index names
+func (v *Vectors) Keys() (keys []string) {
+	for k := range v.record {
+		keys = append(keys, k)
+	}
+	return
+}
+
+func (x *Index) bruteForce(query []float32, k int, filter map[string]string) []candidate {
+	qnorm := norm(query)
+	var res []candidate
+	for id, n := range x.nodes {
+		if !n.deleted && matches(n.meta, filter) {
+			res = append(res, candidate{id: id, dist: x.distance(query, qnorm, n)})
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].less(res[j]) })
+	if len(res) > k {
+		res = res[:k]
+	}
+	return res
+}
+
+func matches(meta, filter map[string]string) bool {
+	for k, v := range filter {
+		if mv, ok := meta[k]; !ok || mv != v {
+			return false
+		}
+	}
+	return true
+}
+
+func copyMeta(meta map[string]string) map[string]string {
+	if meta == nil {
+		return nil
+	}
+	cp := make(map[string]string, len(meta))
+	for k, v := range meta {
+		cp[k] = v
+	}
+	return cp
+}
+
+func norm(vec []float32) float32 {
+	var sum float32
+	for _, f := range vec {
+		sum += f * f
+	}
+	return float32(math.Sqrt(float64(sum)))
+}
@@ -0,0 +1,203 @@
+package vector
+
+import (
+	"math/rand"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func randomVector(r *rand.Rand, dim int) []float32 {
+	vec := make([]float32, dim)
+	for i := range vec {
+		vec[i] = float32(r.NormFloat64())
+	}
+	return vec
+}
+
+func TestVectors_Create(t *testing.T) {
+	v := New()
+	if err := v.Create("idx", 0, Cosine); err != ErrInvalidParams {
+		t.Error("expected ErrInvalidParams, got ", err)
+	}
+	if err := v.Create("idx", 3, Metric(9)); err != ErrInvalidParams {
+		t.Error("expected ErrInvalidParams, got ", err)
+	}
+	_ = v.Create("idx", 3, Cosine)
+	if err := v.Create("idx", 3, L2); err != ErrIndexExists {
+		t.Error("expected ErrIndexExists, got ", err)
+	}
+	if m, err := ParseMetric("IP"); m != InnerProduct || err != nil {
+		t.Errorf("parse got %d, %v", m, err)
+	}
+
+	if err := v.Add("missing", "a", []float32{1, 2, 3}, nil); err != ErrIndexNotExist {
+		t.Error("expected ErrIndexNotExist, got ", err)
+	}
+	if err := v.Add("idx", "a", []float32{1, 2}, nil); err != ErrDimensionMismatch {
+		t.Error("expected ErrDimensionMismatch, got ", err)
+	}
+	if err := v.Add("idx", "a", []float32{0, 0, 0}, nil); err != ErrInvalidVector {
+		t.Error("expected ErrInvalidVector for a zero vector, got ", err)
+	}
+}
+
+func TestVectors_Metrics(t *testing.T) {
+	vectors := map[string][]float32{
+		"x":  {1, 0},
+		"y":  {0, 1},
+		"2x": {2, 0},
+		"xy": {1, 1},
+	}
+	tests := []struct {
+		metric Metric
+		want   []string
+	}{
+		{Cosine, []string{"x", "2x", "xy", "y"}},
+		{L2, []string{"x", "2x", "xy", "y"}},
+		{InnerProduct, []string{"2x", "x", "xy", "y"}},
+	}
+
+	for _, test := range tests {
+		v := New()
+		_ = v.Create("idx", 2, test.metric)
+		for _, key := range []string{"x", "y", "2x", "xy"} {
+			_ = v.Add("idx", key, vectors[key], nil)
+		}
+
+		res, err := v.Search("idx", []float32{1, 0}, 4, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var keys []string
+		for _, r := range res {
+			keys = append(keys, r.Key)
+		}
+		if !reflect.DeepEqual(keys, test.want) {
+			t.Errorf("metric %d got %v", test.metric, keys)
+		}
+	}
+}
+
+func TestVectors_Add(t *testing.T) {
+	v := New()
+	_ = v.Create("idx", 2, L2)
+	_ = v.Add("idx", "a", []float32{1, 1}, map[string]string{"color": "red"})
+	_ = v.Add("idx", "b", []float32{2, 2}, nil)
+
+	//replace a, which moves to the end
+	_ = v.Add("idx", "a", []float32{3, 3}, map[string]string{"color": "blue"})
+	if vec, meta, ok := v.Get("idx", "a"); !ok || !reflect.DeepEqual(vec, []float32{3, 3}) || meta["color"] != "blue" {
+		t.Errorf("get got %v, %v", vec, meta)
+	}
+	if !reflect.DeepEqual(v.Members("idx"), []string{"b", "a"}) || v.Card("idx") != 2 {
+		t.Errorf("members got %v", v.Members("idx"))
+	}
+
+	if ok, _ := v.Del("idx", "b"); !ok {
+		t.Error("expected b to be deleted")
+	}
+	if ok, _ := v.Del("idx", "b"); ok {
+		t.Error("b is deleted twice")
+	}
+	res, _ := v.Search("idx", []float32{0, 0}, 10, nil)
+	if len(res) != 1 || res[0].Key != "a" || res[0].Distance != float32(3*1.4142135) {
+		t.Errorf("search got %v", res)
+	}
+}
+
+func TestVectors_Filter(t *testing.T) {
+	v := New()
+	_ = v.Create("idx", 4, Cosine)
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 2000; i++ {
+		meta := map[string]string{"mod": strconv.Itoa(i % 100)}
+		_ = v.Add("idx", strconv.Itoa(i), randomVector(r, 4), meta)
+	}
+
+	//the few matching vectors are found even if the graph misses them
+	res, _ := v.Search("idx", randomVector(r, 4), 30, map[string]string{"mod": "7"})
+	if len(res) != 20 {
+		t.Errorf("expected 20 results, got %d", len(res))
+	}
+	for _, item := range res {
+		if item.Meta["mod"] != "7" {
+			t.Errorf("%s does not match the filter", item.Key)
+		}
+	}
+}
+
+func TestVectors_HNSW(t *testing.T) {
+	const dim, n, k = 16, 5000, 10
+	r := rand.New(rand.NewSource(1))
+	v := New()
+	_ = v.Create("idx", dim, L2)
+	for i := 0; i < n; i++ {
+		_ = v.Add("idx", strconv.Itoa(i), randomVector(r, dim), nil)
+	}
+	//delete some vectors, which are never returned
+	for i := 0; i < n; i += 3 {
+		_, _ = v.Del("idx", strconv.Itoa(i))
+	}
+
+	x := v.record["idx"]
+	found, total := 0, 0
+	for q := 0; q < 50; q++ {
+		query := randomVector(r, dim)
+		exact := x.bruteForce(query, k, nil)
+		res, _ := v.Search("idx", query, k, nil)
+		if len(res) != k {
+			t.Fatalf("expected %d results, got %d", k, len(res))
+		}
+
+		want := make(map[string]bool)
+		for _, c := range exact {
+			want[x.nodes[c.id].key] = true
+		}
+		for _, item := range res {
+			if id, _ := strconv.Atoi(item.Key); id%3 == 0 {
+				t.Errorf("deleted vector %s is returned", item.Key)
+			}
+			if want[item.Key] {
+				found++
+			}
+		}
+		total += k
+	}
+	if recall := float64(found) / float64(total); recall < 0.9 {
+		t.Errorf("recall %.2f is too low", recall)
+	}
+}
+
+func TestVectors_Rebuild(t *testing.T) {
+	v := New()
+	_ = v.Create("idx", 2, L2)
+	for i := 0; i < 100; i++ {
+		_ = v.Add("idx", strconv.Itoa(i), []float32{float32(i), 0}, nil)
+	}
+	for i := 0; i < 60; i++ {
+		_, _ = v.Del("idx", strconv.Itoa(i))
+	}
+
+	x := v.record["idx"]
+	if len(x.nodes) != 40+9 || x.nDeleted != 9 {
+		t.Errorf("expected the graph to be built again, got %d nodes, %d deleted", len(x.nodes), x.nDeleted)
+	}
+	if res, _ := v.Search("idx", []float32{0, 0}, 1, nil); res[0].Key != "60" {
+		t.Errorf("search got %v", res)
+	}
+}
+
+func TestEncodeMember(t *testing.T) {
+	vec := []float32{1.5, -2, 0}
+	meta := map[string]string{"a": "1", "b": ""}
+	key, gotVec, gotMeta, err := DecodeMember(EncodeMember("k", vec, meta))
+	if err != nil || key != "k" || !reflect.DeepEqual(gotVec, vec) || !reflect.DeepEqual(gotMeta, meta) {
+		t.Errorf("decode got %s, %v, %v, %v", key, gotVec, gotMeta, err)
+	}
+
+	data := EncodeMember("k", vec, nil)
+	if _, _, _, err := DecodeMember(data[:len(data)-1]); err != ErrInvalidData {
+		t.Error("expected ErrInvalidData, got ", err)
+	}
+}
@@ -0,0 +1,36 @@
+package zset
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// ErrInvalidMembers the encoded members are invalid
+var ErrInvalidMembers = errors.New("ds/zset: invalid encoded members")
+
+// EncodeMembers 编码一组成员，每个成员以其长度开头
+// encodes the members, each one is prefixed by its length
+func EncodeMembers(members []string) []byte {
+	var buf []byte
+	lenBuf := make([]byte, binary.MaxVarintLen64)
+	for _, m := range members {
+		n := binary.PutUvarint(lenBuf, uint64(len(m)))
+		buf = append(buf, lenBuf[:n]...)
+		buf = append(buf, m...)
+	}
+	return buf
+}
+
+// DecodeMembers decodes the members encoded by EncodeMembers
+func DecodeMembers(buf []byte) ([]string, error) {
+	var members []string
+	for len(buf) > 0 {
+		size, n := binary.Uvarint(buf)
+		if n <= 0 || uint64(len(buf)-n) < size {
+			return nil, ErrInvalidMembers
+		}
+		members = append(members, string(buf[n:n+int(size)]))
+		buf = buf[n+int(size):]
+	}
+	return members, nil
+}
@@ -0,0 +1,233 @@
+package zset
+
+import (
+	"encoding/binary"
+	"github.com/KarlvenK/kDB/ds/listpack"
+	"math"
+)
+
+// encodings of a sorted set
+const (
+	EncodingListpack = "listpack"
+	EncodingSkiplist = "skiplist"
+)
+
+// 有序集成员较少且较短时，成员和分值按 score 值递增、相同时按成员的字典序交替编码在 listpack 中，
+// 超过上限后转换为 dict 和跳表，不再转换回来。下面的方法屏蔽了两种编码的差异
+// While a sorted set has few and short members, the members and scores are packed in turn in a listpack,
+// ordered by score and by member for the same score. It is converted to the dict and the skip list once
+// the limits are exceeded, never back. The methods below hide the difference of the two encodings.
+
+func (n *SortedSetNode) packed() bool {
+	return n.dict == nil
+}
+
+func (n *SortedSetNode) encoding() string {
+	if n.packed() {
+		return EncodingListpack
+	}
+	return EncodingSkiplist
+}
+
+func (n *SortedSetNode) card() int64 {
+	if n.packed() {
+		return int64(n.lp.Len() / 2)
+	}
+	return n.skl.length
+}
+
+func (n *SortedSetNode) score(member string) (float64, bool) {
+	if !n.packed() {
+		node, exist := n.dict[member]
+		if !exist {
+			return 0, false
+		}
+		return node.score, true
+	}
+
+	if i := n.lp.Find(member, 0, 2); i >= 0 {
+		return decodeScore(n.lp.Get(i + 1)), true
+	}
+	return 0, false
+}
+
+// add adds the member or updates its score
+func (n *SortedSetNode) add(score float64, member string, limits listpack.Limits) {
+	if n.packed() {
+		if i := n.lp.Find(member, 0, 2); i >= 0 {
+			if decodeScore(n.lp.Get(i+1)) == score {
+				return
+			}
+			n.lp.Remove(i, 2)
+		}
+		if limits.Fits(int(n.card())+1, len(member)) {
+			pos := 0
+			n.pairs(func(i int, m string, s float64) bool {
+				if s > score || (s == score && m > member) {
+					return false
+				}
+				pos = i + 1
+				return true
+			})
+			n.lp.Insert(pos*2, []byte(member), encodeScore(score))
+			return
+		}
+		n.convert()
+	}
+
+	v, exist := n.dict[member]
+	var node *sklNode
+	if exist {
+		if score != v.score {
+			n.skl.sklDelete(v.score, member)
+			node = n.skl.sklInsert(score, member)
+		}
+	} else {
+		node = n.skl.sklInsert(score, member)
+	}
+
+	if node != nil {
+		n.dict[member] = node
+	}
+}
+
+func (n *SortedSetNode) remove(member string) bool {
+	if n.packed() {
+		if i := n.lp.Find(member, 0, 2); i >= 0 {
+			n.lp.Remove(i, 2)
+			return true
+		}
+		return false
+	}
+
+	v, exist := n.dict[member]
+	if exist {
+		n.skl.sklDelete(v.score, member)
+		delete(n.dict, member)
+	}
+	return exist
+}
+
+// rank returns the 0-based rank of the member ordered by score
+func (n *SortedSetNode) rank(member string) (int64, bool) {
+	if n.packed() {
+		i := n.lp.Find(member, 0, 2)
+		return int64(i / 2), i >= 0
+	}
+
+	v, exist := n.dict[member]
+	if !exist {
+		return 0, false
+	}
+	return n.skl.sklGetRank(v.score, member) - 1, true
+}
+
+// count 返回从最低分开始满足 fn 的成员个数，fn 需只对开头的一段成员为 true
+// returns the number of members from the lowest score satisfying fn, fn must be true for a prefix of the members only
+func (n *SortedSetNode) count(fn func(score float64, member string) bool) int64 {
+	if !n.packed() {
+		return int64(n.skl.sklCount(func(p *sklNode) bool { return fn(p.score, p.member) }))
+	}
+
+	var c int64
+	n.pairs(func(_ int, m string, s float64) bool {
+		if !fn(s, m) {
+			return false
+		}
+		c++
+		return true
+	})
+	return c
+}
+
+// elements 返回排名介于 start 和 stop 之间的成员，reverse 为 true 时排名从最高分开始计数，要求 0 <= start <= stop < card
+// returns the members with ranks between start and stop, which count from the highest score if reverse is true.
+// It requires 0 <= start <= stop < card.
+func (n *SortedSetNode) elements(start, stop int64, reverse bool) []Element {
+	val := make([]Element, 0, stop-start+1)
+	if n.packed() {
+		var all []Element
+		n.pairs(func(_ int, m string, s float64) bool {
+			all = append(all, Element{Member: m, Score: s})
+			return true
+		})
+		for r := start; r <= stop; r++ {
+			if reverse {
+				val = append(val, all[int64(len(all))-1-r])
+			} else {
+				val = append(val, all[r])
+			}
+		}
+		return val
+	}
+
+	skl := n.skl
+	var node *sklNode
+	if reverse {
+		node = skl.tail
+		if start > 0 {
+			node = skl.sklGetElementByRank(uint64(skl.length - start))
+		}
+	} else {
+		node = skl.head.level[0].forward
+		if start > 0 {
+			node = skl.sklGetElementByRank(uint64(start + 1))
+		}
+	}
+
+	for span := stop - start + 1; span > 0; span-- {
+		val = append(val, Element{Member: node.member, Score: node.score})
+		if reverse {
+			node = node.backward
+		} else {
+			node = node.level[0].forward
+		}
+	}
+	return val
+}
+
+// each calls fn on the members and their scores
+func (n *SortedSetNode) each(fn func(member string, score float64)) {
+	if !n.packed() {
+		for member, node := range n.dict {
+			fn(member, node.score)
+		}
+		return
+	}
+	n.pairs(func(_ int, m string, s float64) bool {
+		fn(m, s)
+		return true
+	})
+}
+
+// pairs calls fn on the i-th packed member and its score in order until fn returns false
+func (n *SortedSetNode) pairs(fn func(i int, member string, score float64) bool) {
+	var member string
+	n.lp.Iterate(func(i int, val []byte) bool {
+		if i%2 == 0 {
+			member = string(val)
+			return true
+		}
+		return fn(i/2, member, decodeScore(val))
+	})
+}
+
+// convert moves the packed members to the dict and the skip list
+func (n *SortedSetNode) convert() {
+	dict, skl := make(map[string]*sklNode, n.card()+1), newSkipList()
+	n.pairs(func(_ int, m string, s float64) bool {
+		dict[m] = skl.sklInsert(s, m)
+		return true
+	})
+	n.dict, n.skl, n.lp = dict, skl, listpack.Listpack{}
+}
+
+func encodeScore(score float64) []byte {
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, math.Float64bits(score))
+	return buf
+}
+
+func decodeScore(buf []byte) float64 {
+	return math.Float64frombits(binary.BigEndian.Uint64(buf))
+}
@@ -2,8 +2,13 @@ package zset
 
 // to be reconstructed
 import (
+	"errors"
+	"github.com/KarlvenK/kDB/ds/listpack"
 	"math"
 	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
 )
 
 /*
@@ -17,16 +22,62 @@ const (
 	probability = 0.25
 )
 
+// ErrInvalidScoreBound the score bound is not a float, optionally started with (
+var ErrInvalidScoreBound = errors.New("ds/zset: invalid score bound")
+
+// ErrInvalidLexRange the lex range is not -, +, or started with [ or (
+var ErrInvalidLexRange = errors.New("ds/zset: invalid lex range")
+
+// Aggregate 并集和交集中同一成员的分值的聚合方式
+// the way to aggregate the scores of a member in the union and intersection
+type Aggregate uint8
+
+// aggregates
+const (
+	AggregateSum Aggregate = iota
+	AggregateMin
+	AggregateMax
+)
+
+var aggregateNames = map[string]Aggregate{
+	"sum": AggregateSum,
+	"min": AggregateMin,
+	"max": AggregateMax,
+}
+
 type (
+	// Element 有序集的一个成员及其分值
+	// a member of a sorted set with its score
+	Element struct {
+		Member string
+		Score  float64
+	}
+
+	// ScoreBound 分值范围的一端，Exclusive 为 true 时不包含 Value
+	// an end of a score range, Value is excluded if Exclusive is true
+	ScoreBound struct {
+		Value     float64
+		Exclusive bool
+	}
+
+	// Limit 跳过前 Offset 个成员，最多返回 Count 个，Count 不大于0时不限制个数
+	// skips Offset members and returns at most Count members, there is no limit if Count is not positive
+	Limit struct {
+		Offset int
+		Count  int
+	}
+
 	// SortedSet sorted set struct
 	SortedSet struct {
 		record map[string]*SortedSetNode
+		limits listpack.Limits // the limits of the compact encoding
 	}
 
 	// SortedSetNode node of sorted set
 	SortedSetNode struct {
-		dict map[string]*sklNode
+		dict map[string]*sklNode // nil while the members are packed in lp
 		skl  *skipList
+		lp   listpack.Listpack // members and scores in turn, ordered by score and member
 	}
 
 	sklLevel struct {
@@ -53,36 +104,32 @@ type (
 func New() *SortedSet {
 	return &SortedSet{
 		make(map[string]*SortedSetNode),
+		listpack.DefaultLimits,
 	}
 }
 
-// ZAdd 将 member 元素及其 score 值加入到有序集 key 当中
-func (z *SortedSet) ZAdd(key string, score float64, member string) {
-	if !z.exist(key) {
+// SetLimits 设置有序集使用紧凑编码的上限，只影响之后写入的有序集
+// sets the limits of the compact encoding, which only affects the sorted sets written afterwards
+func (z *SortedSet) SetLimits(limits listpack.Limits) {
+	z.limits = limits
+}
 
-		node := &SortedSetNode{
-			dict: make(map[string]*sklNode),
-			skl:  newSkipList(),
-		}
-		z.record[key] = node
+// Encoding 返回有序集 key 的编码，listpack 或 skiplist，不存在时返回空字符串
+// returns the encoding of the sorted set, listpack or skiplist, an empty string if it does not exist
+func (z *SortedSet) Encoding(key string) string {
+	if !z.exist(key) {
+		return ""
 	}
+	return z.record[key].encoding()
+}
 
-	item := z.record[key]
-	v, exist := item.dict[member]
-
-	var node *sklNode
-	if exist {
-		if score != v.score {
-			item.skl.sklDelete(v.score, member)
-			node = item.skl.sklInsert(score, member)
-		}
-	} else {
-		node = item.skl.sklInsert(score, member)
+// ZAdd 将 member 元素及其 score 值加入到有序集 key 当中
+func (z *SortedSet) ZAdd(key string, score float64, member string) {
+	if !z.exist(key) {
+		z.record[key] = &SortedSetNode{}
 	}
 
-	if node != nil {
-		item.dict[member] = node
-	}
+	z.record[key].add(score, member, z.limits)
 }
 
 // ZScore 返回集合key中对应member的score值，如果不存在则返回负无穷
@@ -91,12 +138,22 @@ func (z *SortedSet) ZScore(key string, member string) float64 {
 		return math.MinInt64
 	}
 
-	node, exist := z.record[key].dict[member]
+	score, exist := z.record[key].score(member)
 	if !exist {
 		return math.MinInt64
 	}
 
-	return node.score
+	return score
+}
+
+// ZIsMember 判断 member 是否为有序集 key 的成员
+// returns whether member is a member of the sorted set
+func (z *SortedSet) ZIsMember(key, member string) bool {
+	if !z.exist(key) {
+		return false
+	}
+	_, exist := z.record[key].score(member)
+	return exist
 }
 
 // ZCard 返回指定集合key中的元素个数
@@ -105,7 +162,7 @@ func (z *SortedSet) ZCard(key string) int {
 		return 0
 	}
 
-	return len(z.record[key].dict)
+	return int(z.record[key].card())
 }
 
 // ZRank 返回有序集 key 中成员 member 的排名。其中有序集成员按 score 值递增(从小到大)顺序排列
@@ -115,14 +172,11 @@ func (z *SortedSet) ZRank(key, member string) int64 {
 		return -1
 	}
 
-	v, exist := z.record[key].dict[member]
+	rank, exist := z.record[key].rank(member)
 	if !exist {
 		return -1
 	}
 
-	rank := z.record[key].skl.sklGetRank(v.score, member)
-	rank--
-
 	return rank
 }
 
@@ -133,23 +187,21 @@ func (z *SortedSet) ZRevRank(key, member string) int64 {
 		return -1
 	}
 
-	v, exist := z.record[key].dict[member]
+	rank, exist := z.record[key].rank(member)
 	if !exist {
 		return -1
 	}
 
-	rank := z.record[key].skl.sklGetRank(v.score, member)
-
-	return z.record[key].skl.length - rank
+	return z.record[key].card() - 1 - rank
 }
 
 // ZIncrBy 为有序集 key 的成员 member 的 score 值加上增量 increment
 //当 key 不存在，或 member 不是 key 的成员时，ZIncrBy 等同于 ZAdd
 func (z *SortedSet) ZIncrBy(key string, increment float64, member string) float64 {
 	if z.exist(key) {
-		node, exist := z.record[key].dict[member]
+		score, exist := z.record[key].score(member)
 		if exist {
-			increment += node.score
+			increment += score
 		}
 	}
 
@@ -159,21 +211,35 @@ func (z *SortedSet) ZIncrBy(key string, increment float64, member string) float6
 
 // ZRange 返回有序集 key 中，指定区间内的成员，其中成员的位置按 score 值递增(从小到大)来排序
 //具有相同 score 值的成员按字典序(lexicographical order )来排列
+//
+// Deprecated: use ZRangeMembers instead.
 func (z *SortedSet) ZRange(key string, start, stop int) []interface{} {
-	if !z.exist(key) {
-		return nil
-	}
-
-	return z.findRange(key, int64(start), int64(stop), false)
+	return toPairs(z.ZRangeMembers(key, start, stop))
 }
 
 // ZRevRange 返回有序集 key 中，指定区间内的成员，其中成员的位置按 score 值递减(从大到小)来排列
 //具有相同 score 值的成员按字典序的逆序(reverse lexicographical order)排列
+//
+// Deprecated: use ZRevRangeMembers instead.
 func (z *SortedSet) ZRevRange(key string, start, stop int) []interface{} {
+	return toPairs(z.ZRevRangeMembers(key, start, stop))
+}
+
+// ZRangeMembers 返回有序集 key 中排名介于 start 和 stop 之间的成员，按 score 值递增排列，负数表示从最高分开始计数
+// returns the members with ranks between start and stop ordered by score, negative ranks count from the highest score
+func (z *SortedSet) ZRangeMembers(key string, start, stop int) []Element {
 	if !z.exist(key) {
 		return nil
 	}
+	return z.findRange(key, int64(start), int64(stop), false)
+}
 
+// ZRevRangeMembers 返回有序集 key 中排名介于 start 和 stop 之间的成员，按 score 值递减排列
+// returns the members with ranks between start and stop ordered by score from the highest
+func (z *SortedSet) ZRevRangeMembers(key string, start, stop int) []Element {
+	if !z.exist(key) {
+		return nil
+	}
 	return z.findRange(key, int64(start), int64(stop), true)
 }
 
@@ -183,147 +249,450 @@ func (z *SortedSet) ZRem(key, member string) bool {
 		return false
 	}
 
-	v, exist := z.record[key].dict[member]
-	if exist {
-		z.record[key].skl.sklDelete(v.score, member)
-		delete(z.record[key].dict, member)
-		return true
-	}
-
-	return false
+	return z.record[key].remove(member)
 }
 
 // ZGetByRank 根据排名获取member及分值信息，从小到大排列遍历，即分值最低排名为0，依次类推
+//
+// Deprecated: use ZMemberByRank instead.
 func (z *SortedSet) ZGetByRank(key string, rank int) (val []interface{}) {
 	if !z.exist(key) {
 		return
 	}
-
-	member, score := z.getByRank(key, int64(rank), false)
-	val = append(val, member, score)
-	return
+	e, _ := z.ZMemberByRank(key, rank)
+	return []interface{}{e.Member, e.Score}
 }
 
 // ZRevGetByRank 根据排名获取member及分值信息，从大到小排列遍历，即分值最高排名为0，依次类推
+//
+// Deprecated: use ZRevMemberByRank instead.
 func (z *SortedSet) ZRevGetByRank(key string, rank int) (val []interface{}) {
 	if !z.exist(key) {
 		return
 	}
+	e, _ := z.ZRevMemberByRank(key, rank)
+	return []interface{}{e.Member, e.Score}
+}
 
-	member, score := z.getByRank(key, int64(rank), true)
-	val = append(val, member, score)
-	return
+// ZMemberByRank 返回排名为 rank 的成员，分值最低排名为0，成员不存在时 ok 为 false，分值为负无穷
+// returns the member of the rank, the lowest score has rank 0. ok is false and the score is math.MinInt64 if it does not exist
+func (z *SortedSet) ZMemberByRank(key string, rank int) (Element, bool) {
+	return z.memberByRank(key, rank, false)
+}
+
+// ZRevMemberByRank 返回排名为 rank 的成员，分值最高排名为0
+// returns the member of the rank, the highest score has rank 0
+func (z *SortedSet) ZRevMemberByRank(key string, rank int) (Element, bool) {
+	return z.memberByRank(key, rank, true)
 }
 
 // ZScoreRange 返回有序集 key 中，所有 score 值介于 min 和 max 之间(包括等于 min 或 max )的成员
 //有序集成员按 score 值递增(从小到大)次序排列
+//
+// Deprecated: use ZRangeByScore instead.
 func (z *SortedSet) ZScoreRange(key string, min, max float64) (val []interface{}) {
-	if !z.exist(key) || min > max {
-		return
+	return toPairs(z.ZRangeByScore(key, Inclusive(min), Inclusive(max), Limit{}))
+}
+
+// ZRevScoreRange 返回有序集 key 中， score 值介于 max 和 min 之间(默认包括等于 max 或 min )的所有的成员
+//有序集成员按 score 值递减(从大到小)的次序排列
+//
+// Deprecated: use ZRevRangeByScore instead.
+func (z *SortedSet) ZRevScoreRange(key string, max, min float64) (val []interface{}) {
+	return toPairs(z.ZRevRangeByScore(key, Inclusive(max), Inclusive(min), Limit{}))
+}
+
+// ZRangeByScore 返回有序集 key 中 score 值介于 min 和 max 之间的成员，按 score 值递增排列，通过跨度定位范围
+// returns the members with a score between min and max ordered by score, the range is located by the spans
+func (z *SortedSet) ZRangeByScore(key string, min, max ScoreBound, limit Limit) []Element {
+	if !z.exist(key) {
+		return nil
 	}
+	start, stop := z.scoreRanks(key, min, max)
+	return z.limitRange(key, start, stop, limit, false)
+}
 
-	item := z.record[key].skl
-	minScore := item.head.level[0].forward.score
-	if min < minScore {
-		min = minScore
+// ZRevRangeByScore 返回有序集 key 中 score 值介于 max 和 min 之间的成员，按 score 值递减排列
+// returns the members with a score between max and min ordered by score from the highest
+func (z *SortedSet) ZRevRangeByScore(key string, max, min ScoreBound, limit Limit) []Element {
+	if !z.exist(key) {
+		return nil
 	}
+	start, stop := z.scoreRanks(key, min, max)
+	return z.limitRange(key, start, stop, limit, true)
+}
+
+// Inclusive the bound including v
+func Inclusive(v float64) ScoreBound {
+	return ScoreBound{Value: v}
+}
+
+// Exclusive the bound excluding v
+func Exclusive(v float64) ScoreBound {
+	return ScoreBound{Value: v, Exclusive: true}
+}
 
-	maxScore := item.tail.score
-	if max > maxScore {
-		max = maxScore
+// ParseScoreBound 解析分值范围的一端，如 1.5、(1.5、-inf、+inf
+// parses an end of a score range, such as 1.5, (1.5, -inf and +inf
+func ParseScoreBound(s string) (ScoreBound, error) {
+	var b ScoreBound
+	if strings.HasPrefix(s, "(") {
+		b.Exclusive, s = true, s[1:]
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(v) {
+		return ScoreBound{}, ErrInvalidScoreBound
 	}
+	b.Value = v
+	return b, nil
+}
 
-	p := item.head
-	for i := item.level - 1; i >= 0; i-- {
-		for p.level[i].forward != nil && p.level[i].forward.score < min {
-			p = p.level[i].forward
+// below whether the score is below the bound as the min
+func (b ScoreBound) below(score float64) bool {
+	return score < b.Value || (b.Exclusive && score == b.Value)
+}
+
+// notAbove whether the score is not above the bound as the max
+func (b ScoreBound) notAbove(score float64) bool {
+	return score < b.Value || (!b.Exclusive && score == b.Value)
+}
+
+// ParseAggregate parses sum, min and max, ok is false for the others
+func ParseAggregate(name string) (agg Aggregate, ok bool) {
+	agg, ok = aggregateNames[strings.ToLower(name)]
+	return
+}
+
+// ZUnion 返回给定有序集的并集，与 ZRange 的格式相同
+//
+// Deprecated: use ZUnionMembers instead.
+func (z *SortedSet) ZUnion(keys []string, weights []float64, agg Aggregate) []interface{} {
+	return toPairs(z.ZUnionMembers(keys, weights, agg))
+}
+
+// ZInter 返回给定有序集的交集，与 ZRange 的格式相同
+//
+// Deprecated: use ZInterMembers instead.
+func (z *SortedSet) ZInter(keys []string, weights []float64, agg Aggregate) []interface{} {
+	return toPairs(z.ZInterMembers(keys, weights, agg))
+}
+
+// ZDiff 返回第一个有序集中不在其余有序集中的成员，与 ZRange 的格式相同
+//
+// Deprecated: use ZDiffMembers instead.
+func (z *SortedSet) ZDiff(keys ...string) []interface{} {
+	return toPairs(z.ZDiffMembers(keys...))
+}
+
+// ZUnionMembers 返回给定有序集的并集，成员的分值乘以对应集合的权重后按agg聚合，weights 为空时权重都为1
+// 结果按 score 值递增排列
+// returns the union of the sorted sets, the scores are multiplied by the weights of the sets and aggregated by agg.
+// All weights are 1 if weights is empty. The result is ordered by score.
+func (z *SortedSet) ZUnionMembers(keys []string, weights []float64, agg Aggregate) []Element {
+	scores := make(map[string]float64)
+	for i, k := range keys {
+		if !z.exist(k) {
+			continue
 		}
+		z.record[k].each(func(member string, score float64) {
+			score = weightedScore(score, weights, i)
+			if old, ok := scores[member]; ok {
+				score = aggregate(old, score, agg)
+			}
+			scores[member] = score
+		})
+	}
+	return sortedElements(scores)
+}
+
+// ZInterMembers 返回给定有序集的交集，遍历最小的有序集，分值的计算与 ZUnionMembers 相同
+// returns the intersection of the sorted sets by iterating the smallest one, the scores are computed as ZUnionMembers.
+func (z *SortedSet) ZInterMembers(keys []string, weights []float64, agg Aggregate) []Element {
+	if len(keys) == 0 {
+		return nil
 	}
 
-	p = p.level[0].forward
-	for p != nil {
-		if p.score > max {
-			break
+	smallest := 0
+	for i, k := range keys {
+		if !z.exist(k) {
+			return nil
+		}
+		if z.record[k].card() < z.record[keys[smallest]].card() {
+			smallest = i
 		}
+	}
 
-		val = append(val, p.member, p.score)
-		p = p.level[0].forward
+	scores := make(map[string]float64)
+	z.record[keys[smallest]].each(func(member string, _ float64) {
+		var score float64
+		for i, k := range keys {
+			s, ok := z.record[k].score(member)
+			if !ok {
+				return
+			}
+			if i == 0 {
+				score = weightedScore(s, weights, i)
+			} else {
+				score = aggregate(score, weightedScore(s, weights, i), agg)
+			}
+		}
+		scores[member] = score
+	})
+	return sortedElements(scores)
+}
+
+// ZDiffMembers 返回第一个有序集中不在其余有序集中的成员及其分值
+// returns the members of the first sorted set not in the successive ones, with their scores
+func (z *SortedSet) ZDiffMembers(keys ...string) []Element {
+	if len(keys) == 0 || !z.exist(keys[0]) {
+		return nil
 	}
 
-	return
+	scores := make(map[string]float64)
+	z.record[keys[0]].each(func(member string, score float64) {
+		for _, k := range keys[1:] {
+			if z.ZIsMember(k, member) {
+				return
+			}
+		}
+		scores[member] = score
+	})
+	return sortedElements(scores)
 }
 
-// ZRevScoreRange 返回有序集 key 中， score 值介于 max 和 min 之间(默认包括等于 max 或 min )的所有的成员
-//有序集成员按 score 值递减(从大到小)的次序排列
-func (z *SortedSet) ZRevScoreRange(key string, max, min float64) (val []interface{}) {
-	if !z.exist(key) || max < min {
-		return
+// ZClear 删除有序集 key，返回其是否存在
+// deletes the sorted set, returns whether it existed
+func (z *SortedSet) ZClear(key string) bool {
+	if !z.exist(key) {
+		return false
 	}
+	delete(z.record, key)
+	return true
+}
 
-	item := z.record[key].skl
-	minScore := item.head.level[0].forward.score
-	if min < minScore {
-		min = minScore
+func weightedScore(score float64, weights []float64, i int) float64 {
+	if i >= len(weights) {
+		return score
 	}
+	//0 * inf is taken as 0
+	if score = score * weights[i]; math.IsNaN(score) {
+		return 0
+	}
+	return score
+}
 
-	maxScore := item.tail.score
-	if max > maxScore {
-		max = maxScore
+func aggregate(a, b float64, agg Aggregate) float64 {
+	switch agg {
+	case AggregateMin:
+		return math.Min(a, b)
+	case AggregateMax:
+		return math.Max(a, b)
 	}
+	//inf + -inf is taken as 0
+	if sum := a + b; !math.IsNaN(sum) {
+		return sum
+	}
+	return 0
+}
 
-	p := item.head
-	for i := item.level - 1; i >= 0; i-- {
-		for p.level[i].forward != nil && p.level[i].forward.score <= max {
-			p = p.level[i].forward
+// sortedElements 将成员和分值按 score 值递增、相同时按成员的字典序排列
+// orders the members and scores by score, and by member for the same score
+func sortedElements(scores map[string]float64) []Element {
+	elems := make([]Element, 0, len(scores))
+	for member, score := range scores {
+		elems = append(elems, Element{Member: member, Score: score})
+	}
+	sort.Slice(elems, func(i, j int) bool {
+		if elems[i].Score != elems[j].Score {
+			return elems[i].Score < elems[j].Score
 		}
+		return elems[i].Member < elems[j].Member
+	})
+	return elems
+}
+
+// toPairs 转换为成员和分值交替排列的格式
+// converts the elements to members and scores in turn
+func toPairs(elems []Element) (val []interface{}) {
+	for _, e := range elems {
+		val = append(val, e.Member, e.Score)
 	}
+	return
+}
 
-	for p != nil {
-		if p.score < min {
-			break
-		}
+// ZCount 返回有序集 key 中 score 值介于 min 和 max 之间(包括等于 min 或 max )的成员个数，通过跨度计算
+// returns the number of members with a score between min and max, which is computed by the spans
+func (z *SortedSet) ZCount(key string, min, max float64) int {
+	if !z.exist(key) || min > max {
+		return 0
+	}
 
-		val = append(val, p.member, p.score)
-		p = p.backward
+	start, stop := z.scoreRanks(key, Inclusive(min), Inclusive(max))
+	return int(stop - start + 1)
+}
+
+// ZLexCount 返回有序集 key 中成员介于 min 和 max 之间的个数，所有成员的 score 值应该相同
+// min 和 max 为 - 、+ 或以 [ (包含)、( (不包含)开头的成员
+// returns the number of members between min and max, all members should have the same score.
+// min and max are -, +, or a member started with [ (inclusive) or ( (exclusive).
+func (z *SortedSet) ZLexCount(key, min, max string) (int, error) {
+	start, stop, err := z.lexRanks(key, min, max)
+	if err != nil || start > stop {
+		return 0, err
 	}
+	return int(stop - start + 1), nil
+}
 
-	return
+// ZRangeByLex 返回有序集 key 中成员介于 min 和 max 之间的成员，按字典序排列，与 ZRange 的格式相同
+//
+// Deprecated: use ZRangeByLexMembers instead.
+func (z *SortedSet) ZRangeByLex(key, min, max string) ([]interface{}, error) {
+	elems, err := z.ZRangeByLexMembers(key, min, max, Limit{})
+	return toPairs(elems), err
 }
 
-func (z *SortedSet) exist(key string) bool {
-	_, exist := z.record[key]
-	return exist
+// ZRevRangeByLex 返回有序集 key 中成员介于 max 和 min 之间的成员，按字典序的逆序排列
+//
+// Deprecated: use ZRevRangeByLexMembers instead.
+func (z *SortedSet) ZRevRangeByLex(key, max, min string) ([]interface{}, error) {
+	elems, err := z.ZRevRangeByLexMembers(key, max, min, Limit{})
+	return toPairs(elems), err
 }
 
-func (z *SortedSet) getByRank(key string, rank int64, reverse bool) (string, float64) {
+// ZRangeByLexMembers 返回有序集 key 中成员介于 min 和 max 之间的成员，按字典序排列
+// returns the members between min and max in lexicographical order
+func (z *SortedSet) ZRangeByLexMembers(key, min, max string, limit Limit) ([]Element, error) {
+	start, stop, err := z.lexRanks(key, min, max)
+	if err != nil {
+		return nil, err
+	}
+	return z.limitRange(key, start, stop, limit, false), nil
+}
 
-	skl := z.record[key].skl
-	if rank < 0 || rank > skl.length {
-		return "", math.MinInt64
+// ZRevRangeByLexMembers 返回有序集 key 中成员介于 max 和 min 之间的成员，按字典序的逆序排列
+// returns the members between max and min in reverse lexicographical order
+func (z *SortedSet) ZRevRangeByLexMembers(key, max, min string, limit Limit) ([]Element, error) {
+	start, stop, err := z.lexRanks(key, min, max)
+	if err != nil {
+		return nil, err
 	}
+	return z.limitRange(key, start, stop, limit, true), nil
+}
 
+// limitRange 返回排名介于 start 和 stop 之间(按 score 值递增)的成员，reverse 为 true 时从 stop 开始，跳过 limit.Offset 个成员
+// returns the members with ranks between start and stop in the ascending order, from stop if reverse is true,
+// skipping limit.Offset members and returning at most limit.Count members
+func (z *SortedSet) limitRange(key string, start, stop int64, limit Limit, reverse bool) []Element {
+	if limit.Offset < 0 {
+		return nil
+	}
+	offset, count := int64(limit.Offset), int64(limit.Count)
 	if reverse {
-		rank = skl.length - rank
+		stop -= offset
+		if count > 0 && stop-start+1 > count {
+			start = stop - count + 1
+		}
 	} else {
-		rank++
+		start += offset
+		if count > 0 && stop-start+1 > count {
+			stop = start + count - 1
+		}
+	}
+	if start > stop {
+		return nil
 	}
 
-	n := skl.sklGetElementByRank(uint64(rank))
-	if n == nil {
-		return "", math.MinInt64
+	if reverse {
+		length := z.record[key].card()
+		return z.findRange(key, length-1-stop, length-1-start, true)
 	}
+	return z.findRange(key, start, stop, false)
+}
 
-	node := z.record[key].dict[n.member]
-	if node == nil {
-		return "", math.MinInt64
+// scoreRanks 返回 score 值介于 min 和 max 之间的成员的排名范围，范围为空时 start 大于 stop
+// returns the ranks of the first and last members with a score between min and max, start is greater than stop if there are none
+func (z *SortedSet) scoreRanks(key string, min, max ScoreBound) (start, stop int64) {
+	item := z.record[key]
+	start = item.count(func(score float64, _ string) bool { return min.below(score) })
+	stop = item.count(func(score float64, _ string) bool { return max.notAbove(score) }) - 1
+	return
+}
+
+func (z *SortedSet) lexRanks(key, min, max string) (start, stop int64, err error) {
+	lo, err := parseLexBound(min)
+	if err != nil {
+		return 0, -1, err
+	}
+	hi, err := parseLexBound(max)
+	if err != nil || !z.exist(key) {
+		return 0, -1, err
 	}
 
-	return node.member, node.score
+	item := z.record[key]
+	start = item.count(func(_ float64, member string) bool { return lo.below(member) })
+	stop = item.count(func(_ float64, member string) bool { return hi.notAbove(member) }) - 1
+	return
 }
 
-func (z *SortedSet) findRange(key string, start, stop int64, reverse bool) (val []interface{}) {
-	skl := z.record[key].skl
-	length := skl.length
+// lexBound 字典序范围的一端
+// an end of a lex range
+type lexBound struct {
+	value     string
+	exclusive bool
+	inf       int // -1 for -, 1 for +
+}
+
+func parseLexBound(s string) (lexBound, error) {
+	switch {
+	case s == "-":
+		return lexBound{inf: -1}, nil
+	case s == "+":
+		return lexBound{inf: 1}, nil
+	case strings.HasPrefix(s, "["):
+		return lexBound{value: s[1:]}, nil
+	case strings.HasPrefix(s, "("):
+		return lexBound{value: s[1:], exclusive: true}, nil
+	}
+	return lexBound{}, ErrInvalidLexRange
+}
+
+// below whether the member is below the bound as the min
+func (b lexBound) below(member string) bool {
+	if b.inf != 0 {
+		return b.inf > 0
+	}
+	if b.exclusive {
+		return member <= b.value
+	}
+	return member < b.value
+}
+
+// notAbove whether the member is not above the bound as the max
+func (b lexBound) notAbove(member string) bool {
+	if b.inf != 0 {
+		return b.inf > 0
+	}
+	if b.exclusive {
+		return member < b.value
+	}
+	return member <= b.value
+}
+
+func (z *SortedSet) exist(key string) bool {
+	_, exist := z.record[key]
+	return exist
+}
+
+func (z *SortedSet) memberByRank(key string, rank int, reverse bool) (Element, bool) {
+	if !z.exist(key) || rank < 0 || int64(rank) >= z.record[key].card() {
+		return Element{Score: math.MinInt64}, false
+	}
+	return z.findRange(key, int64(rank), int64(rank), reverse)[0], true
+}
+
+func (z *SortedSet) findRange(key string, start, stop int64, reverse bool) (val []Element) {
+	item := z.record[key]
+	length := item.card()
 
 	if start < 0 {
 		start += length
@@ -343,33 +712,8 @@ func (z *SortedSet) findRange(key string, start, stop int64, reverse bool) (val
 	if stop >= length {
 		stop = length - 1
 	}
-	span := (stop - start) + 1
-
-	var node *sklNode
-	if reverse {
-		node = skl.tail
-		if start > 0 {
-			node = skl.sklGetElementByRank(uint64(length - start))
-		}
-	} else {
-		node = skl.head.level[0].forward
-		if start > 0 {
-			node = skl.sklGetElementByRank(uint64(start + 1))
-		}
-	}
-
-	for span > 0 {
-		span--
-
-		val = append(val, node.member, node.score)
-		if reverse {
-			node = node.backward
-		} else {
-			node = node.level[0].forward
-		}
-	}
 
-	return
+	return item.elements(start, stop, reverse)
 }
 
 func sklNewNode(level int16, score float64, member string) *sklNode {
@@ -533,6 +877,20 @@ func (skl *skipList) sklGetRank(score float64, member string) int64 {
 	return 0
 }
 
+// sklCount 通过跨度计算从头开始满足 fn 的节点个数，fn 需只对开头的一段节点为 true
+// returns the number of nodes from the head satisfying fn by the spans, fn must be true for a prefix of the nodes only
+func (skl *skipList) sklCount(fn func(p *sklNode) bool) uint64 {
+	var rank uint64
+	p := skl.head
+	for i := skl.level - 1; i >= 0; i-- {
+		for p.level[i].forward != nil && fn(p.level[i].forward) {
+			rank += p.level[i].span
+			p = p.level[i].forward
+		}
+	}
+	return rank
+}
+
 func (skl *skipList) sklGetElementByRank(rank uint64) *sklNode {
 	var traversed uint64 = 0
 	p := skl.head
@@ -1,7 +1,11 @@
 package zset
 
 import (
+	"github.com/KarlvenK/kDB/ds/listpack"
+	"math"
 	"math/rand"
+	"reflect"
+	"strconv"
 	"testing"
 	"time"
 )
@@ -176,11 +180,8 @@ func TestSortedSet_ZRevGetByRank(t *testing.T) {
 		}
 	}
 
-	dummy := zset.record["myzset"].skl.head
-	p := dummy.level[0].forward
-	for i := 0; i < 100; i++ {
-		t.Log(p.member, p.score)
-		p = p.level[0].forward
+	for _, e := range zset.ZRangeMembers("myzset", 0, 99) {
+		t.Log(e.Member, e.Score)
 	}
 }
 
@@ -241,3 +242,307 @@ func TestSortedSet_ZCard(t *testing.T) {
 	card := zSet.ZCard("myzset")
 	t.Log(card)
 }
+
+func TestSortedSet_ZUnion(t *testing.T) {
+	zSet := New()
+	zSet.ZAdd("z1", 1, "a")
+	zSet.ZAdd("z1", 2, "b")
+	zSet.ZAdd("z2", 3, "b")
+	zSet.ZAdd("z2", 4, "c")
+
+	tests := []struct {
+		name    string
+		weights []float64
+		agg     Aggregate
+		want    []interface{}
+	}{
+		{"sum", nil, AggregateSum, []interface{}{"a", 1.0, "c", 4.0, "b", 5.0}},
+		{"min", nil, AggregateMin, []interface{}{"a", 1.0, "b", 2.0, "c", 4.0}},
+		{"max", nil, AggregateMax, []interface{}{"a", 1.0, "b", 3.0, "c", 4.0}},
+		{"weights", []float64{2, 0.5}, AggregateSum, []interface{}{"a", 2.0, "c", 2.0, "b", 5.5}},
+	}
+	for _, tt := range tests {
+		if got := zSet.ZUnion([]string{"z1", "z2", "not_exist"}, tt.weights, tt.agg); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSortedSet_ZInter(t *testing.T) {
+	zSet := New()
+	zSet.ZAdd("z1", 1, "a")
+	zSet.ZAdd("z1", 2, "b")
+	zSet.ZAdd("z1", math.Inf(1), "c")
+	zSet.ZAdd("z2", 3, "b")
+	zSet.ZAdd("z2", math.Inf(-1), "c")
+
+	want := []interface{}{"c", 0.0, "b", 5.0}
+	if got := zSet.ZInter([]string{"z1", "z2"}, nil, AggregateSum); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	want = []interface{}{"b", 6.0}
+	if got := zSet.ZInter([]string{"z1", "z2"}, []float64{0, 2}, AggregateMax); !reflect.DeepEqual(got[2:], want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got := zSet.ZInter([]string{"z1", "not_exist"}, nil, AggregateSum); len(got) != 0 {
+		t.Errorf("unexpected intersection %v", got)
+	}
+}
+
+func TestSortedSet_ZDiff(t *testing.T) {
+	zSet := InitZSet()
+	zSet.ZAdd("other", 1, "bcd")
+	zSet.ZAdd("other", 1, "mcd")
+
+	want := []interface{}{"acd", 12.0, "ecd", 17.0, "ced", 19.0, "ccd", 21.0, "acc", 32.0}
+	if got := zSet.ZDiff("myzset", "other", "not_exist"); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if !zSet.ZClear("myzset") || zSet.ZCard("myzset") != 0 {
+		t.Error("the sorted set should be deleted")
+	}
+}
+
+func TestSortedSet_ZCount(t *testing.T) {
+	zSet := InitZSet()
+
+	tests := []struct {
+		min, max float64
+		want     int
+	}{
+		{17, 19, 4},
+		{0, 100, 7},
+		{math.Inf(-1), 12, 1},
+		{22, 31, 0},
+		{20, 10, 0},
+	}
+	for _, tt := range tests {
+		if got := zSet.ZCount("myzset", tt.min, tt.max); got != tt.want {
+			t.Errorf("ZCount(%v, %v) = %d, want %d", tt.min, tt.max, got, tt.want)
+		}
+	}
+	if zSet.ZCount("not_exist", 0, 100) != 0 {
+		t.Error("the sorted set not exist should be empty")
+	}
+}
+
+func TestSortedSet_ZRangeByLex(t *testing.T) {
+	zSet := New()
+	for _, m := range []string{"a", "b", "c", "d", "e", "f", "g"} {
+		zSet.ZAdd("lex", 0, m)
+	}
+
+	tests := []struct {
+		min, max string
+		want     []interface{}
+	}{
+		{"-", "[c", []interface{}{"a", 0.0, "b", 0.0, "c", 0.0}},
+		{"-", "(c", []interface{}{"a", 0.0, "b", 0.0}},
+		{"[aaa", "(g", []interface{}{"b", 0.0, "c", 0.0, "d", 0.0, "e", 0.0, "f", 0.0}},
+		{"(f", "+", []interface{}{"g", 0.0}},
+		{"+", "-", nil},
+		{"[d", "[c", nil},
+	}
+	for _, tt := range tests {
+		got, err := zSet.ZRangeByLex("lex", tt.min, tt.max)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ZRangeByLex(%s, %s) = %v, want %v", tt.min, tt.max, got, tt.want)
+		}
+		if n, _ := zSet.ZLexCount("lex", tt.min, tt.max); n != len(tt.want)/2 {
+			t.Errorf("ZLexCount(%s, %s) = %d, want %d", tt.min, tt.max, n, len(tt.want)/2)
+		}
+	}
+
+	got, _ := zSet.ZRevRangeByLex("lex", "[c", "-")
+	if want := []interface{}{"c", 0.0, "b", 0.0, "a", 0.0}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if _, err := zSet.ZRangeByLex("lex", "a", "+"); err != ErrInvalidLexRange {
+		t.Errorf("expected ErrInvalidLexRange, got %v", err)
+	}
+}
+
+func TestEncodeMembers(t *testing.T) {
+	members := []string{"a", "", "member with spaces", string(make([]byte, 300))}
+	got, err := DecodeMembers(EncodeMembers(members))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, members) {
+		t.Errorf("got %v, want %v", got, members)
+	}
+	if _, err = DecodeMembers([]byte{5, 'a'}); err != ErrInvalidMembers {
+		t.Errorf("expected ErrInvalidMembers, got %v", err)
+	}
+}
+
+func TestSortedSet_ZIsMember(t *testing.T) {
+	zSet := InitZSet()
+
+	if !zSet.ZIsMember("myzset", "acd") || zSet.ZIsMember("myzset", "zzz") || zSet.ZIsMember("not_exist", "acd") {
+		t.Error("unexpected membership")
+	}
+}
+
+func TestParseScoreBound(t *testing.T) {
+	tests := []struct {
+		s    string
+		want ScoreBound
+		err  error
+	}{
+		{"1.5", Inclusive(1.5), nil},
+		{"(1.5", Exclusive(1.5), nil},
+		{"-inf", Inclusive(math.Inf(-1)), nil},
+		{"(+inf", Exclusive(math.Inf(1)), nil},
+		{"abc", ScoreBound{}, ErrInvalidScoreBound},
+		{"nan", ScoreBound{}, ErrInvalidScoreBound},
+	}
+	for _, tt := range tests {
+		got, err := ParseScoreBound(tt.s)
+		if got != tt.want || err != tt.err {
+			t.Errorf("ParseScoreBound(%s) = %v %v, want %v %v", tt.s, got, err, tt.want, tt.err)
+		}
+	}
+}
+
+func TestSortedSet_ZRangeByScore(t *testing.T) {
+	zSet := InitZSet()
+	members := func(elems []Element) (res []string) {
+		for _, e := range elems {
+			res = append(res, e.Member)
+		}
+		return
+	}
+
+	tests := []struct {
+		name     string
+		min, max ScoreBound
+		limit    Limit
+		reverse  bool
+		want     []string
+	}{
+		{"inclusive", Inclusive(17), Inclusive(19), Limit{}, false, []string{"bcd", "ecd", "mcd", "ced"}},
+		{"exclusive", Exclusive(17), Exclusive(21), Limit{}, false, []string{"ced"}},
+		{"limit", Inclusive(math.Inf(-1)), Inclusive(math.Inf(1)), Limit{Offset: 2, Count: 3}, false, []string{"ecd", "mcd", "ced"}},
+		{"reverse", Inclusive(17), Inclusive(21), Limit{}, true, []string{"ccd", "ced", "mcd", "ecd", "bcd"}},
+		{"reverse limit", Inclusive(17), Inclusive(21), Limit{Offset: 1, Count: 2}, true, []string{"ced", "mcd"}},
+		{"offset beyond", Inclusive(17), Inclusive(21), Limit{Offset: 10}, false, nil},
+		{"empty", Exclusive(19), Exclusive(19), Limit{}, false, nil},
+	}
+	for _, tt := range tests {
+		var got []Element
+		if tt.reverse {
+			got = zSet.ZRevRangeByScore("myzset", tt.max, tt.min, tt.limit)
+		} else {
+			got = zSet.ZRangeByScore("myzset", tt.min, tt.max, tt.limit)
+		}
+		if !reflect.DeepEqual(members(got), tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, members(got), tt.want)
+		}
+	}
+
+	if elems, _ := zSet.ZRangeByLexMembers("myzset", "-", "+", Limit{Count: 2}); len(elems) != 2 {
+		t.Errorf("expected 2 members, got %v", elems)
+	}
+}
+
+func TestSortedSet_ZMemberByRank(t *testing.T) {
+	zSet := InitZSet()
+
+	if e, ok := zSet.ZMemberByRank("myzset", 0); !ok || e != (Element{Member: "acd", Score: 12}) {
+		t.Errorf("unexpected member %v", e)
+	}
+	if e, ok := zSet.ZRevMemberByRank("myzset", 0); !ok || e != (Element{Member: "acc", Score: 32}) {
+		t.Errorf("unexpected member %v", e)
+	}
+	if _, ok := zSet.ZMemberByRank("myzset", 7); ok {
+		t.Error("the rank is out of range")
+	}
+	if got := zSet.ZGetByRank("myzset", 1); !reflect.DeepEqual(got, []interface{}{"bcd", 17.0}) {
+		t.Errorf("the deprecated function returned %v", got)
+	}
+}
+
+func TestSortedSet_Encoding(t *testing.T) {
+	//the same operations on a packed and a skip list sorted set give the same results
+	key := "myzset"
+	packed, full := New(), New()
+	full.SetLimits(listpack.Limits{MaxEntries: -1, MaxValue: -1})
+	rnd := rand.New(rand.NewSource(1))
+
+	for i := 0; i < 2000; i++ {
+		member := "m" + strconv.Itoa(rnd.Intn(60))
+		score := float64(rnd.Intn(20))
+		switch rnd.Intn(4) {
+		case 0, 1:
+			packed.ZAdd(key, score, member)
+			full.ZAdd(key, score, member)
+		case 2:
+			if packed.ZRem(key, member) != full.ZRem(key, member) {
+				t.Fatalf("ZRem %s differs", member)
+			}
+		default:
+			packed.ZIncrBy(key, score, member)
+			full.ZIncrBy(key, score, member)
+		}
+
+		if packed.Encoding(key) != EncodingListpack || full.Encoding(key) != EncodingSkiplist {
+			t.Fatalf("unexpected encodings %s and %s", packed.Encoding(key), full.Encoding(key))
+		}
+		if packed.ZCard(key) != full.ZCard(key) ||
+			packed.ZRank(key, member) != full.ZRank(key, member) ||
+			packed.ZRevRank(key, member) != full.ZRevRank(key, member) ||
+			packed.ZScore(key, member) != full.ZScore(key, member) {
+			t.Fatalf("step %d: the member %s differs", i, member)
+		}
+		if i%50 == 0 {
+			compare := func(name string, a, b interface{}) {
+				if !reflect.DeepEqual(a, b) {
+					t.Fatalf("step %d: %s differs:\n%v\n%v", i, name, a, b)
+				}
+			}
+			compare("ZRangeMembers", packed.ZRangeMembers(key, 0, -1), full.ZRangeMembers(key, 0, -1))
+			compare("ZRevRangeMembers", packed.ZRevRangeMembers(key, 3, -4), full.ZRevRangeMembers(key, 3, -4))
+			compare("ZRangeByScore", packed.ZRangeByScore(key, Inclusive(5), Exclusive(15), Limit{Offset: 1, Count: 5}),
+				full.ZRangeByScore(key, Inclusive(5), Exclusive(15), Limit{Offset: 1, Count: 5}))
+			compare("ZRevRangeByScore", packed.ZRevRangeByScore(key, Inclusive(15), Inclusive(2), Limit{}),
+				full.ZRevRangeByScore(key, Inclusive(15), Inclusive(2), Limit{}))
+			compare("ZCount", packed.ZCount(key, 3, 9), full.ZCount(key, 3, 9))
+			pm, _ := packed.ZMemberByRank(key, 7)
+			fm, _ := full.ZMemberByRank(key, 7)
+			compare("ZMemberByRank", pm, fm)
+		}
+	}
+}
+
+func TestSortedSet_EncodingConversion(t *testing.T) {
+	key := "myzset"
+	zset := New()
+	zset.SetLimits(listpack.Limits{MaxEntries: 3, MaxValue: 5})
+
+	zset.ZAdd(key, 3, "c")
+	zset.ZAdd(key, 1, "a")
+	zset.ZAdd(key, 2, "b")
+	if zset.Encoding(key) != EncodingListpack {
+		t.Errorf("expected listpack, got %s", zset.Encoding(key))
+	}
+	zset.ZAdd(key, 2, "d")
+	if zset.Encoding(key) != EncodingSkiplist {
+		t.Errorf("expected skiplist once there are too many members, got %s", zset.Encoding(key))
+	}
+	want := []Element{{"a", 1}, {"b", 2}, {"d", 2}, {"c", 3}}
+	if got := zset.ZRangeMembers(key, 0, -1); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+
+	zset.ZAdd("long", 1, "abcdef")
+	if zset.Encoding("long") != EncodingSkiplist {
+		t.Errorf("expected skiplist for a long member, got %s", zset.Encoding("long"))
+	}
+	if zset.Encoding("missing") != "" {
+		t.Error("expected no encoding for a missing key")
+	}
+}
@@ -1,32 +1,50 @@
 package kDB
 
 import (
+	"encoding/json"
+	"github.com/KarlvenK/kDB/ds/bloom"
+	"github.com/KarlvenK/kDB/ds/document"
 	"github.com/KarlvenK/kDB/ds/list"
+	"github.com/KarlvenK/kDB/ds/sketch"
+	"github.com/KarlvenK/kDB/ds/stream"
+	"github.com/KarlvenK/kDB/ds/timeseries"
+	"github.com/KarlvenK/kDB/ds/vector"
+	"github.com/KarlvenK/kDB/ds/zset"
 	"github.com/KarlvenK/kDB/index"
+	"github.com/KarlvenK/kDB/storage"
 	"github.com/KarlvenK/kDB/utils"
 	"io"
 	"sort"
 	"strconv"
 	"strings"
-	"time"
 )
 
 //DataType define the data type
 type DataType = uint16
 
-// five different data types
+// twelve different data types
 const (
 	String DataType = iota
 	List
 	Hash
 	Set
 	ZSet
+	HyperLogLog
+	Stream
+	JSON
+	Bloom
+	Sketch
+	TimeSeries
+	Vector
 )
 
 // string operations
 const (
 	StringSet uint16 = iota
 	StringRem
+	StringSetBit
+	StringExpire
+	StringPersist
 )
 
 //list operations
@@ -39,12 +57,17 @@ const (
 	ListLInsert
 	ListLSet
 	ListLTrim
+	ListLMove
 )
 
 // hash table operations
 const (
 	HashHSet uint16 = iota
 	HashHDel
+	HashHMSet
+	HashHIncrBy
+	HashHExpire
+	HashHPersist
 )
 
 // set operations
@@ -52,12 +75,72 @@ const (
 	SetSAdd uint16 = iota
 	SetSRem
 	SetSMove
+	SetSClear
 )
 
 // sorted set operations
 const (
 	ZSetZAdd uint16 = iota
 	ZSetZRem
+	ZSetZClear
+	ZSetZRemRange
+)
+
+// hyperloglog operations
+const (
+	HyperLogLogPFAdd uint16 = iota
+	HyperLogLogPFMerge
+)
+
+// stream operations
+const (
+	StreamXAdd uint16 = iota
+	StreamXTrim
+	StreamXGroup
+	StreamXSnapshot
+)
+
+// json document operations
+const (
+	JSONSet uint16 = iota
+	JSONDel
+	JSONNumIncrBy
+	JSONArrAppend
+)
+
+// bloom and cuckoo filter operations
+const (
+	BloomBFReserve uint16 = iota
+	BloomBFAdd
+	BloomCFReserve
+	BloomCFAdd
+	BloomCFDel
+	BloomRestore
+)
+
+// count-min sketch and top-k operations
+const (
+	SketchCMSInit uint16 = iota
+	SketchCMSIncrBy
+	SketchTopKReserve
+	SketchTopKIncrBy
+	SketchRestore
+)
+
+// time series operations
+const (
+	TimeSeriesCreate uint16 = iota
+	TimeSeriesAdd
+	TimeSeriesCreateRule
+	TimeSeriesDeleteRule
+	TimeSeriesRestore
+)
+
+// vector operations
+const (
+	VectorCreate uint16 = iota
+	VectorAdd
+	VectorDel
 )
 
 //buildStringIndex build string indexes
@@ -66,15 +149,25 @@ func (db *kDB) buildStringIndex(idx *index.Indexer, opt uint16) {
 		return
 	}
 
-	now := uint32(time.Now().Unix())
-	if deadline, exist := db.expires[string(idx.Meta.Key)]; exist && deadline <= now {
-		return
-	}
+	//the expired keys are removed after all the files are loaded, see removeExpiredKeys
 	switch opt {
 	case StringSet:
 		db.strIndex.idxList.Put(idx.Meta.Key, idx)
+		db.strIndex.reset(string(idx.Meta.Key))
 	case StringRem:
 		db.strIndex.idxList.Remove(idx.Meta.Key)
+		db.strIndex.reset(string(idx.Meta.Key))
+		delete(db.expires, string(idx.Meta.Key))
+	case StringSetBit:
+		if offset, err := strconv.Atoi(string(idx.Meta.Extra)); err == nil && len(idx.Meta.Value) == 1 {
+			db.strIndex.setByte(idx.Meta.Key, offset, idx.Meta.Value[0], db.config.IdxMode)
+		}
+	case StringExpire:
+		if deadline, err := strconv.ParseInt(string(idx.Meta.Value), 10, 64); err == nil {
+			db.expires[string(idx.Meta.Key)] = deadline
+		}
+	case StringPersist:
+		delete(db.expires, string(idx.Meta.Key))
 	}
 }
 
@@ -84,41 +177,60 @@ func (db *kDB) buildListIndex(idx *index.Indexer, opt uint16) {
 		return
 	}
 
-	key := string(idx.Meta.Key)
+	applyList(db.listIndex.indexes, string(idx.Meta.Key), opt, string(idx.Meta.Extra), idx.Meta.Value)
+}
+
+// applyList 将日志中记录的一次列表操作应用到列表上，Reclaim时也用于重放旧的数据文件
+// applies a list operation in the log to the lists, also used by Reclaim to replay the archived files
+func applyList(lists *list.List, key string, opt uint16, extra string, value []byte) {
 	switch opt {
 	case ListLPush:
-		db.listIndex.indexes.LPush(key, idx.Meta.Value)
+		lists.LPush(key, value)
 	case ListLPop:
-		db.listIndex.indexes.LPop(key)
+		//the count of the popped elements is in extra since LPopCount, one if it is empty
+		if count, err := strconv.Atoi(extra); err == nil {
+			lists.LPopCount(key, count)
+		} else {
+			lists.LPop(key)
+		}
 	case ListRPush:
-		db.listIndex.indexes.RPush(key, idx.Meta.Value)
+		lists.RPush(key, value)
 	case ListRPop:
-		db.listIndex.indexes.RPop(key)
+		if count, err := strconv.Atoi(extra); err == nil {
+			lists.RPopCount(key, count)
+		} else {
+			lists.RPop(key)
+		}
 	case ListLRem:
-		if count, err := strconv.Atoi(string(idx.Meta.Extra)); err == nil {
-			db.listIndex.indexes.LRem(key, idx.Meta.Value, count)
+		if count, err := strconv.Atoi(extra); err == nil {
+			lists.LRem(key, value, count)
 		}
 	case ListLInsert:
-		extra := string(idx.Meta.Extra)
 		s := strings.Split(extra, ExtraSeparator)
 		if len(s) == 2 {
 			pivot := []byte(s[0])
 			if opt, err := strconv.Atoi(s[1]); err == nil {
-				db.listIndex.indexes.LInsert(string(idx.Meta.Key), list.InsertOption(opt), pivot, idx.Meta.Value)
+				lists.LInsert(key, list.InsertOption(opt), pivot, value)
 			}
 		}
 	case ListLSet:
-		if i, err := strconv.Atoi(string(idx.Meta.Extra)); err == nil {
-			db.listIndex.indexes.LSet(key, i, idx.Meta.Value)
+		if i, err := strconv.Atoi(extra); err == nil {
+			lists.LSet(key, i, value)
 		}
 	case ListLTrim:
-		extra := string(idx.Meta.Extra)
 		s := strings.Split(extra, ExtraSeparator)
 		if len(s) == 2 {
 			start, _ := strconv.Atoi(s[0])
 			end, _ := strconv.Atoi(s[1])
 
-			db.listIndex.indexes.LTrim(string(idx.Meta.Key), start, end)
+			lists.LTrim(key, start, end)
+		}
+	case ListLMove:
+		s := strings.Split(extra, ExtraSeparator)
+		if len(s) == 2 {
+			from, _ := strconv.Atoi(s[0])
+			to, _ := strconv.Atoi(s[1])
+			lists.LMove(key, string(value), list.Direction(from), list.Direction(to))
 		}
 	}
 }
@@ -132,10 +244,19 @@ func (db *kDB) buildHashIndex(idx *index.Indexer, opt uint16) {
 	key := string(idx.Meta.Key)
 
 	switch opt {
-	case HashHSet:
+	case HashHSet, HashHMSet:
 		db.hashIndex.indexes.HSet(key, string(idx.Meta.Extra), idx.Meta.Value)
+	//the results of HIncrBy and HIncrByFloat are logged, which keep the deadline
+	case HashHIncrBy:
+		db.hashIndex.indexes.HUpdate(key, string(idx.Meta.Extra), idx.Meta.Value)
 	case HashHDel:
 		db.hashIndex.indexes.HDel(key, string(idx.Meta.Extra))
+	case HashHExpire:
+		if deadline, err := strconv.ParseInt(string(idx.Meta.Value), 10, 64); err == nil {
+			db.hashIndex.indexes.HExpire(key, string(idx.Meta.Extra), deadline)
+		}
+	case HashHPersist:
+		db.hashIndex.indexes.HPersist(key, string(idx.Meta.Extra))
 	}
 }
 
@@ -156,6 +277,8 @@ func (db *kDB) buildSetIndex(idx *index.Indexer, opt uint16) {
 	case SetSMove:
 		extra := idx.Meta.Extra
 		db.setIndex.indexes.SMove(key, string(extra), idx.Meta.Value)
+	case SetSClear:
+		db.setIndex.indexes.SClear(key)
 	}
 }
 
@@ -175,10 +298,271 @@ func (db *kDB) buildZsetIndex(idx *index.Indexer, opt uint16) {
 		}
 	case ZSetZRem:
 		db.zsetIndex.indexes.ZRem(key, string(idx.Meta.Value))
+	case ZSetZClear:
+		db.zsetIndex.indexes.ZClear(key)
+	case ZSetZRemRange:
+		members, _ := zset.DecodeMembers(idx.Meta.Value)
+		for _, m := range members {
+			db.zsetIndex.indexes.ZRem(key, m)
+		}
 	}
 }
 
-//loadIdxFromFiles load String、List、Hash、Set、ZSet indexes from files
+// buildHllIndex 建立HyperLogLog索引
+// build hyperloglog indexes
+func (db *kDB) buildHllIndex(idx *index.Indexer, opt uint16) {
+	if db.hllIndex == nil || idx == nil {
+		return
+	}
+
+	key := string(idx.Meta.Key)
+	switch opt {
+	case HyperLogLogPFAdd:
+		db.hllIndex.indexes.PFAdd(key, idx.Meta.Value)
+	case HyperLogLogPFMerge:
+		_ = db.hllIndex.indexes.Restore(key, idx.Meta.Value)
+	}
+}
+
+// buildStreamIndex 建立流索引
+// build stream indexes
+func (db *kDB) buildStreamIndex(idx *index.Indexer, opt uint16) {
+	if db.streamIndex == nil || idx == nil {
+		return
+	}
+
+	key := string(idx.Meta.Key)
+	switch opt {
+	case StreamXAdd:
+		id, err := stream.ParseID(string(idx.Meta.Extra), 0)
+		if err != nil {
+			return
+		}
+		if fields, err := stream.DecodeFields(idx.Meta.Value); err == nil {
+			db.streamIndex.indexes.XAdd(key, id, fields)
+		}
+	case StreamXTrim:
+		if minID, err := stream.ParseID(string(idx.Meta.Extra), 0); err == nil {
+			db.streamIndex.indexes.XTrimMinID(key, minID)
+		}
+	case StreamXGroup:
+		if u, err := stream.DecodeGroupUpdate(idx.Meta.Value); err == nil {
+			db.streamIndex.indexes.ApplyGroup(key, u)
+		}
+	case StreamXSnapshot:
+		_ = db.streamIndex.indexes.Restore(key, idx.Meta.Value)
+	}
+}
+
+// buildJSONIndex 建立JSON文档索引
+// build json document indexes
+func (db *kDB) buildJSONIndex(idx *index.Indexer, opt uint16) {
+	if db.jsonIndex == nil || idx == nil {
+		return
+	}
+
+	applyJSON(db.jsonIndex.indexes, string(idx.Meta.Key), opt, string(idx.Meta.Extra), idx.Meta.Value)
+}
+
+// applyJSON 将日志中记录的一次路径修改应用到文档上，Reclaim时也用于重放旧的数据文件
+// applies a path-level mutation in the log to the documents, also used by Reclaim to replay the archived files
+func applyJSON(docs *document.Documents, key string, opt uint16, path string, value []byte) {
+	switch opt {
+	case JSONSet:
+		_, _ = docs.Set(key, path, value)
+	case JSONDel:
+		_, _ = docs.Del(key, path)
+	case JSONNumIncrBy:
+		_, _ = docs.NumIncrBy(key, path, value)
+	case JSONArrAppend:
+		var values []json.RawMessage
+		if err := json.Unmarshal(value, &values); err != nil {
+			return
+		}
+		elems := make([][]byte, len(values))
+		for i, v := range values {
+			elems[i] = v
+		}
+		_, _ = docs.ArrAppend(key, path, elems...)
+	}
+}
+
+// buildBloomIndex 建立布隆过滤器和布谷鸟过滤器索引
+// build bloom and cuckoo filter indexes
+func (db *kDB) buildBloomIndex(idx *index.Indexer, opt uint16) {
+	if db.bloomIndex == nil || idx == nil {
+		return
+	}
+
+	applyBloom(db.bloomIndex.indexes, string(idx.Meta.Key), opt, idx.Meta.Extra, idx.Meta.Value)
+}
+
+// applyBloom 将日志中记录的操作应用到过滤器上，Reclaim时也用于重放旧的数据文件
+// applies an operation in the log to the filters, also used by Reclaim to replay the archived files
+func applyBloom(filters *bloom.Filters, key string, opt uint16, extra, value []byte) {
+	switch opt {
+	case BloomBFReserve:
+		s := strings.Split(string(extra), ExtraSeparator)
+		if len(s) != 3 {
+			return
+		}
+		errorRate, err1 := strconv.ParseFloat(s[0], 64)
+		capacity, err2 := strconv.ParseUint(s[1], 10, 64)
+		expansion, err3 := strconv.ParseUint(s[2], 10, 64)
+		if err1 == nil && err2 == nil && err3 == nil {
+			_ = filters.BFReserve(key, errorRate, capacity, expansion)
+		}
+	case BloomBFAdd:
+		_, _ = filters.BFAdd(key, value)
+	case BloomCFReserve:
+		s := strings.Split(string(extra), ExtraSeparator)
+		if len(s) != 4 {
+			return
+		}
+		var params [4]uint64
+		for i := range s {
+			n, err := strconv.ParseUint(s[i], 10, 64)
+			if err != nil {
+				return
+			}
+			params[i] = n
+		}
+		_ = filters.CFReserve(key, params[0], params[1], params[2], params[3])
+	case BloomCFAdd:
+		_ = filters.CFAdd(key, value)
+	case BloomCFDel:
+		_, _ = filters.CFDel(key, value)
+	case BloomRestore:
+		_ = filters.Restore(key, value)
+	}
+}
+
+// buildSketchIndex 建立Count-Min Sketch和Top-K索引
+// build count-min sketch and top-k indexes
+func (db *kDB) buildSketchIndex(idx *index.Indexer, opt uint16) {
+	if db.sketchIndex == nil || idx == nil {
+		return
+	}
+
+	applySketch(db.sketchIndex.indexes, string(idx.Meta.Key), opt, idx.Meta.Extra, idx.Meta.Value)
+}
+
+// applySketch 将日志中记录的操作应用到sketch上，Reclaim时也用于重放旧的数据文件
+// applies an operation in the log to the sketches, also used by Reclaim to replay the archived files
+func applySketch(sketches *sketch.Sketches, key string, opt uint16, extra, value []byte) {
+	switch opt {
+	case SketchCMSInit:
+		s := strings.Split(string(extra), ExtraSeparator)
+		if len(s) != 2 {
+			return
+		}
+		width, err1 := strconv.ParseUint(s[0], 10, 64)
+		depth, err2 := strconv.ParseUint(s[1], 10, 64)
+		if err1 == nil && err2 == nil {
+			_ = sketches.CMSInitByDim(key, width, depth)
+		}
+	case SketchCMSIncrBy:
+		if incr, err := strconv.ParseUint(string(extra), 10, 64); err == nil {
+			_, _ = sketches.CMSIncrBy(key, value, incr)
+		}
+	case SketchTopKReserve:
+		s := strings.Split(string(extra), ExtraSeparator)
+		if len(s) != 4 {
+			return
+		}
+		k, err1 := strconv.ParseUint(s[0], 10, 64)
+		width, err2 := strconv.ParseUint(s[1], 10, 64)
+		depth, err3 := strconv.ParseUint(s[2], 10, 64)
+		decay, err4 := strconv.ParseFloat(s[3], 64)
+		if err1 == nil && err2 == nil && err3 == nil && err4 == nil {
+			_ = sketches.TopKReserve(key, k, width, depth, decay)
+		}
+	case SketchTopKIncrBy:
+		if incr, err := strconv.ParseUint(string(extra), 10, 64); err == nil {
+			_, _ = sketches.TopKIncrBy(key, value, incr)
+		}
+	case SketchRestore:
+		_ = sketches.Restore(key, value)
+	}
+}
+
+// buildTimeSeriesIndex 建立时间序列索引
+// build time series indexes
+func (db *kDB) buildTimeSeriesIndex(idx *index.Indexer, opt uint16) {
+	if db.timeSeriesIndex == nil || idx == nil {
+		return
+	}
+
+	applyTimeSeries(db.timeSeriesIndex.indexes, string(idx.Meta.Key), opt, string(idx.Meta.Extra), idx.Meta.Value)
+}
+
+// applyTimeSeries 将日志中记录的操作应用到时间序列上，Reclaim时也用于重放旧的数据文件
+// applies an operation in the log to the time series, also used by Reclaim to replay the archived files
+func applyTimeSeries(series *timeseries.TimeSeries, key string, opt uint16, extra string, value []byte) {
+	switch opt {
+	case TimeSeriesCreate:
+		retention, err := strconv.ParseInt(extra, 10, 64)
+		labels, err2 := timeseries.DecodeLabels(value)
+		if err == nil && err2 == nil {
+			_ = series.Create(key, retention, labels)
+		}
+	case TimeSeriesAdd:
+		timestamp, err1 := strconv.ParseInt(extra, 10, 64)
+		v, err2 := strconv.ParseFloat(string(value), 64)
+		if err1 == nil && err2 == nil {
+			_ = series.Add(key, timestamp, v)
+		}
+	case TimeSeriesCreateRule:
+		s := strings.Split(extra, ExtraSeparator)
+		if len(s) != 3 {
+			return
+		}
+		agg, err1 := strconv.ParseUint(s[1], 10, 8)
+		bucket, err2 := strconv.ParseInt(s[2], 10, 64)
+		if err1 == nil && err2 == nil {
+			_ = series.CreateRule(key, s[0], timeseries.Aggregation(agg), bucket)
+		}
+	case TimeSeriesDeleteRule:
+		_ = series.DeleteRule(key, extra)
+	case TimeSeriesRestore:
+		_ = series.Restore(key, value)
+	}
+}
+
+// buildVectorIndex 建立向量索引，HNSW 图随向量的添加重新建立
+// build vector indexes, the HNSW graphs are built again as the vectors are added
+func (db *kDB) buildVectorIndex(idx *index.Indexer, opt uint16) {
+	if db.vectorIndex == nil || idx == nil {
+		return
+	}
+
+	applyVector(db.vectorIndex.indexes, string(idx.Meta.Key), opt, string(idx.Meta.Extra), idx.Meta.Value)
+}
+
+// applyVector 将日志中记录的操作应用到向量索引上，Reclaim时也用于重放旧的数据文件
+// applies an operation in the log to the vector indexes, also used by Reclaim to replay the archived files
+func applyVector(vectors *vector.Vectors, name string, opt uint16, extra string, value []byte) {
+	switch opt {
+	case VectorCreate:
+		s := strings.Split(extra, ExtraSeparator)
+		if len(s) != 2 {
+			return
+		}
+		dim, err1 := strconv.Atoi(s[0])
+		metric, err2 := strconv.ParseUint(s[1], 10, 8)
+		if err1 == nil && err2 == nil {
+			_ = vectors.Create(name, dim, vector.Metric(metric))
+		}
+	case VectorAdd:
+		if key, vec, meta, err := vector.DecodeMember(value); err == nil {
+			_ = vectors.Add(name, key, vec, meta)
+		}
+	case VectorDel:
+		_, _ = vectors.Del(name, string(value))
+	}
+}
+
+//loadIdxFromFiles load String、List、Hash、Set、ZSet、HyperLogLog、Stream、JSON、Bloom、Sketch、TimeSeries、Vector indexes from files
 func (db *kDB) loadIdxFromFiles() error {
 	if db.archFiles == nil && db.activeFile == nil {
 		return nil
@@ -190,6 +574,14 @@ func (db *kDB) loadIdxFromFiles() error {
 		dbFile[k] = v
 		fileIds = append(fileIds, int(k))
 	}
+	if db.activeFile != nil {
+		dbFile[db.activeFileID] = db.activeFile
+		fileIds = append(fileIds, int(db.activeFileID))
+	}
+
+	//entries of an unfinished batch, applied when the batch is completed
+	var batch []*storage.Entry
+	var batchIdx []*index.Indexer
 
 	sort.Ints(fileIds)
 	for i := 0; i < len(fileIds); i++ {
@@ -207,6 +599,18 @@ func (db *kDB) loadIdxFromFiles() error {
 				}
 				offset += int64(e.Size())
 
+				if e.Continued {
+					batch = append(batch, e)
+					batchIdx = append(batchIdx, idx)
+					continue
+				}
+				for j := range batch {
+					if err := db.buildIndex(batch[j], batchIdx[j]); err != nil {
+						return err
+					}
+				}
+				batch, batchIdx = nil, nil
+
 				if err := db.buildIndex(e, idx); err != nil {
 					return err
 				}
@@ -219,5 +623,30 @@ func (db *kDB) loadIdxFromFiles() error {
 		}
 	}
 
+	//the last batch is not completely written, discard it
+	if len(batch) > 0 {
+		return db.discardBatch(dbFile, fileIds, batchIdx[0].FileId, batchIdx[0].Offset)
+	}
+	return nil
+}
+
+//discardBatch 丢弃未完整写入的批次，从批次的起始位置截断数据文件
+//discard the unfinished batch by truncating the db files from the start of it
+func (db *kDB) discardBatch(dbFile ArchivedFiles, fileIds []int, fid uint32, offset int64) error {
+	for _, id := range fileIds {
+		if uint32(id) < fid {
+			continue
+		}
+
+		var off int64 = 0
+		if uint32(id) == fid {
+			off = offset
+		}
+		if err := dbFile[uint32(id)].Truncate(off); err != nil {
+			return err
+		}
+	}
+
+	db.meta.ActiveWriteOff = db.activeFile.Offset
 	return nil
 }
@@ -4,13 +4,15 @@ import (
 	"bytes"
 	"encoding/json"
 	"errors"
-	"fmt"
+	"github.com/KarlvenK/kDB/ds/stream"
 	"github.com/KarlvenK/kDB/index"
 	"github.com/KarlvenK/kDB/storage"
 	"github.com/KarlvenK/kDB/utils"
 	"io"
 	"io/ioutil"
 	"os"
+	"sort"
+	"strconv"
 	"sync"
 	"time"
 )
@@ -45,6 +47,69 @@ var (
 
 	// ErrKeyExpired the key is expired
 	ErrKeyExpired = errors.New("kdb: key is expired")
+
+	// ErrValueNotInteger the value is not an integer or out of range
+	ErrValueNotInteger = errors.New("kdb: value is not an integer or out of range")
+
+	// ErrValueNotFloat the value is not a valid float
+	ErrValueNotFloat = errors.New("kdb: value is not a valid float")
+
+	// ErrIncrOverflow increment or decrement would overflow
+	ErrIncrOverflow = errors.New("kdb: increment or decrement would overflow")
+
+	// ErrWrongNumberOfArgs the number of arguments is wrong, e.g. keys and values are not in pairs
+	ErrWrongNumberOfArgs = errors.New("kdb: wrong number of arguments")
+
+	// ErrOffsetOutOfRange the offset is out of range
+	ErrOffsetOutOfRange = errors.New("kdb: offset is out of range")
+
+	// ErrInvalidBit the bit is not 0 or 1
+	ErrInvalidBit = errors.New("kdb: bit is not 0 or 1")
+
+	// ErrInvalidBitOp the bit operation is invalid
+	ErrInvalidBitOp = errors.New("kdb: invalid bit operation")
+
+	// ErrStreamIDTooSmall the ID of XAdd is equal or smaller than the greatest ID of the stream
+	ErrStreamIDTooSmall = errors.New("kdb: the stream ID is equal or smaller than the greatest one")
+
+	// ErrGroupExists the consumer group already exists
+	ErrGroupExists = errors.New("kdb: consumer group already exists")
+
+	// ErrNoSuchGroup the consumer group does not exist
+	ErrNoSuchGroup = errors.New("kdb: no such consumer group")
+
+	// ErrMemberNotExist the member does not exist
+	ErrMemberNotExist = errors.New("kdb: member not exist")
+
+	// ErrInvalidCoordinates the longitude or the latitude is out of range
+	ErrInvalidCoordinates = errors.New("kdb: invalid longitude or latitude")
+
+	// ErrInvalidGeoUnit the distance unit is not one of m, km, mi and ft
+	ErrInvalidGeoUnit = errors.New("kdb: invalid distance unit")
+
+	// ErrInvalidGeoShape neither a positive radius nor a positive width and height is given
+	ErrInvalidGeoShape = errors.New("kdb: invalid radius or box of geo search")
+
+	// ErrInvalidAggregate the aggregate of the sorted sets is not sum, min or max
+	ErrInvalidAggregate = errors.New("kdb: invalid aggregate")
+
+	// ErrInvalidZAddFlags NX is given with XX, GT or LT, GT is given with LT, or INCR is given with more than one member
+	ErrInvalidZAddFlags = errors.New("kdb: invalid flags of zadd")
+
+	// ErrInvalidLPosOption the count or maxlen of LPos is negative
+	ErrInvalidLPosOption = errors.New("kdb: count and maxlen of lpos can not be negative")
+
+	// ErrDBClosed the db is closed while waiting
+	ErrDBClosed = errors.New("kdb: db is closed")
+
+	// ErrSortNotNumber an element or weight of a numeric sort is not a valid float
+	ErrSortNotNumber = errors.New("kdb: one or more weights of sort can not be converted into float")
+)
+
+// the encodings returned by ObjectEncoding besides the ones of the ds packages
+const (
+	EncodingRaw       = "raw"
+	EncodingQuicklist = "quicklist"
 )
 
 const (
@@ -73,18 +138,28 @@ const (
 type (
 	// kDB the kdb struct
 	kDB struct {
-		activeFile   *storage.DBFile // current active file
-		activeFileID uint32          //current active file id
-		archFiles    ArchivedFiles   //the archived files
-		strIndex     *StrIdx         //string indexes
-		listIndex    *ListIdx        //list indexes
-		hashIndex    *HashIdx        //hash indexes
-		setIndex     *SetIdx         //set indexes
-		zsetIndex    *ZsetIdx        //Zset indexes
-		config       Config          //config of kdb
-		mu           sync.RWMutex
-		meta         *storage.DBMeta //meta info for kdb
-		expires      storage.Expires //expired directory
+		activeFile      *storage.DBFile // current active file
+		activeFileID    uint32          //current active file id
+		archFiles       ArchivedFiles   //the archived files
+		strIndex        *StrIdx         //string indexes
+		listIndex       *ListIdx        //list indexes
+		hashIndex       *HashIdx        //hash indexes
+		setIndex        *SetIdx         //set indexes
+		zsetIndex       *ZsetIdx        //Zset indexes
+		hllIndex        *HllIdx         //hyperloglog indexes
+		streamIndex     *StreamIdx      //stream indexes
+		jsonIndex       *JSONIdx        //json document indexes
+		bloomIndex      *BloomIdx       //bloom and cuckoo filter indexes
+		sketchIndex     *SketchIdx      //count-min sketch and top-k indexes
+		timeSeriesIndex *TimeSeriesIdx  //time series indexes
+		vectorIndex     *VectorIdx      //vector indexes
+		config          Config          //config of kdb
+		mu              sync.RWMutex
+		writeMu         sync.Mutex      //serializes the writes to the db files
+		meta            *storage.DBMeta //meta info for kdb
+		expires         storage.Expires //expired directory
+		cipher          *storage.Cipher //cipher of the current key, nil if encryption is disabled
+		done            chan struct{}   //closed when the db is closed, stops the background tasks
 	}
 
 	//ArchivedFiles define the archived files
@@ -99,6 +174,20 @@ func Open(config Config) (*kDB, error) {
 			return nil, err
 		}
 	}
+
+	//load db meta info, fail if the key is wrong
+	meta, err := storage.LoadMeta(config.DirPath+dbMetaSaveFile, config.KeyProvider)
+	if err != nil {
+		return nil, err
+	}
+
+	var cipher *storage.Cipher
+	if config.KeyProvider != nil {
+		if cipher, err = storage.CurrentCipher(config.KeyProvider); err != nil {
+			return nil, err
+		}
+	}
+
 	//load the db files
 	archFiles, activeFileId, err := storage.Build(config.DirPath, config.RwMethod, config.BlockSize)
 	if err != nil {
@@ -109,55 +198,113 @@ func Open(config Config) (*kDB, error) {
 	if err != nil {
 		return nil, err
 	}
+	activeFile.Offset = meta.ActiveWriteOff
 
-	//load expired directories
-	expires := storage.LoadExpires(config.DirPath + expireFile)
+	//set the ciphers of the encrypted db files
+	if err := loadFileCiphers(config.KeyProvider, meta, archFiles, activeFile); err != nil {
+		return nil, err
+	}
+	if _, exist := meta.FileKeys[activeFileId]; !exist && cipher != nil && activeFile.Offset == 0 {
+		activeFile.SetCipher(cipher)
+		meta.FileKeys[activeFileId] = cipher.KeyId()
+	}
 
-	//load db meta info
-	meta := storage.LoadMeta(config.DirPath + dbMetaSaveFile)
-	activeFile.Offset = meta.ActiveWriteOff
+	//load expired directories
+	expires, err := storage.LoadExpires(config.DirPath+expireFile, config.KeyProvider)
+	if err != nil {
+		return nil, err
+	}
 
 	db := &kDB{
-		activeFile:   activeFile,
-		activeFileID: activeFileId,
-		archFiles:    archFiles,
-		config:       config,
-		strIndex:     newStrIdx(),
-		meta:         meta,
-		listIndex:    newList(),
-		hashIndex:    newHashIdx(),
-		setIndex:     newSetIdx(),
-		zsetIndex:    newZsetIdx(),
-		expires:      expires,
+		activeFile:      activeFile,
+		activeFileID:    activeFileId,
+		archFiles:       archFiles,
+		config:          config,
+		strIndex:        newStrIdx(),
+		meta:            meta,
+		listIndex:       newList(),
+		hashIndex:       newHashIdx(),
+		setIndex:        newSetIdx(),
+		zsetIndex:       newZsetIdx(),
+		hllIndex:        newHllIdx(),
+		streamIndex:     newStreamIdx(),
+		jsonIndex:       newJSONIdx(),
+		bloomIndex:      newBloomIdx(),
+		sketchIndex:     newSketchIdx(),
+		timeSeriesIndex: newTimeSeriesIdx(),
+		vectorIndex:     newVectorIdx(),
+		expires:         expires,
+		cipher:          cipher,
+		done:            make(chan struct{}),
 	}
 
+	db.hashIndex.indexes.SetLimits(listpackLimits(config.HashMaxListpackEntries, config.HashMaxListpackValue))
+	db.setIndex.indexes.SetLimits(listpackLimits(config.SetMaxListpackEntries, config.SetMaxListpackValue))
+	db.zsetIndex.indexes.SetLimits(listpackLimits(config.ZSetMaxListpackEntries, config.ZSetMaxListpackValue))
+
 	//load indexers from files
 	if err := db.loadIdxFromFiles(); err != nil {
 		return nil, err
 	}
+	db.removeExpiredKeys()
+
+	//the encrypted meta is used to check the key when reopen
+	if cipher != nil {
+		if err := db.saveMeta(); err != nil {
+			return nil, err
+		}
+	}
+
+	go db.expireHashFields(db.done)
 	return db, nil
 }
 
 func Reopen(path string) (*kDB, error) {
-	if exist := utils.Exist(path + configSaveFile); !exist {
-		return nil, ErrCfgNotExist
-	}
-
-	var config Config
-	Bytes, err := ioutil.ReadFile(path + configSaveFile)
+	config, err := loadConfig(path)
 	if err != nil {
 		return nil, err
 	}
-	if err := json.Unmarshal(Bytes, &config); err != nil {
+	return Open(config)
+}
+
+//ReopenWithKey 使用保存的配置和给定的密钥重新打开加密的数据库，密钥不会保存在配置文件中
+//reopens an encrypted db with the saved config and the key provider, which is not saved in the config file
+func ReopenWithKey(path string, kp storage.KeyProvider) (*kDB, error) {
+	config, err := loadConfig(path)
+	if err != nil {
 		return nil, err
 	}
+	config.KeyProvider = kp
 	return Open(config)
 }
 
+//loadConfig 读取关闭数据库时保存的配置
+//load the config saved when the db is closed
+func loadConfig(path string) (config Config, err error) {
+	if exist := utils.Exist(path + configSaveFile); !exist {
+		return config, ErrCfgNotExist
+	}
+
+	Bytes, err := ioutil.ReadFile(path + configSaveFile)
+	if err != nil {
+		return config, err
+	}
+	err = json.Unmarshal(Bytes, &config)
+	return
+}
+
 //Close 关闭数据库，保存config
 func (db *kDB) Close() error {
 	db.mu.Lock()
 	defer db.mu.Unlock()
+	db.writeMu.Lock()
+	defer db.writeMu.Unlock()
+
+	select {
+	case <-db.done:
+	default:
+		close(db.done)
+	}
 
 	if err := db.saveConfig(); err != nil {
 		return err
@@ -165,7 +312,7 @@ func (db *kDB) Close() error {
 	if err := db.saveMeta(); err != nil {
 		return err
 	}
-	if err := db.expires.SaveExpires(db.config.DirPath + expireFile); err != nil {
+	if err := db.expires.SaveExpires(db.config.DirPath+expireFile, db.config.KeyProvider); err != nil {
 		return err
 	}
 
@@ -205,14 +352,28 @@ func (db *kDB) Reclaim() (err error) {
 	}()
 
 	var (
-		activeFileId uint32 = 0
-		newArchFiles        = make(ArchivedFiles)
+		newFileId    uint32
+		newArchFiles = make(ArchivedFiles)
+		newFileKeys  = make(map[uint32]uint32)
 		df           *storage.DBFile
+		reclaimers   = db.reclaimers()
 	)
 
 	db.mu.Lock()
 	defer db.mu.Unlock()
-	for _, file := range db.archFiles {
+
+	//the new db files take the ids after the active file, so they never collide with the ones being reclaimed
+	newFileId = db.activeFileID + 1
+
+	//rewrite the entries in the order they were written, which the replay depends on
+	var fileIds []int
+	for id := range db.archFiles {
+		fileIds = append(fileIds, int(id))
+	}
+	sort.Ints(fileIds)
+
+	for i, fid := range fileIds {
+		file := db.archFiles[uint32(fid)]
 		var offset int64 = 0
 		var reclaimEntries []*storage.Entry
 
@@ -226,11 +387,16 @@ func (db *kDB) Reclaim() (err error) {
 
 		for {
 			if e, err := file.Read(offset); err == nil {
-				//check if the entry is valid
-				if db.validEntry(e, offset, fileId) {
-					reclaimEntries = append(reclaimEntries, e)
+				//the reclaimer may change the entry, so the size is taken as it is read
+				size := int64(e.Size())
+				//the entries of the types not registered are dropped
+				if int(e.Type) < len(reclaimers) {
+					valid := db.validEntry(e, offset, fileId)
+					if entry := reclaimers[e.Type].reclaim(e, valid); entry != nil {
+						reclaimEntries = append(reclaimEntries, entry)
+					}
 				}
-				offset += int64(e.Size())
+				offset += size
 			} else {
 				if err == io.EOF {
 					break
@@ -239,34 +405,48 @@ func (db *kDB) Reclaim() (err error) {
 			}
 		}
 
+		//the data replayed from the archived files, the active file is replayed after them
+		if i == len(fileIds)-1 {
+			for _, r := range reclaimers {
+				reclaimEntries = append(reclaimEntries, r.snapshot()...)
+			}
+		}
+
 		//rewrite entry to the db file
 		if len(reclaimEntries) > 0 {
 			for _, entry := range reclaimEntries {
-				if df == nil || int64(entry.Size())+df.Offset > db.config.BlockSize {
-					df, err = storage.NewDBFile(reclaimPath, activeFileId, db.config.RwMethod, db.config.BlockSize)
+				//the entry may be sealed in the new file, even if it is read from a plain one or built from a snapshot
+				if df == nil || int64(df.EntrySize(entry))+df.Offset > db.config.BlockSize {
+					//the new db files are encrypted with the current key
+					df, err = db.newDBFile(reclaimPath, newFileId)
 					if err != nil {
 						return err
 					}
 
-					newArchFiles[activeFileId] = df
-					activeFileId++
+					newArchFiles[newFileId] = df
+					if c := df.Cipher(); c != nil {
+						newFileKeys[newFileId] = c.KeyId()
+					}
+					newFileId++
 				}
 
+				//the rewritten entries are all committed
+				entry.Continued = false
 				if err = df.Write(entry); err != nil {
 					return
 				}
 
-				//update string indexers
-				if entry.Type == String {
-					item := db.strIndex.idxList.Get(entry.Meta.Key)
-					idx := item.Value().(*index.Indexer)
-					idx.Offset = df.Offset - int64(entry.Size())
-					idx.FileId = activeFileId
-					db.strIndex.idxList.Put(idx.Meta.Key, idx)
+				//update the indexers of the rewritten entry
+				if rw, ok := reclaimers[entry.Type].(rewriter); ok {
+					rw.rewritten(entry, df.Id, df.Offset-int64(entry.Size()))
 				}
 			}
 		}
 	}
+	//the db files are swapped while no entry is being written
+	db.writeMu.Lock()
+	defer db.writeMu.Unlock()
+
 	//删除旧的数据，临时目录拷贝位新的数据文件
 	//delete the old db files, and copy the directory as new db files
 	for _, v := range db.archFiles {
@@ -274,14 +454,161 @@ func (db *kDB) Reclaim() (err error) {
 	}
 
 	for _, v := range newArchFiles {
-		name := storage.PathSeparator + fmt.Sprintf(storage.DBFileFormatName, v.Id)
-		_ = os.Rename(reclaimPath+name, db.config.DirPath+name)
+		if err = v.Rename(db.config.DirPath, v.Id); err != nil {
+			return
+		}
 	}
 
 	db.archFiles = newArchFiles
+
+	//the active file is replayed after the new db files, so it takes the id after them
+	if len(newArchFiles) > 0 {
+		if err = db.moveActiveFile(newFileId); err != nil {
+			return
+		}
+	}
+
+	//record the keys of the new db files
+	for id := range db.meta.FileKeys {
+		if id != db.activeFileID {
+			delete(db.meta.FileKeys, id)
+		}
+	}
+	for id, keyId := range newFileKeys {
+		db.meta.FileKeys[id] = keyId
+	}
+	err = db.saveMeta()
+	return
+}
+
+//reclaimer Reclaim 时一种数据类型的钩子，由该类型的索引创建
+//the hook of a data type in Reclaim, which is created by the indexes of the type
+type reclaimer interface {
+	//reclaim 处理旧数据文件中的一个entry，valid 表示entry仍然有效，返回需要重写的entry，没有时返回nil
+	//handles an entry of the archived files, returns the entry to rewrite or nil
+	reclaim(e *storage.Entry, valid bool) *storage.Entry
+	//snapshot 返回重放旧数据文件得到的快照，写在最后一个旧数据文件的entries之后
+	//returns the snapshot replayed from the archived files, which is written after the entries of the last one
+	snapshot() []*storage.Entry
+}
+
+//rewriter 在 entry 重写后更新索引
+//updates the indexes after an entry is rewritten at offset of the file
+type rewriter interface {
+	rewritten(e *storage.Entry, fileId uint32, offset int64)
+}
+
+//reclaimers 返回每种数据类型的 reclaimer，快照按类型的顺序写入
+//returns the reclaimers indexed by the data type, the snapshots are written in the order of the types
+func (db *kDB) reclaimers() []reclaimer {
+	return []reclaimer{
+		String:      db.strIndex.reclaimer(db),
+		List:        db.listIndex.reclaimer(),
+		Hash:        db.hashIndex.reclaimer(),
+		Set:         db.setIndex.reclaimer(),
+		ZSet:        db.zsetIndex.reclaimer(),
+		HyperLogLog: db.hllIndex.reclaimer(),
+		Stream:      db.streamIndex.reclaimer(),
+		JSON:        db.jsonIndex.reclaimer(),
+		Bloom:       db.bloomIndex.reclaimer(),
+		Sketch:      db.sketchIndex.reclaimer(),
+		TimeSeries:  db.timeSeriesIndex.reclaimer(),
+		Vector:      db.vectorIndex.reclaimer(),
+	}
+}
+
+//validReclaimer 保留仍然有效的entry
+//keeps the entries still valid
+type validReclaimer struct{}
+
+func (validReclaimer) reclaim(e *storage.Entry, valid bool) *storage.Entry {
+	if valid {
+		return e
+	}
+	return nil
+}
+
+func (validReclaimer) snapshot() []*storage.Entry {
+	return nil
+}
+
+//replayReclaimer 重放旧数据文件中的所有entry，最后按key的顺序写入每个key的快照
+//replays all entries of the archived files, since the operations depend on the ones before them,
+//and writes the snapshot of each key in the order of the keys at last
+type replayReclaimer struct {
+	apply func(e *storage.Entry)
+	keys  func() []string
+	dump  func(key string) []*storage.Entry
+}
+
+func (r *replayReclaimer) reclaim(e *storage.Entry, valid bool) *storage.Entry {
+	r.apply(e)
+	return nil
+}
+
+func (r *replayReclaimer) snapshot() (entries []*storage.Entry) {
+	keys := r.keys()
+	sort.Strings(keys)
+	for _, key := range keys {
+		entries = append(entries, r.dump(key)...)
+	}
 	return
 }
 
+//keySnapshotReclaimer 保留仍然有效的entry，一个key无效的entries替换为一个当前数据的快照
+//keeps the entries still valid, and replaces the dropped entries of a key by one entry of its current data
+type keySnapshotReclaimer struct {
+	keys map[string]bool
+	dump func(e *storage.Entry) //sets the snapshot of the key as the value of e
+}
+
+func (r *keySnapshotReclaimer) reclaim(e *storage.Entry, valid bool) *storage.Entry {
+	if valid {
+		return e
+	}
+	if r.keys[string(e.Meta.Key)] {
+		return nil
+	}
+	r.keys[string(e.Meta.Key)] = true
+	r.dump(e)
+	return e
+}
+
+func (r *keySnapshotReclaimer) snapshot() []*storage.Entry {
+	return nil
+}
+
+// ObjectEncoding 返回 key 的值在内存中的编码，依次查找字符串、列表、哈希表、集合和有序集，key 不存在时返回 ErrKeyNotExist
+// 字符串为 raw，列表为 quicklist，哈希表和集合为 listpack 或 hashtable，有序集为 listpack 或 skiplist
+// returns the in-memory encoding of the value of key, looking up the strings, lists, hashes, sets and sorted sets in turn.
+// It is raw for a string, quicklist for a list, listpack or hashtable for a hash or a set, and listpack or skiplist
+// for a sorted set. Returns ErrKeyNotExist if none of them holds key.
+func (db *kDB) ObjectEncoding(key []byte) (string, error) {
+	if err := db.checkKeyValue(key, nil); err != nil {
+		return "", err
+	}
+
+	switch {
+	case db.StrExists(key):
+		return EncodingRaw, nil
+	case db.LLen(key) > 0:
+		return EncodingQuicklist, nil
+	case db.HLen(key) > 0:
+		db.hashIndex.mu.RLock()
+		defer db.hashIndex.mu.RUnlock()
+		return db.hashIndex.indexes.Encoding(string(key)), nil
+	case db.SCard(key) > 0:
+		db.setIndex.mu.RLock()
+		defer db.setIndex.mu.RUnlock()
+		return db.setIndex.indexes.Encoding(string(key)), nil
+	case db.ZCard(key) > 0:
+		db.zsetIndex.mu.RLock()
+		defer db.zsetIndex.mu.RUnlock()
+		return db.zsetIndex.indexes.Encoding(string(key)), nil
+	}
+	return "", ErrKeyNotExist
+}
+
 //Backup 复制数据库目录，用于备份
 func (db *kDB) Backup(dir string) (err error) {
 	if utils.Exist(db.config.DirPath) {
@@ -323,7 +650,53 @@ func (db *kDB) saveConfig() (err error) {
 
 func (db *kDB) saveMeta() error {
 	metaPath := db.config.DirPath + dbMetaSaveFile
-	return db.meta.Store(metaPath)
+	return db.meta.Store(metaPath, db.config.KeyProvider)
+}
+
+//newDBFile 新建数据文件，并使用当前密钥加密
+func (db *kDB) newDBFile(path string, fileId uint32) (*storage.DBFile, error) {
+	df, err := storage.NewDBFile(path, fileId, db.config.RwMethod, db.config.BlockSize)
+	if err != nil {
+		return nil, err
+	}
+
+	if db.cipher != nil {
+		df.SetCipher(db.cipher)
+	}
+	return df, nil
+}
+
+//loadFileCiphers 根据元数据中记录的密钥id设置数据文件的加密方式
+//set the ciphers of the db files by the key ids saved in meta
+func loadFileCiphers(kp storage.KeyProvider, meta *storage.DBMeta, archFiles ArchivedFiles, activeFile *storage.DBFile) error {
+	ciphers := make(map[uint32]*storage.Cipher)
+	setCipher := func(df *storage.DBFile) error {
+		keyId, exist := meta.FileKeys[df.Id]
+		if !exist {
+			return nil
+		}
+		if kp == nil {
+			return storage.ErrKeyRequired
+		}
+
+		c, ok := ciphers[keyId]
+		if !ok {
+			var err error
+			if c, err = storage.LoadCipher(kp, keyId); err != nil {
+				return err
+			}
+			ciphers[keyId] = c
+		}
+		df.SetCipher(c)
+		return nil
+	}
+
+	for _, df := range archFiles {
+		if err := setCipher(df); err != nil {
+			return err
+		}
+	}
+	return setCipher(activeFile)
 }
 
 //buildIndex 建立索引
@@ -344,46 +717,166 @@ func (db *kDB) buildIndex(e *storage.Entry, idx *index.Indexer) error {
 		db.buildSetIndex(idx, e.Mark)
 	case storage.ZSet:
 		db.buildZsetIndex(idx, e.Mark)
+	case storage.HyperLogLog:
+		db.buildHllIndex(idx, e.Mark)
+	case storage.Stream:
+		db.buildStreamIndex(idx, e.Mark)
+	case storage.JSON:
+		db.buildJSONIndex(idx, e.Mark)
+	case storage.Bloom:
+		db.buildBloomIndex(idx, e.Mark)
+	case storage.Sketch:
+		db.buildSketchIndex(idx, e.Mark)
+	case storage.TimeSeries:
+		db.buildTimeSeriesIndex(idx, e.Mark)
+	case storage.Vector:
+		db.buildVectorIndex(idx, e.Mark)
 	}
 	return nil
 }
 
+//moveActiveFile 修改活跃文件的id，并更新指向它的字符串索引
+//change the id of the active file, and update the string indexes pointing to it
+func (db *kDB) moveActiveFile(fileId uint32) error {
+	oldId := db.activeFileID
+	if err := db.activeFile.Rename(db.config.DirPath, fileId); err != nil {
+		return err
+	}
+	db.activeFileID = fileId
+
+	if keyId, exist := db.meta.FileKeys[oldId]; exist {
+		delete(db.meta.FileKeys, oldId)
+		db.meta.FileKeys[fileId] = keyId
+	}
+
+	db.strIndex.idxList.Foreach(func(e *index.Element) bool {
+		if idx := e.Value().(*index.Indexer); idx.FileId == oldId {
+			idx.FileId = fileId
+		}
+		return true
+	})
+	return nil
+}
+
 //store entry to db file
 func (db *kDB) store(e *storage.Entry) error {
-	//sync the db file if file size is not enough, and open a new db file
-	config := db.config
-	if db.activeFile.Offset+int64(e.Size()) > config.BlockSize {
-		if err := db.activeFile.Sync(); err != nil {
+	_, err := db.storeBatch(e)
+	return err
+}
+
+//rotateActiveFile 封存当前的活跃文件，并打开一个新的数据文件
+//archive the active file and open a new db file
+func (db *kDB) rotateActiveFile() error {
+	if err := db.activeFile.Sync(); err != nil {
+		return err
+	}
+
+	activeFileID := db.activeFileID + 1
+	dbFile, err := db.newDBFile(db.config.DirPath, activeFileID)
+	if err != nil {
+		return err
+	}
+
+	//save the old file
+	db.archFiles[db.activeFileID] = db.activeFile
+	db.activeFile = dbFile
+	db.activeFileID = activeFileID
+	db.meta.ActiveWriteOff = 0
+
+	//record the key of the new db file at once
+	if db.cipher != nil {
+		db.meta.FileKeys[activeFileID] = db.cipher.KeyId()
+		if err := db.saveMeta(); err != nil {
 			return err
 		}
+	}
+	return nil
+}
 
-		//save the old file
-		db.archFiles[db.activeFileID] = db.activeFile
-		activeFileID := db.activeFileID + 1
+//storeBatch 在数据库的写锁下写入一批entry，每个数据文件中的部分一次写入，失败时截断已写入的部分，
+//重放时只有完整写入的批次才会生效，返回每个entry的位置索引
+//store the entries as one batch under the write lock of the db, the part in each db file is written at once,
+//and the written parts are truncated if it fails. Replay applies a batch only if it is completely written.
+func (db *kDB) storeBatch(entries ...*storage.Entry) (idxes []*index.Indexer, err error) {
+	db.writeMu.Lock()
+	defer db.writeMu.Unlock()
 
-		if dbFile, err := storage.NewDBFile(config.DirPath, activeFileID, config.RwMethod, config.BlockSize); err != nil {
-			return err
-		} else {
-			db.activeFile = dbFile
-			db.activeFileID = activeFileID
-			db.meta.ActiveWriteOff = 0
+	for i, e := range entries {
+		e.Continued = i < len(entries)-1
+	}
+
+	//keep the batch in one db file if it can
+	var size int64
+	for _, e := range entries {
+		size += int64(db.activeFile.EntrySize(e))
+	}
+	if db.activeFile.Offset > 0 && db.activeFile.Offset+size > db.config.BlockSize && size <= db.config.BlockSize {
+		if err = db.rotateActiveFile(); err != nil {
+			return nil, err
 		}
 	}
 
-	//write data to db file
-	if err := db.activeFile.Write(e); err != nil {
-		return err
+	//the db files written and where the batch starts in them, which are truncated if the batch fails
+	var written []*storage.DBFile
+	var starts []int64
+	defer func() {
+		if err != nil {
+			for i, df := range written {
+				_ = df.Truncate(starts[i])
+			}
+			db.meta.ActiveWriteOff = db.activeFile.Offset
+		}
+	}()
+
+	for rest := entries; len(rest) > 0; {
+		//the entries the active file can hold, an entry larger than a db file is written to an empty one
+		var n int
+		offset := db.activeFile.Offset
+		for n < len(rest) && offset+int64(db.activeFile.EntrySize(rest[n])) <= db.config.BlockSize {
+			offset += int64(db.activeFile.EntrySize(rest[n]))
+			n++
+		}
+		if n == 0 && db.activeFile.Offset > 0 {
+			if err = db.rotateActiveFile(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if n == 0 {
+			n = 1
+		}
+
+		written = append(written, db.activeFile)
+		starts = append(starts, db.activeFile.Offset)
+
+		var offsets []int64
+		if offsets, err = db.activeFile.WriteEntries(rest[:n]...); err != nil {
+			return nil, err
+		}
+		for i, e := range rest[:n] {
+			idxes = append(idxes, &index.Indexer{
+				Meta: &storage.Meta{
+					KeySize:   uint32(len(e.Meta.Key)),
+					Key:       e.Meta.Key,
+					ValueSize: uint32(len(e.Meta.Value)),
+				},
+				FileId:    db.activeFileID,
+				EntrySize: e.Size(),
+				Offset:    offsets[i],
+			})
+		}
+		rest = rest[n:]
 	}
 
 	db.meta.ActiveWriteOff = db.activeFile.Offset
 
 	//persist the data to disk
-	if config.Sync {
-		if err := db.activeFile.Sync(); err != nil {
-			return err
+	if db.config.Sync {
+		if err = db.activeFile.Sync(); err != nil {
+			return nil, err
 		}
 	}
-	return nil
+	return idxes, nil
 }
 
 //validEntry 判断entry所属的操作标识（增、改类型操作），以及val是否有效
@@ -394,12 +887,18 @@ func (db *kDB) validEntry(e *storage.Entry, offset int64, fileId uint32) bool {
 	mark := e.Mark
 	switch e.Type {
 	case String:
+		// expired key is invalid
+		now := time.Now().UnixNano() / int64(time.Millisecond)
+		deadline, exist := db.expires[string(e.Meta.Key)]
+		if exist && deadline < now {
+			return false
+		}
+
+		//only the current deadline of a key is kept
+		if mark == StringExpire {
+			return exist && strconv.FormatInt(deadline, 10) == string(e.Meta.Value) && db.StrExists(e.Meta.Key)
+		}
 		if mark == StringSet {
-			// expired key is invalid
-			now := uint32(time.Now().Unix())
-			if deadline, exist := db.expires[string(e.Meta.Key)]; exist && deadline < now {
-				return false
-			}
 
 			//check the data position
 			node := db.strIndex.idxList.Get(e.Meta.Key)
@@ -413,20 +912,26 @@ func (db *kDB) validEntry(e *storage.Entry, offset int64, fileId uint32) bool {
 				}
 			}
 
-			if val, err := db.Get(e.Meta.Key); err == nil && string(val) == string(e.Meta.Value) {
+			//the value may differ from the entry if bits are set after it
+			if _, err := db.Get(e.Meta.Key); err == nil {
 				return true
 			}
 		}
-	case List:
-		if mark == ListLPush || mark == ListRPush || mark == ListLInsert || mark == ListLSet {
-			return true
-		}
 	case Hash:
-		if mark == HashHSet {
+		if mark == HashHSet || mark == HashHMSet || mark == HashHIncrBy {
 			if val := db.HGet(e.Meta.Key, e.Meta.Extra); string(val) == string(e.Meta.Value) {
 				return true
 			}
 		}
+		//only the current deadline of a field not expired is kept
+		if mark == HashHExpire {
+			db.hashIndex.mu.RLock()
+			deadline, ok := db.hashIndex.indexes.HDeadline(string(e.Meta.Key), string(e.Meta.Extra))
+			db.hashIndex.mu.RUnlock()
+			if ok && strconv.FormatInt(deadline, 10) == string(e.Meta.Value) {
+				return true
+			}
+		}
 	case Set:
 		if mark == SetSMove {
 			if db.SIsMember(e.Meta.Extra, e.Meta.Value) {
@@ -438,6 +943,14 @@ func (db *kDB) validEntry(e *storage.Entry, offset int64, fileId uint32) bool {
 				return true
 			}
 		}
+	case Stream:
+		if mark == StreamXAdd {
+			if id, err := stream.ParseID(string(e.Meta.Extra), 0); err == nil {
+				db.streamIndex.mu.RLock()
+				defer db.streamIndex.mu.RUnlock()
+				return db.streamIndex.indexes.EntryExists(string(e.Meta.Key), id)
+			}
+		}
 	case ZSet:
 		if mark == ZSetZAdd {
 			if val, err := utils.StrToFloat64(string(e.Meta.Extra)); err == nil {
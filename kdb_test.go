@@ -1,12 +1,19 @@
 package kDB
 
 import (
+	"bytes"
 	"encoding/json"
+	"fmt"
+	"github.com/KarlvenK/kDB/ds/hash"
+	"github.com/KarlvenK/kDB/ds/set"
+	"github.com/KarlvenK/kDB/ds/zset"
 	"github.com/KarlvenK/kDB/storage"
 	"io/ioutil"
 	"log"
 	"math/rand"
+	"os"
 	"strconv"
+	"sync"
 	"testing"
 	"time"
 )
@@ -37,6 +44,38 @@ func ReopenDb() *kDB {
 	return db
 }
 
+//OpenDb 在dir中打开一个新的数据库，数据文件较小以便测试 Reclaim
+//open a new db in dir, the db files are small so that Reclaim can be tested
+func OpenDb(t testing.TB, dir string, mode DataIndexMode) (*kDB, Config) {
+	config := DefaultConfig()
+	config.DirPath = dir
+	config.IdxMode = mode
+	config.BlockSize = 64 * 1024
+	config.ReclaimThreshold = 1
+	_ = os.RemoveAll(config.DirPath)
+
+	db, err := Open(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db, config
+}
+
+//failNextWrite 使下一次写入失败，返回恢复的函数
+//makes the next write fail, as the active file looks full and the next db file can not be created
+func failNextWrite(t *testing.T, db *kDB) (restore func()) {
+	next := db.config.DirPath + "/" + fmt.Sprintf(storage.DBFileFormatName, db.activeFileID+1)
+	if err := os.Mkdir(next, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	offset := db.activeFile.Offset
+	db.activeFile.Offset = db.config.BlockSize
+	return func() {
+		db.activeFile.Offset, db.meta.ActiveWriteOff = offset, offset
+		_ = os.Remove(next)
+	}
+}
+
 func TestOpen(t *testing.T) {
 
 	opendb := func(method storage.FileRWMethod) {
@@ -67,8 +106,9 @@ func Test_SaveInfo(t *testing.T) {
 	db, err := Open(config)
 
 	if err != nil {
-		t.Error("数据库打开失败 ", err)
+		t.Fatal("数据库打开失败 ", err)
 	}
+	defer db.Close()
 
 	db.saveConfig()
 
@@ -80,20 +120,21 @@ func Test_SaveInfo(t *testing.T) {
 
 func TestReopen(t *testing.T) {
 	path := dbPath
-	_, _ = Reopen(path)
-	//defer db.Close()
-
-	//if err != nil {
-	//	log.Println(err)
-	//}
+	db, err := Reopen(path)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	defer db.Close()
 }
 
 func Test_kDB_Backup(t *testing.T) {
 	path := dbPath
 	db, err := Reopen(path)
 	if err != nil {
-		t.Error("reopen db error ", err)
+		t.Fatal("reopen db error ", err)
 	}
+	defer db.Close()
 
 	err = db.Backup("/tmp/kdb/backup-db0")
 	if err != nil {
@@ -157,6 +198,174 @@ func Test_kDB_Reclaim(t *testing.T) {
 	}
 }
 
+func Test_kDB_ReclaimFileIds(t *testing.T) {
+	config := DefaultConfig()
+	config.DirPath = "/tmp/kdb/db-reclaim-ids"
+	config.IdxMode = KeyOnlyRamMode
+	config.BlockSize = 4 * 1024
+	config.ReclaimThreshold = 1
+	_ = os.RemoveAll(config.DirPath)
+
+	db, err := Open(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//the values grown by SetBit are rewritten larger than their entries, so the new db files may outnumber the old ones
+	want := make(map[string]string)
+	write := func(round int) {
+		for i := 0; i < 300; i++ {
+			key := fmt.Sprintf("reclaim_key_%03d", i%150)
+			want[key] = fmt.Sprintf("value_%04d_%04d", round, i)
+			if err := db.Set([]byte(key), []byte(want[key])); err != nil {
+				t.Fatal(err)
+			}
+			if i%10 == 0 {
+				if _, err := db.SetBit([]byte(key), 8*100, 0); err != nil {
+					t.Fatal(err)
+				}
+				want[key] += string(make([]byte, 101-len(want[key])))
+			}
+		}
+	}
+	check := func(step string) {
+		for key, val := range want {
+			if v, err := db.Get([]byte(key)); err != nil || string(v) != val {
+				t.Errorf("%s: expected %s of %s, got %s %v", step, val, key, v, err)
+			}
+		}
+	}
+	reclaim := func() {
+		oldActive := db.activeFileID
+		if err := db.Reclaim(); err != nil {
+			t.Fatal(err)
+		}
+		for id := range db.archFiles {
+			if id <= oldActive || id >= db.activeFileID {
+				t.Errorf("unexpected id %d of a reclaimed file, the active file was %d and is %d", id, oldActive, db.activeFileID)
+			}
+		}
+	}
+
+	write(0)
+	reclaim()
+	check("after reclaim")
+
+	//the moved active file keeps working, and the reclaimed files can be reclaimed again
+	write(1)
+	reclaim()
+	check("after the second reclaim")
+	_ = db.Close()
+
+	if db, err = Open(config); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	check("after reopen")
+}
+
+func Test_kDB_StoreBatchConcurrent(t *testing.T) {
+	config := DefaultConfig()
+	config.DirPath = "/tmp/kdb/db-store-batch"
+	config.IdxMode = KeyOnlyRamMode
+	config.BlockSize = 16 * 1024
+	_ = os.RemoveAll(config.DirPath)
+
+	db, err := Open(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//the string batches are written along with the hashes, the indexes must point to where they are written
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 300; i++ {
+			v := []byte(strconv.Itoa(i))
+			if err := db.MSet([]byte("batch_a"), v, []byte("batch_b"), v, []byte("batch_c"), v); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 300; i++ {
+			if _, err := db.HMSet([]byte("batch_hash"), []byte("f1"), []byte(strconv.Itoa(i)), []byte("f2"), []byte("v")); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+	wg.Wait()
+
+	check := func(step string) {
+		for _, key := range []string{"batch_a", "batch_b", "batch_c"} {
+			if val, err := db.Get([]byte(key)); err != nil || string(val) != "299" {
+				t.Errorf("%s: expected 299 of %s, got %s %v", step, key, val, err)
+			}
+		}
+		if val := db.HGet([]byte("batch_hash"), []byte("f1")); string(val) != "299" {
+			t.Errorf("%s: expected 299 of the hash, got %s", step, val)
+		}
+	}
+	check("before reopen")
+	_ = db.Close()
+
+	if db, err = Open(config); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	check("after reopen")
+}
+
+func Test_kDB_StoreBatchFailed(t *testing.T) {
+	config := DefaultConfig()
+	config.DirPath = "/tmp/kdb/db-store-batch-failed"
+	config.IdxMode = KeyOnlyRamMode
+	config.BlockSize = 4 * 1024
+	_ = os.RemoveAll(config.DirPath)
+
+	db, err := Open(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = db.Set([]byte("before"), []byte("value"))
+
+	//the batch is larger than a db file, and the next db file can not be created after the first part is written
+	next := config.DirPath + "/" + fmt.Sprintf(storage.DBFileFormatName, db.activeFileID+1)
+	_ = os.Mkdir(next, os.ModePerm)
+	var pairs [][]byte
+	for i := 0; i < 100; i++ {
+		pairs = append(pairs, []byte(fmt.Sprintf("failed_%03d", i)), bytes.Repeat([]byte("v"), 64))
+	}
+	offset := db.activeFile.Offset
+	if err = db.MSet(pairs...); err == nil {
+		t.Fatal("expected an error")
+	}
+	if db.activeFile.Offset != offset {
+		t.Errorf("the written part is not truncated, offset %d, expected %d", db.activeFile.Offset, offset)
+	}
+	_ = os.Remove(next)
+
+	_ = db.Set([]byte("after"), []byte("value"))
+	_ = db.Close()
+
+	if db, err = Open(config); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for _, key := range []string{"before", "after"} {
+		if val, err := db.Get([]byte(key)); err != nil || string(val) != "value" {
+			t.Errorf("expected the value of %s, got %s %v", key, val, err)
+		}
+	}
+	if db.StrExists([]byte("failed_000")) {
+		t.Error("the failed batch is replayed")
+	}
+}
+
 func writeMultiLargeData(db *kDB) {
 	keyPrefix := "test_key_"
 	valPrefix := "test_value_"
@@ -211,3 +420,256 @@ func writeMultiLargeData(db *kDB) {
 		db.ZAdd([]byte(key), float64(i+100), []byte(val))
 	}
 }
+
+func Test_kDB_Encryption(t *testing.T) {
+	config := DefaultConfig()
+	config.DirPath = "/tmp/kdb/db-encrypt"
+	config.IdxMode = KeyOnlyRamMode
+	config.BlockSize = 1024
+	config.ReclaimThreshold = 1
+	_ = os.RemoveAll(config.DirPath)
+
+	keys := &storage.StaticKeyProvider{
+		Current: 1,
+		Keys:    map[uint32][]byte{1: []byte("0123456789abcdef")},
+	}
+	config.KeyProvider = keys
+
+	db, err := Open(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100; i++ {
+		_ = db.Set([]byte("enc_key_"+strconv.Itoa(i%10)), []byte("enc_val_"+strconv.Itoa(i)))
+	}
+	_ = db.Expire([]byte("enc_key_1"), 100)
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	b, _ := ioutil.ReadFile(config.DirPath + "/000000000.data")
+	if bytes.Contains(b, []byte("enc_val_")) {
+		t.Error("the db file is not encrypted")
+	}
+
+	// open with the wrong key or without key
+	wrong := config
+	wrong.KeyProvider = &storage.StaticKeyProvider{
+		Current: 1,
+		Keys:    map[uint32][]byte{1: []byte("fedcba9876543210")},
+	}
+	if _, err := Open(wrong); err != storage.ErrDecrypt {
+		t.Errorf("open with wrong key, err = %v", err)
+	}
+	wrong.KeyProvider = nil
+	if _, err := Open(wrong); err != storage.ErrKeyRequired {
+		t.Errorf("open without key, err = %v", err)
+	}
+
+	// rotate the key, and reclaim to re-encrypt the archived files
+	keys.Keys[2] = []byte("abcdef0123456789")
+	keys.Current = 2
+	db, err = Open(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Reclaim(); err != nil {
+		t.Fatal(err)
+	}
+	for id := range db.archFiles {
+		if db.meta.FileKeys[id] != 2 {
+			t.Errorf("file %d is encrypted with key %d", id, db.meta.FileKeys[id])
+		}
+	}
+	_ = db.Close()
+
+	db, err = Open(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if val, err := db.Get([]byte("enc_key_9")); err != nil || string(val) != "enc_val_99" {
+		t.Errorf("get after key rotation got %s, %v", val, err)
+	}
+	if db.TTL([]byte("enc_key_1")) == 0 {
+		t.Error("the expires is lost")
+	}
+}
+
+func Test_kDB_ReclaimEncryptsPlainFiles(t *testing.T) {
+	key := func(i int) []byte { return []byte(fmt.Sprintf("enc_key_%02d", i)) }
+	val := func(i int) []byte { return []byte(fmt.Sprintf("enc_value_%02d", i)) }
+
+	config := DefaultConfig()
+	config.DirPath = "/tmp/kdb/db-encrypt-reclaim"
+	config.IdxMode = KeyOnlyRamMode
+	config.ReclaimThreshold = 1
+	//a new db file holds two sealed entries, and the third one fits only if it is counted as plain
+	plain := int64(storage.NewEntryNoExtra(key(0), val(0), String, StringSet).Size())
+	config.BlockSize = 2*(plain+storage.SealOverhead) + plain
+	_ = os.RemoveAll(config.DirPath)
+
+	db, err := Open(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 20; i++ {
+		if err = db.Set(key(i), val(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_ = db.Close()
+
+	check := func(step string) {
+		for i := 0; i < 20; i++ {
+			if v, err := db.Get(key(i)); err != nil || !bytes.Equal(v, val(i)) {
+				t.Errorf("%s: expected %s of %s, got %s %v", step, val(i), key(i), v, err)
+			}
+		}
+	}
+
+	//the plain files are encrypted by Reclaim
+	config.KeyProvider = &storage.StaticKeyProvider{
+		Current: 1,
+		Keys:    map[uint32][]byte{1: []byte("0123456789abcdef")},
+	}
+	if db, err = Open(config); err != nil {
+		t.Fatal(err)
+	}
+	if err = db.Reclaim(); err != nil {
+		t.Fatal(err)
+	}
+	for id, df := range db.archFiles {
+		if df.Offset > config.BlockSize {
+			t.Errorf("db file %d holds %d bytes, more than the block size %d", id, df.Offset, config.BlockSize)
+		}
+	}
+	check("after reclaim")
+	_ = db.Close()
+
+	if db, err = Open(config); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	check("after reopen")
+}
+
+func Test_kDB_ReopenWithKey(t *testing.T) {
+	config := DefaultConfig()
+	config.DirPath = "/tmp/kdb/db-encrypt-reopen"
+	_ = os.RemoveAll(config.DirPath)
+
+	keys := &storage.StaticKeyProvider{
+		Current: 1,
+		Keys:    map[uint32][]byte{1: []byte("0123456789abcdef")},
+	}
+	config.KeyProvider = keys
+
+	db, err := Open(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = db.Set([]byte("enc_key"), []byte("enc_val"))
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the key is not saved in the config file
+	if _, err := Reopen(config.DirPath); err != storage.ErrKeyRequired {
+		t.Errorf("reopen without key, err = %v", err)
+	}
+
+	db, err = ReopenWithKey(config.DirPath, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if val, err := db.Get([]byte("enc_key")); err != nil || string(val) != "enc_val" {
+		t.Errorf("get after reopen got %s, %v", val, err)
+	}
+}
+
+func Test_kDB_ReplayActiveFile(t *testing.T) {
+	db, config := OpenDb(t, "/tmp/kdb/db-active-replay", KeyOnlyRamMode)
+	_ = db.Set([]byte("str"), []byte("v"))
+	_, _ = db.RPush([]byte("list"), []byte("a"), []byte("b"))
+	_, _ = db.HSet([]byte("hash"), []byte("field"), []byte("v"))
+	if len(db.archFiles) != 0 {
+		t.Fatalf("expected all the data in the active file, got %d archived files", len(db.archFiles))
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var err error
+	if db, err = Open(config); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if val, err := db.Get([]byte("str")); err != nil || string(val) != "v" {
+		t.Errorf("get str got %s, %v", val, err)
+	}
+	if db.LLen([]byte("list")) != 2 {
+		t.Errorf("expected 2 list items, got %d", db.LLen([]byte("list")))
+	}
+	if val := db.HGet([]byte("hash"), []byte("field")); string(val) != "v" {
+		t.Errorf("hget got %s", val)
+	}
+}
+
+func Test_kDB_ObjectEncoding(t *testing.T) {
+	config := DefaultConfig()
+	config.DirPath = "/tmp/kdb/db-encoding"
+	config.HashMaxListpackEntries = 4
+	config.SetMaxListpackValue = 8
+	config.ZSetMaxListpackEntries = -1
+	_ = os.RemoveAll(config.DirPath)
+
+	db, err := Open(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_ = db.Set([]byte("str"), []byte("v"))
+	_, _ = db.RPush([]byte("list"), []byte("v"))
+	for i := 0; i < 4; i++ {
+		_, _ = db.HSet([]byte("small_hash"), []byte(strconv.Itoa(i)), []byte("v"))
+		_, _ = db.HSet([]byte("big_hash"), []byte(strconv.Itoa(i)), []byte("v"))
+	}
+	_, _ = db.HSet([]byte("big_hash"), []byte("4"), []byte("v"))
+	_, _ = db.SAdd([]byte("small_set"), []byte("member"))
+	_, _ = db.SAdd([]byte("big_set"), []byte("a long member"))
+	_ = db.ZAdd([]byte("zset"), 1, []byte("member"))
+
+	want := map[string]string{
+		"str":        EncodingRaw,
+		"list":       EncodingQuicklist,
+		"small_hash": hash.EncodingListpack,
+		"big_hash":   hash.EncodingHashtable,
+		"small_set":  set.EncodingListpack,
+		"big_set":    set.EncodingHashtable,
+		"zset":       zset.EncodingSkiplist,
+	}
+	check := func(step string) {
+		for key, encoding := range want {
+			if got, err := db.ObjectEncoding([]byte(key)); err != nil || got != encoding {
+				t.Errorf("%s: expected %s of %s, got %s %v", step, encoding, key, got, err)
+			}
+		}
+		if _, err := db.ObjectEncoding([]byte("missing")); err != ErrKeyNotExist {
+			t.Errorf("%s: expected ErrKeyNotExist, got %v", step, err)
+		}
+	}
+	check("before reopen")
+	_ = db.Close()
+
+	if db, err = Open(config); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	check("after reopen")
+	if db.HLen([]byte("big_hash")) != 5 {
+		t.Errorf("expected 5 fields, got %d", db.HLen([]byte("big_hash")))
+	}
+}
@@ -0,0 +1,176 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+var (
+	// ErrKeyRequired the data is encrypted but no key provider is set
+	ErrKeyRequired = errors.New("storage/crypto: data is encrypted but no key provider is set")
+
+	// ErrDecrypt the data can not be decrypted with the given key
+	ErrDecrypt = errors.New("storage/crypto: failed to decrypt, wrong key or corrupted data")
+
+	// ErrUnknownKey the key provider does not know the key id
+	ErrUnknownKey = errors.New("storage/crypto: unknown key id")
+)
+
+const (
+	nonceSize = 12
+	tagSize   = 16
+
+	// SealOverhead 加密后每个entry增加的字节数 (nonce + tag)
+	// the extra bytes of an encrypted entry
+	SealOverhead = nonceSize + tagSize
+
+	// 加密文件的头部：magic(4) + key id(4)
+	sealedFileHeaderSize = 8
+)
+
+// sealedFileMagic 加密的元数据文件前缀
+var sealedFileMagic = []byte("KDBE")
+
+// KeyProvider 提供加密数据使用的密钥，密钥通过 id 区分，以支持密钥轮换
+// supplies the AES keys (16, 24 or 32 bytes), identified by a key id so that keys can be rotated
+type KeyProvider interface {
+	// CurrentKey returns the id and the key used to encrypt new data
+	CurrentKey() (id uint32, key []byte, err error)
+
+	// Key returns the key registered under id, which may be an old one
+	Key(id uint32) ([]byte, error)
+}
+
+// StaticKeyProvider 保存在内存中的密钥环
+// a KeyProvider backed by an in-memory key ring
+type StaticKeyProvider struct {
+	Current uint32
+	Keys    map[uint32][]byte
+}
+
+// CurrentKey returns the current key of the key ring
+func (p *StaticKeyProvider) CurrentKey() (uint32, []byte, error) {
+	key, err := p.Key(p.Current)
+	return p.Current, key, err
+}
+
+// Key returns the key of id
+func (p *StaticKeyProvider) Key(id uint32) ([]byte, error) {
+	key, ok := p.Keys[id]
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+	return key, nil
+}
+
+// Cipher AES-GCM 加解密
+type Cipher struct {
+	id   uint32
+	aead cipher.AEAD
+}
+
+// NewCipher new a AES-GCM cipher of the key
+func NewCipher(id uint32, key []byte) (*Cipher, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &Cipher{id: id, aead: aead}, nil
+}
+
+// CurrentCipher new a cipher of the current key of the provider
+func CurrentCipher(kp KeyProvider) (*Cipher, error) {
+	id, key, err := kp.CurrentKey()
+	if err != nil {
+		return nil, err
+	}
+	return NewCipher(id, key)
+}
+
+// LoadCipher new a cipher of the key id of the provider
+func LoadCipher(kp KeyProvider, id uint32) (*Cipher, error) {
+	key, err := kp.Key(id)
+	if err != nil {
+		return nil, err
+	}
+	return NewCipher(id, key)
+}
+
+// KeyId the key id of the cipher
+func (c *Cipher) KeyId() uint32 {
+	return c.id
+}
+
+// Seal 加密数据，返回 nonce + 密文
+// encrypt plain, additional data is authenticated but not encrypted
+func (c *Cipher) Seal(plain, additional []byte) ([]byte, error) {
+	buf := make([]byte, nonceSize, nonceSize+len(plain)+tagSize)
+	if _, err := io.ReadFull(rand.Reader, buf); err != nil {
+		return nil, err
+	}
+	return c.aead.Seal(buf, buf, plain, additional), nil
+}
+
+// Open 解密 Seal 返回的数据
+// decrypt the data returned by Seal
+func (c *Cipher) Open(data, additional []byte) ([]byte, error) {
+	if len(data) < SealOverhead {
+		return nil, ErrDecrypt
+	}
+
+	plain, err := c.aead.Open(nil, data[:nonceSize], data[nonceSize:], additional)
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	return plain, nil
+}
+
+// sealFile 加密元数据文件内容，kp 为 nil 时不加密
+// encrypt the content of a meta file with the current key, the key id is saved as the file header
+func sealFile(kp KeyProvider, plain []byte) ([]byte, error) {
+	if kp == nil {
+		return plain, nil
+	}
+
+	c, err := CurrentCipher(kp)
+	if err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, sealedFileHeaderSize)
+	copy(header, sealedFileMagic)
+	binary.BigEndian.PutUint32(header[4:8], c.id)
+
+	sealed, err := c.Seal(plain, header)
+	if err != nil {
+		return nil, err
+	}
+	return append(header, sealed...), nil
+}
+
+// openFile 解密 sealFile 返回的数据，未加密的数据原样返回
+// decrypt the content returned by sealFile, plain content is returned as it is
+func openFile(kp KeyProvider, data []byte) ([]byte, error) {
+	if len(data) < sealedFileHeaderSize || !bytes.Equal(data[:4], sealedFileMagic) {
+		return data, nil
+	}
+	if kp == nil {
+		return nil, ErrKeyRequired
+	}
+
+	c, err := LoadCipher(kp, binary.BigEndian.Uint32(data[4:8]))
+	if err != nil {
+		return nil, err
+	}
+	return c.Open(data[sealedFileHeaderSize:], data[:sealedFileHeaderSize])
+}
@@ -0,0 +1,144 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"io/ioutil"
+	"testing"
+)
+
+func testKeys() *StaticKeyProvider {
+	return &StaticKeyProvider{
+		Current: 1,
+		Keys: map[uint32][]byte{
+			1: []byte("0123456789abcdef"),
+			2: []byte("fedcba9876543210"),
+		},
+	}
+}
+
+func TestCipher_Seal(t *testing.T) {
+	c, err := CurrentCipher(testKeys())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plain := []byte("some regulated data")
+	sealed, err := c.Seal(plain, []byte("header"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sealed) != len(plain)+SealOverhead {
+		t.Errorf("sealed size %d, want %d", len(sealed), len(plain)+SealOverhead)
+	}
+
+	res, err := c.Open(sealed, []byte("header"))
+	if err != nil || !bytes.Equal(res, plain) {
+		t.Errorf("open sealed data got %s, %v", res, err)
+	}
+
+	if _, err := c.Open(sealed, []byte("other header")); err != ErrDecrypt {
+		t.Errorf("open with wrong additional data, err = %v", err)
+	}
+
+	wrong, _ := LoadCipher(testKeys(), 2)
+	if _, err := wrong.Open(sealed, []byte("header")); err != ErrDecrypt {
+		t.Errorf("open with wrong key, err = %v", err)
+	}
+}
+
+func TestSealFile(t *testing.T) {
+	kp := testKeys()
+	data, err := sealFile(kp, []byte("meta"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := openFile(nil, data); err != ErrKeyRequired {
+		t.Errorf("open without key, err = %v", err)
+	}
+
+	kp.Current = 2
+	res, err := openFile(kp, data)
+	if err != nil || string(res) != "meta" {
+		t.Errorf("open with rotated keys got %s, %v", res, err)
+	}
+
+	kp.Keys[1] = []byte("0000000000000000")
+	if _, err := openFile(kp, data); err != ErrDecrypt {
+		t.Errorf("open with wrong key, err = %v", err)
+	}
+}
+
+func TestDBFile_SetCipher(t *testing.T) {
+	c, _ := CurrentCipher(testKeys())
+	df, err := NewDBFile(path1, 9, FileIO, defaultBlockSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer df.Close(false)
+	df.SetCipher(c)
+	df.Offset = 0
+
+	e := NewEntry([]byte("enc_key"), []byte("enc_val"), []byte("enc_extra"), Hash, 0)
+	if err := df.Write(e); err != nil {
+		t.Fatal(err)
+	}
+	if e.Size() != df.EntrySize(e) || df.Offset != int64(e.Size()) {
+		t.Errorf("entry size %d, file offset %d", e.Size(), df.Offset)
+	}
+
+	res, err := df.Read(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(res.Meta.Key) != "enc_key" || string(res.Meta.Value) != "enc_val" || string(res.Meta.Extra) != "enc_extra" {
+		t.Errorf("read encrypted entry got %+v", res.Meta)
+	}
+
+	df.SetCipher(nil)
+	if _, err := df.Read(0); err == nil {
+		t.Error("read encrypted entry without cipher should fail")
+	}
+}
+
+func TestDBFile_SealedCrc(t *testing.T) {
+	c, _ := CurrentCipher(testKeys())
+	df, err := NewDBFile(path1, 10, FileIO, defaultBlockSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer df.Close(false)
+	df.SetCipher(c)
+	df.Offset = 0
+
+	//a one byte value is easily recovered from its crc
+	val := []byte("1")
+	if err := df.Write(NewEntryNoExtra([]byte("flag"), val, String, 0)); err != nil {
+		t.Fatal(err)
+	}
+
+	raw, err := ioutil.ReadFile(df.File.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	crc := make([]byte, 4)
+	binary.BigEndian.PutUint32(crc, crc32.ChecksumIEEE(val))
+	if bytes.Contains(raw[:df.Offset], crc) {
+		t.Error("the db file holds the crc of the plaintext value")
+	}
+
+	if res, err := df.Read(0); err != nil || !bytes.Equal(res.Meta.Value, val) {
+		t.Errorf("read encrypted entry got %v, %v", res, err)
+	}
+
+	//the header is still authenticated
+	raw[0] ^= 1
+	if _, err := df.File.WriteAt(raw[:1], 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := df.Read(0); err != ErrDecrypt {
+		t.Errorf("read tampered entry, err = %v", err)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"github.com/edsrzf/mmap-go"
 	"hash/crc32"
+	"io"
 	"io/ioutil"
 	"os"
 	"sort"
@@ -26,6 +27,9 @@ const (
 var (
 	// ErrEmptyEntry the entry is empty
 	ErrEmptyEntry = errors.New("storage/db_file: entry or the Key of entry is empty")
+
+	// ErrExceedMapping the entries exceed the mapped size of the file
+	ErrExceedMapping = errors.New("storage/db_file: entries exceed the mapped size of the file")
 )
 
 //FileRWMethod 文件数据读写方式
@@ -47,6 +51,7 @@ type DBFile struct {
 	mmap   mmap.MMap
 	Offset int64
 	method FileRWMethod
+	cipher *Cipher //nil if the file is not encrypted
 }
 
 // NewDBFile	新建一个数据读写文件，如果是MMap，则需要Truncate文件并进行加载
@@ -87,7 +92,29 @@ func (df *DBFile) Read(offset int64) (e *Entry, err error) {
 		return
 	}
 
+	//entry的key不能为空，读到空的key说明已到达数据末尾（mmap文件会预先分配空间）
+	if e.Meta.KeySize == 0 {
+		return nil, io.EOF
+	}
+
 	offset += entryHeaderSize
+	if df.cipher != nil {
+		if err = df.readSealed(e, buf, offset); err != nil {
+			return nil, err
+		}
+	} else if err = df.readPlain(e, offset); err != nil {
+		return nil, err
+	}
+
+	//the sealed entries are checked by the tag, and keep no crc of the plaintext
+	if !e.sealed && crc32.ChecksumIEEE(e.Meta.Value) != e.crc32 {
+		return nil, ErrInvalidCrc
+	}
+	return
+}
+
+// readPlain read the key, value and extra of a plain entry
+func (df *DBFile) readPlain(e *Entry, offset int64) (err error) {
 	if e.Meta.KeySize > 0 {
 		var key []byte
 		if key, err = df.readBuf(offset, int64(e.Meta.KeySize)); err != nil {
@@ -113,12 +140,31 @@ func (df *DBFile) Read(offset int64) (e *Entry, err error) {
 		}
 		e.Meta.Extra = val
 	}
+	return
+}
 
-	checkCrc := crc32.ChecksumIEEE(e.Meta.Value)
-	if checkCrc != e.crc32 {
-		return nil, ErrInvalidCrc
+// readSealed read and decrypt the key, value and extra of an encrypted entry
+func (df *DBFile) readSealed(e *Entry, header []byte, offset int64) error {
+	ks, vs := e.Meta.KeySize, e.Meta.ValueSize
+	e.sealed = true
+
+	buf, err := df.readBuf(offset, int64(e.Size()-entryHeaderSize))
+	if err != nil {
+		return err
 	}
-	return
+	payload, err := df.cipher.Open(buf, header)
+	if err != nil {
+		return err
+	}
+
+	e.Meta.Key = payload[:ks:ks]
+	if vs > 0 {
+		e.Meta.Value = payload[ks : ks+vs : ks+vs]
+	}
+	if e.Meta.ExtraSize > 0 {
+		e.Meta.Extra = payload[ks+vs:]
+	}
+	return nil
 }
 
 func (df *DBFile) readBuf(offset int64, n int64) ([]byte, error) {
@@ -140,29 +186,127 @@ func (df *DBFile) readBuf(offset int64, n int64) ([]byte, error) {
 
 // Write 从文件的offset处开始写数据
 func (df *DBFile) Write(e *Entry) error {
+	_, err := df.WriteEntries(e)
+	return err
+}
+
+// WriteEntries 将多个entry编码后从文件的offset处一次写入，返回每个entry的写入位置，写入失败时offset不变
+// encode the entries and write them at the offset of the file at once, returns the positions of the entries.
+// The offset is unchanged if the write fails.
+func (df *DBFile) WriteEntries(entries ...*Entry) ([]int64, error) {
+	writeOff := df.Offset
+	offsets := make([]int64, len(entries))
+
+	var buf []byte
+	for i, e := range entries {
+		encVal, err := df.encode(e)
+		if err != nil {
+			return nil, err
+		}
+		offsets[i] = writeOff + int64(len(buf))
+		buf = append(buf, encVal...)
+	}
+
+	//the mapping can not grow, so the entries out of it would be cut off
+	if df.method == MMap && writeOff+int64(len(buf)) > int64(len(df.mmap)) {
+		return nil, ErrExceedMapping
+	}
+
+	if df.method == FileIO {
+		if _, err := df.File.WriteAt(buf, writeOff); err != nil {
+			return nil, err
+		}
+	}
+	if df.method == MMap {
+		copy(df.mmap[writeOff:], buf)
+	}
+	df.Offset += int64(len(buf))
+	return offsets, nil
+}
+
+// encode 编码entry，文件加密时对其进行加密
+// encode the entry, which is sealed if the file is encrypted
+func (df *DBFile) encode(e *Entry) ([]byte, error) {
 	if e == nil || e.Meta.KeySize == 0 {
-		return ErrEmptyEntry
+		return nil, ErrEmptyEntry
 	}
 
-	method := df.method
-	writeOff := df.Offset
+	e.sealed = false
 	encVal, err := e.Encode()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	if method == FileIO {
-		if _, err := df.File.WriteAt(encVal, writeOff); err != nil {
+	if df.cipher != nil {
+		//the crc of the plaintext would give away short values, so it is cleared from the header
+		copy(encVal[0:4], make([]byte, 4))
+
+		var sealed []byte
+		if sealed, err = df.cipher.Seal(encVal[entryHeaderSize:], encVal[:entryHeaderSize]); err != nil {
+			return nil, err
+		}
+		encVal = append(encVal[:entryHeaderSize], sealed...)
+		e.sealed = true
+	}
+	return encVal, nil
+}
+
+// Truncate 丢弃文件offset之后的数据
+// discard the data after offset
+func (df *DBFile) Truncate(offset int64) error {
+	if df.method == FileIO {
+		if err := df.File.Truncate(offset); err != nil {
 			return err
 		}
 	}
-	if method == MMap {
-		copy(df.mmap[writeOff:], encVal)
+
+	if df.method == MMap && offset < int64(len(df.mmap)) {
+		copy(df.mmap[offset:], make([]byte, int64(len(df.mmap))-offset))
 	}
-	df.Offset += int64(e.Size())
+	df.Offset = offset
 	return nil
 }
 
+// Rename 将数据文件移动到 path 目录下并修改其 id，已打开的文件在移动后仍可读写
+// move the db file to the directory path with a new id, the opened file keeps working after it
+func (df *DBFile) Rename(path string, fileId uint32) error {
+	oldPath := df.path + PathSeparator + fmt.Sprintf(DBFileFormatName, df.Id)
+	newPath := path + PathSeparator + fmt.Sprintf(DBFileFormatName, fileId)
+	if err := os.Rename(oldPath, newPath); err != nil {
+		return err
+	}
+
+	//reopen the file so that its name follows the new path
+	if df.File != nil {
+		file, err := os.OpenFile(newPath, os.O_RDWR, FilePerm)
+		if err != nil {
+			return err
+		}
+		_ = df.File.Close()
+		df.File = file
+	}
+	df.path, df.Id = path, fileId
+	return nil
+}
+
+// SetCipher 设置文件的加密方式，c 为 nil 表示不加密
+// set the cipher used to encrypt entries of the file, nil means plaintext
+func (df *DBFile) SetCipher(c *Cipher) {
+	df.cipher = c
+}
+
+// Cipher the cipher of the file, nil if the file is not encrypted
+func (df *DBFile) Cipher() *Cipher {
+	return df.cipher
+}
+
+// EntrySize 返回entry写入该文件后占用的大小
+// the size of the entry once written to the file
+func (df *DBFile) EntrySize(e *Entry) uint32 {
+	e.sealed = df.cipher != nil
+	return e.Size()
+}
+
 // Close 读写后进行关闭擦偶走
 // sync 关闭前是否持久化数据
 func (df *DBFile) Close(sync bool) (err error) {
@@ -152,3 +152,107 @@ func TestDBFile_Read(t *testing.T) {
 	//readEntry(0)
 	//readEntry(40)
 }
+
+func TestDBFile_Rename(t *testing.T) {
+	dir := "/tmp/kdb/db-file-rename"
+	_ = os.RemoveAll(dir)
+	_ = os.MkdirAll(dir+"/new", os.ModePerm)
+
+	df, err := NewDBFile(dir, 3, FileIO, defaultBlockSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = df.Write(NewEntryNoExtra([]byte("key"), []byte("value"), 0, 0)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = df.Rename(dir+"/new", 7); err != nil {
+		t.Fatal(err)
+	}
+	if df.Id != 7 || df.File.Name() != dir+"/new/000000007.data" {
+		t.Errorf("unexpected id %d and name %s", df.Id, df.File.Name())
+	}
+	if _, err = os.Stat(dir + "/000000003.data"); !os.IsNotExist(err) {
+		t.Error("the old file still exists")
+	}
+
+	//the renamed file can be written and read again
+	if err = df.Write(NewEntryNoExtra([]byte("key2"), []byte("value2"), 0, 0)); err != nil {
+		t.Fatal(err)
+	}
+	e, err := df.Read(0)
+	if err != nil || string(e.Meta.Value) != "value" {
+		t.Errorf("unexpected entry %v %v", e, err)
+	}
+	if e, err = df.Read(int64(e.Size())); err != nil || string(e.Meta.Value) != "value2" {
+		t.Errorf("unexpected entry %v %v", e, err)
+	}
+}
+
+func TestDBFile_WriteEntries(t *testing.T) {
+	dir := "/tmp/kdb/db-file-entries"
+	_ = os.RemoveAll(dir)
+	_ = os.MkdirAll(dir, os.ModePerm)
+
+	df, err := NewDBFile(dir, 0, FileIO, defaultBlockSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = df.Write(NewEntryNoExtra([]byte("first"), []byte("0"), 0, 0))
+
+	entries := []*Entry{
+		NewEntryNoExtra([]byte("k1"), []byte("v1"), 0, 0),
+		NewEntry([]byte("k2"), []byte("value2"), []byte("extra"), 0, 0),
+	}
+	entries[0].Continued = true
+	offsets, err := df.WriteEntries(entries...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, off := range offsets {
+		e, err := df.Read(off)
+		if err != nil || string(e.Meta.Key) != string(entries[i].Meta.Key) || e.Continued != entries[i].Continued {
+			t.Errorf("unexpected entry at %d: %v %v", off, e, err)
+		}
+	}
+	if end := offsets[1] + int64(entries[1].Size()); df.Offset != end {
+		t.Errorf("expected offset %d, got %d", end, df.Offset)
+	}
+
+	//a failed write keeps the offset
+	offset := df.Offset
+	df.File, _ = os.Open(df.File.Name())
+	if _, err = df.WriteEntries(entries...); err == nil || df.Offset != offset {
+		t.Errorf("expected an error and offset %d, got %v %d", offset, err, df.Offset)
+	}
+	if _, err = df.WriteEntries(NewEntryNoExtra(nil, nil, 0, 0)); err != ErrEmptyEntry {
+		t.Errorf("expected ErrEmptyEntry, got %v", err)
+	}
+}
+
+func TestDBFile_WriteEntriesMMap(t *testing.T) {
+	dir := "/tmp/kdb/db-file-mmap"
+	_ = os.RemoveAll(dir)
+	_ = os.MkdirAll(dir, os.ModePerm)
+
+	df, err := NewDBFile(dir, 0, MMap, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer df.Close(false)
+
+	e := NewEntryNoExtra([]byte("key"), []byte("value"), 0, 0)
+	if err = df.Write(e); err != nil {
+		t.Fatal(err)
+	}
+
+	//the entry past the mapping is rejected instead of being cut off
+	offset := df.Offset
+	large := NewEntryNoExtra([]byte("large"), make([]byte, 64), 0, 0)
+	if err = df.Write(large); err != ErrExceedMapping || df.Offset != offset {
+		t.Errorf("expected ErrExceedMapping and offset %d, got %v %d", offset, err, df.Offset)
+	}
+	if e, err = df.Read(0); err != nil || string(e.Meta.Value) != "value" {
+		t.Errorf("unexpected entry %v %v", e, err)
+	}
+}
@@ -8,33 +8,43 @@ import (
 
 //DBMeta 保存数据库的一些额外信息
 type DBMeta struct {
-	ActiveWriteOff int64 `json:"active_write_off"` //当前数据库文件的写偏移
+	ActiveWriteOff int64             `json:"active_write_off"`    //当前数据库文件的写偏移
+	FileKeys       map[uint32]uint32 `json:"file_keys,omitempty"` //加密数据文件使用的密钥id  file id -> key id of encrypted db files
 }
 
-// LoadMeta 加载数据库的额外信息
-func LoadMeta(path string) (m *DBMeta) {
-	m = &DBMeta{}
+// LoadMeta 加载数据库的额外信息，kp 用于解密加密过的元数据
+func LoadMeta(path string, kp KeyProvider) (m *DBMeta, err error) {
+	m = &DBMeta{FileKeys: make(map[uint32]uint32)}
 
 	file, err := os.OpenFile(path, os.O_RDONLY, 0600)
 	if err != nil {
-		return
+		return m, nil
 	}
 	defer file.Close()
 
 	b, _ := ioutil.ReadAll(file)
+	if b, err = openFile(kp, b); err != nil {
+		return nil, err
+	}
 	_ = json.Unmarshal(b, m)
+	if m.FileKeys == nil {
+		m.FileKeys = make(map[uint32]uint32)
+	}
 	return
 }
 
-//Store 存储数据信息
-func (m *DBMeta) Store(path string) error {
-	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY, 0600)
+//Store 存储数据信息，kp 不为 nil 时使用当前密钥加密
+func (m *DBMeta) Store(path string, kp KeyProvider) error {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
 	if err != nil {
 		return err
 	}
 	defer file.Close()
 
 	b, _ := json.Marshal(m)
+	if b, err = sealFile(kp, b); err != nil {
+		return err
+	}
 	_, err = file.Write(b)
 	return err
 }
@@ -16,6 +16,10 @@ var (
 const (
 	//KeySize, ValuesSize, ExtraSize, crc32均为 uint32, 各占 4 Byte
 	entryHeaderSize = 20
+
+	//Type的最高位标记entry属于一个批次且后面还有同批次的entry
+	//the highest bit of type marks that the entry is followed by the rest of its batch
+	continuedFlag uint16 = 1 << 15
 )
 
 //Value的数据结构类型
@@ -25,6 +29,13 @@ const (
 	Hash
 	Set
 	ZSet
+	HyperLogLog
+	Stream
+	JSON
+	Bloom
+	Sketch
+	TimeSeries
+	Vector
 )
 
 type (
@@ -34,6 +45,12 @@ type (
 		Type  uint16 //data type
 		Mark  uint16 //data operation type
 		crc32 uint32 //check sum
+
+		//Continued 批次中除最后一个外的entry均为true，重放时只有完整写入的批次才会生效
+		//the entry is part of a batch and followed by the rest of it
+		Continued bool
+
+		sealed bool //whether the entry is encrypted in the db file
 	}
 	//Meta meta 数据
 	Meta struct {
@@ -69,7 +86,11 @@ func NewEntryNoExtra(key, value []byte, t, mark uint16) *Entry {
 
 // Size returns the entry size
 func (e *Entry) Size() uint32 {
-	return entryHeaderSize + e.Meta.KeySize + e.Meta.ValueSize + e.Meta.ExtraSize
+	size := entryHeaderSize + e.Meta.KeySize + e.Meta.ValueSize + e.Meta.ExtraSize
+	if e.sealed {
+		size += SealOverhead
+	}
+	return size
 }
 
 // Encode 对Entry进行编码， 返回字节数组
@@ -80,12 +101,16 @@ func (e *Entry) Encode() ([]byte, error) {
 
 	ks, vs := e.Meta.KeySize, e.Meta.ValueSize
 	es := e.Meta.ExtraSize
-	buf := make([]byte, e.Size())
+	buf := make([]byte, entryHeaderSize+ks+vs+es)
 
 	binary.BigEndian.PutUint32(buf[4:8], ks)
 	binary.BigEndian.PutUint32(buf[8:12], vs)
 	binary.BigEndian.PutUint32(buf[12:16], es)
-	binary.BigEndian.PutUint16(buf[16:18], e.Type)
+	t := e.Type
+	if e.Continued {
+		t |= continuedFlag
+	}
+	binary.BigEndian.PutUint16(buf[16:18], t)
 	binary.BigEndian.PutUint16(buf[18:20], e.Mark)
 	copy(buf[entryHeaderSize:entryHeaderSize+ks], e.Meta.Key)
 	copy(buf[entryHeaderSize+ks:(entryHeaderSize+ks+vs)], e.Meta.Value)
@@ -114,8 +139,9 @@ func Decode(buf []byte) (*Entry, error) {
 			ValueSize: vs,
 			ExtraSize: es,
 		},
-		Type:  t,
-		Mark:  mark,
-		crc32: crc,
+		Type:      t &^ continuedFlag,
+		Mark:      mark,
+		crc32:     crc,
+		Continued: t&continuedFlag != 0,
 	}, nil
 }
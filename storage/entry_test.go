@@ -127,3 +127,18 @@ func TestEntry_Size(t *testing.T) {
 	e := NewEntryNoExtra([]byte("key001"), []byte("val001"), 1, 2)
 	e.Size()
 }
+
+func TestEntry_Continued(t *testing.T) {
+	e := NewEntryNoExtra([]byte("key001"), []byte("val001"), Hash, 2)
+	e.Continued = true
+
+	buf, err := e.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, _ := Decode(buf[:entryHeaderSize])
+	if res.Type != Hash || res.Mark != 2 || !res.Continued {
+		t.Errorf("decode continued entry got type %d, mark %d, continued %v", res.Type, res.Mark, res.Continued)
+	}
+}
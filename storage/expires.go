@@ -2,15 +2,19 @@ package storage
 
 import (
 	"encoding/binary"
-	"io"
+	"io/ioutil"
 	"log"
 	"os"
 )
 
 const expireHeadSize = 12
 
-//Expires 过期字典定义
-type Expires map[string]uint32
+//deadlines below it are saved in seconds by the old versions, it is in year 2001 as milliseconds
+const secondDeadlineLimit = 1e12
+
+//Expires 过期字典定义，过期时间为unix毫秒
+//the deadlines of the keys in unix milliseconds
+type Expires map[string]int64
 
 // ExpiresValue	expires value
 type ExpiresValue struct {
@@ -19,15 +23,15 @@ type ExpiresValue struct {
 	Deadline uint64
 }
 
-//SaveExpires 保存过期字典信息
-func (e *Expires) SaveExpires(path string) (err error) {
-	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY, 0600)
+//SaveExpires 保存过期字典信息，kp 不为 nil 时使用当前密钥加密
+func (e *Expires) SaveExpires(path string, kp KeyProvider) (err error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
 	if err != nil {
 		return err
 	}
 	defer file.Close()
 
-	var offset int64 = 0
+	var data []byte
 	for k, v := range *e {
 		ev := &ExpiresValue{
 			Key:      []byte(k),
@@ -39,57 +43,60 @@ func (e *Expires) SaveExpires(path string) (err error) {
 		binary.BigEndian.PutUint32(buf[0:4], ev.KeySize)
 		binary.BigEndian.PutUint64(buf[4:12], ev.Deadline)
 		copy(buf[expireHeadSize:], ev.Key)
-		_, err = file.WriteAt(buf, offset)
-		if err != nil {
-			return
-		}
-		offset += int64(expireHeadSize + ev.KeySize)
+		data = append(data, buf...)
 	}
+
+	if data, err = sealFile(kp, data); err != nil {
+		return
+	}
+	_, err = file.Write(data)
 	return
 }
 
-//LoadExpires 加载过期字典信息
-func LoadExpires(path string) (expires Expires) {
+//LoadExpires 加载过期字典信息，kp 用于解密加密过的过期字典
+func LoadExpires(path string, kp KeyProvider) (expires Expires, err error) {
 	expires = make(Expires)
 	file, err := os.OpenFile(path, os.O_RDONLY, 0600)
 	if err != nil {
-		return
+		return expires, nil
 	}
 	defer file.Close()
 
-	var offset int64 = 0
-	for {
-		ev, err := readExpire(file, offset)
-		if err != nil {
-			if err == io.EOF {
-				break
-			}
-			log.Println("load expire error : ", err)
+	data, err := ioutil.ReadAll(file)
+	if err != nil {
+		return
+	}
+	if data, err = openFile(kp, data); err != nil {
+		return nil, err
+	}
+
+	var offset uint32 = 0
+	for int(offset) < len(data) {
+		ev, ok := readExpire(data[offset:])
+		if !ok {
+			log.Println("load expire error : invalid expire record")
 			return
 		}
-		offset += int64(ev.KeySize + expireHeadSize)
-		expires[string(ev.Key)] = uint32(ev.Deadline)
+		offset += ev.KeySize + expireHeadSize
+		if ev.Deadline < secondDeadlineLimit {
+			ev.Deadline *= 1000
+		}
+		expires[string(ev.Key)] = int64(ev.Deadline)
 	}
 	return
 }
 
-func readExpire(file *os.File, offset int64) (ev *ExpiresValue, err error) {
-	buf := make([]byte, expireHeadSize)
-	_, err = file.ReadAt(buf, offset)
-	if err != nil {
+func readExpire(buf []byte) (ev *ExpiresValue, ok bool) {
+	if len(buf) < expireHeadSize {
 		return
 	}
 
 	ev = decodeExpire(buf)
-	offset += int64(expireHeadSize)
-	key := make([]byte, ev.KeySize)
-	_, err = file.ReadAt(key, offset)
-	if err != nil {
-		return
+	if uint32(len(buf)-expireHeadSize) < ev.KeySize {
+		return nil, false
 	}
-	ev.Key = key
-	return
-
+	ev.Key = buf[expireHeadSize : expireHeadSize+ev.KeySize]
+	return ev, true
 }
 
 func decodeExpire(buf []byte) *ExpiresValue {
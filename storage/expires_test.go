@@ -12,16 +12,37 @@ func TestExpires_SaveExpires(t *testing.T) {
 	expires["key_003"] = 2312223
 	expires["key_005"] = 7312223
 
-	err := expires.SaveExpires("/tmp/kdb/db.expires")
+	err := expires.SaveExpires("/tmp/kdb/db.expires", nil)
 	if err != nil {
 		t.Error(err)
 	}
 }
 
 func TestLoadExpires(t *testing.T) {
-	newExpires := LoadExpires("/tmp/kdb/db.expires")
+	newExpires, err := LoadExpires("/tmp/kdb/db.expires", nil)
+	if err != nil {
+		t.Error(err)
+	}
 	t.Logf("%+v\n", newExpires)
 	for k, v := range newExpires {
 		fmt.Println(k, ":", v)
 	}
 }
+
+func TestLoadExpires_Milliseconds(t *testing.T) {
+	expires := make(Expires)
+	expires["millis"] = 1700000000123
+	expires["seconds"] = 1700000000 // saved in seconds by the old versions
+
+	path := "/tmp/kdb/db.expires.millis"
+	if err := expires.SaveExpires(path, nil); err != nil {
+		t.Fatal(err)
+	}
+	newExpires, err := LoadExpires(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if newExpires["millis"] != 1700000000123 || newExpires["seconds"] != 1700000000000 {
+		t.Errorf("got %+v", newExpires)
+	}
+}